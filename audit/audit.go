@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+)
+
+// Type of audit event
+const (
+	LoginSuccess   = "login_success"
+	LoginFailure   = "login_failure"
+	TokenRefresh   = "token_refresh"
+	Registration   = "registration"
+	PasswordChange = "password_change"
+	Lockout        = "lockout"
+	AdminAction    = "admin_action"
+	SessionRevoked = "session_revoked"
+	ProfileUpdate  = "profile_update"
+	DataExport     = "data_export"
+	AccountErasure = "account_erasure"
+)
+
+// Outcome of audit event
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Event is a security relevant event emitted by domain services
+type Event struct {
+	Type    string
+	Outcome string
+	// Reason explain why the event happened, mostly the cause of failure
+	Reason string
+	// ActorID is id of the user doing the action, empty for anonymous
+	ActorID string
+	// SubjectID is id of the user the action is done to, or PseudonymousLogin of login matching no user
+	SubjectID string
+	Metadata  map[string]interface{}
+}
+
+// PseudonymousLogin give keyed hash of login matching no user, so attempts on the same login can be related
+// while the login, which may be email or phone number, is never saved in audit events kept after erasure.
+// It is empty when AUDIT_LOGIN_KEY is not set
+func PseudonymousLogin(login string) string {
+	key := environments.Get("AUDIT_LOGIN_KEY")
+	if len(key) == 0 || len(login) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(login))
+	return "login:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit save the event completed with client details of the request,
+// failing to save never break the request so the error is only printed
+func Emit(c *gin.Context, event Event) {
+	record := makeRecord(event)
+	record.ClientID = c.GetString("clientID")
+	record.ClientIP = c.ClientIP()
+	record.UserAgent = c.Request.UserAgent()
+	if err := save(&record); err != nil {
+		fmt.Println("Failed to save audit event " + event.Type + ": " + err.Error())
+	}
+}
+
+// Record save the event happened outside of http request
+func Record(event Event) error {
+	record := makeRecord(event)
+	return save(&record)
+}
+
+func makeRecord(event Event) db.AuditEvent {
+	if len(event.Outcome) == 0 {
+		event.Outcome = Success
+	}
+	record := db.AuditEvent{
+		Timestamp: time.Now(),
+		Type:      event.Type,
+		Outcome:   event.Outcome,
+		Reason:    event.Reason,
+		ActorID:   event.ActorID,
+		SubjectID: event.SubjectID,
+	}
+	if len(event.Metadata) > 0 {
+		metadata, err := json.Marshal(event.Metadata)
+		if err == nil {
+			record.Metadata = string(metadata)
+		}
+	}
+	return record
+}
+
+func save(record *db.AuditEvent) error {
+	return logs.CreateAuditEvent(record)
+}
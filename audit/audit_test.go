@@ -0,0 +1,108 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var logs *memory.LogRepository
+
+func setupTestCase(t *testing.T) func(t *testing.T) {
+	environments.Set("RELEASE_TYPE", "localhost")
+	_, filename, _, _ := runtime.Caller(0)
+	dir := path.Join(path.Dir(filename), "..")
+	err := os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+	environments.LoadEnvironmentVariableFile()
+	logs = memory.NewLogRepository()
+	audit.SetLogRepository(logs)
+	return func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func TestEmit(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	r := gin.Default()
+	r.POST("/t/login", func(c *gin.Context) {
+		c.Set("clientID", "testclient")
+		audit.Emit(c, audit.Event{
+			Type:      audit.LoginFailure,
+			Outcome:   audit.Failure,
+			Reason:    "invalid_password",
+			SubjectID: "testid",
+			Metadata:  map[string]interface{}{"loginWith": "id"},
+		})
+		c.JSON(http.StatusUnauthorized, gin.H{})
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/t/login", nil)
+	req.Header.Set("User-Agent", "audit-test")
+	r.ServeHTTP(w, req)
+
+	auditEvents := logs.AuditEvents()
+	assert.Len(t, auditEvents, 1, "event should be saved")
+	event := auditEvents[0]
+	assert.Equal(t, audit.LoginFailure, event.Type)
+	assert.Equal(t, "invalid_password", event.Reason)
+	assert.Equal(t, "testclient", event.ClientID)
+	assert.Equal(t, "audit-test", event.UserAgent)
+	var metadata map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(event.Metadata), &metadata), "metadata should be saved as json")
+	assert.Equal(t, "id", metadata["loginWith"])
+}
+
+func TestRecord(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	err := audit.Record(audit.Event{Type: audit.AdminAction, ActorID: "testadmin"})
+	assert.Nil(t, err, "Should return nil because there is no error")
+
+	auditEvents := logs.AuditEvents()
+	assert.Len(t, auditEvents, 1, "event should be saved")
+	event := auditEvents[0]
+	assert.Equal(t, "testadmin", event.ActorID)
+	assert.Equal(t, audit.Success, event.Outcome, "outcome should be success by default")
+	assert.False(t, event.Timestamp.IsZero(), "timestamp should be filled")
+}
+
+func TestPseudonymousLogin(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		login string
+		empty bool
+	}{
+		{name: "OK", key: "testkey", login: "email:test@test.com"},
+		{name: "EmptyWithoutKey", key: "", login: "email:test@test.com", empty: true},
+		{name: "EmptyWithoutLogin", key: "testkey", login: "", empty: true},
+	}
+	for _, tc := range tests {
+		environments.Set("AUDIT_LOGIN_KEY", tc.key)
+		got := audit.PseudonymousLogin(tc.login)
+		assert.Equal(t, tc.empty, len(got) == 0, "test "+tc.name+" case")
+		if tc.empty {
+			continue
+		}
+		assert.NotContains(t, got, "test@test.com", "login should not be recorded in test "+tc.name+" case")
+		assert.Equal(t, got, audit.PseudonymousLogin(tc.login), "same login should be related in test "+tc.name+" case")
+		assert.NotEqual(t, got, audit.PseudonymousLogin("email:other@test.com"), "test "+tc.name+" case")
+		environments.Set("AUDIT_LOGIN_KEY", "otherkey")
+		assert.NotEqual(t, got, audit.PseudonymousLogin(tc.login), "hash should depend on the key in test "+tc.name+" case")
+	}
+	environments.Set("AUDIT_LOGIN_KEY", "")
+}
@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// LogRepository is audit event storage used by audit emitter
+type LogRepository interface {
+	CreateAuditEvent(event *db.AuditEvent) error
+}
+
+var logs LogRepository = db.NewGormLogRepository(nil)
+
+// SetLogRepository replace audit event storage used by audit emitter
+func SetLogRepository(repository LogRepository) {
+	logs = repository
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/drd-engineering/TwinCape/domains/client"
+)
+
+// clientCommand is command to manage applications allowed to call the API
+func clientCommand(args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return errors.New("Usage: TwinCape client create -name name")
+	}
+	command := flag.NewFlagSet("client create", flag.ContinueOnError)
+	name := command.String("name", "", "name of the application, required")
+	if err := command.Parse(args[1:]); err != nil {
+		return err
+	}
+	created, secret, err := client.Create(*name)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Created client " + created.ID)
+	fmt.Println("Secret: " + secret)
+	fmt.Println("Send the id in Drd-Client-Id header and the secret in Drd-Identification header, the secret can not be shown again")
+	return nil
+}
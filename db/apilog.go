@@ -0,0 +1,306 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrNotInitialized returned when database is used before Init
+var ErrNotInitialized = errors.New("db: database is not initialized")
+
+// APILogQuery is filter to search api logs, zero value field is not filtered
+type APILogQuery struct {
+	From time.Time
+	To   time.Time
+	Path string
+	// PathPrefix search every path starting with Path
+	PathPrefix bool
+	Method     string
+	Status     int
+	ClientIP   string
+	// UserAgent search every client tools containing it
+	UserAgent string
+	UserID    string
+	// BeforeID search logs having id lower than it, used for pagination
+	BeforeID int
+	Limit    int
+}
+
+// StatusCount is number of api logs having the same response status
+type StatusCount struct {
+	ResponseStatus int
+	Total          int
+}
+
+// PathCount is number of api logs having the same path
+type PathCount struct {
+	Path  string
+	Total int
+}
+
+// GormLogRepository is api log and audit event storage in relational database through gorm
+type GormLogRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormLogRepository create log repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormLogRepository(conn *gorm.DB) *GormLogRepository {
+	return &GormLogRepository{conn: conn}
+}
+
+// apiLogColumns is number of columns inserted for every api log by CreateAPILogs
+const apiLogColumns = 13
+
+// MaxAPILogBatchSize is the most api logs given to a single CreateAPILogs, postgres take at most 65535
+// parameters in a statement
+const MaxAPILogBatchSize = 65535 / apiLogColumns
+
+// CreateAPILogs insert many api logs using single statement as the last links of api log chain
+func (r *GormLogRepository) CreateAPILogs(apiLogs []APILog) error {
+	if len(apiLogs) == 0 {
+		return nil
+	}
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return appendChained(dbInstance, APILogTable, func(tx *gorm.DB, lastHash string) error {
+		placeholders := make([]string, 0, len(apiLogs))
+		values := make([]interface{}, 0, len(apiLogs)*apiLogColumns)
+		for i := range apiLogs {
+			apiLog := &apiLogs[i]
+			// db keep microsecond only, hash must be computed from what is saved
+			apiLog.Timestamp = chainTime(apiLog.Timestamp)
+			if err := apiLog.HashPersonalData(); err != nil {
+				return err
+			}
+			apiLog.PrevHash = lastHash
+			apiLog.Hash = ChainHash(lastHash, apiLog.ContentHash())
+			lastHash = apiLog.Hash
+
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			values = append(values,
+				apiLog.Timestamp,
+				apiLog.TTL,
+				apiLog.ResponseStatus,
+				apiLog.Path,
+				apiLog.Method,
+				apiLog.ClientIP,
+				apiLog.ClientTools,
+				apiLog.Protocol,
+				apiLog.UserID,
+				apiLog.PersonalSalt,
+				apiLog.PersonalHash,
+				apiLog.PrevHash,
+				apiLog.Hash,
+			)
+		}
+		// rows get increasing id following the order of values, keeping the chain order
+		query := "INSERT INTO api_logs (timestamp, ttl, response_status, path, method, client_ip, client_tools, protocol, " +
+			"user_id, personal_salt, personal_hash, prev_hash, hash) VALUES " +
+			strings.Join(placeholders, ", ")
+		return tx.Exec(query, values...).Error
+	})
+}
+
+// CreateAuditEvent insert audit event as the last link of audit event chain
+func (r *GormLogRepository) CreateAuditEvent(event *AuditEvent) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return appendChained(dbInstance, AuditEventTable, func(tx *gorm.DB, lastHash string) error {
+		// db keep microsecond only, hash must be computed from what is saved
+		event.Timestamp = chainTime(event.Timestamp)
+		event.PrevHash = lastHash
+		event.Hash = ChainHash(lastHash, event.ContentHash())
+		return tx.Create(event).Error
+	})
+}
+
+// SearchAPILogs get api logs matching the query ordered from the newest
+func (r *GormLogRepository) SearchAPILogs(query APILogQuery) ([]APILog, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	apiLogs := []APILog{}
+	search := filterAPILogs(dbInstance.Model(&APILog{}), query)
+	if query.BeforeID > 0 {
+		search = search.Where("id < ?", query.BeforeID)
+	}
+	if query.Limit > 0 {
+		search = search.Limit(query.Limit)
+	}
+	err = search.Order("id desc").Find(&apiLogs).Error
+	return apiLogs, err
+}
+
+// CountAPILogsByStatus count api logs matching the query for each response status
+func (r *GormLogRepository) CountAPILogsByStatus(query APILogQuery) ([]StatusCount, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	statusCounts := []StatusCount{}
+	err = filterAPILogs(dbInstance.Model(&APILog{}), query).
+		Select("response_status, count(*) as total").Group("response_status").
+		Order("response_status").Scan(&statusCounts).Error
+	return statusCounts, err
+}
+
+// CountAPILogsByPath count api logs matching the query for each path, the most used path first
+func (r *GormLogRepository) CountAPILogsByPath(query APILogQuery, limit int) ([]PathCount, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	pathCounts := []PathCount{}
+	err = filterAPILogs(dbInstance.Model(&APILog{}), query).
+		Select("path, count(*) as total").Group("path").
+		Order("total desc, path").Limit(limit).Scan(&pathCounts).Error
+	return pathCounts, err
+}
+
+// EachAPILog give every api log with timestamp in range [from, to) ordered by id to visit,
+// zero from or to means the range is not limited on that side
+func (r *GormLogRepository) EachAPILog(from time.Time, to time.Time, visit func(APILog) error) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	rows, err := filterAPILogs(dbInstance.Model(&APILog{}), APILogQuery{From: from, To: to}).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var apiLog APILog
+		if err := dbInstance.ScanRows(rows, &apiLog); err != nil {
+			return err
+		}
+		if err := visit(apiLog); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// redactBatchSize is number of api logs redacted by one statement, ids are bound as parameters
+const redactBatchSize = 500
+
+// RedactAPILogs erase personal data of every api log of the user and give their ids, the logs stay in the chain
+// verifiable through their personal hash. Logs saved while redacting are left to redact again
+func (r *GormLogRepository) RedactAPILogs(userID string) ([]int, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	err = dbInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&APILog{}).Where("user_id = ? AND personal_hash <> ''", userID).Order("id").
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		for start := 0; start < len(ids); start += redactBatchSize {
+			end := start + redactBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			err := tx.Model(&APILog{}).Where("id IN (?)", ids[start:end]).UpdateColumns(map[string]interface{}{
+				"user_id": "", "client_ip": "", "client_tools": "", "personal_salt": "", "redacted": true}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// FindAuditEventsOfUser get audit events done by or to the user, the oldest first
+func (r *GormLogRepository) FindAuditEventsOfUser(userID string) ([]AuditEvent, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	events := []AuditEvent{}
+	err = dbInstance.Where("actor_id = ? OR subject_id = ?", userID, userID).Order("id").Find(&events).Error
+	return events, err
+}
+
+// FindPurgeLimit give id of the last api log which can be purged, zero when there is none. Logs are purged up to
+// a checkpoint so the chain left starts from a signed hash, only when every log up to it is older than the time
+// given. The last log is always kept so checkpoints are never left without the log they sign
+func (r *GormLogRepository) FindPurgeLimit(before time.Time) (int, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return 0, err
+	}
+	var limit sql.NullInt64
+	err = dbInstance.Raw("SELECT MAX(last_id) FROM log_checkpoints WHERE log_table = ? AND last_id < "+
+		"COALESCE((SELECT MIN(id) FROM api_logs WHERE timestamp >= ?), (SELECT MAX(id) FROM api_logs))",
+		APILogTable, before.UTC()).Row().Scan(&limit)
+	return int(limit.Int64), err
+}
+
+// DeleteAPILogs delete at most limit oldest api logs having id up to maxID
+func (r *GormLogRepository) DeleteAPILogs(maxID int, limit int) (int, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return 0, err
+	}
+	deleted := dbInstance.Exec("DELETE FROM api_logs WHERE id IN (SELECT id FROM api_logs WHERE id <= ? ORDER BY id LIMIT ?)",
+		maxID, limit)
+	return int(deleted.RowsAffected), deleted.Error
+}
+
+func filterAPILogs(search *gorm.DB, query APILogQuery) *gorm.DB {
+	if !query.From.IsZero() {
+		search = search.Where("timestamp >= ?", query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		search = search.Where("timestamp < ?", query.To.UTC())
+	}
+	if len(query.Path) > 0 {
+		if query.PathPrefix {
+			search = search.Where("path LIKE ? ESCAPE '\\'", escapeLike(query.Path)+"%")
+		} else {
+			search = search.Where("path = ?", query.Path)
+		}
+	}
+	if len(query.Method) > 0 {
+		search = search.Where("method = ?", query.Method)
+	}
+	if query.Status > 0 {
+		search = search.Where("response_status = ?", query.Status)
+	}
+	if len(query.ClientIP) > 0 {
+		search = search.Where("client_ip = ?", query.ClientIP)
+	}
+	if len(query.UserAgent) > 0 {
+		search = search.Where("client_tools LIKE ? ESCAPE '\\'", "%"+escapeLike(query.UserAgent)+"%")
+	}
+	if len(query.UserID) > 0 {
+		search = search.Where("user_id = ?", query.UserID)
+	}
+	return search
+}
+
+// chainTime convert time to what is saved in db, sqlite save time as text
+// so every time must be in UTC to be compared correctly
+func chainTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
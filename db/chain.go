@@ -0,0 +1,137 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Table name of logs protected by hash chain
+const (
+	APILogTable     = "api_logs"
+	AuditEventTable = "audit_events"
+)
+
+// chainLockIDs are postgres advisory lock keys serializing append to each chain,
+// so several instances writing the same table never fork the chain,
+// sqlite transaction is already serialized by taking the write lock on begin
+var chainLockIDs = map[string]int64{
+	APILogTable:     730100,
+	AuditEventTable: 730200,
+}
+
+// ChainHash compute hash of a log from its content hash and hash of the log before it
+func ChainHash(prevHash string, contentHash string) string {
+	sum := sha256.Sum256([]byte(prevHash + contentHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentHash compute hash of api log content, id and chain columns excluded. Personal data is covered
+// through PersonalHash so it can be erased, logs saved before PersonalHash existed cover it directly
+func (l APILog) ContentHash() string {
+	if len(l.PersonalHash) > 0 {
+		return hashFields(
+			formatChainTime(l.Timestamp),
+			l.TTL,
+			strconv.Itoa(l.ResponseStatus),
+			l.Path,
+			l.Method,
+			l.Protocol,
+			l.PersonalHash,
+		)
+	}
+	return hashFields(
+		formatChainTime(l.Timestamp),
+		l.TTL,
+		strconv.Itoa(l.ResponseStatus),
+		l.Path,
+		l.Method,
+		l.ClientIP,
+		l.ClientTools,
+		l.Protocol,
+	)
+}
+
+// HashPersonalData set a random salt and the hash of personal data of api log before it is chained,
+// the salt is erased with the personal data so it can not be guessed back from the hash
+func (l *APILog) HashPersonalData() error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	l.PersonalSalt = hex.EncodeToString(salt)
+	l.PersonalHash = l.personalDataHash()
+	return nil
+}
+
+func (l APILog) personalDataHash() string {
+	return hashFields(l.PersonalSalt, l.UserID, l.ClientIP, l.ClientTools)
+}
+
+// PersonalDataIntact tell personal data of api log match its hash, or is erased when the log is redacted
+func (l APILog) PersonalDataIntact() bool {
+	if l.Redacted {
+		return len(l.PersonalSalt) == 0 && len(l.UserID) == 0 && len(l.ClientIP) == 0 && len(l.ClientTools) == 0
+	}
+	return len(l.PersonalHash) == 0 || l.PersonalHash == l.personalDataHash()
+}
+
+// ContentHash compute hash of audit event content, id and chain columns excluded
+func (e AuditEvent) ContentHash() string {
+	return hashFields(
+		formatChainTime(e.Timestamp),
+		e.Type,
+		e.Outcome,
+		e.Reason,
+		e.ActorID,
+		e.SubjectID,
+		e.ClientID,
+		e.ClientIP,
+		e.UserAgent,
+		e.Metadata,
+	)
+}
+
+func hashFields(fields ...string) string {
+	hash := sha256.New()
+	for _, field := range fields {
+		// length prefix so moving characters from a field to another change the hash
+		fmt.Fprintf(hash, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// formatChainTime format time the same way before saving and after reading it back from db
+func formatChainTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
+
+// appendChained run insert inside transaction holding the chain lock with hash of the last log in the table
+func appendChained(conn *gorm.DB, table string, insert func(tx *gorm.DB, lastHash string) error) error {
+	tx := conn.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.Dialect().GetName() == "postgres" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockIDs[table]).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	var last struct{ Hash string }
+	err := tx.Table(table).Select("hash").Order("id desc").Limit(1).Scan(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return err
+	}
+	if err := insert(tx, last.Hash); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,42 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+func TestContentHash(t *testing.T) {
+	now := time.Now()
+	apiLog := db.APILog{Timestamp: now, Path: "/api/v1/sso/auth/login", Method: "POST", ResponseStatus: 200}
+
+	sameInOtherZone := apiLog
+	sameInOtherZone.Timestamp = now.In(time.FixedZone("WIB", 7*60*60))
+	assert.Equal(t, apiLog.ContentHash(), sameInOtherZone.ContentHash(), "time zone should not change the hash")
+
+	readBack := apiLog
+	readBack.Timestamp = now.Truncate(time.Microsecond)
+	assert.Equal(t, apiLog.ContentHash(), readBack.ContentHash(), "precision lost in db should not change the hash")
+
+	tampered := apiLog
+	tampered.ResponseStatus = 500
+	assert.NotEqual(t, apiLog.ContentHash(), tampered.ContentHash(), "changing content should change the hash")
+
+	movedCharacter := db.APILog{Timestamp: now, Path: "/api/v1/sso/auth/login", Method: "POS", ClientIP: "T"}
+	notMoved := db.APILog{Timestamp: now, Path: "/api/v1/sso/auth/login", Method: "POST"}
+	assert.NotEqual(t, notMoved.ContentHash(), movedCharacter.ContentHash(), "moving character between fields should change the hash")
+
+	auditEvent := db.AuditEvent{Timestamp: now, Type: "login_success", ActorID: "testid"}
+	changedActor := auditEvent
+	changedActor.ActorID = "otherid"
+	assert.NotEqual(t, auditEvent.ContentHash(), changedActor.ContentHash(), "changing actor should change the hash")
+}
+
+func TestChainHash(t *testing.T) {
+	content := db.APILog{Path: "/"}.ContentHash()
+	assert.Len(t, db.ChainHash("", content), 64, "hash should be hex of sha256")
+	assert.NotEqual(t, db.ChainHash("", content), db.ChainHash("abc", content), "previous hash should change the hash")
+}
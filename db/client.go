@@ -0,0 +1,59 @@
+package db
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrClientNotFound returned when there is no client having the id
+var ErrClientNotFound = errors.New("db: client not found")
+
+// HashClientSecret compute hash of client secret kept in db, secret is random
+// and long enough that a fast hash is enough
+func HashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret tell the secret given is the secret of the client
+func (c Client) VerifySecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(c.SecretHash), []byte(HashClientSecret(secret))) == 1
+}
+
+// GormClientRepository is client storage in relational database through gorm
+type GormClientRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormClientRepository create client repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormClientRepository(conn *gorm.DB) *GormClientRepository {
+	return &GormClientRepository{conn: conn}
+}
+
+// FindClientByID get client having the id
+func (r *GormClientRepository) FindClientByID(id string) (Client, error) {
+	var client Client
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return client, err
+	}
+	err = dbInstance.Where("id = ?", id).First(&client).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Client{}, ErrClientNotFound
+	}
+	return client, err
+}
+
+// CreateClient insert new client
+func (r *GormClientRepository) CreateClient(client *Client) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Create(client).Error
+}
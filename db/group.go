@@ -0,0 +1,176 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrGroupNotFound returned when there is no group having the id
+var ErrGroupNotFound = errors.New("db: group not found")
+
+// GormGroupRepository is group storage in relational database through gorm
+type GormGroupRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormGroupRepository create group repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormGroupRepository(conn *gorm.DB) *GormGroupRepository {
+	return &GormGroupRepository{conn: conn}
+}
+
+// GroupQuery is filter to search groups, zero value field is not filtered
+type GroupQuery struct {
+	DisplayName string
+	ExternalID  string
+	Offset      int
+	// Limit of groups returned, zero means only counting the groups
+	Limit int
+}
+
+// CreateGroup insert new group
+func (r *GormGroupRepository) CreateGroup(group *Group) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Create(group).Error
+}
+
+// FindGroupByID get group having the id
+func (r *GormGroupRepository) FindGroupByID(id string) (Group, error) {
+	var group Group
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return group, err
+	}
+	err = dbInstance.Where("id = ?", id).First(&group).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Group{}, ErrGroupNotFound
+	}
+	return group, err
+}
+
+// FindGroups get groups matching the query, the oldest first, with the number of groups matching it
+func (r *GormGroupRepository) FindGroups(query GroupQuery) ([]Group, int, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, 0, err
+	}
+	search := dbInstance.Model(&Group{})
+	if len(query.DisplayName) > 0 {
+		search = search.Where("display_name = ?", query.DisplayName)
+	}
+	if len(query.ExternalID) > 0 {
+		search = search.Where("external_id = ?", query.ExternalID)
+	}
+	var total int
+	if err := search.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	groups := []Group{}
+	if query.Limit > 0 {
+		err = search.Order("created_at, id").Offset(query.Offset).Limit(query.Limit).Find(&groups).Error
+	}
+	return groups, total, err
+}
+
+// UpdateGroup replace display name and external id of the group
+func (r *GormGroupRepository) UpdateGroup(group *Group) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	updated := dbInstance.Model(&Group{}).Where("id = ?", group.ID).
+		Updates(map[string]interface{}{"display_name": group.DisplayName, "external_id": group.ExternalID})
+	if updated.Error == nil && updated.RowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+	return updated.Error
+}
+
+// DeleteGroup delete the group having the id with its members
+func (r *GormGroupRepository) DeleteGroup(id string) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&GroupMember{}).Error; err != nil {
+			return err
+		}
+		deleted := tx.Where("id = ?", id).Delete(&Group{})
+		if deleted.Error == nil && deleted.RowsAffected == 0 {
+			return ErrGroupNotFound
+		}
+		return deleted.Error
+	})
+}
+
+// FindGroupMembers get id of users being member of the group
+func (r *GormGroupRepository) FindGroupMembers(groupID string) ([]string, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []string{}
+	err = dbInstance.Model(&GroupMember{}).Where("group_id = ?", groupID).Order("user_id").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// AddGroupMembers add the users to the group, user already being member is skipped
+func (r *GormGroupRepository) AddGroupMembers(groupID string, userIDs []string) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Transaction(func(tx *gorm.DB) error {
+		for _, userID := range userIDs {
+			var count int
+			if err := tx.Model(&GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(&GroupMember{GroupID: groupID, UserID: userID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveGroupMembers remove the users from the group
+func (r *GormGroupRepository) RemoveGroupMembers(groupID string, userIDs []string) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return dbInstance.Where("group_id = ? AND user_id IN (?)", groupID, userIDs).Delete(&GroupMember{}).Error
+}
+
+// FindGroupsOfUser get every group the user is member of ordered by display name
+func (r *GormGroupRepository) FindGroupsOfUser(userID string) ([]Group, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	groups := []Group{}
+	err = dbInstance.Joins("JOIN group_members ON group_members.group_id = user_groups.id").
+		Where("group_members.user_id = ?", userID).Order("display_name").Find(&groups).Error
+	return groups, err
+}
+
+// RemoveUserFromGroups remove the user from every group it is member of
+func (r *GormGroupRepository) RemoveUserFromGroups(userID string) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Where("user_id = ?", userID).Delete(&GroupMember{}).Error
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrIdentityLinkNotFound returned when there is no user linked to the account of the provider
+var ErrIdentityLinkNotFound = errors.New("db: identity link not found")
+
+// GormIdentityLinkRepository is identity link storage in relational database through gorm
+type GormIdentityLinkRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormIdentityLinkRepository create identity link repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormIdentityLinkRepository(conn *gorm.DB) *GormIdentityLinkRepository {
+	return &GormIdentityLinkRepository{conn: conn}
+}
+
+// FindIdentityLink get link of the account having the subject in the provider
+func (r *GormIdentityLinkRepository) FindIdentityLink(provider string, subject string) (IdentityLink, error) {
+	var link IdentityLink
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return link, err
+	}
+	err = dbInstance.Where("provider = ? AND subject = ?", provider, subject).First(&link).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return IdentityLink{}, ErrIdentityLinkNotFound
+	}
+	return link, err
+}
+
+// CreateIdentityLink insert new link, an account of the provider can be linked to one user only
+func (r *GormIdentityLinkRepository) CreateIdentityLink(link *IdentityLink) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Create(link).Error
+}
+
+// FindIdentityLinksOfUser get every provider account linked to the user, the oldest first
+func (r *GormIdentityLinkRepository) FindIdentityLinksOfUser(userID string) ([]IdentityLink, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	links := []IdentityLink{}
+	err = dbInstance.Where("user_id = ?", userID).Order("id").Find(&links).Error
+	return links, err
+}
+
+// DeleteIdentityLinksOfUser delete every provider account linked to the user, return the number of links deleted
+func (r *GormIdentityLinkRepository) DeleteIdentityLinksOfUser(userID string) (int64, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return 0, err
+	}
+	result := dbInstance.Where("user_id = ?", userID).Delete(&IdentityLink{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ErrDuplicateClient returned when the client break uniqueness of id, same as the db constraint
+var ErrDuplicateClient = errors.New("memory: client with same id already exists")
+
+// ClientRepository is client storage kept in memory, used for development and tests
+type ClientRepository struct {
+	lock    sync.RWMutex
+	clients map[string]db.Client
+}
+
+// NewClientRepository create empty client repository
+func NewClientRepository() *ClientRepository {
+	return &ClientRepository{clients: map[string]db.Client{}}
+}
+
+// FindClientByID get client having the id
+func (r *ClientRepository) FindClientByID(id string) (db.Client, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	client, ok := r.clients[id]
+	if !ok {
+		return db.Client{}, db.ErrClientNotFound
+	}
+	return client, nil
+}
+
+// CreateClient insert new client
+func (r *ClientRepository) CreateClient(client *db.Client) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.clients[client.ID]; ok {
+		return ErrDuplicateClient
+	}
+	now := time.Now()
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = now
+	}
+	client.UpdatedAt = now
+	r.clients[client.ID] = *client
+	return nil
+}
@@ -0,0 +1,24 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRepository(t *testing.T) {
+	clients := memory.NewClientRepository()
+	testClient := db.Client{ID: "testclient", Name: "test", SecretHash: db.HashClientSecret("testsecret")}
+	assert.Nil(t, clients.CreateClient(&testClient))
+	assert.False(t, testClient.CreatedAt.IsZero(), "created time should be filled")
+
+	found, err := clients.FindClientByID("testclient")
+	assert.Nil(t, err)
+	assert.Equal(t, "test", found.Name)
+	_, err = clients.FindClientByID("unknown")
+	assert.Equal(t, db.ErrClientNotFound, err, "unknown client should not be found")
+	assert.Equal(t, memory.ErrDuplicateClient, clients.CreateClient(&db.Client{ID: "testclient"}),
+		"same id should be rejected")
+}
@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ErrDuplicateGroup returned when the group break uniqueness of id or display name, same as the db constraint
+var ErrDuplicateGroup = errors.New("memory: group with same id or display name already exists")
+
+// GroupRepository is group storage kept in memory, used for development and tests
+type GroupRepository struct {
+	lock    sync.RWMutex
+	groups  map[string]db.Group
+	members map[string]map[string]bool
+}
+
+// NewGroupRepository create empty group repository
+func NewGroupRepository() *GroupRepository {
+	return &GroupRepository{groups: map[string]db.Group{}, members: map[string]map[string]bool{}}
+}
+
+// CreateGroup insert new group
+func (r *GroupRepository) CreateGroup(group *db.Group) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, existing := range r.groups {
+		if existing.ID == group.ID || existing.DisplayName == group.DisplayName {
+			return ErrDuplicateGroup
+		}
+	}
+	now := time.Now()
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = now
+	}
+	group.UpdatedAt = now
+	r.groups[group.ID] = *group
+	r.members[group.ID] = map[string]bool{}
+	return nil
+}
+
+// FindGroupByID get group having the id
+func (r *GroupRepository) FindGroupByID(id string) (db.Group, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	group, ok := r.groups[id]
+	if !ok {
+		return db.Group{}, db.ErrGroupNotFound
+	}
+	return group, nil
+}
+
+// FindGroups get groups matching the query, the oldest first, with the number of groups matching it
+func (r *GroupRepository) FindGroups(query db.GroupQuery) ([]db.Group, int, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	matched := []db.Group{}
+	for _, group := range r.groups {
+		if (len(query.DisplayName) > 0 && group.DisplayName != query.DisplayName) ||
+			(len(query.ExternalID) > 0 && group.ExternalID != query.ExternalID) {
+			continue
+		}
+		matched = append(matched, group)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+	groups := []db.Group{}
+	for i := query.Offset; i < len(matched) && len(groups) < query.Limit; i++ {
+		groups = append(groups, matched[i])
+	}
+	return groups, len(matched), nil
+}
+
+// UpdateGroup replace display name and external id of the group
+func (r *GroupRepository) UpdateGroup(group *db.Group) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	existing, ok := r.groups[group.ID]
+	if !ok {
+		return db.ErrGroupNotFound
+	}
+	for _, other := range r.groups {
+		if other.ID != group.ID && other.DisplayName == group.DisplayName {
+			return ErrDuplicateGroup
+		}
+	}
+	existing.DisplayName = group.DisplayName
+	existing.ExternalID = group.ExternalID
+	existing.UpdatedAt = time.Now()
+	r.groups[group.ID] = existing
+	return nil
+}
+
+// DeleteGroup delete the group having the id with its members
+func (r *GroupRepository) DeleteGroup(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.groups[id]; !ok {
+		return db.ErrGroupNotFound
+	}
+	delete(r.groups, id)
+	delete(r.members, id)
+	return nil
+}
+
+// FindGroupMembers get id of users being member of the group
+func (r *GroupRepository) FindGroupMembers(groupID string) ([]string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	userIDs := []string{}
+	for userID := range r.members[groupID] {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+// AddGroupMembers add the users to the group, user already being member is skipped
+func (r *GroupRepository) AddGroupMembers(groupID string, userIDs []string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.members[groupID]; !ok {
+		r.members[groupID] = map[string]bool{}
+	}
+	for _, userID := range userIDs {
+		r.members[groupID][userID] = true
+	}
+	return nil
+}
+
+// RemoveGroupMembers remove the users from the group
+func (r *GroupRepository) RemoveGroupMembers(groupID string, userIDs []string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, userID := range userIDs {
+		delete(r.members[groupID], userID)
+	}
+	return nil
+}
+
+// FindGroupsOfUser get every group the user is member of ordered by display name
+func (r *GroupRepository) FindGroupsOfUser(userID string) ([]db.Group, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	groups := []db.Group{}
+	for groupID, members := range r.members {
+		if group, ok := r.groups[groupID]; ok && members[userID] {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].DisplayName < groups[j].DisplayName })
+	return groups, nil
+}
+
+// RemoveUserFromGroups remove the user from every group it is member of
+func (r *GroupRepository) RemoveUserFromGroups(userID string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, members := range r.members {
+		delete(members, userID)
+	}
+	return nil
+}
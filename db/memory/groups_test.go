@@ -0,0 +1,31 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRepository(t *testing.T) {
+	groups := memory.NewGroupRepository()
+	assert.Nil(t, groups.CreateGroup(&db.Group{ID: "staff", DisplayName: "staff"}))
+	assert.Equal(t, memory.ErrDuplicateGroup, groups.CreateGroup(&db.Group{ID: "other", DisplayName: "staff"}),
+		"same display name should be rejected")
+
+	assert.Nil(t, groups.AddGroupMembers("staff", []string{"testid", "otherid"}))
+	members, err := groups.FindGroupMembers("staff")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"otherid", "testid"}, members)
+	assert.Nil(t, groups.RemoveUserFromGroups("testid"))
+	members, _ = groups.FindGroupMembers("staff")
+	assert.Equal(t, []string{"otherid"}, members, "removed user should leave the group")
+
+	found, total, err := groups.FindGroups(db.GroupQuery{DisplayName: "staff", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	assert.Len(t, found, 1)
+	assert.Nil(t, groups.DeleteGroup("staff"))
+	assert.Equal(t, db.ErrGroupNotFound, groups.DeleteGroup("staff"), "deleted group should not be deleted again")
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ErrDuplicateIdentityLink returned when the link break uniqueness of provider and subject, same as the db constraint
+var ErrDuplicateIdentityLink = errors.New("memory: identity link with same provider and subject already exists")
+
+// IdentityLinkRepository is identity link storage kept in memory, used for development and tests
+type IdentityLinkRepository struct {
+	lock  sync.RWMutex
+	links []db.IdentityLink
+}
+
+// NewIdentityLinkRepository create empty identity link repository
+func NewIdentityLinkRepository() *IdentityLinkRepository {
+	return &IdentityLinkRepository{}
+}
+
+// FindIdentityLink get link of the account having the subject in the provider
+func (r *IdentityLinkRepository) FindIdentityLink(provider string, subject string) (db.IdentityLink, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, link := range r.links {
+		if link.Provider == provider && link.Subject == subject {
+			return link, nil
+		}
+	}
+	return db.IdentityLink{}, db.ErrIdentityLinkNotFound
+}
+
+// CreateIdentityLink insert new link, an account of the provider can be linked to one user only
+func (r *IdentityLinkRepository) CreateIdentityLink(link *db.IdentityLink) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, existing := range r.links {
+		if existing.Provider == link.Provider && existing.Subject == link.Subject {
+			return ErrDuplicateIdentityLink
+		}
+	}
+	link.ID = len(r.links) + 1
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+	r.links = append(r.links, *link)
+	return nil
+}
+
+// FindIdentityLinksOfUser get every provider account linked to the user, the oldest first
+func (r *IdentityLinkRepository) FindIdentityLinksOfUser(userID string) ([]db.IdentityLink, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	links := []db.IdentityLink{}
+	for _, link := range r.links {
+		if link.UserID == userID {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// DeleteIdentityLinksOfUser delete every provider account linked to the user, return the number of links deleted
+func (r *IdentityLinkRepository) DeleteIdentityLinksOfUser(userID string) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	kept := []db.IdentityLink{}
+	for _, link := range r.links {
+		if link.UserID != userID {
+			kept = append(kept, link)
+		}
+	}
+	deleted := int64(len(r.links) - len(kept))
+	r.links = kept
+	return deleted, nil
+}
@@ -0,0 +1,22 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityLinkRepository(t *testing.T) {
+	links := memory.NewIdentityLinkRepository()
+	assert.Nil(t, links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "testid"}))
+
+	found, err := links.FindIdentityLink("google", "123")
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", found.UserID)
+	_, err = links.FindIdentityLink("microsoft", "123")
+	assert.Equal(t, db.ErrIdentityLinkNotFound, err, "same subject of other provider should not be found")
+	assert.Equal(t, memory.ErrDuplicateIdentityLink, links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "otherid"}),
+		"account of the provider should be linked to one user only")
+}
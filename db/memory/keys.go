@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// KeyRepository is signing key storage kept in memory, used for development and tests
+type KeyRepository struct {
+	lock sync.RWMutex
+	keys []db.SigningKey
+}
+
+// NewKeyRepository create empty signing key repository
+func NewKeyRepository() *KeyRepository {
+	return &KeyRepository{}
+}
+
+// FindSigningKeys get every key of the purpose including retired and expired ones, the newest first
+func (r *KeyRepository) FindSigningKeys(purpose string) ([]db.SigningKey, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	keys := []db.SigningKey{}
+	for _, key := range r.keys {
+		if key.Purpose == purpose {
+			keys = append(keys, key)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// RotateSigningKey retire the active keys of the key purpose, keeping them valid until expiresAt,
+// and insert the key as the new active one
+func (r *KeyRepository) RotateSigningKey(key *db.SigningKey, expiresAt time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range r.keys {
+		if r.keys[i].Purpose == key.Purpose && r.keys[i].RetiredAt == nil {
+			retiredAt := key.CreatedAt
+			r.keys[i].RetiredAt = &retiredAt
+			r.keys[i].ExpiresAt = &expiresAt
+		}
+	}
+	r.keys = append(r.keys, *key)
+	return nil
+}
@@ -0,0 +1,266 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// LogRepository is api log and audit event storage kept in memory, used for development and tests
+type LogRepository struct {
+	lock        sync.RWMutex
+	apiLogs     []db.APILog
+	auditEvents []db.AuditEvent
+	checkpoints []db.LogCheckpoint
+}
+
+// NewLogRepository create empty log repository
+func NewLogRepository() *LogRepository {
+	return &LogRepository{}
+}
+
+// CreateAPILogs append api logs as the last links of api log chain
+func (r *LogRepository) CreateAPILogs(apiLogs []db.APILog) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range apiLogs {
+		apiLog := &apiLogs[i]
+		apiLog.ID = 1
+		apiLog.PrevHash = ""
+		if last := len(r.apiLogs); last > 0 {
+			apiLog.ID = r.apiLogs[last-1].ID + 1
+			apiLog.PrevHash = r.apiLogs[last-1].Hash
+		}
+		apiLog.Timestamp = apiLog.Timestamp.Truncate(time.Microsecond)
+		if err := apiLog.HashPersonalData(); err != nil {
+			return err
+		}
+		apiLog.Hash = db.ChainHash(apiLog.PrevHash, apiLog.ContentHash())
+		r.apiLogs = append(r.apiLogs, *apiLog)
+	}
+	return nil
+}
+
+// CreateAuditEvent append audit event as the last link of audit event chain
+func (r *LogRepository) CreateAuditEvent(event *db.AuditEvent) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	event.ID = 1
+	event.PrevHash = ""
+	if last := len(r.auditEvents); last > 0 {
+		event.ID = r.auditEvents[last-1].ID + 1
+		event.PrevHash = r.auditEvents[last-1].Hash
+	}
+	event.Timestamp = event.Timestamp.Truncate(time.Microsecond)
+	event.Hash = db.ChainHash(event.PrevHash, event.ContentHash())
+	r.auditEvents = append(r.auditEvents, *event)
+	return nil
+}
+
+// AuditEvents get copy of every audit event saved, the oldest first
+func (r *LogRepository) AuditEvents() []db.AuditEvent {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]db.AuditEvent{}, r.auditEvents...)
+}
+
+// RedactAPILogs erase personal data of every api log of the user and give their ids, the logs stay in the chain
+func (r *LogRepository) RedactAPILogs(userID string) ([]int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	redacted := []int{}
+	for i, apiLog := range r.apiLogs {
+		if apiLog.UserID == userID && len(apiLog.PersonalHash) > 0 {
+			apiLog.UserID, apiLog.ClientIP, apiLog.ClientTools, apiLog.PersonalSalt = "", "", "", ""
+			apiLog.Redacted = true
+			r.apiLogs[i] = apiLog
+			redacted = append(redacted, apiLog.ID)
+		}
+	}
+	return redacted, nil
+}
+
+// FindAuditEventsOfUser get audit events done by or to the user, the oldest first
+func (r *LogRepository) FindAuditEventsOfUser(userID string) ([]db.AuditEvent, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	events := []db.AuditEvent{}
+	for _, event := range r.auditEvents {
+		if event.ActorID == userID || event.SubjectID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// SearchAPILogs get api logs matching the query ordered from the newest
+func (r *LogRepository) SearchAPILogs(query db.APILogQuery) ([]db.APILog, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	apiLogs := []db.APILog{}
+	for i := len(r.apiLogs) - 1; i >= 0; i-- {
+		apiLog := r.apiLogs[i]
+		if query.BeforeID > 0 && apiLog.ID >= query.BeforeID {
+			continue
+		}
+		if !matchAPILog(apiLog, query) {
+			continue
+		}
+		apiLogs = append(apiLogs, apiLog)
+		if query.Limit > 0 && len(apiLogs) == query.Limit {
+			break
+		}
+	}
+	return apiLogs, nil
+}
+
+// CountAPILogsByStatus count api logs matching the query for each response status
+func (r *LogRepository) CountAPILogsByStatus(query db.APILogQuery) ([]db.StatusCount, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	totals := map[int]int{}
+	for _, apiLog := range r.apiLogs {
+		if matchAPILog(apiLog, query) {
+			totals[apiLog.ResponseStatus]++
+		}
+	}
+	statusCounts := []db.StatusCount{}
+	for status, total := range totals {
+		statusCounts = append(statusCounts, db.StatusCount{ResponseStatus: status, Total: total})
+	}
+	sort.Slice(statusCounts, func(i, j int) bool {
+		return statusCounts[i].ResponseStatus < statusCounts[j].ResponseStatus
+	})
+	return statusCounts, nil
+}
+
+// CountAPILogsByPath count api logs matching the query for each path, the most used path first
+func (r *LogRepository) CountAPILogsByPath(query db.APILogQuery, limit int) ([]db.PathCount, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	totals := map[string]int{}
+	for _, apiLog := range r.apiLogs {
+		if matchAPILog(apiLog, query) {
+			totals[apiLog.Path]++
+		}
+	}
+	pathCounts := []db.PathCount{}
+	for path, total := range totals {
+		pathCounts = append(pathCounts, db.PathCount{Path: path, Total: total})
+	}
+	sort.Slice(pathCounts, func(i, j int) bool {
+		if pathCounts[i].Total != pathCounts[j].Total {
+			return pathCounts[i].Total > pathCounts[j].Total
+		}
+		return pathCounts[i].Path < pathCounts[j].Path
+	})
+	if limit > 0 && len(pathCounts) > limit {
+		pathCounts = pathCounts[:limit]
+	}
+	return pathCounts, nil
+}
+
+// EachAPILog give every api log with timestamp in range [from, to) ordered by id to visit,
+// zero from or to means the range is not limited on that side
+func (r *LogRepository) EachAPILog(from time.Time, to time.Time, visit func(db.APILog) error) error {
+	r.lock.RLock()
+	apiLogs := append([]db.APILog{}, r.apiLogs...)
+	r.lock.RUnlock()
+	query := db.APILogQuery{From: from, To: to}
+	for _, apiLog := range apiLogs {
+		if !matchAPILog(apiLog, query) {
+			continue
+		}
+		if err := visit(apiLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCheckpoint save checkpoint of a log table, checkpoints are signed by logchain on database only
+// so this let tests give the checkpoints purge is limited by
+func (r *LogRepository) CreateCheckpoint(checkpoint *db.LogCheckpoint) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	checkpoint.ID = len(r.checkpoints) + 1
+	r.checkpoints = append(r.checkpoints, *checkpoint)
+	return nil
+}
+
+// FindPurgeLimit give id of the last api log which can be purged, zero when there is none. Logs are purged up to
+// a checkpoint only when every log up to it is older than the time given, and the last log is always kept
+func (r *LogRepository) FindPurgeLimit(before time.Time) (int, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if len(r.apiLogs) == 0 {
+		return 0, nil
+	}
+	bound := r.apiLogs[len(r.apiLogs)-1].ID
+	for _, apiLog := range r.apiLogs {
+		if !apiLog.Timestamp.Before(before) {
+			bound = apiLog.ID
+			break
+		}
+	}
+	limit := 0
+	for _, checkpoint := range r.checkpoints {
+		if checkpoint.LogTable == db.APILogTable && checkpoint.LastID < bound && checkpoint.LastID > limit {
+			limit = checkpoint.LastID
+		}
+	}
+	return limit, nil
+}
+
+// DeleteAPILogs delete at most limit oldest api logs having id up to maxID
+func (r *LogRepository) DeleteAPILogs(maxID int, limit int) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	kept := r.apiLogs[:0]
+	deleted := 0
+	for _, apiLog := range r.apiLogs {
+		if deleted < limit && apiLog.ID <= maxID {
+			deleted++
+			continue
+		}
+		kept = append(kept, apiLog)
+	}
+	r.apiLogs = kept
+	return deleted, nil
+}
+
+func matchAPILog(apiLog db.APILog, query db.APILogQuery) bool {
+	if !query.From.IsZero() && apiLog.Timestamp.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !apiLog.Timestamp.Before(query.To) {
+		return false
+	}
+	if len(query.Path) > 0 {
+		if query.PathPrefix && !strings.HasPrefix(apiLog.Path, query.Path) {
+			return false
+		}
+		if !query.PathPrefix && apiLog.Path != query.Path {
+			return false
+		}
+	}
+	if len(query.Method) > 0 && apiLog.Method != query.Method {
+		return false
+	}
+	if query.Status > 0 && apiLog.ResponseStatus != query.Status {
+		return false
+	}
+	if len(query.ClientIP) > 0 && apiLog.ClientIP != query.ClientIP {
+		return false
+	}
+	if len(query.UserAgent) > 0 && !strings.Contains(apiLog.ClientTools, query.UserAgent) {
+		return false
+	}
+	if len(query.UserID) > 0 && apiLog.UserID != query.UserID {
+		return false
+	}
+	return true
+}
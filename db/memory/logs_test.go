@@ -0,0 +1,78 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRepositoryChain(t *testing.T) {
+	logs := memory.NewLogRepository()
+	apiLogs := []db.APILog{{Timestamp: time.Now(), Path: "/a"}, {Timestamp: time.Now(), Path: "/b"}}
+	assert.Nil(t, logs.CreateAPILogs(apiLogs))
+	assert.Equal(t, 1, apiLogs[0].ID, "id should be given in order")
+	assert.Equal(t, 2, apiLogs[1].ID, "id should be given in order")
+	assert.Equal(t, apiLogs[0].Hash, apiLogs[1].PrevHash, "log should be linked to the one before it")
+	assert.Equal(t, db.ChainHash(apiLogs[1].PrevHash, apiLogs[1].ContentHash()), apiLogs[1].Hash)
+
+	first := db.AuditEvent{Timestamp: time.Now(), Type: "login_success"}
+	second := db.AuditEvent{Timestamp: time.Now(), Type: "token_refresh"}
+	logs.CreateAuditEvent(&first)
+	logs.CreateAuditEvent(&second)
+	assert.Equal(t, first.Hash, second.PrevHash, "event should be linked to the one before it")
+	assert.Len(t, logs.AuditEvents(), 2)
+}
+
+func TestLogRepositorySearch(t *testing.T) {
+	logs := memory.NewLogRepository()
+	logs.CreateAPILogs([]db.APILog{
+		{Timestamp: time.Now().Add(-time.Hour), ResponseStatus: 200, Path: "/api/auth/login", Method: "POST", ClientTools: "curl/7.68.0"},
+		{Timestamp: time.Now(), ResponseStatus: 401, Path: "/api/auth/login", Method: "POST", ClientTools: "Mozilla/5.0"},
+		{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/register", Method: "GET", ClientTools: "Mozilla/5.0"},
+	})
+	tests := []struct {
+		name  string
+		query db.APILogQuery
+		ids   []int
+	}{
+		{name: "All", query: db.APILogQuery{}, ids: []int{3, 2, 1}},
+		{name: "PathPrefix", query: db.APILogQuery{Path: "/api/auth", PathPrefix: true}, ids: []int{2, 1}},
+		{name: "PathExact", query: db.APILogQuery{Path: "/api/auth"}, ids: []int{}},
+		{name: "UserAgentContains", query: db.APILogQuery{UserAgent: "Mozilla"}, ids: []int{3, 2}},
+		{name: "From", query: db.APILogQuery{From: time.Now().Add(-time.Minute)}, ids: []int{3, 2}},
+		{name: "To", query: db.APILogQuery{To: time.Now().Add(-time.Minute)}, ids: []int{1}},
+		{name: "MethodAndStatus", query: db.APILogQuery{Method: "POST", Status: 200}, ids: []int{1}},
+		{name: "BeforeIDAndLimit", query: db.APILogQuery{BeforeID: 3, Limit: 1}, ids: []int{2}},
+	}
+	for _, tc := range tests {
+		apiLogs, err := logs.SearchAPILogs(tc.query)
+		assert.Nil(t, err, "test "+tc.name+" case")
+		ids := []int{}
+		for _, apiLog := range apiLogs {
+			ids = append(ids, apiLog.ID)
+		}
+		assert.Equal(t, tc.ids, ids, "test "+tc.name+" case")
+	}
+
+	statusCounts, _ := logs.CountAPILogsByStatus(db.APILogQuery{})
+	assert.Equal(t, []db.StatusCount{{ResponseStatus: 200, Total: 2}, {ResponseStatus: 401, Total: 1}}, statusCounts)
+	pathCounts, _ := logs.CountAPILogsByPath(db.APILogQuery{}, 1)
+	assert.Equal(t, []db.PathCount{{Path: "/api/auth/login", Total: 2}}, pathCounts)
+
+	limit, _ := logs.FindPurgeLimit(time.Now().Add(time.Minute))
+	assert.Equal(t, 0, limit, "logs not checkpointed should not be purged")
+	logs.CreateCheckpoint(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 2})
+	logs.CreateCheckpoint(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 3})
+	limit, _ = logs.FindPurgeLimit(time.Now().Add(time.Minute))
+	assert.Equal(t, 2, limit, "the last log should be kept")
+	limit, _ = logs.FindPurgeLimit(time.Now().Add(-time.Minute))
+	assert.Equal(t, 0, limit, "logs up to a checkpoint covering a newer log should be kept")
+
+	deleted, _ := logs.DeleteAPILogs(2, 10)
+	assert.Equal(t, 2, deleted, "log with id greater than max id should be kept")
+	remaining, _ := logs.SearchAPILogs(db.APILogQuery{})
+	assert.Len(t, remaining, 1)
+}
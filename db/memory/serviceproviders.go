@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ServiceProviderRepository is SAML service provider storage kept in memory, used for development and tests
+type ServiceProviderRepository struct {
+	lock             sync.RWMutex
+	serviceProviders map[string]db.ServiceProvider
+}
+
+// NewServiceProviderRepository create empty service provider repository
+func NewServiceProviderRepository() *ServiceProviderRepository {
+	return &ServiceProviderRepository{serviceProviders: map[string]db.ServiceProvider{}}
+}
+
+// FindServiceProviderByID get service provider having the entity ID
+func (r *ServiceProviderRepository) FindServiceProviderByID(id string) (db.ServiceProvider, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	serviceProvider, ok := r.serviceProviders[id]
+	if !ok {
+		return db.ServiceProvider{}, db.ErrServiceProviderNotFound
+	}
+	return serviceProvider, nil
+}
+
+// SaveServiceProvider insert the service provider or replace the one having the same entity ID
+func (r *ServiceProviderRepository) SaveServiceProvider(serviceProvider *db.ServiceProvider) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if existing, ok := r.serviceProviders[serviceProvider.ID]; ok {
+		serviceProvider.CreatedAt = existing.CreatedAt
+	} else if serviceProvider.CreatedAt.IsZero() {
+		serviceProvider.CreatedAt = now
+	}
+	serviceProvider.UpdatedAt = now
+	r.serviceProviders[serviceProvider.ID] = *serviceProvider
+	return nil
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ErrDuplicateSession returned when the session break uniqueness of id, same as the db constraint
+var ErrDuplicateSession = errors.New("memory: session with same id already exists")
+
+// SessionRepository is session storage kept in memory, used for development and tests
+type SessionRepository struct {
+	lock     sync.RWMutex
+	sessions map[string]db.Session
+}
+
+// NewSessionRepository create empty session repository
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{sessions: map[string]db.Session{}}
+}
+
+// CreateSession insert new session
+func (r *SessionRepository) CreateSession(session *db.Session) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.sessions[session.ID]; ok {
+		return ErrDuplicateSession
+	}
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+// FindSessionByID get session having the id, revoked or not
+func (r *SessionRepository) FindSessionByID(id string) (db.Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return db.Session{}, db.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// FindActiveSessions get sessions of the user not revoked and used after since, the last used first
+func (r *SessionRepository) FindActiveSessions(userID string, since time.Time) ([]db.Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	sessions := []db.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && !session.LastUsedAt.Before(since) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+// TouchSession set the time the session was last used
+func (r *SessionRepository) TouchSession(id string, usedAt time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if session, ok := r.sessions[id]; ok {
+		session.LastUsedAt = usedAt
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+// RevokeSession revoke the not revoked session of the user having the id
+func (r *SessionRepository) RevokeSession(userID string, id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || session.UserID != userID || session.RevokedAt != nil {
+		return db.ErrSessionNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	r.sessions[id] = session
+	return nil
+}
+
+// RevokeOtherSessions revoke every not revoked session of the user except the one having exceptID,
+// return the number of sessions revoked
+func (r *SessionRepository) RevokeOtherSessions(userID string, exceptID string) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	var revoked int64
+	for id, session := range r.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.sessions[id] = session
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// FindSessionsOfUser get every session of the user, revoked ones included, the oldest first
+func (r *SessionRepository) FindSessionsOfUser(userID string) ([]db.Session, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	sessions := []db.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// EraseUserSessions revoke every session of the user and erase its device and IP address,
+// return the number of sessions erased
+func (r *SessionRepository) EraseUserSessions(userID string) (int64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	var erased int64
+	for id, session := range r.sessions {
+		if session.UserID != userID {
+			continue
+		}
+		if session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+		session.UserAgent, session.IPAddress = "", ""
+		r.sessions[id] = session
+		erased++
+	}
+	return erased, nil
+}
@@ -0,0 +1,47 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRepository(t *testing.T) {
+	sessions := memory.NewSessionRepository()
+	now := time.Now()
+	for _, session := range []db.Session{
+		{ID: "current", UserID: "testid", CreatedAt: now, LastUsedAt: now},
+		{ID: "other", UserID: "testid", CreatedAt: now, LastUsedAt: now.Add(-time.Hour)},
+		{ID: "stale", UserID: "testid", CreatedAt: now, LastUsedAt: now.Add(-48 * time.Hour)},
+		{ID: "otheruser", UserID: "otherid", CreatedAt: now, LastUsedAt: now},
+	} {
+		session := session
+		assert.Nil(t, sessions.CreateSession(&session))
+	}
+	active, err := sessions.FindActiveSessions("testid", now.Add(-24*time.Hour))
+	assert.Nil(t, err)
+	if assert.Len(t, active, 2, "only recently used sessions of the user should be active") {
+		assert.Equal(t, "current", active[0].ID, "last used session should be first")
+	}
+
+	assert.Nil(t, sessions.TouchSession("other", now.Add(time.Minute)))
+	found, err := sessions.FindSessionByID("other")
+	assert.Nil(t, err)
+	assert.True(t, found.LastUsedAt.After(now), "last used time should be updated")
+	_, err = sessions.FindSessionByID("unknown")
+	assert.Equal(t, db.ErrSessionNotFound, err, "unknown session should not be found")
+
+	assert.Equal(t, db.ErrSessionNotFound, sessions.RevokeSession("otherid", "other"), "session of other user should not be revoked")
+	assert.Nil(t, sessions.RevokeSession("testid", "other"))
+	assert.Equal(t, db.ErrSessionNotFound, sessions.RevokeSession("testid", "other"), "revoked session should not be revoked again")
+	revoked, err := sessions.RevokeOtherSessions("testid", "current")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), revoked, "only the stale session should be left to revoke")
+	found, _ = sessions.FindSessionByID("current")
+	assert.Nil(t, found.RevokedAt, "current session should stay active")
+	found, _ = sessions.FindSessionByID("otheruser")
+	assert.Nil(t, found.RevokedAt, "session of other user should stay active")
+}
@@ -0,0 +1,322 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage kept in memory, used for development and tests
+type UserRepository struct {
+	lock  sync.RWMutex
+	users map[string]db.User
+}
+
+// NewUserRepository create empty user repository
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: map[string]db.User{}}
+}
+
+// FindUserByID get user having the id
+func (r *UserRepository) FindUserByID(id string) (db.User, error) {
+	return r.findUser(func(user db.User) bool { return user.ID == id })
+}
+
+// FindUserWithDeleted get user having the id even when it is deleted
+func (r *UserRepository) FindUserWithDeleted(id string) (db.User, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	user, ok := r.users[id]
+	if !ok {
+		return db.User{}, db.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// FindUserByEmail get user having the email in any case
+func (r *UserRepository) FindUserByEmail(email string) (db.User, error) {
+	email = db.NormalizeEmail(email)
+	return r.findUser(func(user db.User) bool { return user.Email == email })
+}
+
+// FindUserByPhoneNumber get user having the phone number in E.164
+func (r *UserRepository) FindUserByPhoneNumber(phoneNumber string) (db.User, error) {
+	return r.findUser(func(user db.User) bool { return user.PhoneNumber == phoneNumber })
+}
+
+func (r *UserRepository) findUser(match func(db.User) bool) (db.User, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, user := range r.users {
+		if user.DeletedAt == nil && match(user) {
+			return user, nil
+		}
+	}
+	return db.User{}, db.ErrUserNotFound
+}
+
+// IsUserIDUsed tell there is a user having the id, deleted user keep its id
+func (r *UserRepository) IsUserIDUsed(id string) (bool, error) {
+	return r.isUsedWithDeleted(func(user db.User) bool { return user.ID == id })
+}
+
+// IsKtpNumberUsed tell there is a user having the KTP number, deleted user keep its KTP number
+func (r *UserRepository) IsKtpNumberUsed(ktpNumber string) (bool, error) {
+	return r.isUsedWithDeleted(func(user db.User) bool { return user.KtpNumber == ktpNumber })
+}
+
+// IsEmailUsed tell there is a user having the email in any case
+func (r *UserRepository) IsEmailUsed(email string) (bool, error) {
+	email = db.NormalizeEmail(email)
+	return r.isUsed(func(user db.User) bool { return user.Email == email })
+}
+
+// IsPhoneNumberUsed tell there is a user having the phone number
+func (r *UserRepository) IsPhoneNumberUsed(phoneNumber string) (bool, error) {
+	return r.isUsed(func(user db.User) bool { return user.PhoneNumber == phoneNumber })
+}
+
+func (r *UserRepository) isUsed(match func(db.User) bool) (bool, error) {
+	_, err := r.findUser(match)
+	if err == db.ErrUserNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *UserRepository) isUsedWithDeleted(match func(db.User) bool) (bool, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, user := range r.users {
+		if match(user) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindUsers get users matching the query, the oldest first, with the number of users matching it
+func (r *UserRepository) FindUsers(query db.UserQuery) ([]db.User, int, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	matched := []db.User{}
+	for _, user := range r.users {
+		if user.DeletedAt != nil ||
+			(len(query.Email) > 0 && user.Email != db.NormalizeEmail(query.Email)) ||
+			(len(query.ExternalID) > 0 && user.ExternalID != query.ExternalID) {
+			continue
+		}
+		matched = append(matched, user)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+	users := []db.User{}
+	for i := query.Offset; i < len(matched) && len(users) < query.Limit; i++ {
+		users = append(users, matched[i])
+	}
+	return users, len(matched), nil
+}
+
+// SealUsers do nothing, users kept in memory are not saved at rest so their personal data is not encrypted
+func (r *UserRepository) SealUsers(afterID string, limit int) (db.SealResult, error) {
+	return db.SealResult{LastID: afterID, Duplicate: []string{}}, nil
+}
+
+// FindUsersToNormalizePhone get users having phone number but no original phone number,
+// they are saved before phone numbers were normalized
+func (r *UserRepository) FindUsersToNormalizePhone(limit int) ([]db.User, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	users := []db.User{}
+	for _, user := range r.users {
+		if user.DeletedAt == nil && len(user.OriginalPhoneNumber) == 0 && len(user.PhoneNumber) > 0 {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// CreateUser insert new user with its email normalized
+func (r *UserRepository) CreateUser(user *db.User) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user.Email = db.NormalizeEmail(user.Email)
+	return r.createUser(user)
+}
+
+// RegisterUser insert new user with its email normalized and id given by newID,
+// newID is called again while the id is used by another user up to attempts times
+func (r *UserRepository) RegisterUser(user *db.User, newID func() (string, error), attempts int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user.Email = db.NormalizeEmail(user.Email)
+	for attempt := 1; ; attempt++ {
+		var err error
+		if user.ID, err = newID(); err != nil {
+			return err
+		}
+		err = r.createUser(user)
+		if duplicate, ok := err.(*db.DuplicateUserError); !ok || duplicate.Column != "id" || attempt >= attempts {
+			return err
+		}
+	}
+}
+
+func (r *UserRepository) createUser(user *db.User) error {
+	if _, ok := r.users[user.ID]; ok {
+		return &db.DuplicateUserError{Column: "id"}
+	}
+	if column := r.duplicateColumn(*user); len(column) > 0 {
+		return &db.DuplicateUserError{Column: column}
+	}
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	r.users[user.ID] = *user
+	return nil
+}
+
+// UpdatePassword replace hashed password of the user having the id
+func (r *UserRepository) UpdatePassword(id string, password string) error {
+	return r.updateUser(id, func(user *db.User) { user.Password = password })
+}
+
+// SetUserDisabled disable or enable the user having the id
+func (r *UserRepository) SetUserDisabled(id string, disabled bool) error {
+	return r.updateUser(id, func(user *db.User) { user.Disabled = disabled })
+}
+
+// SetPhoneNumber replace phone number of the user having the id with the original phone number it is written from
+func (r *UserRepository) SetPhoneNumber(id string, phoneNumber string, originalPhoneNumber string) error {
+	return r.updateUser(id, func(user *db.User) {
+		user.PhoneNumber = phoneNumber
+		user.OriginalPhoneNumber = originalPhoneNumber
+	})
+}
+
+// UpdateUser replace profile of the user with its email normalized, password and administrator flag are kept
+func (r *UserRepository) UpdateUser(user *db.User) error {
+	return r.updateProfile(user, nil)
+}
+
+// updateProfile replace profile of the user when check of the saved user pass, nil check always pass
+func (r *UserRepository) updateProfile(user *db.User, check func(db.User) error) error {
+	user.Email = db.NormalizeEmail(user.Email)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	existing, ok := r.users[user.ID]
+	if !ok || existing.DeletedAt != nil {
+		return db.ErrUserNotFound
+	}
+	if check != nil {
+		if err := check(existing); err != nil {
+			return err
+		}
+	}
+	updated := *user
+	updated.CreatedAt = existing.CreatedAt
+	updated.Password = existing.Password
+	updated.IsAdmin = existing.IsAdmin
+	if column := r.duplicateColumn(updated); len(column) > 0 {
+		return &db.DuplicateUserError{Column: column}
+	}
+	updated.UpdatedAt = time.Now()
+	user.UpdatedAt = updated.UpdatedAt
+	r.users[user.ID] = updated
+	return nil
+}
+
+// UpdateProfile replace profile of the user as UpdateUser only when it is not updated since updatedAt,
+// db.ErrStaleUser is returned otherwise
+func (r *UserRepository) UpdateProfile(user *db.User, updatedAt time.Time) error {
+	return r.updateProfile(user, func(existing db.User) error {
+		if !existing.UpdatedAt.Equal(updatedAt) {
+			return db.ErrStaleUser
+		}
+		return nil
+	})
+}
+
+// DeleteUser delete the user having the id, the user is kept with deleted time
+func (r *UserRepository) DeleteUser(id string) error {
+	return r.updateUser(id, func(user *db.User) {
+		now := time.Now()
+		user.DeletedAt = &now
+	})
+}
+
+// PurgeUser remove the user having the id, deleted user included
+func (r *UserRepository) PurgeUser(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return db.ErrUserNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// EraseUser anonymize the user having the id as db.GormUserRepository.EraseUser, deleted user included
+func (r *UserRepository) EraseUser(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return db.ErrUserNotFound
+	}
+	now := time.Now()
+	deletedAt := user.DeletedAt
+	if deletedAt == nil {
+		deletedAt = &now
+	}
+	r.users[id] = db.User{ID: id, CreatedAt: user.CreatedAt, UpdatedAt: now, DeletedAt: deletedAt,
+		KtpNumber: db.ErasedKtpNumber(id), Disabled: true}
+	return nil
+}
+
+// duplicateColumn give the column of the user which another user has, the KTP number is checked against
+// all users and the email and phone number against users which are not deleted, as the unique indexes of
+// users table. Empty column means no duplicate
+func (r *UserRepository) duplicateColumn(user db.User) string {
+	for _, existing := range r.users {
+		switch {
+		case existing.ID == user.ID:
+		case existing.KtpNumber == user.KtpNumber:
+			return "ktp_number"
+		case existing.DeletedAt != nil:
+		case len(user.Email) > 0 && existing.Email == user.Email:
+			return "email"
+		case len(user.PhoneNumber) > 0 && existing.PhoneNumber == user.PhoneNumber:
+			return "phone_number"
+		}
+	}
+	return ""
+}
+
+func (r *UserRepository) updateUser(id string, update func(*db.User)) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return db.ErrUserNotFound
+	}
+	update(&user)
+	if column := r.duplicateColumn(user); len(column) > 0 {
+		return &db.DuplicateUserError{Column: column}
+	}
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
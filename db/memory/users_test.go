@@ -0,0 +1,95 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRepository(t *testing.T) {
+	users := memory.NewUserRepository()
+	testUser := db.User{ID: "testid", Email: "test@test.com", KtpNumber: "1111", PhoneNumber: "+6281200000000"}
+	assert.Nil(t, users.CreateUser(&testUser), "Should return nil because there is no error")
+	assert.False(t, testUser.CreatedAt.IsZero(), "created time should be filled")
+
+	found, err := users.FindUserByID("testid")
+	assert.Nil(t, err)
+	assert.Equal(t, "test@test.com", found.Email)
+	found, err = users.FindUserByEmail("test@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", found.ID)
+	_, err = users.FindUserByID("unknown")
+	assert.Equal(t, db.ErrUserNotFound, err, "unknown user should not be found")
+
+	tests := []struct {
+		name    string
+		isUsed  func() (bool, error)
+		expects bool
+	}{
+		{name: "UsedID", isUsed: func() (bool, error) { return users.IsUserIDUsed("testid") }, expects: true},
+		{name: "UnusedID", isUsed: func() (bool, error) { return users.IsUserIDUsed("otherid") }, expects: false},
+		{name: "UsedKtpNumber", isUsed: func() (bool, error) { return users.IsKtpNumberUsed("1111") }, expects: true},
+		{name: "UnusedKtpNumber", isUsed: func() (bool, error) { return users.IsKtpNumberUsed("2222") }, expects: false},
+		{name: "UsedEmail", isUsed: func() (bool, error) { return users.IsEmailUsed("test@test.com") }, expects: true},
+		{name: "UsedEmailOtherCase", isUsed: func() (bool, error) { return users.IsEmailUsed("Test@Test.com") }, expects: true},
+		{name: "UsedPhoneNumber", isUsed: func() (bool, error) { return users.IsPhoneNumberUsed("+6281200000000") }, expects: true},
+	}
+	for _, tc := range tests {
+		isUsed, err := tc.isUsed()
+		assert.Nil(t, err, "test "+tc.name+" case")
+		assert.Equal(t, tc.expects, isUsed, "test "+tc.name+" case")
+	}
+
+	assert.Equal(t, &db.DuplicateUserError{Column: "id"}, users.CreateUser(&db.User{ID: "testid", KtpNumber: "2222"}),
+		"same id should be rejected")
+	assert.Equal(t, &db.DuplicateUserError{Column: "ktp_number"}, users.CreateUser(&db.User{ID: "otherid", KtpNumber: "1111"}),
+		"same KTP number should be rejected")
+	assert.Equal(t, &db.DuplicateUserError{Column: "email"}, users.CreateUser(&db.User{ID: "otherid", KtpNumber: "2222", Email: "TEST@test.com"}),
+		"same email in other case should be rejected")
+	assert.Equal(t, &db.DuplicateUserError{Column: "phone_number"}, users.CreateUser(&db.User{ID: "otherid", KtpNumber: "2222", PhoneNumber: "+6281200000000"}),
+		"same phone number should be rejected")
+
+	assert.Nil(t, users.UpdatePassword("testid", "newhash"))
+	assert.Nil(t, users.SetUserDisabled("testid", true))
+	found, _ = users.FindUserByID("testid")
+	assert.Equal(t, "newhash", found.Password, "password should be updated")
+	assert.True(t, found.Disabled, "user should be disabled")
+	assert.Equal(t, db.ErrUserNotFound, users.SetUserDisabled("unknown", true), "unknown user should not be updated")
+
+	assert.Nil(t, users.CreateUser(&db.User{ID: "legacyid", KtpNumber: "3333", PhoneNumber: "0812 0000 0001"}))
+	toNormalize, err := users.FindUsersToNormalizePhone(10)
+	assert.Nil(t, err)
+	if assert.Len(t, toNormalize, 2, "users having phone number without original should be normalized") {
+		assert.Equal(t, "legacyid", toNormalize[0].ID, "users should be ordered by id")
+	}
+	assert.Nil(t, users.SetPhoneNumber("legacyid", "+6281200000001", "0812 0000 0001"))
+	found, err = users.FindUserByPhoneNumber("+6281200000001")
+	assert.Nil(t, err)
+	assert.Equal(t, "0812 0000 0001", found.OriginalPhoneNumber, "original phone number should be kept")
+	toNormalize, _ = users.FindUsersToNormalizePhone(10)
+	assert.Len(t, toNormalize, 1, "normalized user should not be normalized again")
+}
+
+func TestUserRepositoryUpdateProfile(t *testing.T) {
+	users := memory.NewUserRepository()
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", Email: "test@test.com", KtpNumber: "1111"}))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "otherid", Email: "other@test.com", KtpNumber: "2222"}))
+
+	read, _ := users.FindUserByID("testid")
+	changed := read
+	changed.Name = "changed"
+	assert.Nil(t, users.UpdateProfile(&changed, read.UpdatedAt), "user not updated since read should be updated")
+	found, _ := users.FindUserByID("testid")
+	assert.True(t, found.UpdatedAt.Equal(changed.UpdatedAt), "updated time given back should be the one saved")
+
+	stale := read
+	stale.Name = "stale"
+	assert.Equal(t, db.ErrStaleUser, users.UpdateProfile(&stale, read.UpdatedAt), "user updated since read should not be updated")
+	found.Email = "Other@test.com"
+	assert.Equal(t, &db.DuplicateUserError{Column: "email"}, users.UpdateProfile(&found, found.UpdatedAt))
+	unknown := db.User{ID: "unknown"}
+	assert.Equal(t, db.ErrUserNotFound, users.UpdateProfile(&unknown, time.Time{}))
+}
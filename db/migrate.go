@@ -0,0 +1,278 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrSchemaNotMigrated returned when database schema is not at the version the binary expect
+var ErrSchemaNotMigrated = errors.New("db: schema is not migrated, run migrate up")
+
+// migrationLockID is postgres advisory lock key serializing migrations of several instances
+const migrationLockID = 730000
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change with the SQL applying and reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration with the time it was applied, nil AppliedAt means pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// SchemaMigration is db definition of an applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+var schemaMigrationsTable = map[string]string{
+	DriverPostgres: "CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text, applied_at timestamp with time zone)",
+	DriverSQLite:   "CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text, applied_at datetime)",
+}
+
+// adoptedColumns are columns the tables created by AutoMigrate of the first release do not have, added when
+// the first migration adopt those tables. Postgres add them in the migration itself by ADD COLUMN IF NOT EXISTS
+var adoptedColumns = []struct {
+	Table      string
+	Column     string
+	Definition string
+}{
+	{"users", "is_admin", "boolean"},
+	{"api_logs", "prev_hash", "text"},
+	{"api_logs", "hash", "text"},
+}
+
+// adoptSQLiteColumns add adoptedColumns missing from the tables, sqlite has no ADD COLUMN IF NOT EXISTS.
+// Columns are read from table_info since gorm HasColumn of sqlite match any column ending by the name
+func adoptSQLiteColumns(tx *gorm.DB) error {
+	for _, adopted := range adoptedColumns {
+		var count int
+		err := tx.Raw("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", adopted.Table, adopted.Column).
+			Row().Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		err = tx.Exec("ALTER TABLE " + adopted.Table + " ADD COLUMN " + adopted.Column + " " + adopted.Definition).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrations read migrations of the dialect embedded in the binary ordered by version
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("db: no migrations for dialect %s", dialect)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		// file name is <version>_<name>.<up|down>.sql
+		fileName := entry.Name()
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("db: invalid migration file name %s", fileName)
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+		if direction == ".up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if len(migration.Up) == 0 || len(migration.Down) == 0 {
+			return nil, fmt.Errorf("db: migration %d must have both up and down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatuses list every migration of the connection dialect and when it was applied
+func MigrationStatuses(conn *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(conn.Dialect().GetName())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if schemaMigration, ok := applied[migration.Version]; ok {
+			appliedAt := schemaMigration.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	if len(applied) > 0 {
+		return nil, fmt.Errorf("db: %d applied migrations are unknown, the binary is older than the schema", len(applied))
+	}
+	return statuses, nil
+}
+
+// CheckSchema return ErrSchemaNotMigrated when there is a pending migration
+func CheckSchema(conn *gorm.DB) error {
+	statuses, err := MigrationStatuses(conn)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			return fmt.Errorf("%w: migration %d %s is pending", ErrSchemaNotMigrated, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp apply every pending migration in order and return the ones applied
+func MigrateUp(conn *gorm.DB) ([]Migration, error) {
+	statuses, err := MigrationStatuses(conn)
+	if err != nil {
+		return nil, err
+	}
+	applied := []Migration{}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			continue
+		}
+		done, err := runMigration(conn, status.Migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("db: migration %d %s failed: %w", status.Version, status.Name, err)
+		}
+		if done {
+			applied = append(applied, status.Migration)
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown revert at most steps migrations from the newest and return the ones reverted
+func MigrateDown(conn *gorm.DB, steps int) ([]Migration, error) {
+	statuses, err := MigrationStatuses(conn)
+	if err != nil {
+		return nil, err
+	}
+	reverted := []Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		status := statuses[i]
+		if status.AppliedAt == nil {
+			continue
+		}
+		done, err := runMigration(conn, status.Migration, false)
+		if err != nil {
+			return reverted, fmt.Errorf("db: reverting migration %d %s failed: %w", status.Version, status.Name, err)
+		}
+		if done {
+			reverted = append(reverted, status.Migration)
+		}
+	}
+	return reverted, nil
+}
+
+func appliedMigrations(conn *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := conn.Exec(schemaMigrationsTable[conn.Dialect().GetName()]).Error; err != nil {
+		return nil, err
+	}
+	var schemaMigrations []SchemaMigration
+	if err := conn.Order("version").Find(&schemaMigrations).Error; err != nil {
+		return nil, err
+	}
+	applied := map[int]SchemaMigration{}
+	for _, schemaMigration := range schemaMigrations {
+		applied[schemaMigration.Version] = schemaMigration
+	}
+	return applied, nil
+}
+
+// runMigration apply or revert the migration inside transaction together with its schema_migrations row,
+// return false when another instance already did it
+func runMigration(conn *gorm.DB, migration Migration, up bool) (bool, error) {
+	tx := conn.Begin()
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	if tx.Dialect().GetName() == DriverPostgres {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	var count int
+	if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if (count > 0) == up {
+		tx.Rollback()
+		return false, nil
+	}
+	// migration SQL is run as is, gorm would replace question marks in it as placeholders
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+	if _, err := tx.CommonDB().Exec(script); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if up && migration.Version == 1 && tx.Dialect().GetName() == DriverSQLite {
+		if err := adoptSQLiteColumns(tx); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	var err error
+	if up {
+		err = tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+	} else {
+		err = tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit().Error
+}
@@ -0,0 +1,122 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+func TestMigrations(t *testing.T) {
+	for _, dialect := range []string{db.DriverPostgres, db.DriverSQLite} {
+		migrations, err := db.Migrations(dialect)
+		assert.Nil(t, err, "test "+dialect+" dialect")
+		assert.NotEmpty(t, migrations, "test "+dialect+" dialect")
+		for i, migration := range migrations {
+			assert.Equal(t, i+1, migration.Version, "versions should be numbered without gap in "+dialect+" dialect")
+		}
+	}
+	_, err := db.Migrations("mysql")
+	assert.Error(t, err, "unknown dialect should return an error")
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	conn, err := db.Open(&db.Config{Driver: db.DriverSQLite, Path: db.SQLiteMemory})
+	assert.Nil(t, err)
+	defer conn.Close()
+	migrations, _ := db.Migrations(db.DriverSQLite)
+
+	err = db.CheckSchema(conn)
+	assert.True(t, errors.Is(err, db.ErrSchemaNotMigrated), "empty database should not be migrated")
+	applied, err := db.MigrateUp(conn)
+	assert.Nil(t, err)
+	assert.Len(t, applied, len(migrations), "every migration should be applied")
+	assert.Nil(t, db.CheckSchema(conn), "schema should be up to date")
+	assert.True(t, conn.Dialect().HasIndex("users", "idx_users_email"), "email should be indexed")
+	applied, _ = db.MigrateUp(conn)
+	assert.Empty(t, applied, "applied migration should not be applied again")
+
+	reverted, err := db.MigrateDown(conn, 1)
+	assert.Nil(t, err)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, migrations[len(migrations)-1].Version, reverted[0].Version, "the newest migration should be reverted")
+	statuses, err := db.MigrationStatuses(conn)
+	assert.Nil(t, err)
+	assert.Nil(t, statuses[len(statuses)-1].AppliedAt, "reverted migration should be pending")
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Error(t, db.CheckSchema(conn), "schema with pending migration should be refused")
+
+	reverted, _ = db.MigrateDown(conn, len(migrations)+1)
+	assert.Len(t, reverted, len(migrations)-1, "only applied migrations should be reverted")
+	assert.False(t, conn.HasTable(&db.User{}), "users table should be dropped")
+}
+
+// legacyUser is user table created by AutoMigrate of the first release, before migrations were versioned
+type legacyUser struct {
+	ID           string `gorm:"primary_key"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time
+	Name         string
+	Gender       string
+	Email        string
+	KtpNumber    int64 `gorm:"unique;not null"`
+	Address      string
+	PhoneNumber  string
+	Password     string
+	DateOfBirth  time.Time
+	Cityzenship  string
+	PlaceOfBirth string
+}
+
+func (legacyUser) TableName() string {
+	return "users"
+}
+
+// legacyAPILog is api log table created by AutoMigrate of the first release, before logs were chained
+type legacyAPILog struct {
+	ID             int `gorm:"primary_key"`
+	Timestamp      time.Time
+	TTL            string
+	ResponseStatus int
+	Path           string
+	Method         string
+	ClientIP       string
+	ClientTools    string
+	Protocol       string
+}
+
+func (legacyAPILog) TableName() string {
+	return "api_logs"
+}
+
+func TestMigrateUpAdoptAutoMigratedSchema(t *testing.T) {
+	conn, err := db.Open(&db.Config{Driver: db.DriverSQLite, Path: db.SQLiteMemory})
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.AutoMigrate(&legacyUser{}, &legacyAPILog{})
+	conn.Create(&legacyUser{ID: "testid", KtpNumber: 1111, Email: "Test@Test.com", PhoneNumber: "08120000000"})
+	conn.Create(&legacyAPILog{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/v1/sso/auth/login"})
+
+	_, err = db.MigrateUp(conn)
+	assert.Nil(t, err, "existing tables should be adopted")
+	found, err := db.NewGormUserRepository(conn).FindUserByID("testid")
+	assert.Nil(t, err)
+	assert.Equal(t, "1111", found.KtpNumber, "existing user should be kept with KTP number as text")
+	assert.Equal(t, "test@test.com", found.Email, "existing email should be lowercased")
+	toNormalize, err := db.NewGormUserRepository(conn).FindUsersToNormalizePhone(10)
+	assert.Nil(t, err)
+	assert.Len(t, toNormalize, 1, "existing phone number should wait to be normalized")
+	assert.True(t, conn.Dialect().HasColumn("users", "is_admin"), "missing column should be added")
+	admin := db.User{ID: "adminid", KtpNumber: "2222", Email: "admin@test.com", IsAdmin: true}
+	assert.Nil(t, db.NewGormUserRepository(conn).CreateUser(&admin), "administrator should be saved")
+	logs := db.NewGormLogRepository(conn)
+	assert.Nil(t, logs.CreateAPILogs([]db.APILog{{Timestamp: time.Now(), ResponseStatus: 200}}),
+		"api log should be chained after the existing ones")
+	apiLogs, err := logs.SearchAPILogs(db.APILogQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, apiLogs, 2, "existing api log should be kept")
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS log_checkpoints;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS api_logs;
+DROP TABLE IF EXISTS users;
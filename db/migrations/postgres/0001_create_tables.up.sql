@@ -0,0 +1,66 @@
+-- tables used to be created by gorm AutoMigrate, IF NOT EXISTS let existing database adopt this migration
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    name text,
+    gender text,
+    email text,
+    ktp_number bigint NOT NULL UNIQUE,
+    address text,
+    phone_number text,
+    password text,
+    date_of_birth timestamp with time zone,
+    cityzenship text,
+    place_of_birth text,
+    is_admin boolean
+);
+
+CREATE TABLE IF NOT EXISTS api_logs (
+    id serial PRIMARY KEY,
+    timestamp timestamp with time zone,
+    ttl text,
+    response_status integer,
+    path text,
+    method text,
+    client_ip text,
+    client_tools text,
+    protocol text,
+    prev_hash text,
+    hash text
+);
+
+-- columns the tables created by AutoMigrate of the first release do not have
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin boolean;
+ALTER TABLE api_logs ADD COLUMN IF NOT EXISTS prev_hash text;
+ALTER TABLE api_logs ADD COLUMN IF NOT EXISTS hash text;
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id serial PRIMARY KEY,
+    timestamp timestamp with time zone,
+    type text,
+    outcome text,
+    reason text,
+    actor_id text,
+    subject_id text,
+    client_id text,
+    client_ip text,
+    user_agent text,
+    metadata text,
+    prev_hash text,
+    hash text
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject_id ON audit_events (subject_id);
+
+CREATE TABLE IF NOT EXISTS log_checkpoints (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    log_table text,
+    last_id integer,
+    last_hash text,
+    signature text
+);
+CREATE INDEX IF NOT EXISTS idx_log_checkpoints_log_table ON log_checkpoints (log_table);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_api_logs_timestamp;
+DROP INDEX IF EXISTS idx_users_phone_number;
+DROP INDEX IF EXISTS idx_users_email;
@@ -0,0 +1,8 @@
+CREATE TABLE clients (
+    id text PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    name text NOT NULL,
+    secret_hash text NOT NULL,
+    disabled boolean NOT NULL DEFAULT false
+);
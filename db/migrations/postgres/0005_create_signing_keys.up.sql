@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    id text PRIMARY KEY,
+    created_at timestamp with time zone NOT NULL,
+    purpose text NOT NULL,
+    secret text NOT NULL,
+    retired_at timestamp with time zone,
+    expires_at timestamp with time zone
+);
+CREATE INDEX idx_signing_keys_purpose ON signing_keys (purpose);
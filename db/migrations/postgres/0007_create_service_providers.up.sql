@@ -0,0 +1,9 @@
+CREATE TABLE service_providers (
+    id text PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    name text NOT NULL,
+    metadata text NOT NULL,
+    attribute_mapping text NOT NULL,
+    disabled boolean NOT NULL DEFAULT false
+);
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN external_id text;
+CREATE INDEX idx_users_external_id ON users (external_id);
+
+CREATE TABLE user_groups (
+    id text PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    display_name text NOT NULL UNIQUE,
+    external_id text
+);
+CREATE INDEX idx_user_groups_external_id ON user_groups (external_id);
+
+CREATE TABLE group_members (
+    group_id text NOT NULL,
+    user_id text NOT NULL,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_group_members_user_id ON group_members (user_id);
@@ -0,0 +1,2 @@
+-- KTP number which is not digits can not be reverted, it must be fixed before migrating down
+ALTER TABLE users ALTER COLUMN ktp_number TYPE bigint USING ktp_number::bigint;
@@ -0,0 +1,2 @@
+-- KTP number is NIK kept as text, existing numbers are written in decimal digits
+ALTER TABLE users ALTER COLUMN ktp_number TYPE text USING ktp_number::text;
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN original_phone_number;
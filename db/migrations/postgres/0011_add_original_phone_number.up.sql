@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN original_phone_number text;
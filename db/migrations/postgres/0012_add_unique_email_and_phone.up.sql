@@ -0,0 +1,5 @@
+-- emails are unique regardless of case, so the existing ones are lowercased as new ones are saved.
+-- Users sharing email or phone number must be changed before this migration, deleted users keep theirs
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+CREATE UNIQUE INDEX idx_users_email_unique ON users (lower(email)) WHERE deleted_at IS NULL AND email <> '';
+CREATE UNIQUE INDEX idx_users_phone_number_unique ON users (phone_number) WHERE deleted_at IS NULL AND phone_number <> '';
@@ -0,0 +1,6 @@
+-- encrypted users can not be read without their date of birth, so users must be saved as plaintext before reverting
+DROP INDEX IF EXISTS idx_users_phone_number_index_unique;
+DROP INDEX IF EXISTS idx_users_ktp_number_index_unique;
+ALTER TABLE users DROP COLUMN sealed_date_of_birth;
+ALTER TABLE users DROP COLUMN phone_number_index;
+ALTER TABLE users DROP COLUMN ktp_number_index;
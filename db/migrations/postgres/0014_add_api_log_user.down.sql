@@ -0,0 +1,6 @@
+-- logs saved since are no longer verifiable, their hash cover personal_hash
+DROP INDEX IF EXISTS idx_api_logs_user_id;
+ALTER TABLE api_logs DROP COLUMN redacted;
+ALTER TABLE api_logs DROP COLUMN personal_hash;
+ALTER TABLE api_logs DROP COLUMN personal_salt;
+ALTER TABLE api_logs DROP COLUMN user_id;
@@ -0,0 +1,7 @@
+-- api logs keep the user logged in so its logs can be exported and erased. Their personal data is covered by the
+-- hash chain through personal_hash, so it can be erased while the chain stays verifiable
+ALTER TABLE api_logs ADD COLUMN user_id text NOT NULL DEFAULT '';
+ALTER TABLE api_logs ADD COLUMN personal_salt text NOT NULL DEFAULT '';
+ALTER TABLE api_logs ADD COLUMN personal_hash text NOT NULL DEFAULT '';
+ALTER TABLE api_logs ADD COLUMN redacted boolean NOT NULL DEFAULT false;
+CREATE INDEX idx_api_logs_user_id ON api_logs (user_id);
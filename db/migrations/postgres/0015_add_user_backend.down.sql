@@ -0,0 +1,2 @@
+-- users provisioned from a directory can login by the db backend again after reverting
+ALTER TABLE users DROP COLUMN backend;
@@ -0,0 +1,3 @@
+-- users provisioned from a directory are marked by its backend, their password is not known so the db backend
+-- must not authenticate them. Empty backend is user registered in the users table
+ALTER TABLE users ADD COLUMN backend text NOT NULL DEFAULT '';
@@ -0,0 +1,62 @@
+-- tables used to be created by gorm AutoMigrate, IF NOT EXISTS let existing database adopt this migration,
+-- columns those tables may not have are added by the migration runner since sqlite can not add them if not exists
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    gender text,
+    email text,
+    ktp_number bigint NOT NULL UNIQUE,
+    address text,
+    phone_number text,
+    password text,
+    date_of_birth datetime,
+    cityzenship text,
+    place_of_birth text,
+    is_admin boolean
+);
+
+CREATE TABLE IF NOT EXISTS api_logs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    timestamp datetime,
+    ttl text,
+    response_status integer,
+    path text,
+    method text,
+    client_ip text,
+    client_tools text,
+    protocol text,
+    prev_hash text,
+    hash text
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    timestamp datetime,
+    type text,
+    outcome text,
+    reason text,
+    actor_id text,
+    subject_id text,
+    client_id text,
+    client_ip text,
+    user_agent text,
+    metadata text,
+    prev_hash text,
+    hash text
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject_id ON audit_events (subject_id);
+
+CREATE TABLE IF NOT EXISTS log_checkpoints (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    log_table text,
+    last_id integer,
+    last_hash text,
+    signature text
+);
+CREATE INDEX IF NOT EXISTS idx_log_checkpoints_log_table ON log_checkpoints (log_table);
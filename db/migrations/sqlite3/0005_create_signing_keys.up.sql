@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    id text PRIMARY KEY,
+    created_at datetime NOT NULL,
+    purpose text NOT NULL,
+    secret text NOT NULL,
+    retired_at datetime,
+    expires_at datetime
+);
+CREATE INDEX idx_signing_keys_purpose ON signing_keys (purpose);
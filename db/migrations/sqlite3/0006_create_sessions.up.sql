@@ -0,0 +1,11 @@
+CREATE TABLE sessions (
+    id text PRIMARY KEY,
+    created_at datetime NOT NULL,
+    last_used_at datetime NOT NULL,
+    user_id text NOT NULL,
+    client_id text,
+    user_agent text,
+    ip_address text,
+    revoked_at datetime
+);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE identity_links (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    user_id text NOT NULL,
+    email text,
+    UNIQUE (provider, subject)
+);
+CREATE INDEX idx_identity_links_user_id ON identity_links (user_id);
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS user_groups;
+-- sqlite cannot drop column, so the table is rebuilt without it
+CREATE TABLE users_without_external_id (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    gender text,
+    email text,
+    ktp_number bigint NOT NULL UNIQUE,
+    address text,
+    phone_number text,
+    password text,
+    date_of_birth datetime,
+    cityzenship text,
+    place_of_birth text,
+    is_admin boolean,
+    disabled boolean NOT NULL DEFAULT false
+);
+INSERT INTO users_without_external_id
+SELECT id, created_at, updated_at, deleted_at, name, gender, email, ktp_number, address,
+    phone_number, password, date_of_birth, cityzenship, place_of_birth, is_admin, disabled
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_without_external_id RENAME TO users;
+CREATE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_phone_number ON users (phone_number);
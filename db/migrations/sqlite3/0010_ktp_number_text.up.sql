@@ -0,0 +1,29 @@
+-- sqlite cannot change column type, so the table is rebuilt with KTP number as text
+CREATE TABLE users_text_ktp_number (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    gender text,
+    email text,
+    ktp_number text NOT NULL UNIQUE,
+    address text,
+    phone_number text,
+    password text,
+    date_of_birth datetime,
+    cityzenship text,
+    place_of_birth text,
+    is_admin boolean,
+    disabled boolean NOT NULL DEFAULT false,
+    external_id text
+);
+INSERT INTO users_text_ktp_number
+SELECT id, created_at, updated_at, deleted_at, name, gender, email, CAST(ktp_number AS text), address,
+    phone_number, password, date_of_birth, cityzenship, place_of_birth, is_admin, disabled, external_id
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_text_ktp_number RENAME TO users;
+CREATE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_phone_number ON users (phone_number);
+CREATE INDEX idx_users_external_id ON users (external_id);
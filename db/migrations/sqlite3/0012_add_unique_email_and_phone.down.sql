@@ -0,0 +1,3 @@
+-- lowercased emails are kept, they are still found by lowercased lookup
+DROP INDEX IF EXISTS idx_users_phone_number_unique;
+DROP INDEX IF EXISTS idx_users_email_unique;
@@ -0,0 +1,33 @@
+-- encrypted users can not be read without their date of birth, so users must be saved as plaintext before reverting.
+-- sqlite cannot drop column, so the table is rebuilt without them
+CREATE TABLE users_without_field_encryption (
+    id text PRIMARY KEY,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name text,
+    gender text,
+    email text,
+    ktp_number text NOT NULL UNIQUE,
+    address text,
+    phone_number text,
+    original_phone_number text,
+    password text,
+    date_of_birth datetime,
+    cityzenship text,
+    place_of_birth text,
+    is_admin boolean,
+    disabled boolean NOT NULL DEFAULT false,
+    external_id text
+);
+INSERT INTO users_without_field_encryption
+SELECT id, created_at, updated_at, deleted_at, name, gender, email, ktp_number, address, phone_number,
+    original_phone_number, password, date_of_birth, cityzenship, place_of_birth, is_admin, disabled, external_id
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_without_field_encryption RENAME TO users;
+CREATE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_phone_number ON users (phone_number);
+CREATE INDEX idx_users_external_id ON users (external_id);
+CREATE UNIQUE INDEX idx_users_email_unique ON users (lower(email)) WHERE deleted_at IS NULL AND email <> '';
+CREATE UNIQUE INDEX idx_users_phone_number_unique ON users (phone_number) WHERE deleted_at IS NULL AND phone_number <> '';
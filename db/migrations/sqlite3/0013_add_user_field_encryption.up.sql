@@ -0,0 +1,7 @@
+-- personal data of users is encrypted by the application when FIELD_KEY_FILE is set, blind indexes keep
+-- encrypted KTP numbers and phone numbers unique and searchable. Existing users are encrypted by encrypt-users
+ALTER TABLE users ADD COLUMN ktp_number_index text NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN phone_number_index text NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN sealed_date_of_birth text NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX idx_users_ktp_number_index_unique ON users (ktp_number_index) WHERE ktp_number_index <> '';
+CREATE UNIQUE INDEX idx_users_phone_number_index_unique ON users (phone_number_index) WHERE deleted_at IS NULL AND phone_number_index <> '';
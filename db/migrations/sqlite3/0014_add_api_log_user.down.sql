@@ -0,0 +1,21 @@
+-- logs saved since are no longer verifiable, their hash cover personal_hash.
+-- sqlite cannot drop column, so the table is rebuilt without them
+CREATE TABLE api_logs_without_user (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    timestamp datetime,
+    ttl text,
+    response_status integer,
+    path text,
+    method text,
+    client_ip text,
+    client_tools text,
+    protocol text,
+    prev_hash text,
+    hash text
+);
+INSERT INTO api_logs_without_user
+SELECT id, timestamp, ttl, response_status, path, method, client_ip, client_tools, protocol, prev_hash, hash
+FROM api_logs;
+DROP TABLE api_logs;
+ALTER TABLE api_logs_without_user RENAME TO api_logs;
+CREATE INDEX idx_api_logs_timestamp ON api_logs (timestamp);
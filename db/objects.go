@@ -6,20 +6,44 @@ import (
 
 // User is db definition of a user in SSO System
 type User struct {
-	ID           string `gorm:"primary_key"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	DeletedAt    *time.Time
-	Name         string
-	Gender       string
-	Email        string
-	KtpNumber    int64 `gorm:"unique;not null"`
-	Address      string
-	PhoneNumber  string
-	Password     string
-	DateOfBirth  time.Time
-	Cityzenship  string
-	PlaceOfBirth string
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	Name      string
+	Gender    string
+	Email     string
+	KtpNumber string `gorm:"unique;not null"`
+	Address   string
+	// PhoneNumber is in E.164 while OriginalPhoneNumber keep it as the user wrote it
+	PhoneNumber         string
+	OriginalPhoneNumber string
+	Password            string
+	DateOfBirth         time.Time
+	Cityzenship         string
+	PlaceOfBirth        string
+	IsAdmin             bool
+	Disabled            bool
+	// ExternalID is id of the user in the system provisioning it through SCIM
+	ExternalID string `gorm:"index"`
+	// Backend is the authentication backend provisioning the user, empty for user registered in users table
+	Backend string `gorm:"not null;default:''"`
+	// KtpNumberIndex and PhoneNumberIndex are blind indexes looking up the encrypted KTP number and phone number,
+	// SealedDateOfBirth is the encrypted date of birth saved instead of DateOfBirth. They are empty when
+	// personal data is not encrypted
+	KtpNumberIndex    string
+	PhoneNumberIndex  string
+	SealedDateOfBirth string
+}
+
+// Client is db definition of an application allowed to call SSO System
+type Client struct {
+	ID         string `gorm:"primary_key"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	SecretHash string
+	Disabled   bool
 }
 
 // APILog is db definition of a Log of API service consume
@@ -33,4 +57,107 @@ type APILog struct {
 	ClientIP       string
 	ClientTools    string
 	Protocol       string
+	// UserID is id of the user logged in when the API is called
+	UserID string `gorm:"index"`
+	// PersonalSalt and PersonalHash keep the chain verifiable once personal data of the log is erased, Redacted
+	// tell the personal data and its salt are erased
+	PersonalSalt string
+	PersonalHash string
+	Redacted     bool
+	PrevHash     string
+	Hash         string
+}
+
+// AuditEvent is db definition of a security relevant event happened in SSO System
+type AuditEvent struct {
+	ID        int `gorm:"primary_key"`
+	Timestamp time.Time
+	Type      string `gorm:"index"`
+	Outcome   string
+	Reason    string
+	ActorID   string `gorm:"index"`
+	SubjectID string `gorm:"index"`
+	ClientID  string
+	ClientIP  string
+	UserAgent string
+	Metadata  string
+	PrevHash  string
+	Hash      string
+}
+
+// LogCheckpoint is db definition of a signed hash of the last chained log at a point of time
+type LogCheckpoint struct {
+	ID        int `gorm:"primary_key"`
+	CreatedAt time.Time
+	LogTable  string `gorm:"index"`
+	LastID    int
+	LastHash  string
+	Signature string
+}
+
+// SigningKey is db definition of a key signing tokens, the newest not retired key of a purpose sign new tokens
+// and retired key still verify tokens until it expires
+type SigningKey struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	Purpose   string `gorm:"index"`
+	Secret    string
+	RetiredAt *time.Time
+	ExpiresAt *time.Time
+}
+
+// Session is db definition of a login of a user from a device, refresh tokens are bound to it
+// and stop working once it is revoked
+type Session struct {
+	ID         string `gorm:"primary_key"`
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UserID     string `gorm:"index"`
+	ClientID   string
+	UserAgent  string
+	IPAddress  string
+	RevokedAt  *time.Time
+}
+
+// ServiceProvider is db definition of a SAML service provider allowed to login users through the identity provider,
+// ID is its entity ID and AttributeMapping is JSON object of SAML attribute name to user field
+type ServiceProvider struct {
+	ID               string `gorm:"primary_key"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Name             string
+	Metadata         string
+	AttributeMapping string
+	Disabled         bool
+}
+
+// IdentityLink is db definition of an account of external OpenID Connect provider linked to a user,
+// Subject is the id of the account given by the provider
+type IdentityLink struct {
+	ID        int `gorm:"primary_key"`
+	CreatedAt time.Time
+	Provider  string
+	Subject   string
+	UserID    string `gorm:"index"`
+	Email     string
+}
+
+// Group is db definition of a group of users provisioned through SCIM
+type Group struct {
+	ID          string `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DisplayName string `gorm:"unique;not null"`
+	ExternalID  string `gorm:"index"`
+}
+
+// TableName of group, groups is a keyword in sqlite
+func (Group) TableName() string {
+	return "user_groups"
+}
+
+// GroupMember is db definition of a user being member of a group
+type GroupMember struct {
+	GroupID string `gorm:"primary_key"`
+	UserID  string `gorm:"primary_key;index"`
 }
@@ -1,34 +1,96 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 var db *gorm.DB //database
 
+// Database driver available
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// SQLiteMemory is SQLite path of database living in memory only, gone when the connection is closed
+const SQLiteMemory = ":memory:"
+
 // Config is db Config for db initiation
 type Config struct {
+	// Driver is DriverPostgres or DriverSQLite, empty means DriverPostgres
+	Driver   string
 	Host     string
 	Username string
 	DBName   string
 	Password string
+	// SSLMode is postgres sslmode, empty means disable
+	SSLMode string
+	// Path is SQLite database file or SQLiteMemory
+	Path string
+	// MigrateOnInit apply pending migrations on Init instead of refusing to start
+	MigrateOnInit bool
 }
 
-// InitPostgre cocnnection start
-func InitPostgre(config *Config) error {
-	dbURI := fmt.Sprintf("host=%s user=%s dbname=%s sslmode=disable password=%s", config.Host, config.Username, config.DBName, config.Password) //Build connection string
-	conn, err := gorm.Open("postgres", dbURI)
+// Init open connection using the driver in config and keep it as the singleton Db,
+// return ErrSchemaNotMigrated when there is a pending migration
+func Init(config *Config) error {
+	conn, err := Open(config)
+	if err != nil {
+		return err
+	}
+	if config.MigrateOnInit {
+		_, err = MigrateUp(conn)
+	} else {
+		err = CheckSchema(conn)
+	}
 	if err != nil {
+		conn.Close()
 		return err
 	}
 	db = conn
-	db.Debug().AutoMigrate(&User{}, &APILog{})
 	return nil
 }
 
+// InitPostgre cocnnection start
+func InitPostgre(config *Config) error {
+	postgresConfig := *config
+	postgresConfig.Driver = DriverPostgres
+	return Init(&postgresConfig)
+}
+
+// Open connection using the driver in config without touching the singleton Db
+func Open(config *Config) (*gorm.DB, error) {
+	switch config.Driver {
+	case "", DriverPostgres:
+		sslMode := config.SSLMode
+		if len(sslMode) == 0 {
+			sslMode = "disable"
+		}
+		dbURI := fmt.Sprintf("host=%s user=%s dbname=%s sslmode=%s password=%s", config.Host, config.Username, config.DBName, sslMode, config.Password) //Build connection string
+		return gorm.Open(DriverPostgres, dbURI)
+	case DriverSQLite:
+		if len(config.Path) == 0 {
+			return nil, errors.New("db: SQLite path must not be empty")
+		}
+		// immediate transaction take the write lock on begin, serializing append to the hash chains,
+		// case sensitive like make path and user agent search behave like postgres
+		conn, err := gorm.Open(DriverSQLite, config.Path+"?_foreign_keys=1&_busy_timeout=5000&_txlock=immediate&_cslike=1")
+		if err != nil {
+			return nil, err
+		}
+		// every connection to memory database is a different database, and sqlite allow one writer only anyway
+		conn.DB().SetMaxOpenConns(1)
+		return conn, nil
+	default:
+		return nil, errors.New("db: unknown driver " + config.Driver)
+	}
+}
+
 // GetDb function for getting the singleton Db
 func GetDb() *gorm.DB {
 	return db
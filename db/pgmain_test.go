@@ -15,12 +15,16 @@ import (
 
 func dbTestConfig() *db.Config {
 	return &db.Config{
-		Host:     environments.Get("HOST_DB"),
-		Username: environments.Get("USERNAME_DB"),
-		DBName:   environments.Get("DB_NAME"),
-		Password: environments.Get("PASSWORD_DB"),
+		Host:          environments.Get("HOST_DB"),
+		Username:      environments.Get("USERNAME_DB"),
+		DBName:        environments.Get("DB_NAME"),
+		Password:      environments.Get("PASSWORD_DB"),
+		MigrateOnInit: true,
 	}
 }
+func sqliteTestConfig() *db.Config {
+	return &db.Config{Driver: db.DriverSQLite, Path: db.SQLiteMemory, MigrateOnInit: true}
+}
 func setupTestCase(t *testing.T) func(t *testing.T) {
 	environments.Set("RELEASE_TYPE", "localhost")
 	_, filename, _, _ := runtime.Caller(0)
@@ -30,6 +34,9 @@ func setupTestCase(t *testing.T) func(t *testing.T) {
 		panic(err)
 	}
 	environments.LoadEnvironmentVariableFile()
+	if len(environments.Get("HOST_DB")) == 0 {
+		t.Skip("HOST_DB is not configured, skipping test against live database")
+	}
 	return func(t *testing.T) {
 		os.Clearenv()
 	}
@@ -50,6 +57,29 @@ func TestGetDbSuccess(t *testing.T) {
 }
 
 func TestInitPostgreFailed(t *testing.T) {
-	err := db.InitPostgre(dbTestConfig())
+	// socket directory that never exists so the result never depend on environment
+	err := db.InitPostgre(&db.Config{Host: "/nonexistent-twincape-socket", Username: "test", DBName: "test"})
 	assert.Error(t, err, "Should return an error")
 }
+
+func TestInitSQLite(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *db.Config
+		isError bool
+	}{
+		{name: "OKMemory", config: sqliteTestConfig()},
+		{name: "OKFile", config: &db.Config{Driver: db.DriverSQLite, Path: path.Join(t.TempDir(), "twincape.db"), MigrateOnInit: true}},
+		{name: "FailedNotMigrated", config: &db.Config{Driver: db.DriverSQLite, Path: db.SQLiteMemory}, isError: true},
+		{name: "FailedEmptyPath", config: &db.Config{Driver: db.DriverSQLite}, isError: true},
+		{name: "FailedUnknownDriver", config: &db.Config{Driver: "mysql"}, isError: true},
+	}
+	for _, tc := range tests {
+		err := db.Init(tc.config)
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+		if err == nil {
+			assert.True(t, db.GetDb().HasTable(&db.User{}), "schema should be migrated in test "+tc.name+" case")
+			db.GetDb().Close()
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrUserNotFound returned when there is no user matching the lookup
+var ErrUserNotFound = errors.New("db: user not found")
+
+// ErrStaleUser returned when the user is updated by someone else since it was read
+var ErrStaleUser = errors.New("db: user is updated since it was read")
+
+// DuplicateUserError returned when saving the user break a unique constraint of users table
+type DuplicateUserError struct {
+	// Column is id, ktp_number, email or phone_number
+	Column string
+}
+
+func (e *DuplicateUserError) Error() string {
+	return "db: user with same " + e.Column + " already exists"
+}
+
+// GormUserRepository is user storage in relational database through gorm
+type GormUserRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormUserRepository create user repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormUserRepository(conn *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{conn: conn}
+}
+
+func (r *GormUserRepository) getDb() (*gorm.DB, error) {
+	return connection(r.conn)
+}
+
+// connection return the connection given or the one opened by Init
+func connection(conn *gorm.DB) (*gorm.DB, error) {
+	if conn != nil {
+		return conn, nil
+	}
+	if db == nil {
+		return nil, ErrNotInitialized
+	}
+	return db, nil
+}
+
+// FindUserByID get user having the id
+func (r *GormUserRepository) FindUserByID(id string) (User, error) {
+	return r.findUser("id = ?", id)
+}
+
+// FindUserWithDeleted get user having the id even when it is deleted
+func (r *GormUserRepository) FindUserWithDeleted(id string) (User, error) {
+	var user User
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return user, err
+	}
+	err = dbInstance.Unscoped().Where("id = ?", id).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return User{}, ErrUserNotFound
+	}
+	if err == nil {
+		err = openUser(&user)
+	}
+	return user, err
+}
+
+// NormalizeEmail give the email as it is saved, emails are unique regardless of case
+// so they are saved lowercased and looked up by the lowercased email
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// FindUserByEmail get user having the email in any case
+func (r *GormUserRepository) FindUserByEmail(email string) (User, error) {
+	return r.findUser("email = ?", NormalizeEmail(email))
+}
+
+// FindUserByPhoneNumber get user having the phone number in E.164
+func (r *GormUserRepository) FindUserByPhoneNumber(phoneNumber string) (User, error) {
+	condition, values := lookupCondition("phone_number", phoneNumber)
+	return r.findUser(condition, values...)
+}
+
+func (r *GormUserRepository) findUser(condition string, values ...interface{}) (User, error) {
+	var user User
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return user, err
+	}
+	err = dbInstance.Where(condition, values...).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return User{}, ErrUserNotFound
+	}
+	if err == nil {
+		err = openUser(&user)
+	}
+	return user, err
+}
+
+// IsUserIDUsed tell there is a user having the id, deleted user keep its id
+func (r *GormUserRepository) IsUserIDUsed(id string) (bool, error) {
+	return r.isUsed(true, "id = ?", id)
+}
+
+// IsKtpNumberUsed tell there is a user having the KTP number, deleted user keep its KTP number
+// since the column is unique
+func (r *GormUserRepository) IsKtpNumberUsed(ktpNumber string) (bool, error) {
+	condition, values := lookupCondition("ktp_number", ktpNumber)
+	return r.isUsed(true, condition, values...)
+}
+
+// IsEmailUsed tell there is a user having the email in any case
+func (r *GormUserRepository) IsEmailUsed(email string) (bool, error) {
+	return r.isUsed(false, "email = ?", NormalizeEmail(email))
+}
+
+// IsPhoneNumberUsed tell there is a user having the phone number
+func (r *GormUserRepository) IsPhoneNumberUsed(phoneNumber string) (bool, error) {
+	condition, values := lookupCondition("phone_number", phoneNumber)
+	return r.isUsed(false, condition, values...)
+}
+
+func (r *GormUserRepository) isUsed(withDeleted bool, condition string, values ...interface{}) (bool, error) {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return false, err
+	}
+	if withDeleted {
+		dbInstance = dbInstance.Unscoped()
+	}
+	var existingUserCount int
+	err = dbInstance.Model(&User{}).Where(condition, values...).Count(&existingUserCount).Error
+	return existingUserCount > 0, err
+}
+
+// UserQuery is filter to search users, zero value field is not filtered
+type UserQuery struct {
+	Email      string
+	ExternalID string
+	Offset     int
+	// Limit of users returned, zero means only counting the users
+	Limit int
+}
+
+// FindUsers get users matching the query, the oldest first, with the number of users matching it
+func (r *GormUserRepository) FindUsers(query UserQuery) ([]User, int, error) {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return nil, 0, err
+	}
+	search := dbInstance.Model(&User{})
+	if len(query.Email) > 0 {
+		search = search.Where("email = ?", NormalizeEmail(query.Email))
+	}
+	if len(query.ExternalID) > 0 {
+		search = search.Where("external_id = ?", query.ExternalID)
+	}
+	var total int
+	if err := search.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	users := []User{}
+	if query.Limit > 0 {
+		err = search.Order("created_at, id").Offset(query.Offset).Limit(query.Limit).Find(&users).Error
+	}
+	if err == nil {
+		err = openUsers(users)
+	}
+	return users, total, err
+}
+
+// FindUsersToNormalizePhone get users having phone number but no original phone number,
+// they are saved before phone numbers were normalized
+func (r *GormUserRepository) FindUsersToNormalizePhone(limit int) ([]User, error) {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	err = dbInstance.Where("(original_phone_number IS NULL OR original_phone_number = '') AND phone_number <> ''").
+		Order("id").Limit(limit).Find(&users).Error
+	if err == nil {
+		err = openUsers(users)
+	}
+	return users, err
+}
+
+// CreateUser insert new user with its email normalized and its personal data sealed when a field cipher is set
+func (r *GormUserRepository) CreateUser(user *User) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	user.Email = NormalizeEmail(user.Email)
+	sealed, err := sealUser(*user)
+	if err != nil {
+		return err
+	}
+	err = translateUserError(dbInstance.Create(&sealed).Error)
+	user.CreatedAt, user.UpdatedAt = sealed.CreatedAt, sealed.UpdatedAt
+	return err
+}
+
+// RegisterUser insert new user with its email normalized and id given by newID in a transaction,
+// newID is called again while the id is used by another user up to attempts times
+func (r *GormUserRepository) RegisterUser(user *User, newID func() (string, error), attempts int) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	user.Email = NormalizeEmail(user.Email)
+	sealed := *user
+	defer func() {
+		user.ID, user.CreatedAt, user.UpdatedAt = sealed.ID, sealed.CreatedAt, sealed.UpdatedAt
+	}()
+	return dbInstance.Transaction(func(tx *gorm.DB) error {
+		for attempt := 1; ; attempt++ {
+			if user.ID, err = newID(); err != nil {
+				return err
+			}
+			// personal data is sealed with the id of the user, so it is sealed again for every id tried
+			if sealed, err = sealUser(*user); err != nil {
+				return err
+			}
+			// failed statement abort the postgres transaction, rolling back to the savepoint allow the retry
+			if err := tx.Exec("SAVEPOINT register_user").Error; err != nil {
+				return err
+			}
+			err = translateUserError(tx.Create(&sealed).Error)
+			var duplicate *DuplicateUserError
+			if !errors.As(err, &duplicate) || duplicate.Column != "id" || attempt >= attempts {
+				return err
+			}
+			if err := tx.Exec("ROLLBACK TO SAVEPOINT register_user").Error; err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// UpdatePassword replace hashed password of the user having the id
+func (r *GormUserRepository) UpdatePassword(id string, password string) error {
+	return r.updateUser(id, map[string]interface{}{"password": password})
+}
+
+// SetUserDisabled disable or enable the user having the id
+func (r *GormUserRepository) SetUserDisabled(id string, disabled bool) error {
+	return r.updateUser(id, map[string]interface{}{"disabled": disabled})
+}
+
+// SetPhoneNumber replace phone number of the user having the id with the original phone number it is written from
+func (r *GormUserRepository) SetPhoneNumber(id string, phoneNumber string, originalPhoneNumber string) error {
+	sealed, err := sealUser(User{ID: id, PhoneNumber: phoneNumber, OriginalPhoneNumber: originalPhoneNumber})
+	if err != nil {
+		return err
+	}
+	return r.updateUser(id, map[string]interface{}{"phone_number": sealed.PhoneNumber,
+		"original_phone_number": sealed.OriginalPhoneNumber, "phone_number_index": sealed.PhoneNumberIndex})
+}
+
+// UpdateUser replace profile of the user with its email normalized, password and administrator flag are kept
+func (r *GormUserRepository) UpdateUser(user *User) error {
+	fields, err := profileFields(user)
+	if err != nil {
+		return err
+	}
+	return r.updateUser(user.ID, fields)
+}
+
+// UpdateProfile replace profile of the user as UpdateUser only when it is not updated since updatedAt,
+// ErrStaleUser is returned otherwise
+func (r *GormUserRepository) UpdateProfile(user *User, updatedAt time.Time) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	fields, err := profileFields(user)
+	if err != nil {
+		return err
+	}
+	updated := dbInstance.Model(&User{}).Where("id = ? AND updated_at = ?", user.ID, updatedAt).UpdateColumns(fields)
+	if updated.Error != nil {
+		return translateUserError(updated.Error)
+	}
+	if updated.RowsAffected == 0 {
+		if _, err := r.FindUserByID(user.ID); err != nil {
+			return err
+		}
+		return ErrStaleUser
+	}
+	return nil
+}
+
+// profileFields give the columns replaced by UpdateUser with personal data sealed, updated time of the user is set to now
+func profileFields(user *User) (map[string]interface{}, error) {
+	user.UpdatedAt = updatedNow()
+	user.Email = NormalizeEmail(user.Email)
+	sealed, err := sealUser(*user)
+	if err != nil {
+		return nil, err
+	}
+	fields := sealedFields(sealed)
+	fields["updated_at"] = sealed.UpdatedAt
+	fields["name"] = sealed.Name
+	fields["gender"] = sealed.Gender
+	fields["email"] = sealed.Email
+	fields["cityzenship"] = sealed.Cityzenship
+	fields["disabled"] = sealed.Disabled
+	fields["external_id"] = sealed.ExternalID
+	return fields, nil
+}
+
+// DeleteUser delete the user having the id, the user is kept with deleted time
+// so logs and sessions still refer to it
+func (r *GormUserRepository) DeleteUser(id string) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	deleted := dbInstance.Where("id = ?", id).Delete(&User{})
+	if deleted.Error == nil && deleted.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return deleted.Error
+}
+
+// PurgeUser remove the row of the user having the id, deleted user included. It is only for user nothing refer to yet,
+// such as user whose registration failed after it is saved
+func (r *GormUserRepository) PurgeUser(id string) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	purged := dbInstance.Unscoped().Where("id = ?", id).Delete(&User{})
+	if purged.Error == nil && purged.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return purged.Error
+}
+
+// ErasedKtpNumber give the KTP number saved for the erased user having the id, KTP number is unique and not null
+func ErasedKtpNumber(id string) string {
+	return "erased:" + id
+}
+
+// IsErased tell the user is anonymized by EraseUser
+func (u User) IsErased() bool {
+	return u.KtpNumber == ErasedKtpNumber(u.ID)
+}
+
+// EraseUser anonymize the user having the id, deleted user included. Its personal data is emptied, it can no longer
+// login and it is deleted, while its row and id are kept so sessions, logs and audit events still refer to it
+func (r *GormUserRepository) EraseUser(id string) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	now := updatedNow()
+	erased := dbInstance.Unscoped().Model(&User{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"updated_at":            now,
+		"deleted_at":            gorm.Expr("COALESCE(deleted_at, ?)", now),
+		"name":                  "",
+		"gender":                "",
+		"email":                 "",
+		"ktp_number":            ErasedKtpNumber(id),
+		"address":               "",
+		"phone_number":          "",
+		"original_phone_number": "",
+		"password":              "",
+		"date_of_birth":         time.Time{},
+		"cityzenship":           "",
+		"place_of_birth":        "",
+		"is_admin":              false,
+		"disabled":              true,
+		"external_id":           "",
+		"ktp_number_index":      "",
+		"phone_number_index":    "",
+		"sealed_date_of_birth":  "",
+	})
+	if erased.Error == nil && erased.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return erased.Error
+}
+
+func (r *GormUserRepository) updateUser(id string, fields map[string]interface{}) error {
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return err
+	}
+	if _, ok := fields["updated_at"]; !ok {
+		fields["updated_at"] = updatedNow()
+	}
+	// UpdateColumns save the updated time given instead of the one gorm would set
+	updated := dbInstance.Model(&User{}).Where("id = ?", id).UpdateColumns(fields)
+	if updated.Error == nil && updated.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return translateUserError(updated.Error)
+}
+
+// updatedNow give updated time of users, postgres keep microseconds so the time given back to clients
+// is the one saved
+func updatedNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// userUniqueConstraints is the column guarded by each unique constraint of users table, by the constraint
+// name postgres gives or by the table.column or index name sqlite gives
+var userUniqueConstraints = map[string]string{
+	"users_pkey":                    "id",
+	"users.id":                      "id",
+	"users_ktp_number_key":          "ktp_number",
+	"users.ktp_number":              "ktp_number",
+	"idx_users_email_unique":        "email",
+	"idx_users_phone_number_unique": "phone_number",
+	"users.phone_number":            "phone_number",
+	// blind indexes guard uniqueness of encrypted KTP numbers and phone numbers
+	"idx_users_ktp_number_index_unique":   "ktp_number",
+	"users.ktp_number_index":              "ktp_number",
+	"idx_users_phone_number_index_unique": "phone_number",
+	"users.phone_number_index":            "phone_number",
+}
+
+// translateUserError give *DuplicateUserError for the error of breaking a unique constraint of users table,
+// other errors are given as they are
+func translateUserError(err error) error {
+	var constraint string
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		constraint = pqErr.Constraint
+	case errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey):
+		// the message is "UNIQUE constraint failed: users.ktp_number" or "... failed: index 'idx_users_email_unique'"
+		message := sqliteErr.Error()
+		constraint = strings.Trim(message[strings.LastIndex(message, " ")+1:], "'")
+	default:
+		return err
+	}
+	if column, ok := userUniqueConstraints[constraint]; ok {
+		return &DuplicateUserError{Column: column}
+	}
+	return err
+}
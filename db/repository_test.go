@@ -0,0 +1,530 @@
+package db_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/fieldcrypt"
+)
+
+func TestGormUserRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	users := db.NewGormUserRepository(nil)
+
+	testUser := db.User{ID: "testid", Email: "test@test.com", KtpNumber: "1111", PhoneNumber: "+6281200000000"}
+	assert.Nil(t, users.CreateUser(&testUser), "Should return nil because there is no error")
+	found, err := users.FindUserByEmail("Test@Test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", found.ID, "email should be found in any case")
+	_, err = users.FindUserByID("unknown")
+	assert.Equal(t, db.ErrUserNotFound, err, "unknown user should not be found")
+	isUsed, err := users.IsUserIDUsed("testid")
+	assert.Nil(t, err)
+	assert.True(t, isUsed, "user ID should be used")
+	isUsed, err = users.IsKtpNumberUsed("1111")
+	assert.Nil(t, err)
+	assert.True(t, isUsed, "KTP number should be used")
+	isUsed, _ = users.IsPhoneNumberUsed("+6211111111111")
+	assert.False(t, isUsed, "phone number should not be used")
+	assert.Equal(t, &db.DuplicateUserError{Column: "ktp_number"}, users.CreateUser(&db.User{ID: "otherid", KtpNumber: "1111"}),
+		"same KTP number should be rejected")
+
+	assert.Nil(t, users.UpdatePassword("testid", "newhash"))
+	assert.Nil(t, users.SetUserDisabled("testid", true))
+	found, _ = users.FindUserByID("testid")
+	assert.Equal(t, "newhash", found.Password, "password should be updated")
+	assert.True(t, found.Disabled, "user should be disabled")
+	assert.Equal(t, db.ErrUserNotFound, users.UpdatePassword("unknown", "newhash"), "unknown user should not be updated")
+
+	found.Name = "changed"
+	found.ExternalID = "hr-1"
+	assert.Nil(t, users.UpdateUser(&found))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "otherid", Email: "other@test.com", KtpNumber: "2222"}))
+	listed, total, err := users.FindUsers(db.UserQuery{ExternalID: "hr-1", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total, "only user having the external id should be counted")
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, "changed", listed[0].Name, "profile should be updated")
+		assert.Equal(t, "newhash", listed[0].Password, "password should be kept")
+	}
+	listed, total, _ = users.FindUsers(db.UserQuery{Offset: 1, Limit: 10})
+	assert.Equal(t, 2, total)
+	assert.Len(t, listed, 1, "offset should be applied")
+
+	assert.Equal(t, &db.DuplicateUserError{Column: "email"}, users.CreateUser(&db.User{ID: "sameemailid", Email: "TEST@test.com", KtpNumber: "3333"}),
+		"same email in other case should be rejected")
+	assert.Equal(t, &db.DuplicateUserError{Column: "phone_number"}, users.CreateUser(&db.User{ID: "samephoneid", Email: "phone@test.com", KtpNumber: "3333",
+		PhoneNumber: "+6281200000000"}), "same phone number should be rejected")
+	other, _ := users.FindUserByID("otherid")
+	other.Email = "Test@test.com"
+	assert.Equal(t, &db.DuplicateUserError{Column: "email"}, users.UpdateUser(&other), "changing to email of another user should be rejected")
+
+	assert.Nil(t, users.DeleteUser("testid"))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "newid", Email: "Test@Test.com", KtpNumber: "3333", PhoneNumber: "+6281200000000"}),
+		"email and phone number of deleted user should be free")
+	found, _ = users.FindUserByID("newid")
+	assert.Equal(t, "test@test.com", found.Email, "email should be saved lowercased")
+	_, err = users.FindUserByID("testid")
+	assert.Equal(t, db.ErrUserNotFound, err, "deleted user should not be found")
+	isUsed, _ = users.IsKtpNumberUsed("1111")
+	assert.True(t, isUsed, "KTP number of deleted user should stay used")
+	assert.Equal(t, db.ErrUserNotFound, users.DeleteUser("testid"), "deleted user should not be deleted again")
+}
+
+func TestGormUserRepositoryRegisterUser(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	users := db.NewGormUserRepository(nil)
+	assert.Nil(t, users.CreateUser(&db.User{ID: "usedid", Email: "test@test.com", KtpNumber: "1111"}))
+	newIDs := func(ids ...string) func() (string, error) {
+		return func() (string, error) {
+			id := ids[0]
+			ids = ids[1:]
+			return id, nil
+		}
+	}
+
+	user := db.User{Email: "Other@Test.com", KtpNumber: "2222"}
+	assert.Nil(t, users.RegisterUser(&user, newIDs("usedid", "usedid", "newid"), 3), "used id should be generated again")
+	assert.Equal(t, "newid", user.ID)
+	found, err := users.FindUserByID("newid")
+	assert.Nil(t, err, "user should be saved after the id is generated again")
+	assert.Equal(t, "other@test.com", found.Email, "email should be saved lowercased")
+
+	assert.Equal(t, &db.DuplicateUserError{Column: "id"},
+		users.RegisterUser(&db.User{KtpNumber: "3333"}, newIDs("usedid", "newid"), 2), "attempts should be limited")
+	assert.Equal(t, &db.DuplicateUserError{Column: "email"},
+		users.RegisterUser(&db.User{Email: "TEST@test.com", KtpNumber: "3333"}, newIDs("thirdid"), 3))
+	assert.Equal(t, &db.DuplicateUserError{Column: "ktp_number"},
+		users.RegisterUser(&db.User{KtpNumber: "1111"}, newIDs("thirdid"), 3))
+	_, err = users.FindUserByID("thirdid")
+	assert.Equal(t, db.ErrUserNotFound, err, "rejected user should not be saved")
+}
+
+func TestGormUserRepositoryUpdateProfile(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	users := db.NewGormUserRepository(nil)
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", Email: "test@test.com", KtpNumber: "1111"}))
+
+	read, _ := users.FindUserByID("testid")
+	changed := read
+	changed.Name = "changed"
+	assert.Nil(t, users.UpdateProfile(&changed, read.UpdatedAt), "user not updated since read should be updated")
+	assert.True(t, changed.UpdatedAt.After(read.UpdatedAt), "updated time should be given back")
+
+	stale := read
+	stale.Name = "stale"
+	assert.Equal(t, db.ErrStaleUser, users.UpdateProfile(&stale, read.UpdatedAt), "user updated since read should not be updated")
+	found, _ := users.FindUserByID("testid")
+	assert.Equal(t, "changed", found.Name, "stale update should not be saved")
+	assert.True(t, found.UpdatedAt.Equal(changed.UpdatedAt), "updated time given back should be the one saved")
+
+	found.Name = "again"
+	assert.Nil(t, users.UpdateProfile(&found, found.UpdatedAt), "user read again should be updated")
+	unknown := db.User{ID: "unknown"}
+	assert.Equal(t, db.ErrUserNotFound, users.UpdateProfile(&unknown, time.Time{}))
+}
+
+func TestGormUserRepositoryPhoneNumbers(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	users := db.NewGormUserRepository(nil)
+
+	assert.Nil(t, users.CreateUser(&db.User{ID: "legacyid", KtpNumber: "1111", PhoneNumber: "0812 0000 0000"}))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", KtpNumber: "2222", PhoneNumber: "+6281200000001",
+		OriginalPhoneNumber: "0812-0000-0001"}))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "nophoneid", KtpNumber: "3333"}))
+	found, err := users.FindUsersToNormalizePhone(10)
+	assert.Nil(t, err)
+	if assert.Len(t, found, 1, "only user having phone number without original should be normalized") {
+		assert.Equal(t, "legacyid", found[0].ID)
+	}
+
+	assert.Nil(t, users.SetPhoneNumber("legacyid", "+6281200000000", "0812 0000 0000"))
+	user, err := users.FindUserByPhoneNumber("+6281200000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacyid", user.ID)
+	assert.Equal(t, "0812 0000 0000", user.OriginalPhoneNumber, "original phone number should be kept")
+	found, _ = users.FindUsersToNormalizePhone(10)
+	assert.Empty(t, found, "normalized user should not be normalized again")
+	_, err = users.FindUserByPhoneNumber("0812 0000 0000")
+	assert.Equal(t, db.ErrUserNotFound, err, "user should be found only by phone number in E.164")
+}
+
+func TestGormUserErasure(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	users := db.NewGormUserRepository(nil)
+	sessions := db.NewGormSessionRepository(nil)
+	links := db.NewGormIdentityLinkRepository(nil)
+	groups := db.NewGormGroupRepository(nil)
+	dateOfBirth, _ := time.Parse("2006-01-02", "1990-05-15")
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "1111",
+		PhoneNumber: "+6281200000000", Password: "hash", DateOfBirth: dateOfBirth, IsAdmin: true, ExternalID: "hr-1"}))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "deletedid", Email: "deleted@test.com", KtpNumber: "2222"}))
+	assert.Nil(t, users.DeleteUser("deletedid"))
+	now := time.Now()
+	assert.Nil(t, sessions.CreateSession(&db.Session{ID: "active", UserID: "testid", CreatedAt: now, LastUsedAt: now,
+		UserAgent: "test-agent", IPAddress: "10.0.0.1"}))
+	assert.Nil(t, sessions.CreateSession(&db.Session{ID: "otheruser", UserID: "otherid", CreatedAt: now, LastUsedAt: now}))
+	assert.Nil(t, links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "testid", Email: "test@test.com"}))
+	assert.Nil(t, groups.CreateGroup(&db.Group{ID: "groupid", DisplayName: "Staff"}))
+	assert.Nil(t, groups.AddGroupMembers("groupid", []string{"testid"}))
+
+	found, err := users.FindUserWithDeleted("deletedid")
+	assert.Nil(t, err, "deleted user should be found")
+	assert.Equal(t, "deleted@test.com", found.Email)
+	userSessions, _ := sessions.FindSessionsOfUser("testid")
+	assert.Len(t, userSessions, 1)
+	userLinks, _ := links.FindIdentityLinksOfUser("testid")
+	assert.Len(t, userLinks, 1)
+	userGroups, err := groups.FindGroupsOfUser("testid")
+	assert.Nil(t, err)
+	if assert.Len(t, userGroups, 1) {
+		assert.Equal(t, "Staff", userGroups[0].DisplayName)
+	}
+
+	erased, err := sessions.EraseUserSessions("testid")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), erased)
+	session, _ := sessions.FindSessionByID("active")
+	assert.NotNil(t, session.RevokedAt, "session of erased user should be revoked")
+	assert.Empty(t, session.UserAgent+session.IPAddress, "device and IP address of session should be erased")
+	session, _ = sessions.FindSessionByID("otheruser")
+	assert.Nil(t, session.RevokedAt, "session of other user should stay active")
+	deleted, err := links.DeleteIdentityLinksOfUser("testid")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	assert.Nil(t, users.EraseUser("testid"))
+	_, err = users.FindUserByID("testid")
+	assert.Equal(t, db.ErrUserNotFound, err, "erased user should be deleted")
+	found, _ = users.FindUserWithDeleted("testid")
+	assert.True(t, found.IsErased())
+	assert.True(t, found.Disabled, "erased user should not login")
+	assert.False(t, found.IsAdmin, "erased user should not be administrator")
+	assert.Empty(t, found.Name+found.Email+found.PhoneNumber+found.Password+found.ExternalID, "personal data should be erased")
+	assert.True(t, found.DateOfBirth.IsZero())
+	isUsed, _ := users.IsKtpNumberUsed("1111")
+	assert.False(t, isUsed, "KTP number of erased user should be free")
+	assert.Nil(t, users.EraseUser("deletedid"), "deleted user should be erased")
+	assert.Nil(t, users.EraseUser("testid"), "erased user should be erased again")
+	assert.Equal(t, db.ErrUserNotFound, users.EraseUser("unknown"))
+}
+
+// testFieldCipher create cipher whose current key version is the last of versions, every version has its own key
+func testFieldCipher(t *testing.T, versions ...string) *fieldcrypt.Cipher {
+	key := func(b byte) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), fieldcrypt.KeySize)))
+	}
+	keys := []string{}
+	for i, version := range versions {
+		keys = append(keys, `"`+version+`":"`+key(byte('a'+i))+`"`)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"current":"` + versions[len(versions)-1] + `","keys":{` + strings.Join(keys, ",") + `},"indexKey":"` + key('i') + `"}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := fieldcrypt.NewCipher(fieldcrypt.FileKeyProvider{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestGormUserRepositoryFieldEncryption(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	defer db.SetFieldCipher(nil)
+	users := db.NewGormUserRepository(nil)
+	dateOfBirth, _ := time.Parse("2006-01-02", "1990-05-15")
+	assert.Nil(t, users.CreateUser(&db.User{ID: "legacyid", Email: "legacy@test.com", KtpNumber: "1111",
+		PhoneNumber: "+6281200000000", Address: "jalan lama", DateOfBirth: dateOfBirth}))
+
+	db.SetFieldCipher(testFieldCipher(t, "1"))
+	user := db.User{ID: "testid", Email: "test@test.com", KtpNumber: "2222", PhoneNumber: "+6281200000001",
+		OriginalPhoneNumber: "0812-0000-0001", Address: "jalan test", PlaceOfBirth: "Bandung", DateOfBirth: dateOfBirth}
+	assert.Nil(t, users.CreateUser(&user))
+	assert.Equal(t, "2222", user.KtpNumber, "user given should be kept as plaintext")
+	var saved db.User
+	assert.Nil(t, db.GetDb().Where("id = ?", "testid").First(&saved).Error)
+	for _, value := range []string{saved.KtpNumber, saved.PhoneNumber, saved.OriginalPhoneNumber, saved.Address,
+		saved.PlaceOfBirth, saved.SealedDateOfBirth} {
+		assert.True(t, strings.HasPrefix(value, "enc:1:"), "personal data should be saved encrypted")
+	}
+	assert.True(t, saved.DateOfBirth.IsZero(), "date of birth should be saved encrypted only")
+	assert.Equal(t, "test@test.com", saved.Email, "email should stay searchable")
+
+	found, err := users.FindUserByID("testid")
+	assert.Nil(t, err)
+	assert.Equal(t, user.KtpNumber, found.KtpNumber)
+	assert.Equal(t, user.OriginalPhoneNumber, found.OriginalPhoneNumber)
+	assert.Equal(t, user.Address, found.Address)
+	assert.Equal(t, user.PlaceOfBirth, found.PlaceOfBirth)
+	assert.True(t, dateOfBirth.Equal(found.DateOfBirth), "date of birth should be decrypted")
+	found, err = users.FindUserByPhoneNumber("+6281200000001")
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", found.ID, "encrypted phone number should be found by its blind index")
+	found, err = users.FindUserByPhoneNumber("+6281200000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacyid", found.ID, "plaintext phone number should still be found")
+	isUsed, _ := users.IsKtpNumberUsed("2222")
+	assert.True(t, isUsed, "encrypted KTP number should be used")
+	isUsed, _ = users.IsKtpNumberUsed("1111")
+	assert.True(t, isUsed, "plaintext KTP number should be used")
+	assert.Equal(t, &db.DuplicateUserError{Column: "ktp_number"}, users.CreateUser(&db.User{ID: "sameid", KtpNumber: "2222"}),
+		"same encrypted KTP number should be rejected")
+	assert.Equal(t, &db.DuplicateUserError{Column: "phone_number"}, users.CreateUser(&db.User{ID: "sameid", KtpNumber: "3333",
+		PhoneNumber: "+6281200000001"}), "same encrypted phone number should be rejected")
+
+	found, _ = users.FindUserByID("testid")
+	found.Address = "jalan baru"
+	assert.Nil(t, users.UpdateProfile(&found, found.UpdatedAt))
+	found, _ = users.FindUserByID("testid")
+	assert.Equal(t, "jalan baru", found.Address, "updated profile should be encrypted and decrypted")
+
+	result, err := users.SealUsers("", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Sealed, "only plaintext user should be encrypted")
+	result, _ = users.SealUsers(result.LastID, 10)
+	assert.Equal(t, 0, result.Sealed, "encrypted users should not be encrypted again")
+	var legacy db.User
+	assert.Nil(t, db.GetDb().Where("id = ?", "legacyid").First(&legacy).Error)
+	assert.True(t, strings.HasPrefix(legacy.KtpNumber, "enc:1:"), "plaintext user should be encrypted")
+	found, err = users.FindUserByPhoneNumber("+6281200000000")
+	assert.Nil(t, err)
+	assert.Equal(t, "jalan lama", found.Address, "encrypted user should be decrypted")
+
+	db.SetFieldCipher(testFieldCipher(t, "1", "2"))
+	found, err = users.FindUserByID("testid")
+	assert.Nil(t, err, "user encrypted by retired key should be decrypted")
+	result, _ = users.SealUsers("", 10)
+	assert.Equal(t, 2, result.Sealed, "users encrypted by retired key should be encrypted by current key")
+	isUsed, _ = users.IsKtpNumberUsed("2222")
+	assert.True(t, isUsed, "blind index should not change by key rotation")
+
+	db.SetFieldCipher(nil)
+	_, err = users.FindUserByID("testid")
+	assert.Equal(t, db.ErrNoFieldCipher, err, "encrypted user should not be read without key")
+}
+
+func TestGormUserRepositorySealedValueSwap(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	defer db.SetFieldCipher(nil)
+	db.SetFieldCipher(testFieldCipher(t, "1"))
+	users := db.NewGormUserRepository(nil)
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", Email: "test@test.com", KtpNumber: "1111",
+		PhoneNumber: "+6281200000000", Address: "jalan test"}))
+	registered := db.User{Email: "other@test.com", KtpNumber: "2222", PhoneNumber: "+6281200000001", Address: "jalan lain"}
+	ids := []string{"testid", "otherid"}
+	newID := func() (string, error) {
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}
+	assert.Nil(t, users.RegisterUser(&registered, newID, 2))
+	found, err := users.FindUserByID("otherid")
+	assert.Nil(t, err, "user registered after its id is retried should be decrypted")
+	assert.Equal(t, "jalan lain", found.Address)
+
+	var saved db.User
+	assert.Nil(t, db.GetDb().Where("id = ?", "testid").First(&saved).Error)
+	assert.Nil(t, db.GetDb().Model(&db.User{}).Where("id = ?", "otherid").
+		UpdateColumns(map[string]interface{}{"address": saved.Address}).Error)
+	_, err = users.FindUserByID("otherid")
+	assert.Equal(t, fieldcrypt.ErrDecryptionFailed, err, "value moved from another user should not be decrypted")
+}
+
+func TestGormLogRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	logs := db.NewGormLogRepository(nil)
+
+	apiLogs := []db.APILog{
+		{Timestamp: time.Now().Add(-time.Hour), ResponseStatus: 200, Path: "/api/auth/login", Method: "POST"},
+		{Timestamp: time.Now(), ResponseStatus: 401, Path: "/api/auth/login", Method: "POST"},
+	}
+	assert.Nil(t, logs.CreateAPILogs(apiLogs))
+	assert.Equal(t, apiLogs[0].Hash, apiLogs[1].PrevHash, "log should be linked to the one before it")
+
+	found, err := logs.SearchAPILogs(db.APILogQuery{Path: "/api/auth", PathPrefix: true, Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, found, 1, "limit should be applied")
+	assert.Equal(t, 401, found[0].ResponseStatus, "newest log should be first")
+	// time saved as text in sqlite must still be compared correctly from another time zone
+	found, err = logs.SearchAPILogs(db.APILogQuery{From: time.Now().In(time.FixedZone("WIB", 7*60*60)).Add(-time.Minute)})
+	assert.Nil(t, err)
+	assert.Len(t, found, 1, "only the recent log should be found")
+	statusCounts, err := logs.CountAPILogsByStatus(db.APILogQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, statusCounts, 2)
+
+	limit, err := logs.FindPurgeLimit(time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, limit, "logs not checkpointed should not be purged")
+	db.GetDb().Create(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 1, LastHash: apiLogs[0].Hash})
+	db.GetDb().Create(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 2, LastHash: apiLogs[1].Hash})
+	limit, err = logs.FindPurgeLimit(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, limit, "the last log should be kept")
+	deleted, err := logs.DeleteAPILogs(limit, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted, "only the log up to the limit should be deleted")
+	assert.Nil(t, logs.CreateAuditEvent(&db.AuditEvent{Timestamp: time.Now(), Type: "login_success"}))
+}
+
+func TestGormClientRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	clients := db.NewGormClientRepository(nil)
+
+	testClient := db.Client{ID: "testclient", Name: "test", SecretHash: db.HashClientSecret("testsecret")}
+	assert.Nil(t, clients.CreateClient(&testClient))
+	found, err := clients.FindClientByID("testclient")
+	assert.Nil(t, err)
+	assert.True(t, found.VerifySecret("testsecret"), "secret of the client should be verified")
+	assert.False(t, found.VerifySecret("othersecret"), "other secret should be rejected")
+	_, err = clients.FindClientByID("unknown")
+	assert.Equal(t, db.ErrClientNotFound, err, "unknown client should not be found")
+	assert.Error(t, clients.CreateClient(&db.Client{ID: "testclient"}), "same id should be rejected")
+}
+
+func TestGormKeyRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	keys := db.NewGormKeyRepository(nil)
+
+	now := time.Now().UTC()
+	assert.Nil(t, keys.RotateSigningKey(&db.SigningKey{ID: "oldkid", CreatedAt: now.Add(-time.Hour), Purpose: "access", Secret: "old"}, now))
+	assert.Nil(t, keys.RotateSigningKey(&db.SigningKey{ID: "newkid", CreatedAt: now, Purpose: "access", Secret: "new"}, now.Add(time.Hour)))
+	assert.Nil(t, keys.RotateSigningKey(&db.SigningKey{ID: "otherkid", CreatedAt: now, Purpose: "refresh", Secret: "other"}, now))
+
+	found, err := keys.FindSigningKeys("access")
+	assert.Nil(t, err)
+	assert.Len(t, found, 2, "only keys of the purpose should be found")
+	assert.Equal(t, "newkid", found[0].ID, "newest key should be first")
+	assert.Nil(t, found[0].RetiredAt, "new key should be active")
+	assert.NotNil(t, found[1].RetiredAt, "old key should be retired")
+	assert.True(t, found[1].ExpiresAt.Equal(now.Add(time.Hour)), "old key should expire at the time given")
+}
+
+func TestGormSessionRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	sessions := db.NewGormSessionRepository(nil)
+
+	now := time.Now()
+	for _, session := range []db.Session{
+		{ID: "current", UserID: "testid", CreatedAt: now, LastUsedAt: now},
+		{ID: "other", UserID: "testid", CreatedAt: now, LastUsedAt: now.Add(-time.Hour)},
+		{ID: "stale", UserID: "testid", CreatedAt: now, LastUsedAt: now.Add(-48 * time.Hour)},
+		{ID: "otheruser", UserID: "otherid", CreatedAt: now, LastUsedAt: now},
+	} {
+		session := session
+		assert.Nil(t, sessions.CreateSession(&session))
+	}
+	active, err := sessions.FindActiveSessions("testid", now.Add(-24*time.Hour))
+	assert.Nil(t, err)
+	if assert.Len(t, active, 2, "only recently used sessions of the user should be active") {
+		assert.Equal(t, "current", active[0].ID, "last used session should be first")
+	}
+
+	assert.Nil(t, sessions.TouchSession("other", now.Add(time.Minute)))
+	found, err := sessions.FindSessionByID("other")
+	assert.Nil(t, err)
+	assert.True(t, found.LastUsedAt.After(now), "last used time should be updated")
+	_, err = sessions.FindSessionByID("unknown")
+	assert.Equal(t, db.ErrSessionNotFound, err, "unknown session should not be found")
+
+	assert.Equal(t, db.ErrSessionNotFound, sessions.RevokeSession("otherid", "other"), "session of other user should not be revoked")
+	assert.Nil(t, sessions.RevokeSession("testid", "other"))
+	assert.Equal(t, db.ErrSessionNotFound, sessions.RevokeSession("testid", "other"), "revoked session should not be revoked again")
+	revoked, err := sessions.RevokeOtherSessions("testid", "current")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), revoked, "only the stale session should be left to revoke")
+	found, _ = sessions.FindSessionByID("current")
+	assert.Nil(t, found.RevokedAt, "current session should stay active")
+	found, _ = sessions.FindSessionByID("otheruser")
+	assert.Nil(t, found.RevokedAt, "session of other user should stay active")
+}
+
+func TestGormServiceProviderRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	serviceProviders := db.NewGormServiceProviderRepository(nil)
+
+	assert.Nil(t, serviceProviders.SaveServiceProvider(&db.ServiceProvider{ID: "http://sp.test", Name: "test", Metadata: "<old/>"}))
+	saved, err := serviceProviders.FindServiceProviderByID("http://sp.test")
+	assert.Nil(t, err)
+	assert.Nil(t, serviceProviders.SaveServiceProvider(&db.ServiceProvider{ID: "http://sp.test", Name: "test", Metadata: "<new/>"}))
+	found, err := serviceProviders.FindServiceProviderByID("http://sp.test")
+	assert.Nil(t, err)
+	assert.Equal(t, "<new/>", found.Metadata, "saving same entity ID should replace the metadata")
+	assert.True(t, saved.CreatedAt.Equal(found.CreatedAt), "created time should be kept when replaced")
+	_, err = serviceProviders.FindServiceProviderByID("unknown")
+	assert.Equal(t, db.ErrServiceProviderNotFound, err, "unknown service provider should not be found")
+}
+
+func TestGormIdentityLinkRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	links := db.NewGormIdentityLinkRepository(nil)
+
+	assert.Nil(t, links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "testid"}))
+	found, err := links.FindIdentityLink("google", "123")
+	assert.Nil(t, err)
+	assert.Equal(t, "testid", found.UserID)
+	_, err = links.FindIdentityLink("microsoft", "123")
+	assert.Equal(t, db.ErrIdentityLinkNotFound, err, "same subject of other provider should not be found")
+	assert.Error(t, links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "otherid"}),
+		"account of the provider should be linked to one user only")
+}
+
+func TestGormGroupRepository(t *testing.T) {
+	assert.Nil(t, db.Init(sqliteTestConfig()))
+	defer db.GetDb().Close()
+	groups := db.NewGormGroupRepository(nil)
+
+	assert.Nil(t, groups.CreateGroup(&db.Group{ID: "staff", DisplayName: "staff", ExternalID: "hr-staff"}))
+	assert.Nil(t, groups.CreateGroup(&db.Group{ID: "admins", DisplayName: "admins"}))
+	assert.Error(t, groups.CreateGroup(&db.Group{ID: "other", DisplayName: "staff"}), "same display name should be rejected")
+	found, total, err := groups.FindGroups(db.GroupQuery{ExternalID: "hr-staff", Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "staff", found[0].ID)
+	}
+
+	assert.Nil(t, groups.AddGroupMembers("staff", []string{"testid", "otherid"}))
+	assert.Nil(t, groups.AddGroupMembers("staff", []string{"testid"}), "existing member should be skipped")
+	assert.Nil(t, groups.AddGroupMembers("admins", []string{"testid"}))
+	members, err := groups.FindGroupMembers("staff")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"otherid", "testid"}, members)
+	assert.Nil(t, groups.RemoveGroupMembers("staff", []string{"otherid"}))
+	assert.Nil(t, groups.RemoveUserFromGroups("testid"))
+	members, _ = groups.FindGroupMembers("staff")
+	assert.Empty(t, members, "removed members should leave the group")
+	members, _ = groups.FindGroupMembers("admins")
+	assert.Empty(t, members, "user should leave every group")
+
+	assert.Nil(t, groups.UpdateGroup(&db.Group{ID: "staff", DisplayName: "employees"}))
+	group, err := groups.FindGroupByID("staff")
+	assert.Nil(t, err)
+	assert.Equal(t, "employees", group.DisplayName, "display name should be updated")
+	assert.Nil(t, groups.DeleteGroup("staff"))
+	_, err = groups.FindGroupByID("staff")
+	assert.Equal(t, db.ErrGroupNotFound, err, "deleted group should not be found")
+	assert.Equal(t, db.ErrGroupNotFound, groups.DeleteGroup("staff"), "deleted group should not be deleted again")
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/fieldcrypt"
+)
+
+// ErrNoFieldCipher returned when personal data of users is encrypted but no field cipher is set to decrypt it
+var ErrNoFieldCipher = errors.New("db: personal data of users is encrypted but no field key is configured")
+
+// fieldCipher encrypt personal data of users saved by GormUserRepository, nil keep it as plaintext
+var fieldCipher *fieldcrypt.Cipher
+
+// SetFieldCipher set the cipher encrypting personal data of users saved by GormUserRepository,
+// nil save it as plaintext
+func SetFieldCipher(cipher *fieldcrypt.Cipher) {
+	fieldCipher = cipher
+}
+
+// sealedDateLayout is layout of the date of birth before it is encrypted
+const sealedDateLayout = "2006-01-02"
+
+// sealedColumns give the encrypted fields of the user by their column name, the column name and the user id are
+// authenticated with the value so a value moved to another column or another user can not be decrypted
+func sealedColumns(user *User) map[string]*string {
+	return map[string]*string{
+		"ktp_number":            &user.KtpNumber,
+		"address":               &user.Address,
+		"phone_number":          &user.PhoneNumber,
+		"original_phone_number": &user.OriginalPhoneNumber,
+		"place_of_birth":        &user.PlaceOfBirth,
+		"sealed_date_of_birth":  &user.SealedDateOfBirth,
+	}
+}
+
+// sealUser give the user with its personal data encrypted and blind indexed when a field cipher is set, the id
+// of the user must be set before. Date of birth is always sealed even when it is empty, so it tells the key
+// version the user is sealed with
+func sealUser(user User) (User, error) {
+	if fieldCipher == nil {
+		return user, nil
+	}
+	user.KtpNumberIndex = fieldCipher.BlindIndex("ktp_number", user.KtpNumber)
+	user.PhoneNumberIndex = fieldCipher.BlindIndex("phone_number", user.PhoneNumber)
+	user.SealedDateOfBirth = user.DateOfBirth.Format(sealedDateLayout)
+	user.DateOfBirth = time.Time{}
+	for column, value := range sealedColumns(&user) {
+		sealed, err := fieldCipher.Encrypt(column, user.ID, *value)
+		if err != nil {
+			return user, err
+		}
+		*value = sealed
+	}
+	return user, nil
+}
+
+// openUser decrypt personal data of the user read from database, user saved as plaintext is kept as it is
+func openUser(user *User) error {
+	if len(user.SealedDateOfBirth) == 0 {
+		return nil
+	}
+	if fieldCipher == nil {
+		return ErrNoFieldCipher
+	}
+	for column, value := range sealedColumns(user) {
+		opened, err := fieldCipher.Decrypt(column, user.ID, *value)
+		if err != nil {
+			return err
+		}
+		*value = opened
+	}
+	dateOfBirth, err := time.Parse(sealedDateLayout, user.SealedDateOfBirth)
+	if err != nil {
+		return err
+	}
+	user.DateOfBirth, user.SealedDateOfBirth = dateOfBirth, ""
+	return nil
+}
+
+// openUsers decrypt personal data of every user read from database
+func openUsers(users []User) error {
+	for i := range users {
+		if err := openUser(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupCondition give the condition matching users having the value in the column, by its blind index when
+// a field cipher is set. Users saved before the cipher was set are still matched by the plaintext column
+func lookupCondition(column string, value string) (string, []interface{}) {
+	if fieldCipher == nil || len(value) == 0 {
+		return column + " = ?", []interface{}{value}
+	}
+	return "(" + column + "_index = ? OR " + column + " = ?)",
+		[]interface{}{fieldCipher.BlindIndex(column, value), value}
+}
+
+// sealedFields give the columns saving the sealed user, plaintext columns of sealed fields are replaced too
+func sealedFields(user User) map[string]interface{} {
+	fields := map[string]interface{}{
+		"ktp_number_index":     user.KtpNumberIndex,
+		"phone_number_index":   user.PhoneNumberIndex,
+		"sealed_date_of_birth": user.SealedDateOfBirth,
+		"date_of_birth":        user.DateOfBirth,
+	}
+	for column, value := range sealedColumns(&user) {
+		fields[column] = *value
+	}
+	return fields
+}
+
+// SealResult is result of SealUsers
+type SealResult struct {
+	// LastID is id of the last user read, the next call continue after it
+	LastID string
+	Sealed int
+	// Duplicate is id of users whose KTP number or phone number is already used by a user sealed before,
+	// they are kept as plaintext until the duplicate is resolved
+	Duplicate []string
+}
+
+// SealUsers encrypt personal data of up to limit users, ordered by id after afterID, which are saved as
+// plaintext or encrypted by a retired key, deleted users included. User updated while it is sealed is
+// skipped since the update seal it
+func (r *GormUserRepository) SealUsers(afterID string, limit int) (SealResult, error) {
+	result := SealResult{LastID: afterID, Duplicate: []string{}}
+	if fieldCipher == nil {
+		return result, ErrNoFieldCipher
+	}
+	dbInstance, err := r.getDb()
+	if err != nil {
+		return result, err
+	}
+	prefix := fieldCipher.CurrentPrefix()
+	batch := []User{}
+	err = dbInstance.Unscoped().Where("id > ? AND substr(sealed_date_of_birth, 1, ?) <> ?", afterID, len(prefix), prefix).
+		Order("id").Limit(limit).Find(&batch).Error
+	if err != nil {
+		return result, err
+	}
+	for _, user := range batch {
+		result.LastID = user.ID
+		if err := openUser(&user); err != nil {
+			return result, err
+		}
+		sealed, err := sealUser(user)
+		if err != nil {
+			return result, err
+		}
+		updated := dbInstance.Unscoped().Model(&User{}).Where("id = ? AND updated_at = ?", user.ID, user.UpdatedAt).
+			UpdateColumns(sealedFields(sealed))
+		var duplicate *DuplicateUserError
+		switch err := translateUserError(updated.Error); {
+		case errors.As(err, &duplicate):
+			result.Duplicate = append(result.Duplicate, user.ID)
+		case err != nil:
+			return result, err
+		case updated.RowsAffected > 0:
+			result.Sealed++
+		}
+	}
+	return result, nil
+}
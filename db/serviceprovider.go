@@ -0,0 +1,53 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrServiceProviderNotFound returned when there is no service provider having the entity ID
+var ErrServiceProviderNotFound = errors.New("db: service provider not found")
+
+// GormServiceProviderRepository is SAML service provider storage in relational database through gorm
+type GormServiceProviderRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormServiceProviderRepository create service provider repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormServiceProviderRepository(conn *gorm.DB) *GormServiceProviderRepository {
+	return &GormServiceProviderRepository{conn: conn}
+}
+
+// FindServiceProviderByID get service provider having the entity ID
+func (r *GormServiceProviderRepository) FindServiceProviderByID(id string) (ServiceProvider, error) {
+	var serviceProvider ServiceProvider
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return serviceProvider, err
+	}
+	err = dbInstance.Where("id = ?", id).First(&serviceProvider).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ServiceProvider{}, ErrServiceProviderNotFound
+	}
+	return serviceProvider, err
+}
+
+// SaveServiceProvider insert the service provider or replace the one having the same entity ID
+func (r *GormServiceProviderRepository) SaveServiceProvider(serviceProvider *ServiceProvider) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	// save update every field, the created time of the replaced one is kept
+	var existing ServiceProvider
+	err = dbInstance.Select("created_at").Where("id = ?", serviceProvider.ID).First(&existing).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	if err == nil {
+		serviceProvider.CreatedAt = existing.CreatedAt
+	}
+	return dbInstance.Save(serviceProvider).Error
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrSessionNotFound returned when there is no session having the id
+var ErrSessionNotFound = errors.New("db: session not found")
+
+// GormSessionRepository is session storage in relational database through gorm
+type GormSessionRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormSessionRepository create session repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormSessionRepository(conn *gorm.DB) *GormSessionRepository {
+	return &GormSessionRepository{conn: conn}
+}
+
+// CreateSession insert new session
+func (r *GormSessionRepository) CreateSession(session *Session) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	session.CreatedAt = session.CreatedAt.UTC()
+	session.LastUsedAt = session.LastUsedAt.UTC()
+	return dbInstance.Create(session).Error
+}
+
+// FindSessionByID get session having the id, revoked or not
+func (r *GormSessionRepository) FindSessionByID(id string) (Session, error) {
+	var session Session
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return session, err
+	}
+	err = dbInstance.Where("id = ?", id).First(&session).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+// FindActiveSessions get sessions of the user not revoked and used after since, the last used first
+func (r *GormSessionRepository) FindActiveSessions(userID string, since time.Time) ([]Session, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	err = dbInstance.Where("user_id = ? AND revoked_at IS NULL AND last_used_at >= ?", userID, since.UTC()).
+		Order("last_used_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// TouchSession set the time the session was last used
+func (r *GormSessionRepository) TouchSession(id string, usedAt time.Time) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Model(&Session{}).Where("id = ?", id).Update("last_used_at", usedAt.UTC()).Error
+}
+
+// RevokeSession revoke the not revoked session of the user having the id
+func (r *GormSessionRepository) RevokeSession(userID string, id string) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	result := dbInstance.Model(&Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions revoke every not revoked session of the user except the one having exceptID,
+// return the number of sessions revoked
+func (r *GormSessionRepository) RevokeOtherSessions(userID string, exceptID string) (int64, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return 0, err
+	}
+	result := dbInstance.Model(&Session{}).Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now().UTC())
+	return result.RowsAffected, result.Error
+}
+
+// FindSessionsOfUser get every session of the user, revoked ones included, the oldest first
+func (r *GormSessionRepository) FindSessionsOfUser(userID string) ([]Session, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []Session{}
+	err = dbInstance.Where("user_id = ?", userID).Order("created_at, id").Find(&sessions).Error
+	return sessions, err
+}
+
+// EraseUserSessions revoke every session of the user and erase its device and IP address,
+// the sessions are kept so logs still refer to them. Return the number of sessions erased
+func (r *GormSessionRepository) EraseUserSessions(userID string) (int64, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return 0, err
+	}
+	result := dbInstance.Model(&Session{}).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+		"revoked_at": gorm.Expr("COALESCE(revoked_at, ?)", time.Now().UTC()), "user_agent": "", "ip_address": ""})
+	return result.RowsAffected, result.Error
+}
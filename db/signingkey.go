@@ -0,0 +1,47 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// GormKeyRepository is signing key storage in relational database through gorm
+type GormKeyRepository struct {
+	conn *gorm.DB
+}
+
+// NewGormKeyRepository create signing key repository using the connection given,
+// nil connection means using the connection opened by Init
+func NewGormKeyRepository(conn *gorm.DB) *GormKeyRepository {
+	return &GormKeyRepository{conn: conn}
+}
+
+// FindSigningKeys get every key of the purpose including retired and expired ones, the newest first
+func (r *GormKeyRepository) FindSigningKeys(purpose string) ([]SigningKey, error) {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return nil, err
+	}
+	keys := []SigningKey{}
+	err = dbInstance.Where("purpose = ?", purpose).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+// RotateSigningKey retire the active keys of the key purpose, keeping them valid until expiresAt,
+// and insert the key as the new active one
+func (r *GormKeyRepository) RotateSigningKey(key *SigningKey, expiresAt time.Time) error {
+	dbInstance, err := connection(r.conn)
+	if err != nil {
+		return err
+	}
+	return dbInstance.Transaction(func(tx *gorm.DB) error {
+		retiredAt := key.CreatedAt
+		err := tx.Model(&SigningKey{}).Where("purpose = ? AND retired_at IS NULL", key.Purpose).
+			Updates(map[string]interface{}{"retired_at": retiredAt, "expires_at": expiresAt}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(key).Error
+	})
+}
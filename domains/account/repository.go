@@ -0,0 +1,23 @@
+package account
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by account management
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	UpdatePassword(id string, password string) error
+	SetUserDisabled(id string, disabled bool) error
+	FindUserByPhoneNumber(phoneNumber string) (db.User, error)
+	FindUsersToNormalizePhone(limit int) ([]db.User, error)
+	SetPhoneNumber(id string, phoneNumber string, originalPhoneNumber string) error
+	SealUsers(afterID string, limit int) (db.SealResult, error)
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+
+// SetUserRepository replace user storage used by account management
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
@@ -0,0 +1,136 @@
+package account
+
+import (
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/phone"
+)
+
+// ResetPassword replace password of the user with a generated one and return it
+func ResetPassword(userID string) (string, error) {
+	if _, err := users.FindUserByID(userID); err != nil {
+		return "", err
+	}
+	password, err := register.GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := register.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if err := users.UpdatePassword(userID, hashedPassword); err != nil {
+		return "", err
+	}
+	audit.Record(audit.Event{
+		Type:      audit.PasswordChange,
+		Reason:    "reset",
+		SubjectID: userID,
+	})
+	return password, nil
+}
+
+// SetDisabled disable the user so it can not login nor refresh token, or enable it back
+func SetDisabled(userID string, disabled bool) error {
+	if err := users.SetUserDisabled(userID, disabled); err != nil {
+		return err
+	}
+	action := "enable_user"
+	if disabled {
+		action = "disable_user"
+	}
+	audit.Record(audit.Event{
+		Type:      audit.AdminAction,
+		SubjectID: userID,
+		Metadata:  map[string]interface{}{"action": action},
+	})
+	return nil
+}
+
+// normalizeBatchSize is number of users read at once by NormalizePhoneNumbers
+const normalizeBatchSize = 100
+
+// PhoneNormalization is result of NormalizePhoneNumbers
+type PhoneNormalization struct {
+	Normalized int
+	// Invalid is id of users whose phone number can not be normalized, it is kept as written
+	Invalid []string
+	// Duplicate is id of users whose normalized phone number is already used by another user,
+	// it is kept as written since phone number is unique
+	Duplicate []string
+}
+
+// NormalizePhoneNumbers backfill phone number of users saved before phone numbers were normalized to E.164,
+// the number as written is kept as original phone number so running it again skip the users done
+func NormalizePhoneNumbers() (PhoneNormalization, error) {
+	result := PhoneNormalization{Invalid: []string{}, Duplicate: []string{}}
+	for {
+		batch, err := users.FindUsersToNormalizePhone(normalizeBatchSize)
+		if err != nil || len(batch) == 0 {
+			if result.Normalized > 0 || len(result.Invalid) > 0 || len(result.Duplicate) > 0 {
+				audit.Record(audit.Event{
+					Type: audit.AdminAction,
+					Metadata: map[string]interface{}{"action": "normalize_phone_numbers", "normalized": result.Normalized,
+						"invalid": len(result.Invalid), "duplicate": len(result.Duplicate)},
+				})
+			}
+			return result, err
+		}
+		for _, user := range batch {
+			phoneNumber, err := phone.Normalize(user.PhoneNumber)
+			if err != nil {
+				result.Invalid = append(result.Invalid, user.ID)
+				phoneNumber = user.PhoneNumber
+			} else {
+				existing, err := users.FindUserByPhoneNumber(phoneNumber)
+				if err != nil && err != db.ErrUserNotFound {
+					return result, err
+				}
+				if err == nil && existing.ID != user.ID {
+					result.Duplicate = append(result.Duplicate, user.ID)
+					phoneNumber = user.PhoneNumber
+				} else {
+					result.Normalized++
+				}
+			}
+			if err := users.SetPhoneNumber(user.ID, phoneNumber, user.PhoneNumber); err != nil {
+				return result, err
+			}
+		}
+	}
+}
+
+// encryptBatchSize is number of users read at once by EncryptUsers
+const encryptBatchSize = 100
+
+// UserEncryption is result of EncryptUsers
+type UserEncryption struct {
+	Encrypted int
+	// Duplicate is id of users whose KTP number or phone number is already used by an encrypted user,
+	// they are kept as they are until the duplicate is resolved
+	Duplicate []string
+}
+
+// EncryptUsers backfill encryption of personal data of users saved as plaintext or encrypted by a retired key,
+// users encrypted by the current key are skipped so running it again after a key rotation re-encrypt the rest
+func EncryptUsers() (UserEncryption, error) {
+	result := UserEncryption{Duplicate: []string{}}
+	afterID := ""
+	for {
+		batch, err := users.SealUsers(afterID, encryptBatchSize)
+		result.Encrypted += batch.Sealed
+		result.Duplicate = append(result.Duplicate, batch.Duplicate...)
+		if err != nil || batch.LastID == afterID {
+			if result.Encrypted > 0 || len(result.Duplicate) > 0 {
+				audit.Record(audit.Event{
+					Type: audit.AdminAction,
+					Metadata: map[string]interface{}{"action": "encrypt_users", "encrypted": result.Encrypted,
+						"duplicate": len(result.Duplicate)},
+				})
+			}
+			return result, err
+		}
+		afterID = batch.LastID
+	}
+}
@@ -0,0 +1,86 @@
+package account_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/account"
+	"github.com/drd-engineering/TwinCape/environments"
+)
+
+func setupTestCase(t *testing.T) (*memory.UserRepository, *memory.LogRepository, func(t *testing.T)) {
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	users := memory.NewUserRepository()
+	users.CreateUser(&db.User{ID: "testid", KtpNumber: "1111", Password: "oldhash"})
+	logs := memory.NewLogRepository()
+	account.SetUserRepository(users)
+	audit.SetLogRepository(logs)
+	return users, logs, func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	users, logs, set := setupTestCase(t)
+	defer set(t)
+
+	password, err := account.ResetPassword("testid")
+	assert.Nil(t, err)
+	user, _ := users.FindUserByID("testid")
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)),
+		"the returned password should be the new password")
+	events := logs.AuditEvents()
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.PasswordChange, events[0].Type)
+
+	_, err = account.ResetPassword("unknown")
+	assert.Equal(t, db.ErrUserNotFound, err, "unknown user should not be reset")
+}
+
+func TestSetDisabled(t *testing.T) {
+	users, logs, set := setupTestCase(t)
+	defer set(t)
+
+	assert.Nil(t, account.SetDisabled("testid", true))
+	user, _ := users.FindUserByID("testid")
+	assert.True(t, user.Disabled, "user should be disabled")
+	assert.Nil(t, account.SetDisabled("testid", false))
+	user, _ = users.FindUserByID("testid")
+	assert.False(t, user.Disabled, "user should be enabled back")
+	assert.Len(t, logs.AuditEvents(), 2, "every change should be audited")
+	assert.Equal(t, db.ErrUserNotFound, account.SetDisabled("unknown", true))
+}
+
+func TestNormalizePhoneNumbers(t *testing.T) {
+	users, logs, set := setupTestCase(t)
+	defer set(t)
+	users.CreateUser(&db.User{ID: "nationalid", KtpNumber: "2222", PhoneNumber: "0812-0000-0001"})
+	users.CreateUser(&db.User{ID: "normalizedid", KtpNumber: "3333", PhoneNumber: "+6281200000002",
+		OriginalPhoneNumber: "+62 812 0000 0002"})
+	users.CreateUser(&db.User{ID: "sameid", KtpNumber: "4444", PhoneNumber: "62 812 0000 0002"})
+	users.CreateUser(&db.User{ID: "invalidid", KtpNumber: "5555", PhoneNumber: "12345"})
+
+	result, err := account.NormalizePhoneNumbers()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Normalized)
+	assert.Equal(t, []string{"invalidid"}, result.Invalid)
+	assert.Equal(t, []string{"sameid"}, result.Duplicate, "user having phone number of another user should be reported")
+	user, _ := users.FindUserByID("nationalid")
+	assert.Equal(t, "+6281200000001", user.PhoneNumber)
+	assert.Equal(t, "0812-0000-0001", user.OriginalPhoneNumber, "phone number as written should be kept")
+	user, _ = users.FindUserByID("sameid")
+	assert.Equal(t, "62 812 0000 0002", user.PhoneNumber, "phone number used by another user should be kept as written")
+	user, _ = users.FindUserByID("invalidid")
+	assert.Equal(t, "12345", user.PhoneNumber, "invalid phone number should be kept as written")
+	assert.Len(t, logs.AuditEvents(), 1, "normalization should be audited")
+
+	result, err = account.NormalizePhoneNumbers()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Normalized+len(result.Invalid)+len(result.Duplicate), "users normalized should be skipped")
+}
@@ -0,0 +1,88 @@
+package apilog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// Export format available
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ExportResult is summary of exported api logs
+type ExportResult struct {
+	Total  int
+	LastID int
+}
+
+var csvHeader = []string{"id", "timestamp", "ttl", "responseStatus", "path", "method", "clientIp", "clientTools", "protocol", "userId"}
+
+// Export stream api logs with timestamp in range [from, to) to writer ordered by id,
+// zero from or to means the range is not limited on that side
+func Export(writer io.Writer, from time.Time, to time.Time, format string) (ExportResult, error) {
+	return export(writer, from, to, 0, format)
+}
+
+// export is Export not giving log with id greater than maxID unless maxID is zero
+func export(writer io.Writer, from time.Time, to time.Time, maxID int, format string) (ExportResult, error) {
+	result := ExportResult{}
+	var write func(ResponseAPILog) error
+	var flush func() error
+	switch format {
+	case FormatJSONL:
+		encoder := json.NewEncoder(writer)
+		write = func(apiLog ResponseAPILog) error { return encoder.Encode(apiLog) }
+		flush = func() error { return nil }
+	case FormatCSV:
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write(csvHeader); err != nil {
+			return result, err
+		}
+		write = func(apiLog ResponseAPILog) error { return csvWriter.Write(csvRecord(apiLog)) }
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	default:
+		return result, errors.New("Export format must be " + FormatJSONL + " or " + FormatCSV)
+	}
+
+	err := logs.EachAPILog(from, to, func(apiLog db.APILog) error {
+		if maxID > 0 && apiLog.ID > maxID {
+			return nil
+		}
+		if err := write(ResponseAPILog{}.CreateResponse(apiLog)); err != nil {
+			return err
+		}
+		result.Total++
+		result.LastID = apiLog.ID
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, flush()
+}
+
+func csvRecord(apiLog ResponseAPILog) []string {
+	return []string{
+		strconv.Itoa(apiLog.ID),
+		apiLog.Timestamp.Format(time.RFC3339Nano),
+		apiLog.TTL,
+		strconv.Itoa(apiLog.ResponseStatus),
+		apiLog.Path,
+		apiLog.Method,
+		apiLog.ClientIP,
+		apiLog.ClientTools,
+		apiLog.Protocol,
+		apiLog.UserID,
+	}
+}
@@ -0,0 +1,49 @@
+package apilog_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		format string
+		total  int
+		fail   bool
+	}{
+		{name: "OKJSONL", format: apilog.FormatJSONL, total: 3},
+		{name: "OKCSV", format: apilog.FormatCSV, total: 3},
+		{name: "OKTimeRange", from: time.Now().Add(-time.Minute), format: apilog.FormatJSONL, total: 2},
+		{name: "OKEmptyRange", to: time.Now().Add(-24 * time.Hour), format: apilog.FormatJSONL, total: 0},
+		{name: "FailedUnknownFormat", format: "xml", fail: true},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		var buffer bytes.Buffer
+		result, err := apilog.Export(&buffer, tc.from, tc.to, tc.format)
+		if tc.fail {
+			assert.Error(t, err, "test "+tc.name+" case")
+			continue
+		}
+		assert.Nil(t, err, "test "+tc.name+" case")
+		assert.Equal(t, tc.total, result.Total, "test "+tc.name+" case")
+		if tc.format == apilog.FormatCSV {
+			records, err := csv.NewReader(&buffer).ReadAll()
+			assert.Nil(t, err, "csv should be readable in test "+tc.name+" case")
+			assert.Len(t, records, tc.total+1, "csv should have header and one record per log in test "+tc.name+" case")
+		} else {
+			lines := strings.Count(buffer.String(), "\n")
+			assert.Equal(t, tc.total, lines, "jsonl should have one line per log in test "+tc.name+" case")
+		}
+	}
+}
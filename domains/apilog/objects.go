@@ -0,0 +1,64 @@
+package apilog
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// SearchFilter is query string accepted to search api logs
+type SearchFilter struct {
+	From      string `form:"from"`
+	To        string `form:"to"`
+	Path      string `form:"path"`
+	Method    string `form:"method"`
+	Status    int    `form:"status"`
+	ClientIP  string `form:"clientIp"`
+	UserAgent string `form:"userAgent"`
+	UserID    string `form:"userId"`
+	Cursor    string `form:"cursor"`
+	Limit     int    `form:"limit"`
+}
+
+// ResponseAPILog is api log data given to administrator
+type ResponseAPILog struct {
+	ID             int       `json:"id"`
+	Timestamp      time.Time `json:"timestamp"`
+	TTL            string    `json:"ttl"`
+	ResponseStatus int       `json:"responseStatus"`
+	Path           string    `json:"path"`
+	Method         string    `json:"method"`
+	ClientIP       string    `json:"clientIp"`
+	ClientTools    string    `json:"clientTools"`
+	Protocol       string    `json:"protocol"`
+	UserID         string    `json:"userId"`
+	Redacted       bool      `json:"redacted"`
+}
+
+// CreateResponse from database
+func (t ResponseAPILog) CreateResponse(apiLog db.APILog) ResponseAPILog {
+	t.ID = apiLog.ID
+	t.Timestamp = apiLog.Timestamp
+	t.TTL = apiLog.TTL
+	t.ResponseStatus = apiLog.ResponseStatus
+	t.Path = apiLog.Path
+	t.Method = apiLog.Method
+	t.ClientIP = apiLog.ClientIP
+	t.ClientTools = apiLog.ClientTools
+	t.Protocol = apiLog.Protocol
+	t.UserID = apiLog.UserID
+	t.Redacted = apiLog.Redacted
+	return t
+}
+
+// StatusCount is number of api logs having the same response status
+type StatusCount struct {
+	ResponseStatus int `json:"responseStatus"`
+	Total          int `json:"total"`
+}
+
+// PathCount is number of api logs having the same path
+type PathCount struct {
+	Path  string `json:"path"`
+	Total int    `json:"total"`
+}
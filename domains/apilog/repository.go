@@ -0,0 +1,24 @@
+package apilog
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// LogRepository is api log storage used by apilog service handlers, retention and export
+type LogRepository interface {
+	SearchAPILogs(query db.APILogQuery) ([]db.APILog, error)
+	CountAPILogsByStatus(query db.APILogQuery) ([]db.StatusCount, error)
+	CountAPILogsByPath(query db.APILogQuery, limit int) ([]db.PathCount, error)
+	EachAPILog(from time.Time, to time.Time, visit func(db.APILog) error) error
+	FindPurgeLimit(before time.Time) (int, error)
+	DeleteAPILogs(maxID int, limit int) (int, error)
+}
+
+var logs LogRepository = db.NewGormLogRepository(nil)
+
+// SetLogRepository replace api log storage used by apilog service handlers, retention and export
+func SetLogRepository(repository LogRepository) {
+	logs = repository
+}
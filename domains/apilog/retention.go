@@ -0,0 +1,105 @@
+package apilog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const purgeChunkSize = 1000
+
+// RetentionConfig define how long api logs kept in database
+type RetentionConfig struct {
+	// MaxAge is age of api log to be purged, zero disable the retention
+	MaxAge time.Duration
+	// Interval is time between two purges
+	Interval time.Duration
+	// ArchiveDir is directory to export purged api logs as jsonl, empty means no archive
+	ArchiveDir string
+}
+
+// PurgeResult is summary of api logs purged
+type PurgeResult struct {
+	Archived    int
+	Deleted     int
+	ArchiveFile string
+}
+
+// StartRetention purge api logs periodically in background until the returned stop function is called
+func StartRetention(config RetentionConfig) (stop func()) {
+	if config.MaxAge <= 0 {
+		return func() {}
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			result, err := Purge(time.Now().Add(-config.MaxAge), config.ArchiveDir)
+			if err != nil {
+				fmt.Println("Failed to purge API logs: " + err.Error())
+			} else if result.Deleted > 0 {
+				fmt.Printf("Purged %d API logs older than %s\n", result.Deleted, config.MaxAge)
+			}
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// Purge delete api logs older than the time given, they are archived first when archiveDir is not empty.
+// Logs are deleted up to the last checkpoint covering only older logs, so the chain left is still verified
+// from a signed hash, nothing is deleted before the logs are checkpointed
+func Purge(before time.Time, archiveDir string) (PurgeResult, error) {
+	result := PurgeResult{}
+	lastID, err := logs.FindPurgeLimit(before)
+	if err != nil || lastID == 0 {
+		return result, err
+	}
+	if len(archiveDir) > 0 {
+		archiveFile := filepath.Join(archiveDir,
+			"api_logs_"+before.UTC().Format("20060102T150405.000Z")+".jsonl")
+		file, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return result, err
+		}
+		exported, err := export(file, time.Time{}, before, lastID, FormatJSONL)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil || exported.Total == 0 {
+			// nothing to delete when archive failed or there is no log to archive
+			os.Remove(archiveFile)
+			return result, err
+		}
+		result.Archived = exported.Total
+		result.ArchiveFile = archiveFile
+	}
+
+	// delete in chunks so the table is never locked for a long time,
+	// oldest first so the logs left always stay one unbroken chain
+	for {
+		deleted, err := logs.DeleteAPILogs(lastID, purgeChunkSize)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted += deleted
+		if deleted < purgeChunkSize {
+			return result, nil
+		}
+	}
+}
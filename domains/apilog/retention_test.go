@@ -0,0 +1,54 @@
+package apilog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurge(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	archiveDir, err := ioutil.TempDir("", "twincape-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(archiveDir)
+
+	result, err := apilog.Purge(time.Now().Add(-time.Minute), archiveDir)
+	assert.Nil(t, err, "purge should succeed")
+	assert.Equal(t, 0, result.Deleted, "log not checkpointed should be kept")
+	assert.Empty(t, result.ArchiveFile, "no archive should be created")
+
+	logs.CreateCheckpoint(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 1})
+	logs.CreateCheckpoint(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 2})
+	result, err = apilog.Purge(time.Now().Add(-time.Minute), archiveDir)
+	assert.Nil(t, err, "purge should succeed")
+	assert.Equal(t, 1, result.Deleted, "only the log older than a minute should be deleted")
+	assert.Equal(t, 1, result.Archived, "deleted log should be archived first")
+	content, err := ioutil.ReadFile(result.ArchiveFile)
+	assert.Nil(t, err, "archive file should be readable")
+	assert.Equal(t, 1, strings.Count(string(content), "\n"), "archive should contain the deleted log")
+
+	remaining, _ := logs.SearchAPILogs(db.APILogQuery{})
+	assert.Len(t, remaining, 2, "newer logs should be kept")
+
+	logs.CreateCheckpoint(&db.LogCheckpoint{LogTable: db.APILogTable, LastID: 3})
+	result, err = apilog.Purge(time.Now().Add(time.Minute), "")
+	assert.Nil(t, err, "purge without archive should succeed")
+	assert.Equal(t, 1, result.Deleted, "every log up to the checkpoint before the last log should be deleted")
+	assert.Empty(t, result.ArchiveFile, "no archive should be created")
+	remaining, _ = logs.SearchAPILogs(db.APILogQuery{})
+	assert.Len(t, remaining, 1, "the last log should be kept for its checkpoint")
+}
+
+func TestStartRetentionDisabled(t *testing.T) {
+	stop := apilog.StartRetention(apilog.RetentionConfig{})
+	assert.NotPanics(t, stop, "stopping disabled retention should never be panic")
+}
@@ -0,0 +1,147 @@
+package apilog
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLimit  = 50
+	maxLimit      = 500
+	maxPathCounts = 50
+)
+
+// SearchAPILogs service handler for administrator to search api logs
+func SearchAPILogs(c *gin.Context) {
+	var filter SearchFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid search filter"})
+		return
+	}
+	query, err := makeQuery(filter)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	pageQuery := query
+	if len(filter.Cursor) > 0 {
+		lastID, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			c.Abort()
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		pageQuery.BeforeID = lastID
+	}
+	limit := filter.Limit
+	if limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	pageQuery.Limit = limit + 1
+
+	apiLogs, err := logs.SearchAPILogs(pageQuery)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to search API logs"})
+		return
+	}
+	nextCursor := ""
+	if len(apiLogs) > limit {
+		apiLogs = apiLogs[:limit]
+		nextCursor = encodeCursor(apiLogs[limit-1].ID)
+	}
+	response := make([]ResponseAPILog, 0, len(apiLogs))
+	for _, apiLog := range apiLogs {
+		response = append(response, ResponseAPILog{}.CreateResponse(apiLog))
+	}
+
+	dbStatusCounts, err := logs.CountAPILogsByStatus(query)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to count API logs"})
+		return
+	}
+	statusCounts := make([]StatusCount, 0, len(dbStatusCounts))
+	for _, statusCount := range dbStatusCounts {
+		statusCounts = append(statusCounts, StatusCount(statusCount))
+	}
+	dbPathCounts, err := logs.CountAPILogsByPath(query, maxPathCounts)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to count API logs"})
+		return
+	}
+	pathCounts := make([]PathCount, 0, len(dbPathCounts))
+	for _, pathCount := range dbPathCounts {
+		pathCounts = append(pathCounts, PathCount(pathCount))
+	}
+
+	audit.Emit(c, audit.Event{
+		Type:     audit.AdminAction,
+		ActorID:  c.GetString("userID"),
+		Metadata: map[string]interface{}{"action": "search_api_logs", "filter": c.Request.URL.RawQuery},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"logs":           response,
+		"nextCursor":     nextCursor,
+		"countPerStatus": statusCounts,
+		"countPerPath":   pathCounts,
+		"message":        "API logs found",
+	})
+}
+
+func makeQuery(filter SearchFilter) (db.APILogQuery, error) {
+	query := db.APILogQuery{
+		Method:    strings.ToUpper(filter.Method),
+		Status:    filter.Status,
+		ClientIP:  filter.ClientIP,
+		UserAgent: filter.UserAgent,
+		UserID:    filter.UserID,
+	}
+	var err error
+	if len(filter.From) > 0 {
+		query.From, err = time.Parse(time.RFC3339, filter.From)
+		if err != nil {
+			return query, errors.New("From format: RFC3339 (2006-01-02T15:04:05Z07:00)")
+		}
+	}
+	if len(filter.To) > 0 {
+		query.To, err = time.Parse(time.RFC3339, filter.To)
+		if err != nil {
+			return query, errors.New("To format: RFC3339 (2006-01-02T15:04:05Z07:00)")
+		}
+	}
+	// trailing * search every path having the prefix
+	query.Path = strings.TrimSuffix(filter.Path, "*")
+	query.PathPrefix = strings.HasSuffix(filter.Path, "*")
+	return query, nil
+}
+
+func encodeCursor(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(lastID)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("Invalid cursor")
+	}
+	lastID, err := strconv.Atoi(string(decoded))
+	if err != nil {
+		return 0, errors.New("Invalid cursor")
+	}
+	return lastID, nil
+}
@@ -0,0 +1,179 @@
+package apilog_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var logs *memory.LogRepository
+
+func setupTestCase(t *testing.T) func(t *testing.T) {
+	environments.Set("RELEASE_TYPE", "localhost")
+	_, filename, _, _ := runtime.Caller(0)
+	dir := path.Join(path.Dir(filename), "../..")
+	err := os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+	environments.LoadEnvironmentVariableFile()
+	logs = memory.NewLogRepository()
+	apilog.SetLogRepository(logs)
+	audit.SetLogRepository(logs)
+	testLogs := []db.APILog{
+		{Timestamp: time.Now().Add(-time.Hour), ResponseStatus: 200, Path: "/api/v1/sso/auth/login", Method: "POST", ClientIP: "10.0.0.1", ClientTools: "curl/7.68.0"},
+		{Timestamp: time.Now(), ResponseStatus: 401, Path: "/api/v1/sso/auth/login", Method: "POST", ClientIP: "10.0.0.2", ClientTools: "Mozilla/5.0"},
+		{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/v1/sso/register/save-user", Method: "POST", ClientIP: "10.0.0.1", ClientTools: "Mozilla/5.0"},
+	}
+	logs.CreateAPILogs(testLogs)
+	return func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func TestSearchAPILogs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		total int
+	}{
+		{name: "OKWithoutFilter", query: "", code: 200, total: 3},
+		{name: "OKFilterStatus", query: "status=401", code: 200, total: 1},
+		{name: "OKFilterPathPrefix", query: "path=/api/v1/sso/auth*", code: 200, total: 2},
+		{name: "OKFilterClientAndAgent", query: "clientIp=10.0.0.1&userAgent=Mozilla", code: 200, total: 1},
+		{name: "OKFilterMethodLowerCase", query: "method=post", code: 200, total: 3},
+		{name: "OKFilterTimeRange", query: "from=" + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), code: 200, total: 2},
+		{name: "FailedTimeFormat", query: "from=yesterday", code: 400},
+		{name: "FailedCursor", query: "cursor=!!!", code: 400},
+	}
+	r := gin.Default()
+	r.GET("/t/api-logs", apilog.SearchAPILogs)
+
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/api-logs?"+tc.query, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		var got struct {
+			Logs           []apilog.ResponseAPILog `json:"logs"`
+			CountPerStatus []apilog.StatusCount    `json:"countPerStatus"`
+			Message        string                  `json:"message"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEmpty(t, got.Message, "the message should not be empty in test "+tc.name+" case")
+		if tc.code == 200 {
+			assert.Len(t, got.Logs, tc.total, "test "+tc.name+" case")
+			counted := 0
+			for _, statusCount := range got.CountPerStatus {
+				counted += statusCount.Total
+			}
+			assert.Equal(t, tc.total, counted, "count per status should cover every log in test "+tc.name+" case")
+		}
+	}
+	auditEvents := logs.AuditEvents()
+	assert.Len(t, auditEvents, 6, "every successful search should be audited")
+	assert.Equal(t, audit.AdminAction, auditEvents[0].Type)
+}
+
+func TestSearchAPILogsPagination(t *testing.T) {
+	r := gin.Default()
+	r.GET("/t/api-logs", apilog.SearchAPILogs)
+
+	set := setupTestCase(t)
+	defer set(t)
+	seen := map[int]bool{}
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/api-logs?limit=2&cursor="+cursor, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+
+		var got struct {
+			Logs       []apilog.ResponseAPILog `json:"logs"`
+			NextCursor string                  `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		for _, apiLog := range got.Logs {
+			assert.False(t, seen[apiLog.ID], "log should never be given twice")
+			seen[apiLog.ID] = true
+		}
+		cursor = got.NextCursor
+		if len(cursor) == 0 {
+			break
+		}
+	}
+	assert.Len(t, seen, 3, "every log should be reachable through the cursor")
+}
+
+// failingCountRepository fail counting api logs, by status or by path
+type failingCountRepository struct {
+	*memory.LogRepository
+	failStatus bool
+	failPath   bool
+}
+
+func (r failingCountRepository) CountAPILogsByStatus(query db.APILogQuery) ([]db.StatusCount, error) {
+	if r.failStatus {
+		return nil, errors.New("count failed")
+	}
+	return r.LogRepository.CountAPILogsByStatus(query)
+}
+
+func (r failingCountRepository) CountAPILogsByPath(query db.APILogQuery, limit int) ([]db.PathCount, error) {
+	if r.failPath {
+		return nil, errors.New("count failed")
+	}
+	return r.LogRepository.CountAPILogsByPath(query, limit)
+}
+
+func TestSearchAPILogsCountFailed(t *testing.T) {
+	tests := []struct {
+		name       string
+		failStatus bool
+		failPath   bool
+		code       int
+	}{
+		{name: "OKCounted", code: 200},
+		{name: "FailedCountPerStatus", failStatus: true, code: 500},
+		{name: "FailedCountPerPath", failPath: true, code: 500},
+	}
+	r := gin.Default()
+	r.GET("/t/api-logs", apilog.SearchAPILogs)
+
+	set := setupTestCase(t)
+	defer set(t)
+	defer apilog.SetLogRepository(logs)
+	for _, tc := range tests {
+		apilog.SetLogRepository(failingCountRepository{logs, tc.failStatus, tc.failPath})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/api-logs", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "failed count should not be reported as zero total in test "+tc.name+" case")
+	}
+	assert.Len(t, logs.AuditEvents(), 1, "only successful search should be audited")
+}
@@ -0,0 +1,103 @@
+package authenticator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/phone"
+)
+
+// ErrUnknownLogin returned by backend having no user of the login, the next backend is tried
+var ErrUnknownLogin = errors.New("authenticator: login is unknown")
+
+// ErrInvalidPassword returned by backend when the password of the login is wrong
+var ErrInvalidPassword = errors.New("authenticator: password is invalid")
+
+// ErrBackendUnavailable returned by backend when its source of users can not be reached, the next backend is tried
+var ErrBackendUnavailable = errors.New("authenticator: backend is unavailable")
+
+// ErrProvisioningFailed returned by backend when the login is valid but its user can not be saved
+var ErrProvisioningFailed = errors.New("authenticator: user can not be provisioned")
+
+// Backend check login details against a source of users, user authenticated by any backend is a db.User
+// so sessions, tokens and the disabled flag work the same for every backend
+type Backend interface {
+	Authenticate(input UserLogin) (db.User, error)
+}
+
+// Backends is every backend available by the name used in AUTH_BACKENDS
+var Backends = map[string]Backend{
+	"db":   DBBackend{},
+	"ldap": LDAPBackend{},
+}
+
+// DBBackend authenticate user by the bcrypt password saved in users table
+type DBBackend struct{}
+
+// Authenticate find the user by id, email or phone number and compare the password. User provisioned
+// by another backend is unknown, its password is only known by that backend
+func (DBBackend) Authenticate(input UserLogin) (db.User, error) {
+	var userInDb db.User
+	var err error
+	switch {
+	case len(input.ID) > 0:
+		userInDb, err = users.FindUserByID(input.ID)
+	case len(input.Email) > 0:
+		userInDb, err = users.FindUserByEmail(input.Email)
+	default:
+		// phone number is saved in E.164, the user may login with the number written any other way
+		phoneNumber, normalizeErr := phone.Normalize(input.PhoneNumber)
+		if normalizeErr != nil {
+			return db.User{}, ErrUnknownLogin
+		}
+		userInDb, err = users.FindUserByPhoneNumber(phoneNumber)
+	}
+	if err == db.ErrUserNotFound {
+		return db.User{}, ErrUnknownLogin
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	if len(userInDb.Backend) > 0 {
+		return db.User{}, ErrUnknownLogin
+	}
+	if !comparePasswords(userInDb.Password, input.Password) {
+		return db.User{}, ErrInvalidPassword
+	}
+	return userInDb, nil
+}
+
+// authenticateWithBackends try the backends listed in AUTH_BACKENDS in order until one know the login,
+// empty AUTH_BACKENDS means the db backend only. Unavailable backend is skipped, when no other backend
+// know the login its error is returned since the login may be of that backend
+func authenticateWithBackends(input UserLogin) (db.User, string, error) {
+	names := environments.Get("AUTH_BACKENDS")
+	if len(names) == 0 {
+		names = "db"
+	}
+	unavailableName, unavailableErr := "", error(nil)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		backend, ok := Backends[name]
+		if !ok {
+			return db.User{}, name, fmt.Errorf("authenticator: unknown backend %s", name)
+		}
+		user, err := backend.Authenticate(input)
+		if errors.Is(err, ErrBackendUnavailable) {
+			if unavailableErr == nil {
+				unavailableName, unavailableErr = name, err
+			}
+			continue
+		}
+		if err != ErrUnknownLogin {
+			return user, name, err
+		}
+	}
+	if unavailableErr != nil {
+		return db.User{}, unavailableName, unavailableErr
+	}
+	return db.User{}, "", ErrUnknownLogin
+}
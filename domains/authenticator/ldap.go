@@ -0,0 +1,185 @@
+package authenticator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/nik"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConnection is the part of LDAP connection used by LDAPBackend
+type LDAPConnection interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// DialLDAP open connection to the directory at the URL, replaced by tests to use directory in memory
+var DialLDAP = func(url string) (LDAPConnection, error) {
+	return ldap.DialURL(url)
+}
+
+// defaultLDAPUserFilter find directory entry by its uid or mail, {login} is replaced by the escaped login
+const defaultLDAPUserFilter = "(|(uid={login})(mail={login}))"
+
+// defaultLDAPAttributes map user fields to the directory attributes of the inetOrgPerson schema. No standard
+// attribute hold KTP number, so ktpNumber must be mapped by LDAP_ATTRIBUTES
+const defaultLDAPAttributes = "name=cn,email=mail,phoneNumber=telephoneNumber"
+
+// ldapFields is every user field which can be provisioned from directory attribute
+var ldapFields = map[string]func(data *register.UserRegistrationData, value string) error{
+	"name":   func(data *register.UserRegistrationData, value string) error { data.Name = value; return nil },
+	"gender": func(data *register.UserRegistrationData, value string) error { data.Gender = value; return nil },
+	"email":  func(data *register.UserRegistrationData, value string) error { data.Email = value; return nil },
+	"ktpNumber": func(data *register.UserRegistrationData, value string) error {
+		data.KtpNumber = nik.Number(value)
+		return nil
+	},
+	"address":      func(data *register.UserRegistrationData, value string) error { data.Address = value; return nil },
+	"phoneNumber":  func(data *register.UserRegistrationData, value string) error { data.PhoneNumber = value; return nil },
+	"dateofBirth":  func(data *register.UserRegistrationData, value string) error { data.DateOfBirth = value; return nil },
+	"cityzenship":  func(data *register.UserRegistrationData, value string) error { data.Cityzenship = value; return nil },
+	"placeofBirth": func(data *register.UserRegistrationData, value string) error { data.PlaceOfBirth = value; return nil },
+}
+
+// LDAPBackend authenticate user by binding to the directory as the entry of the login, configured by LDAP_*
+// environment variable. Directory user is matched to db.User by email, user not saved yet is provisioned
+// from the entry attributes on the first login
+type LDAPBackend struct{}
+
+type ldapConfig struct {
+	url          string
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	userFilter   string
+	attributes   map[string]string
+}
+
+func makeLDAPConfig() (ldapConfig, error) {
+	config := ldapConfig{
+		url:          environments.Get("LDAP_URL"),
+		bindDN:       environments.Get("LDAP_BIND_DN"),
+		bindPassword: environments.Get("LDAP_BIND_PASSWORD"),
+		baseDN:       environments.Get("LDAP_BASE_DN"),
+		userFilter:   environments.Get("LDAP_USER_FILTER"),
+		attributes:   map[string]string{},
+	}
+	if len(config.url) == 0 || len(config.baseDN) == 0 {
+		return config, errors.New("authenticator: LDAP_URL and LDAP_BASE_DN must be set to use ldap backend")
+	}
+	if len(config.userFilter) == 0 {
+		config.userFilter = defaultLDAPUserFilter
+	}
+	// LDAP_ATTRIBUTES add to or replace the default mapping
+	attributes := defaultLDAPAttributes
+	if configured := environments.Get("LDAP_ATTRIBUTES"); len(configured) > 0 {
+		attributes += "," + configured
+	}
+	for _, pair := range strings.Split(attributes, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if _, ok := ldapFields[parts[0]]; !ok || len(parts) != 2 {
+			return config, fmt.Errorf("authenticator: invalid LDAP_ATTRIBUTES %s, expected user field=attribute", pair)
+		}
+		config.attributes[parts[0]] = parts[1]
+	}
+	if _, ok := config.attributes["email"]; !ok {
+		return config, errors.New("authenticator: LDAP_ATTRIBUTES must map email, directory user is matched by email")
+	}
+	if _, ok := config.attributes["ktpNumber"]; !ok {
+		return config, errors.New("authenticator: LDAP_ATTRIBUTES must map ktpNumber, directory user is registered with KTP number")
+	}
+	return config, nil
+}
+
+// Authenticate find the directory entry of the id or email, bind as the entry using the password,
+// then give the user having the entry email
+func (LDAPBackend) Authenticate(input UserLogin) (db.User, error) {
+	config, err := makeLDAPConfig()
+	if err != nil {
+		return db.User{}, err
+	}
+	login := input.ID
+	if len(login) == 0 {
+		login = input.Email
+	}
+	// directory entries are not found by phone number, the next backend may know it
+	if len(login) == 0 {
+		return db.User{}, ErrUnknownLogin
+	}
+	conn, err := DialLDAP(config.url)
+	if err != nil {
+		return db.User{}, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	defer conn.Close()
+	if len(config.bindDN) > 0 {
+		if err := conn.Bind(config.bindDN, config.bindPassword); err != nil {
+			return db.User{}, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+		}
+	}
+	attributes := make([]string, 0, len(config.attributes))
+	for _, attribute := range config.attributes {
+		attributes = append(attributes, attribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(config.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, strings.ReplaceAll(config.userFilter, "{login}", ldap.EscapeFilter(login)), attributes, nil))
+	if err != nil {
+		return db.User{}, fmt.Errorf("%w: %v", ErrBackendUnavailable, err)
+	}
+	if len(result.Entries) == 0 {
+		return db.User{}, ErrUnknownLogin
+	}
+	if len(result.Entries) > 1 {
+		return db.User{}, fmt.Errorf("authenticator: login %s match more than one directory entry", login)
+	}
+	entry := result.Entries[0]
+	// directory accept bind with empty password as anonymous bind, it must never be a login
+	if len(input.Password) == 0 {
+		return db.User{}, ErrInvalidPassword
+	}
+	if err := conn.Bind(entry.DN, input.Password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return db.User{}, ErrInvalidPassword
+		}
+		return db.User{}, err
+	}
+
+	email := entry.GetAttributeValue(config.attributes["email"])
+	if len(email) == 0 {
+		return db.User{}, fmt.Errorf("%w: directory entry %s has no email", ErrProvisioningFailed, entry.DN)
+	}
+	user, err := users.FindUserByEmail(email)
+	if err == nil && user.Backend != "ldap" {
+		// the local account owning the email was not provisioned by the directory, binding must not log into it
+		return db.User{}, fmt.Errorf("%w: email of directory entry %s belongs to user not provisioned by ldap", ErrProvisioningFailed, entry.DN)
+	}
+	if err != db.ErrUserNotFound {
+		return user, err
+	}
+	return provisionLDAPUser(entry, config.attributes)
+}
+
+// provisionLDAPUser register user from the directory entry marked by ldap backend, its generated password
+// is thrown away so the user keep logging in through the directory
+func provisionLDAPUser(entry *ldap.Entry, attributes map[string]string) (db.User, error) {
+	data := register.UserRegistrationData{Backend: "ldap"}
+	for field, attribute := range attributes {
+		value := entry.GetAttributeValue(attribute)
+		if len(value) == 0 {
+			continue
+		}
+		if err := ldapFields[field](&data, value); err != nil {
+			return db.User{}, fmt.Errorf("%w: invalid %s of directory entry %s", ErrProvisioningFailed, attribute, entry.DN)
+		}
+	}
+	user, _, err := register.CreateUser(data, false)
+	if err != nil {
+		return db.User{}, fmt.Errorf("%w: %v", ErrProvisioningFailed, err)
+	}
+	return user, nil
+}
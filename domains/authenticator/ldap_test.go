@@ -0,0 +1,167 @@
+package authenticator_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type directoryEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeDirectory is LDAP directory in memory standing in for the LDAP server
+type fakeDirectory struct {
+	entries []directoryEntry
+	boundDN string
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	if username == "cn=service,dc=test" && password == "servicepassword" {
+		d.boundDN = username
+		return nil
+	}
+	for _, entry := range d.entries {
+		if entry.dn == username && entry.password == password {
+			d.boundDN = username
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if d.boundDN != "cn=service,dc=test" {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("bind as service first"))
+	}
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		for name, values := range entry.attributes {
+			if strings.Contains(searchRequest.Filter, "("+name+"="+ldap.EscapeFilter(values[0])+")") {
+				result.Entries = append(result.Entries, ldap.NewEntry(entry.dn, entry.attributes))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() {}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{entries: []directoryEntry{
+		{dn: "uid=jdoe,ou=people,dc=test", password: "directorypassword", attributes: map[string][]string{
+			"uid": {"jdoe"}, "cn": {"John Doe"}, "mail": {"test@test.com"},
+		}},
+		{dn: "uid=asmith,ou=people,dc=test", password: "directorypassword", attributes: map[string][]string{
+			"uid": {"asmith"}, "cn": {"Anna Smith"}, "mail": {"asmith@test.com"},
+			"telephoneNumber": {"+6211111111111"}, "employeeNumber": {"3201011505900006"},
+		}},
+		{dn: "uid=noktp,ou=people,dc=test", password: "directorypassword", attributes: map[string][]string{
+			"uid": {"noktp"}, "cn": {"No KTP"}, "mail": {"noktp@test.com"}, "telephoneNumber": {"+6222222222222"},
+		}},
+	}}
+}
+
+func TestLoginLDAPBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []byte
+		directoryUp bool
+		code        int
+	}{
+		{name: "FailedEmailOfDbUser", input: []byte(`{"id":"jdoe", "password":"directorypassword"}`), directoryUp: true, code: 403},
+		{name: "SuccessProvisionedUser", input: []byte(`{"email":"asmith@test.com", "password":"directorypassword"}`), directoryUp: true, code: 200},
+		{name: "SuccessExistingUser", input: []byte(`{"id":"asmith", "password":"directorypassword"}`), directoryUp: true, code: 200},
+		{name: "SuccessFallbackToDb", input: []byte(`{"id":"testid", "password":"testing"}`), directoryUp: true, code: 200},
+		{name: "FailedDirectoryPassword", input: []byte(`{"id":"jdoe", "password":"testing"}`), directoryUp: true, code: 401},
+		{name: "FailedEmptyPassword", input: []byte(`{"id":"jdoe", "password":""}`), directoryUp: true, code: 401},
+		{name: "FailedFilterInjection", input: []byte(`{"id":"*", "password":"directorypassword"}`), directoryUp: true, code: 401},
+		{name: "FailedProvisioningWithoutKtp", input: []byte(`{"id":"noktp", "password":"directorypassword"}`), directoryUp: true, code: 403},
+		{name: "FailedDirectoryDown", input: []byte(`{"id":"jdoe", "password":"directorypassword"}`), directoryUp: false, code: 500},
+		{name: "SuccessDirectoryDownFallbackToDb", input: []byte(`{"id":"testid", "password":"testing"}`), directoryUp: false, code: 200},
+		{name: "FailedDirectoryDownWrongDbPassword", input: []byte(`{"id":"testid", "password":"wrong"}`), directoryUp: false, code: 401},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	users := memory.NewUserRepository()
+	authenticator.SetUserRepository(users)
+	register.SetUserRepository(users)
+	testUser := getUserLoginTest()
+	testUser.Password = secureUserPassword("testing")
+	users.CreateUser(&testUser)
+	environments.Set("AUTH_BACKENDS", "ldap,db")
+	environments.Set("LDAP_URL", "ldap://directory.test")
+	environments.Set("LDAP_BASE_DN", "ou=people,dc=test")
+	environments.Set("LDAP_BIND_DN", "cn=service,dc=test")
+	environments.Set("LDAP_BIND_PASSWORD", "servicepassword")
+	environments.Set("LDAP_ATTRIBUTES", "ktpNumber=employeeNumber")
+	defer environments.Set("LDAP_ATTRIBUTES", "")
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	defaultDial := authenticator.DialLDAP
+	defer func() { authenticator.DialLDAP = defaultDial }()
+
+	r := gin.Default()
+	r.POST("/t/login", authenticator.Login)
+	for _, tc := range tests {
+		directoryUp := tc.directoryUp
+		authenticator.DialLDAP = func(url string) (authenticator.LDAPConnection, error) {
+			if !directoryUp {
+				return nil, errors.New("connection refused")
+			}
+			return newFakeDirectory(), nil
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/t/login", bytes.NewBuffer(tc.input))
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		var got gin.H
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if tc.code == 200 {
+			assert.NotEmpty(t, got["accessToken"], "the return body should contain access token in test "+tc.name+" case")
+		}
+	}
+
+	provisioned, err := users.FindUserByEmail("asmith@test.com")
+	assert.Nil(t, err, "directory user should be provisioned on the first login")
+	assert.Equal(t, "Anna Smith", provisioned.Name)
+	assert.Equal(t, "3201011505900006", provisioned.KtpNumber)
+	assert.Equal(t, "+6211111111111", provisioned.PhoneNumber)
+	assert.Equal(t, "ldap", provisioned.Backend, "provisioned user should be marked by its backend")
+	_, err = users.FindUserByEmail("noktp@test.com")
+	assert.Error(t, err, "directory user failing registration rules should not be provisioned")
+
+	// directory user can not be registered without KTP number, which has no default attribute
+	environments.Set("LDAP_ATTRIBUTES", "")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/t/login", bytes.NewBuffer([]byte(`{"id":"jdoe", "password":"directorypassword"}`)))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code, "ldap backend without ktpNumber mapping should not be used")
+
+	// password saved for the directory user must not let it login by the db backend
+	assert.Nil(t, users.UpdatePassword(provisioned.ID, secureUserPassword("testing")))
+	environments.Set("AUTH_BACKENDS", "db")
+	defer environments.Set("AUTH_BACKENDS", "")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/t/login", bytes.NewBuffer([]byte(`{"email":"asmith@test.com", "password":"testing"}`)))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 401, w.Code, "directory user should not login by the db backend")
+}
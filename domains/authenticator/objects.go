@@ -1,16 +1,19 @@
 package authenticator
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/nik"
 )
 
-// UserLogin is user data requested to login to system
+// UserLogin is user data requested to login to system, the user is found by id, email or phone number
 type UserLogin struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phoneNumber"`
+	Password    string `json:"password"`
 }
 
 // TokenDetails is response containing access token and refresh token
@@ -26,16 +29,18 @@ type RequestRefreshToken struct {
 
 // ResponseLoginDetails is data containing user logged in details
 type ResponseLoginDetails struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Gender       string    `json:"gender"`
-	Email        string    `json:"email"`
-	KtpNumber    int64     `json:"ktpNumber"`
-	Address      string    `json:"address"`
-	PhoneNumber  string    `json:"phoneNumber"`
-	DateOfBirth  time.Time `json:"dateofBirth"`
-	Cityzenship  string    `json:"cityzenship"`
-	PlaceOfBirth string    `json:"placeofBirth"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Gender       string     `json:"gender"`
+	Email        string     `json:"email"`
+	KtpNumber    nik.Number `json:"ktpNumber"`
+	Address      string     `json:"address"`
+	PhoneNumber  string     `json:"phoneNumber"`
+	DateOfBirth  time.Time  `json:"dateofBirth"`
+	Cityzenship  string     `json:"cityzenship"`
+	PlaceOfBirth string     `json:"placeofBirth"`
+	// UpdatedAt is sent back to update the profile, it is rejected when the profile is updated since
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 // CreateResponse from database
@@ -44,11 +49,24 @@ func (t ResponseLoginDetails) CreateResponse(user db.User) ResponseLoginDetails
 	t.Name = user.Name
 	t.Gender = user.Gender
 	t.Email = user.Email
-	t.KtpNumber = user.KtpNumber
+	t.KtpNumber = nik.Number(user.KtpNumber)
 	t.Address = user.Address
 	t.PhoneNumber = user.PhoneNumber
 	t.DateOfBirth = user.DateOfBirth
 	t.Cityzenship = user.Cityzenship
 	t.PlaceOfBirth = user.PlaceOfBirth
+	t.UpdatedAt = user.UpdatedAt
 	return t
 }
+
+// ResponseLoginDetailsV1 is ResponseLoginDetails of API v1 where KTP number is json number
+type ResponseLoginDetailsV1 struct {
+	ResponseLoginDetails
+	KtpNumber int64 `json:"ktpNumber"`
+}
+
+// Downgrade convert to response of API v1, KTP number which is not digits is given as zero
+func (t ResponseLoginDetails) Downgrade() ResponseLoginDetailsV1 {
+	ktpNumber, _ := strconv.ParseInt(string(t.KtpNumber), 10, 64)
+	return ResponseLoginDetailsV1{ResponseLoginDetails: t, KtpNumber: ktpNumber}
+}
@@ -0,0 +1,34 @@
+package authenticator
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by authenticator service handlers
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	FindUserByEmail(email string) (db.User, error)
+	FindUserByPhoneNumber(phoneNumber string) (db.User, error)
+}
+
+// SessionRepository is session storage used by authenticator service handlers
+type SessionRepository interface {
+	CreateSession(session *db.Session) error
+	FindSessionByID(id string) (db.Session, error)
+	TouchSession(id string, usedAt time.Time) error
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+
+// SetUserRepository replace user storage used by authenticator service handlers
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
+
+// SetSessionRepository replace session storage used by authenticator service handlers
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
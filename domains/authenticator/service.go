@@ -1,13 +1,17 @@
 package authenticator
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/audit"
 	"github.com/drd-engineering/TwinCape/db"
-	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/phone"
 	"github.com/gin-gonic/gin"
 
 	"golang.org/x/crypto/bcrypt"
@@ -18,33 +22,17 @@ func Login(c *gin.Context) {
 	var input UserLogin
 	c.ShouldBindJSON(&input)
 
-	var dbInstance = db.GetDb()
-	var userInDb db.User
-	if len(input.ID) > 0 {
-		dbInstance.Where("id = ?", input.ID).First(&userInDb)
-	} else if len(input.Email) > 0 {
-		dbInstance.Where("email = ?", input.Email).First(&userInDb)
-	} else {
-		c.Abort()
-		c.JSON(http.StatusUnauthorized,
-			gin.H{"message": "Please provide valid login details"})
-		return
-	}
-	if len(userInDb.ID) == 0 {
-		c.Abort()
-		c.JSON(http.StatusUnauthorized,
-			gin.H{"message": "Please provide valid login details"})
-		return
-	}
-
-	if result := comparePasswords(userInDb.Password, input.Password); !result {
+	userInDb, session, err := Authenticate(c, input)
+	if err != nil {
+		loginErr := err.(*LoginError)
 		c.Abort()
-		c.JSON(http.StatusUnauthorized,
-			gin.H{"message": "Please provide valid login details"})
+		c.JSON(loginErr.Status,
+			gin.H{"message": loginErr.Message})
 		return
 	}
-	token, err := createToken(userInDb.ID)
+	token, err := CreateToken(userInDb.ID, session.ID)
 	if err != nil {
+		emitLoginFailure(c, audit.Event{SubjectID: userInDb.ID}, "token_error")
 		c.Abort()
 		c.JSON(http.StatusInternalServerError,
 			gin.H{"message": "Error when creating token"})
@@ -54,32 +42,172 @@ func Login(c *gin.Context) {
 	c.JSON(http.StatusOK, token)
 }
 
-func createToken(userID string) (TokenDetails, error) {
+// LoginError is failure of Authenticate with the response status and message for the client
+type LoginError struct {
+	Status  int
+	Message string
+}
+
+func (e *LoginError) Error() string {
+	return e.Message
+}
+
+// Authenticate check the login details with the backends and start session of the user on the device
+// of the request, every login protocol use it so they share the audit events and the rules on who can login.
+// The error returned is always *LoginError
+func Authenticate(c *gin.Context, input UserLogin) (db.User, db.Session, error) {
+	loginEvent := audit.Event{Type: audit.LoginSuccess}
+	if len(input.ID) > 0 {
+		loginEvent.Metadata = map[string]interface{}{"loginWith": "id"}
+	} else if len(input.Email) > 0 {
+		loginEvent.Metadata = map[string]interface{}{"loginWith": "email"}
+	} else if len(input.PhoneNumber) > 0 {
+		loginEvent.Metadata = map[string]interface{}{"loginWith": "phoneNumber"}
+	} else {
+		emitLoginFailure(c, loginEvent, "missing_credentials")
+		return db.User{}, db.Session{}, &LoginError{http.StatusUnauthorized, "Please provide valid login details"}
+	}
+	loginEvent.SubjectID = loginSubject(input)
+	userInDb, backend, err := authenticateWithBackends(input)
+	if len(backend) > 0 {
+		loginEvent.Metadata["backend"] = backend
+	}
+	switch {
+	case err == ErrUnknownLogin:
+		emitLoginFailure(c, loginEvent, "unknown_user")
+		return db.User{}, db.Session{}, &LoginError{http.StatusUnauthorized, "Please provide valid login details"}
+	case err == ErrInvalidPassword:
+		emitLoginFailure(c, loginEvent, "invalid_password")
+		return db.User{}, db.Session{}, &LoginError{http.StatusUnauthorized, "Please provide valid login details"}
+	case errors.Is(err, ErrProvisioningFailed):
+		loginEvent.Metadata["error"] = err.Error()
+		emitLoginFailure(c, loginEvent, "provisioning_failed")
+		return db.User{}, db.Session{}, &LoginError{http.StatusForbidden, "User can not be provisioned from directory"}
+	case err != nil:
+		loginEvent.Metadata["error"] = err.Error()
+		reason := "storage_error"
+		if backend != "db" {
+			reason = "backend_error"
+		}
+		emitLoginFailure(c, loginEvent, reason)
+		return db.User{}, db.Session{}, &LoginError{http.StatusInternalServerError, "Failed to get user data"}
+	}
+	session, err := LoginUser(c, userInDb, loginEvent.Metadata)
+	if err != nil {
+		return db.User{}, db.Session{}, err
+	}
+	return userInDb, session, nil
+}
+
+// LoginUser start session of the user proven by Authenticate or by external identity provider,
+// when the user is allowed to login. Metadata tell how the user is proven for the audit event.
+// The error returned is always *LoginError
+func LoginUser(c *gin.Context, user db.User, metadata map[string]interface{}) (db.Session, error) {
+	loginEvent := audit.Event{Type: audit.LoginSuccess, SubjectID: user.ID, Metadata: metadata}
+	if loginEvent.Metadata == nil {
+		loginEvent.Metadata = map[string]interface{}{}
+	}
+	if user.Disabled {
+		emitLoginFailure(c, loginEvent, "disabled_user")
+		return db.Session{}, &LoginError{http.StatusUnauthorized, "User is disabled"}
+	}
+	session, err := startSession(c, user.ID)
+	if err != nil {
+		emitLoginFailure(c, loginEvent, "storage_error")
+		return db.Session{}, &LoginError{http.StatusInternalServerError, "Failed to save session"}
+	}
+	loginEvent.Metadata["sessionID"] = session.ID
+	loginEvent.ActorID = user.ID
+	audit.Emit(c, loginEvent)
+	return session, nil
+}
+
+// loginSubject give the subject of login event, the id of the user having the login or the keyed hash of login
+// matching no user. The login itself may be email or phone number, which must not stay in audit events after
+// the account is erased
+func loginSubject(input UserLogin) string {
+	var user db.User
+	var err error
+	var login string
+	switch {
+	case len(input.ID) > 0:
+		login = "id:" + input.ID
+		user, err = users.FindUserByID(input.ID)
+	case len(input.Email) > 0:
+		login = "email:" + db.NormalizeEmail(input.Email)
+		user, err = users.FindUserByEmail(input.Email)
+	default:
+		login = "phoneNumber:" + input.PhoneNumber
+		phoneNumber, normalizeErr := phone.Normalize(input.PhoneNumber)
+		if normalizeErr != nil {
+			return audit.PseudonymousLogin(login)
+		}
+		login = "phoneNumber:" + phoneNumber
+		user, err = users.FindUserByPhoneNumber(phoneNumber)
+	}
+	if err != nil {
+		return audit.PseudonymousLogin(login)
+	}
+	return user.ID
+}
+
+func emitLoginFailure(c *gin.Context, event audit.Event, reason string) {
+	event.Type = audit.LoginFailure
+	event.Outcome = audit.Failure
+	event.Reason = reason
+	audit.Emit(c, event)
+}
+
+// startSession save new session of the user logging in from the device of the request
+func startSession(c *gin.Context, userID string) (db.Session, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return db.Session{}, err
+	}
+	now := time.Now()
+	session := db.Session{
+		ID:         hex.EncodeToString(idBytes),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		UserID:     userID,
+		ClientID:   c.GetString("clientID"),
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+	}
+	return session, sessions.CreateSession(&session)
+}
+
+// CreateToken create access and refresh token of the session
+func CreateToken(userID string, sessionID string) (TokenDetails, error) {
 	tokenDetails := TokenDetails{}
 
-	accessTokenClaims := jwt.StandardClaims{
-		Audience:  userID,
-		ExpiresAt: time.Now().Add(time.Minute * 30).Unix(),
-		IssuedAt:  time.Now().Unix(),
-		Issuer:    "SSO_TWINCAPE",
-		Subject:   "SSO_ACCESS",
+	accessTokenClaims := keyring.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  userID,
+			ExpiresAt: time.Now().Add(keyring.TokenLifetime[keyring.Access]).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "SSO_TWINCAPE",
+			Subject:   "SSO_ACCESS",
+		},
+		SessionID: sessionID,
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	signAccessToken, err := accessToken.SignedString([]byte(environments.Get("ACCESS_SECRET_KEY")))
+	signAccessToken, err := keyring.Sign(keyring.Access, accessTokenClaims)
 	if err != nil {
 		return TokenDetails{}, err
 	}
 	tokenDetails.AccessToken = signAccessToken
 
-	refreshTokenClaims := jwt.StandardClaims{
-		Audience:  userID,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 7).Unix(),
-		IssuedAt:  time.Now().Unix(),
-		Issuer:    "SSO_TWINCAPE",
-		Subject:   "SSO_REFRESH",
+	refreshTokenClaims := keyring.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  userID,
+			ExpiresAt: time.Now().Add(keyring.TokenLifetime[keyring.Refresh]).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "SSO_TWINCAPE",
+			Subject:   "SSO_REFRESH",
+		},
+		SessionID: sessionID,
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	signRefreshToken, err := refreshToken.SignedString([]byte(environments.Get("REFRESH_SECRET_KEY")))
+	signRefreshToken, err := keyring.Sign(keyring.Refresh, refreshTokenClaims)
 	if err != nil {
 		return TokenDetails{}, err
 	}
@@ -107,6 +235,15 @@ func CheckToken(c *gin.Context) {
 
 // GetLoginDetails service handler to give client user logged in details
 func GetLoginDetails(c *gin.Context) {
+	getLoginDetails(c, func(response ResponseLoginDetails) interface{} { return response })
+}
+
+// GetLoginDetailsV1 is GetLoginDetails of API v1 giving KTP number as json number
+func GetLoginDetailsV1(c *gin.Context) {
+	getLoginDetails(c, func(response ResponseLoginDetails) interface{} { return response.Downgrade() })
+}
+
+func getLoginDetails(c *gin.Context, respond func(ResponseLoginDetails) interface{}) {
 	userID, ok := c.MustGet("userID").(string)
 	if !ok {
 		c.Abort()
@@ -114,12 +251,15 @@ func GetLoginDetails(c *gin.Context) {
 			gin.H{"message": "Failed to get user id from token payload"})
 		return
 	}
-	userDb := db.User{}
-	dbInstance := db.GetDb()
-
-	dbInstance.Where(&db.User{ID: userID}).First(&userDb)
+	userDb, err := users.FindUserByID(userID)
+	if err != nil && err != db.ErrUserNotFound {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"message": "Failed to get user data"})
+		return
+	}
 
-	if len(userDb.ID) == 0 {
+	if len(userDb.ID) == 0 || userDb.Disabled {
 		c.Abort()
 		c.JSON(http.StatusUnauthorized,
 			gin.H{"message": "Invalid user logged in"})
@@ -130,48 +270,115 @@ func GetLoginDetails(c *gin.Context) {
 	response = response.CreateResponse(userDb)
 
 	c.JSON(http.StatusOK,
-		gin.H{"user": response, "message": "You are authorized"})
+		gin.H{"user": respond(response), "message": "You are authorized"})
 }
 
 // RefreshToken service handler to create new token for user logged using refresh token
 func RefreshToken(c *gin.Context) {
 	var input RequestRefreshToken
 	c.ShouldBindJSON(&input)
+	refreshEvent := audit.Event{Type: audit.TokenRefresh, Outcome: audit.Failure}
 
 	if len(input.RefreshToken) == 0 {
+		refreshEvent.Reason = "missing_token"
+		audit.Emit(c, refreshEvent)
 		c.Abort()
 		c.JSON(http.StatusBadRequest,
 			gin.H{"message": "provide refresh token in body"})
 		return
 	}
 
-	claims := jwt.StandardClaims{}
-	_, err := jwt.ParseWithClaims(input.RefreshToken, &claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(environments.Get("REFRESH_SECRET_KEY")), nil
-	})
+	claims := keyring.Claims{}
+	err := keyring.Parse(keyring.Refresh, input.RefreshToken, &claims)
 	if err != nil {
+		refreshEvent.Reason = "invalid_token"
+		refreshEvent.Metadata = map[string]interface{}{"error": err.Error()}
+		audit.Emit(c, refreshEvent)
 		c.Abort()
 		c.JSON(http.StatusBadRequest,
 			gin.H{"message": err.Error()})
 		return
 	}
 	if claims.Issuer != "SSO_TWINCAPE" {
+		refreshEvent.Reason = "invalid_issuer"
+		audit.Emit(c, refreshEvent)
 		c.Abort()
 		c.JSON(http.StatusBadRequest,
 			gin.H{"message": "Invalid refresh token"})
 		return
 	}
 	userID := claims.Audience
-	newToken, err := createToken(userID)
+	refreshEvent.SubjectID = userID
+	if len(claims.SessionID) == 0 {
+		refreshEvent.Reason = "missing_session"
+		audit.Emit(c, refreshEvent)
+		c.Abort()
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"message": "Refresh token has no session, please login again"})
+		return
+	}
+	userInDb, err := users.FindUserByID(userID)
+	if err != nil && err != db.ErrUserNotFound {
+		refreshEvent.Reason = "storage_error"
+		audit.Emit(c, refreshEvent)
+		c.Abort()
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"message": "Failed to get user data"})
+		return
+	}
+	if len(userInDb.ID) == 0 || userInDb.Disabled {
+		refreshEvent.Reason = "disabled_user"
+		audit.Emit(c, refreshEvent)
+		c.Abort()
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"message": "User is disabled"})
+		return
+	}
+	session, err := refreshSession(userID, claims.SessionID)
+	if err != nil && err != db.ErrSessionNotFound {
+		refreshEvent.Reason = "storage_error"
+		audit.Emit(c, refreshEvent)
+		c.Abort()
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"message": "Failed to get session"})
+		return
+	}
+	if err == db.ErrSessionNotFound {
+		refreshEvent.Reason = "revoked_session"
+		refreshEvent.Metadata = map[string]interface{}{"sessionID": claims.SessionID}
+		audit.Emit(c, refreshEvent)
+		c.Abort()
+		c.JSON(http.StatusUnauthorized,
+			gin.H{"message": "Session is revoked"})
+		return
+	}
+	refreshEvent.Metadata = map[string]interface{}{"sessionID": session.ID}
+	newToken, err := CreateToken(userID, session.ID)
 	if err != nil {
+		refreshEvent.Reason = "token_error"
+		audit.Emit(c, refreshEvent)
 		c.Abort()
 		c.JSON(http.StatusInternalServerError,
 			gin.H{"message": "Error when creating token"})
 		return
 	}
+	refreshEvent.Outcome = audit.Success
+	refreshEvent.ActorID = userID
+	audit.Emit(c, refreshEvent)
 
 	c.JSON(http.StatusOK, newToken)
 }
+
+// refreshSession mark the session of the refresh token as used, return ErrSessionNotFound
+// when it is revoked or not of the user
+func refreshSession(userID string, sessionID string) (db.Session, error) {
+	session, err := sessions.FindSessionByID(sessionID)
+	if err != nil {
+		return db.Session{}, err
+	}
+	if session.UserID != userID || session.RevokedAt != nil {
+		return db.Session{}, db.ErrSessionNotFound
+	}
+	session.LastUsedAt = time.Now()
+	return session, sessions.TouchSession(session.ID, session.LastUsedAt)
+}
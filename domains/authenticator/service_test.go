@@ -13,28 +13,23 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/audit"
 	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
 	"github.com/drd-engineering/TwinCape/domains/authenticator"
 	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func dbTestConfig() *db.Config {
-	return &db.Config{
-		Host:     environments.Get("HOST_DB"),
-		Username: environments.Get("USERNAME_DB"),
-		DBName:   environments.Get("DB_NAME"),
-		Password: environments.Get("PASSWORD_DB"),
-	}
-}
 func getUserLoginTest() db.User {
 	return db.User{
 		ID:          "testid",
 		Name:        "test",
 		Email:       "test@test.com",
-		KtpNumber:   10201021020102,
-		PhoneNumber: "+6200000000000",
+		KtpNumber:   "10201021020102",
+		PhoneNumber: "+6281200000000",
 	}
 }
 func secureUserPassword(password string) string {
@@ -51,15 +46,26 @@ func setupTestCase(t *testing.T) func(t *testing.T) {
 		panic(err)
 	}
 	environments.LoadEnvironmentVariableFile()
-	db.InitPostgre(dbTestConfig())
-	dbInstance := db.GetDb()
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	environments.Set("REFRESH_SECRET_KEY", "testrefreshkey")
+	users := memory.NewUserRepository()
+	authenticator.SetUserRepository(users)
+	audit.SetLogRepository(memory.NewLogRepository())
+	keyring.SetKeyRepository(memory.NewKeyRepository())
+	sessions := memory.NewSessionRepository()
+	authenticator.SetSessionRepository(sessions)
+	now := time.Now()
+	revokedAt := now
+	sessions.CreateSession(&db.Session{ID: "activesession", UserID: "testid", CreatedAt: now, LastUsedAt: now})
+	sessions.CreateSession(&db.Session{ID: "revokedsession", UserID: "testid", CreatedAt: now, LastUsedAt: now, RevokedAt: &revokedAt})
+	sessions.CreateSession(&db.Session{ID: "othersession", UserID: "otherid", CreatedAt: now, LastUsedAt: now})
 	testUser := getUserLoginTest()
 	testUser.Password = secureUserPassword("testing")
-	dbInstance.Create(&testUser)
+	users.CreateUser(&testUser)
+	users.CreateUser(&db.User{ID: "disabledid", Email: "disabled@test.com", KtpNumber: "1111",
+		Password: testUser.Password, Disabled: true})
 	return func(t *testing.T) {
 		os.Clearenv()
-		dbInstance := db.GetDb()
-		dbInstance.DropTable(db.User{}, db.APILog{})
 	}
 }
 
@@ -82,6 +88,24 @@ func TestLogin(t *testing.T) {
 			code:  200,
 			body:  []string{"accessToken", "refreshToken"},
 		},
+		{
+			name:  "SuccessLoginEmailOtherCase",
+			input: []byte(`{"email":"Test@Test.com", "password":"testing"}`),
+			code:  200,
+			body:  []string{"accessToken", "refreshToken"},
+		},
+		{
+			name:  "SuccessLoginPhoneNumberNationalFormat",
+			input: []byte(`{"phoneNumber":"0812-0000-0000", "password":"testing"}`),
+			code:  200,
+			body:  []string{"accessToken", "refreshToken"},
+		},
+		{
+			name:  "FailedLoginPhoneNumberInvalid",
+			input: []byte(`{"phoneNumber":"0812", "password":"testing"}`),
+			code:  401,
+			body:  []string{"message"},
+		},
 		{
 			name:  "FailedLoginDetailsNotMatch",
 			input: []byte(`{"id":"testid", "password":"tesing"}`),
@@ -94,6 +118,12 @@ func TestLogin(t *testing.T) {
 			code:  401,
 			body:  []string{"message"},
 		},
+		{
+			name:  "FailedLoginUserDisabled",
+			input: []byte(`{"id":"disabledid", "password":"testing"}`),
+			code:  401,
+			body:  []string{"message"},
+		},
 		{
 			name:  "FailedLoginNoJSONRequestBody",
 			input: []byte(`{"password":"testing"}`),
@@ -226,6 +256,7 @@ type jwtTestDetails struct {
 	signString string
 	issuer     string
 	userID     string
+	sessionID  string
 	expiredAt  int64
 }
 
@@ -234,11 +265,14 @@ func mockJWTCreation(jwtDetails *jwtTestDetails) authenticator.TokenDetails {
 		return authenticator.TokenDetails{}
 	}
 	tokenDetails := authenticator.TokenDetails{}
-	refreshTokenClaims := jwt.StandardClaims{
-		Audience:  jwtDetails.userID,
-		ExpiresAt: jwtDetails.expiredAt,
-		Issuer:    jwtDetails.issuer,
-		IssuedAt:  time.Now().Unix(),
+	refreshTokenClaims := keyring.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  jwtDetails.userID,
+			ExpiresAt: jwtDetails.expiredAt,
+			Issuer:    jwtDetails.issuer,
+			IssuedAt:  time.Now().Unix(),
+		},
+		SessionID: jwtDetails.sessionID,
 	}
 	refreshToken := jwt.NewWithClaims(jwtDetails.signMethod, refreshTokenClaims)
 	signRefreshToken, err := refreshToken.SignedString([]byte(environments.Get(jwtDetails.signString)))
@@ -258,12 +292,40 @@ func TestRefreshToken(t *testing.T) {
 		body  []string
 	}{
 		{
-			name: "Success",
-			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+			name: "SuccessWithSession",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "activesession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
 				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
 			code: 200,
 			body: []string{"accessToken", "refreshToken"},
 		},
+		{
+			name: "FailedWithoutSession",
+			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+			body: []string{"message"},
+		},
+		{
+			name: "FailedSessionRevoked",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "revokedsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+			body: []string{"message"},
+		},
+		{
+			name: "FailedSessionOfOtherUser",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "othersession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+			body: []string{"message"},
+		},
+		{
+			name: "FailedSessionUnknown",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "unknownsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+			body: []string{"message"},
+		},
 		{
 			name: "FailedEXPDateShowTokenExpired",
 			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * -3).Unix(),
@@ -292,6 +354,13 @@ func TestRefreshToken(t *testing.T) {
 			code: 400,
 			body: []string{"message"},
 		},
+		{
+			name: "FailedUserDisabled",
+			input: jwtTestDetails{create: true, userID: "disabledid", sessionID: "activesession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "REFRESH_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+			body: []string{"message"},
+		},
 		{
 			name: "FailedIssuerJWTtokenIsNotSSO",
 			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
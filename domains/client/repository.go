@@ -0,0 +1,17 @@
+package client
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ClientRepository is client storage used by client management
+type ClientRepository interface {
+	CreateClient(client *db.Client) error
+}
+
+var clients ClientRepository = db.NewGormClientRepository(nil)
+
+// SetClientRepository replace client storage used by client management
+func SetClientRepository(repository ClientRepository) {
+	clients = repository
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// Create register application allowed to call SSO System, return the client saved with its secret,
+// only hash of the secret is saved so it can not be shown again
+func Create(name string) (db.Client, string, error) {
+	if len(name) == 0 {
+		return db.Client{}, "", errors.New("Client name must not be empty")
+	}
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return db.Client{}, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return db.Client{}, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	client := db.Client{
+		ID:         hex.EncodeToString(idBytes),
+		Name:       name,
+		SecretHash: db.HashClientSecret(secret),
+	}
+	if err := clients.CreateClient(&client); err != nil {
+		return db.Client{}, "", err
+	}
+	audit.Record(audit.Event{
+		Type:     audit.AdminAction,
+		Metadata: map[string]interface{}{"action": "create_client", "clientID": client.ID, "name": name},
+	})
+	return client, secret, nil
+}
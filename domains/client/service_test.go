@@ -0,0 +1,32 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/client"
+)
+
+func TestCreate(t *testing.T) {
+	clients := memory.NewClientRepository()
+	client.SetClientRepository(clients)
+	audit.SetLogRepository(memory.NewLogRepository())
+
+	created, secret, err := client.Create("test")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.ID, "id should be generated")
+	assert.NotEqual(t, secret, created.SecretHash, "secret should be saved hashed")
+	found, err := clients.FindClientByID(created.ID)
+	assert.Nil(t, err)
+	assert.True(t, found.VerifySecret(secret), "the returned secret should be the client secret")
+
+	other, otherSecret, _ := client.Create("test")
+	assert.NotEqual(t, created.ID, other.ID, "every client should have different id")
+	assert.NotEqual(t, secret, otherSecret, "every client should have different secret")
+
+	_, _, err = client.Create("")
+	assert.Error(t, err, "client without name should be rejected")
+}
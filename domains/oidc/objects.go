@@ -0,0 +1,46 @@
+package oidc
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/domains/register"
+)
+
+// stateClaims is content of the state cookie keeping the login request while the user
+// is at the provider, it is signed so the callback can trust it
+type stateClaims struct {
+	jwt.StandardClaims
+	State       string `json:"state"`
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	RedirectURI string `json:"redirectUri,omitempty"`
+}
+
+// registrationClaims is content of the registration token given when the provider account
+// is not linked to any user, subject is the account at the provider
+type registrationClaims struct {
+	jwt.StandardClaims
+	Provider string `json:"provider"`
+	// Email is only set when the provider verified it
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// idTokenClaims is user details given by the provider in ID token
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// RequestRegistration is json request body completing registration of user logged in through provider,
+// name and email given by the provider are used when they are empty
+type RequestRegistration struct {
+	RegistrationToken string `json:"registrationToken"`
+	register.UserRegistrationData
+}
+
+// RequestRegistrationV1 is RequestRegistration of API v1 where KTP number is json number
+type RequestRegistrationV1 struct {
+	RegistrationToken string `json:"registrationToken"`
+	register.UserRegistrationDataV1
+}
@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/drd-engineering/TwinCape/environments"
+	"golang.org/x/oauth2"
+)
+
+// basePath is path of the OpenID Connect routes added by InitiateRoutes
+const basePath = "/api/v1/sso/oidc"
+
+// ErrUnknownProvider returned when the provider is not listed in OIDC_PROVIDERS
+var ErrUnknownProvider = errors.New("oidc: provider is not configured")
+
+// provider is external OpenID Connect provider configured by OIDC_<NAME>_* environment variable
+type provider struct {
+	name     string
+	oauth2   oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+var discoveryLock sync.Mutex
+
+// discovered keep discovery document of every issuer, it is fetched once as it rarely change
+var discovered = map[string]*gooidc.Provider{}
+
+// findProvider give the provider listed in OIDC_PROVIDERS having the name
+func findProvider(name string) (provider, error) {
+	listed := false
+	for _, configured := range strings.Split(environments.Get("OIDC_PROVIDERS"), ",") {
+		listed = listed || (len(name) > 0 && strings.TrimSpace(configured) == name)
+	}
+	if !listed {
+		return provider{}, ErrUnknownProvider
+	}
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	issuer := environments.Get(prefix + "ISSUER")
+	clientID := environments.Get(prefix + "CLIENT_ID")
+	baseURL := strings.TrimSuffix(environments.Get("OIDC_BASE_URL"), "/")
+	if len(issuer) == 0 || len(clientID) == 0 || len(baseURL) == 0 {
+		return provider{}, fmt.Errorf("oidc: OIDC_BASE_URL, %sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+	}
+	discovery, err := discover(issuer)
+	if err != nil {
+		return provider{}, err
+	}
+	return provider{
+		name: name,
+		oauth2: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: environments.Get(prefix + "CLIENT_SECRET"),
+			Endpoint:     discovery.Endpoint(),
+			RedirectURL:  baseURL + basePath + "/" + name + "/callback",
+			Scopes:       []string{gooidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: discovery.Verifier(&gooidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+func discover(issuer string) (*gooidc.Provider, error) {
+	discoveryLock.Lock()
+	defer discoveryLock.Unlock()
+	if discovery, ok := discovered[issuer]; ok {
+		return discovery, nil
+	}
+	// keys of the issuer are fetched later using this context, so it must outlive the request
+	discovery, err := gooidc.NewProvider(context.Background(), issuer)
+	if err != nil {
+		return nil, err
+	}
+	discovered[issuer] = discovery
+	return discovery, nil
+}
+
+// isRedirectURIAllowed tell the application URI is listed in OIDC_REDIRECT_URIS,
+// tokens are given to it so it must be one of our applications
+func isRedirectURIAllowed(redirectURI string) bool {
+	for _, allowed := range strings.Split(environments.Get("OIDC_REDIRECT_URIS"), ",") {
+		if len(redirectURI) > 0 && strings.TrimSpace(allowed) == redirectURI {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package oidc
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// IdentityLinkRepository is identity link storage used by login through external provider
+type IdentityLinkRepository interface {
+	FindIdentityLink(provider string, subject string) (db.IdentityLink, error)
+	CreateIdentityLink(link *db.IdentityLink) error
+}
+
+// UserRepository is user storage used by login through external provider
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	FindUserByEmail(email string) (db.User, error)
+	PurgeUser(id string) error
+}
+
+var links IdentityLinkRepository = db.NewGormIdentityLinkRepository(nil)
+var users UserRepository = db.NewGormUserRepository(nil)
+
+// SetIdentityLinkRepository replace identity link storage used by login through external provider
+func SetIdentityLinkRepository(repository IdentityLinkRepository) {
+	links = repository
+}
+
+// SetUserRepository replace user storage used by login through external provider
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
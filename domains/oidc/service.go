@@ -0,0 +1,313 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// stateCookie keep the login request while the user is at the provider
+const stateCookie = "twincape_oidc_state"
+
+// Login service handler sending the user to login at the provider, redirect_uri is the application
+// receiving the tokens after the callback, without it the callback respond with json
+func Login(c *gin.Context) {
+	provider, ok := getProvider(c)
+	if !ok {
+		return
+	}
+	redirectURI := c.Query("redirect_uri")
+	if len(redirectURI) > 0 && !isRedirectURIAllowed(redirectURI) {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Redirect URI is not allowed"})
+		return
+	}
+	state, err := newState(provider.name, redirectURI)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to start login"})
+		return
+	}
+	signedState, err := keyring.Sign(keyring.Access, state)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to start login"})
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     stateCookie,
+		Value:    signedState,
+		Path:     basePath + "/" + provider.name,
+		MaxAge:   int(stateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(environments.Get("OIDC_BASE_URL"), "https://"),
+		// provider redirect the user back with top level navigation, lax cookie is sent with it
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, provider.oauth2.AuthCodeURL(state.State,
+		gooidc.Nonce(state.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(state.Verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	))
+}
+
+// Callback service handler receiving the user back from the provider, the user linked to the account
+// at the provider is logged in. Account not linked yet is linked to the user having the same email
+// when the provider verified it, otherwise registration token is given to complete the registration
+func Callback(c *gin.Context) {
+	provider, ok := getProvider(c)
+	if !ok {
+		return
+	}
+	loginEvent := audit.Event{Metadata: map[string]interface{}{"loginWith": "oidc", "provider": provider.name}}
+	cookie, err := c.Request.Cookie(stateCookie)
+	if err != nil {
+		emitLoginFailure(c, loginEvent, "invalid_state")
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Login is not started or already expired"})
+		return
+	}
+	state, err := parseState(provider.name, cookie.Value)
+	if err != nil || state.State != c.Query("state") {
+		emitLoginFailure(c, loginEvent, "invalid_state")
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Login is not started or already expired"})
+		return
+	}
+	// state can only be used once
+	http.SetCookie(c.Writer, &http.Cookie{Name: stateCookie, Path: basePath + "/" + provider.name, MaxAge: -1})
+	if providerError := c.Query("error"); len(providerError) > 0 {
+		loginEvent.Metadata["error"] = providerError
+		emitLoginFailure(c, loginEvent, "provider_error")
+		respond(c, state.RedirectURI, http.StatusUnauthorized, map[string]string{"message": "Login is rejected by provider"})
+		return
+	}
+	token, err := provider.oauth2.Exchange(c.Request.Context(), c.Query("code"),
+		oauth2.SetAuthURLParam("code_verifier", state.Verifier))
+	if err != nil {
+		loginEvent.Metadata["error"] = err.Error()
+		emitLoginFailure(c, loginEvent, "exchange_failed")
+		respond(c, state.RedirectURI, http.StatusUnauthorized, map[string]string{"message": "Failed to login with provider"})
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := provider.verifier.Verify(c.Request.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != state.Nonce {
+		emitLoginFailure(c, loginEvent, "invalid_id_token")
+		respond(c, state.RedirectURI, http.StatusUnauthorized, map[string]string{"message": "Failed to login with provider"})
+		return
+	}
+	userClaims := idTokenClaims{}
+	if err := idToken.Claims(&userClaims); err != nil {
+		emitLoginFailure(c, loginEvent, "invalid_id_token")
+		respond(c, state.RedirectURI, http.StatusUnauthorized, map[string]string{"message": "Failed to login with provider"})
+		return
+	}
+	loginEvent.SubjectID = idToken.Subject
+
+	user, err := findLinkedUser(provider.name, idToken.Subject, userClaims)
+	if err == db.ErrUserNotFound {
+		registrationToken, err := signRegistration(provider.name, idToken.Subject, userClaims)
+		if err != nil {
+			respond(c, state.RedirectURI, http.StatusInternalServerError, map[string]string{"message": "Failed to start registration"})
+			return
+		}
+		email := ""
+		if userClaims.EmailVerified {
+			email = userClaims.Email
+		}
+		respond(c, state.RedirectURI, http.StatusOK, map[string]string{
+			"registrationToken": registrationToken,
+			"email":             email,
+			"name":              userClaims.Name,
+			"message":           "Registration must be completed",
+		})
+		return
+	}
+	if err != nil {
+		loginEvent.Metadata["error"] = err.Error()
+		emitLoginFailure(c, loginEvent, "storage_error")
+		respond(c, state.RedirectURI, http.StatusInternalServerError, map[string]string{"message": "Failed to get user data"})
+		return
+	}
+	tokenDetails, loginErr := loginUser(c, user, provider.name)
+	if loginErr != nil {
+		respond(c, state.RedirectURI, loginErr.Status, map[string]string{"message": loginErr.Message})
+		return
+	}
+	respond(c, state.RedirectURI, http.StatusOK, map[string]string{
+		"accessToken":  tokenDetails.AccessToken,
+		"refreshToken": tokenDetails.RefreshToken,
+	})
+}
+
+// CompleteRegistration service handler creating user of the account at the provider having registration
+// token, through the same rules as register.SaveUser, then log the user in
+func CompleteRegistration(c *gin.Context) {
+	var input RequestRegistration
+	c.ShouldBindJSON(&input)
+	completeRegistration(c, input, func(response register.ResponseSaveUser) interface{} { return response })
+}
+
+// CompleteRegistrationV1 is CompleteRegistration of API v1 taking and giving KTP number as json number
+func CompleteRegistrationV1(c *gin.Context) {
+	var input RequestRegistrationV1
+	c.ShouldBindJSON(&input)
+	completeRegistration(c, RequestRegistration{input.RegistrationToken, input.Upgrade()},
+		func(response register.ResponseSaveUser) interface{} { return response.Downgrade() })
+}
+
+// completeRegistration register and link the account, respond convert the saved user to the response of the
+// API version. User failing to be linked is removed so the account can register again
+func completeRegistration(c *gin.Context, input RequestRegistration, respond func(register.ResponseSaveUser) interface{}) {
+	claims, err := parseRegistration(input.RegistrationToken)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Registration token is invalid or expired"})
+		return
+	}
+	if _, err := links.FindIdentityLink(claims.Provider, claims.Subject); err == nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Account is already registered"})
+		return
+	} else if err != db.ErrIdentityLinkNotFound {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get user data"})
+		return
+	}
+	// email verified by the provider is trusted, so it can not be replaced
+	if len(claims.Email) > 0 {
+		input.Email = claims.Email
+	}
+	if len(input.Name) == 0 {
+		input.Name = claims.Name
+	}
+	user, _, err := register.CreateUser(input.UserRegistrationData, false)
+	var validationErr *register.ValidationError
+	if errors.As(err, &validationErr) {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": validationErr.Message})
+		return
+	}
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save user"})
+		return
+	}
+	if err := links.CreateIdentityLink(&db.IdentityLink{
+		CreatedAt: time.Now(),
+		Provider:  claims.Provider,
+		Subject:   claims.Subject,
+		UserID:    user.ID,
+		Email:     claims.Email,
+	}); err != nil {
+		// user without link can not login by the provider and would hold its KTP number and email
+		users.PurgeUser(user.ID)
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to link account"})
+		return
+	}
+	tokenDetails, loginErr := loginUser(c, user, claims.Provider)
+	if loginErr != nil {
+		c.Abort()
+		c.JSON(loginErr.Status, gin.H{"message": loginErr.Message})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":         respond(register.ResponseSaveUser{}.CreateResponse(user)),
+		"accessToken":  tokenDetails.AccessToken,
+		"refreshToken": tokenDetails.RefreshToken,
+		"message":      "User saved",
+	})
+}
+
+// findLinkedUser give the user linked to the account at the provider, db.ErrUserNotFound
+// means the account must be registered
+func findLinkedUser(providerName string, subject string, userClaims idTokenClaims) (db.User, error) {
+	link, err := links.FindIdentityLink(providerName, subject)
+	if err == nil {
+		return users.FindUserByID(link.UserID)
+	}
+	if err != db.ErrIdentityLinkNotFound {
+		return db.User{}, err
+	}
+	// unverified email may belong to someone else, linking it would give away the user
+	if !userClaims.EmailVerified || len(userClaims.Email) == 0 {
+		return db.User{}, db.ErrUserNotFound
+	}
+	user, err := users.FindUserByEmail(userClaims.Email)
+	if err != nil {
+		return db.User{}, err
+	}
+	err = links.CreateIdentityLink(&db.IdentityLink{
+		CreatedAt: time.Now(),
+		Provider:  providerName,
+		Subject:   subject,
+		UserID:    user.ID,
+		Email:     userClaims.Email,
+	})
+	return user, err
+}
+
+func loginUser(c *gin.Context, user db.User, providerName string) (authenticator.TokenDetails, *authenticator.LoginError) {
+	session, err := authenticator.LoginUser(c, user, map[string]interface{}{"loginWith": "oidc", "provider": providerName})
+	if err != nil {
+		return authenticator.TokenDetails{}, err.(*authenticator.LoginError)
+	}
+	tokenDetails, err := authenticator.CreateToken(user.ID, session.ID)
+	if err != nil {
+		return authenticator.TokenDetails{}, &authenticator.LoginError{Status: http.StatusInternalServerError, Message: "Error when creating token"}
+	}
+	return tokenDetails, nil
+}
+
+// getProvider give the provider of the path, responding the error when it is unknown or not configured
+func getProvider(c *gin.Context) (provider, bool) {
+	provider, err := findProvider(c.Param("provider"))
+	if err == ErrUnknownProvider {
+		c.Abort()
+		c.JSON(http.StatusNotFound, gin.H{"message": "Unknown provider"})
+		return provider, false
+	}
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return provider, false
+	}
+	return provider, true
+}
+
+// respond give the result of the callback to the application in URI fragment, so it is not sent
+// to any server, or as json when the login is not started by an application
+func respond(c *gin.Context, redirectURI string, status int, result map[string]string) {
+	if len(redirectURI) == 0 {
+		c.JSON(status, result)
+		return
+	}
+	values := url.Values{}
+	for key, value := range result {
+		if len(value) > 0 {
+			values.Set(key, value)
+		}
+	}
+	c.Redirect(http.StatusFound, redirectURI+"#"+values.Encode())
+}
+
+func emitLoginFailure(c *gin.Context, event audit.Event, reason string) {
+	event.Type = audit.LoginFailure
+	event.Outcome = audit.Failure
+	event.Reason = reason
+	audit.Emit(c, event)
+}
@@ -0,0 +1,339 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/oidc"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// account is user logged in at the mock provider
+type account struct {
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+// authorization is request of the mock provider waiting for the code to be exchanged
+type authorization struct {
+	account   account
+	nonce     string
+	challenge string
+}
+
+// mockProvider is OpenID Connect provider signing ID token for the account given to authorize
+type mockProvider struct {
+	server         *httptest.Server
+	key            *rsa.PrivateKey
+	lock           sync.Mutex
+	authorizations map[string]authorization
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &mockProvider{key: key, authorizations: map[string]authorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                provider.server.URL,
+			"authorization_endpoint":                provider.server.URL + "/authorize",
+			"token_endpoint":                        provider.server.URL + "/token",
+			"jwks_uri":                              provider.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "testkey",
+			"n": base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	return provider
+}
+
+// authorize act as the user logging in at the provider, giving the code of the authorization URL
+func (p *mockProvider) authorize(t *testing.T, authorizationURL string, loggedIn account) (state string, code string) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil || !strings.HasPrefix(authorizationURL, p.server.URL+"/authorize") {
+		t.Fatalf("login should redirect to the provider, got %s", authorizationURL)
+	}
+	query := parsed.Query()
+	assert.Equal(t, "S256", query.Get("code_challenge_method"), "PKCE should be used")
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	code = loggedIn.subject + "code"
+	p.authorizations[code] = authorization{account: loggedIn, nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	return query.Get("state"), code
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	authorized, ok := p.authorizations[r.PostFormValue("code")]
+	delete(p.authorizations, r.PostFormValue("code"))
+	p.lock.Unlock()
+	verifierHash := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != authorized.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            authorized.account.subject,
+		"aud":            "testclient",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          authorized.nonce,
+		"email":          authorized.account.email,
+		"email_verified": authorized.account.emailVerified,
+		"name":           "test provider",
+	})
+	token.Header["kid"] = "testkey"
+	idToken, _ := token.SignedString(p.key)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "provideraccesstoken", "token_type": "Bearer", "expires_in": 60, "id_token": idToken,
+	})
+}
+
+func setupTestCase(t *testing.T) (*gin.Engine, *mockProvider, *memory.IdentityLinkRepository, func(t *testing.T)) {
+	provider := newMockProvider(t)
+	environments.Set("OIDC_PROVIDERS", "test")
+	environments.Set("OIDC_BASE_URL", "http://sso.test")
+	environments.Set("OIDC_TEST_ISSUER", provider.server.URL)
+	environments.Set("OIDC_TEST_CLIENT_ID", "testclient")
+	environments.Set("OIDC_TEST_CLIENT_SECRET", "testsecret")
+	environments.Set("OIDC_REDIRECT_URIS", "http://app.test/callback")
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	environments.Set("REFRESH_SECRET_KEY", "testrefreshkey")
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+
+	users := memory.NewUserRepository()
+	links := memory.NewIdentityLinkRepository()
+	authenticator.SetUserRepository(users)
+	authenticator.SetSessionRepository(memory.NewSessionRepository())
+	register.SetUserRepository(users)
+	oidc.SetUserRepository(users)
+	oidc.SetIdentityLinkRepository(links)
+	audit.SetLogRepository(memory.NewLogRepository())
+	keyring.SetKeyRepository(memory.NewKeyRepository())
+	users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "1", PhoneNumber: "+6281200000001"})
+	users.CreateUser(&db.User{ID: "disabledid", Email: "disabled@test.com", KtpNumber: "2", PhoneNumber: "+6281200000002", Disabled: true})
+
+	r := gin.New()
+	r.GET("/api/v1/sso/oidc/:provider/login", oidc.Login)
+	r.GET("/api/v1/sso/oidc/:provider/callback", oidc.Callback)
+	r.POST("/api/v1/sso/register/oidc", oidc.CompleteRegistrationV1)
+	r.POST("/api/v2/sso/register/oidc", oidc.CompleteRegistration)
+	return r, provider, links, func(t *testing.T) {
+		provider.server.Close()
+		os.Clearenv()
+	}
+}
+
+// login go through the login at the provider and give the callback response
+func login(t *testing.T, r *gin.Engine, provider *mockProvider, loggedIn account, redirectURI string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/sso/oidc/test/login?redirect_uri="+url.QueryEscape(redirectURI), nil))
+	if w.Code != http.StatusFound {
+		return w
+	}
+	state, code := provider.authorize(t, w.Header().Get("Location"), loggedIn)
+	req := httptest.NewRequest("GET", "/api/v1/sso/oidc/test/callback?state="+state+"&code="+code, nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginWithProvider(t *testing.T) {
+	testCases := []struct {
+		name            string
+		account         account
+		redirectURI     string
+		expectedCode    int
+		expectedUserID  string
+		expectedLinked  bool
+		expectedMessage string
+	}{
+		{"verified email of existing user", account{"subject1", "test@test.com", true}, "", 200, "testid", true, ""},
+		{"unverified email of existing user", account{"subject2", "test@test.com", false}, "", 200, "", false, "Registration must be completed"},
+		{"unknown email", account{"subject3", "new@test.com", true}, "", 200, "", false, "Registration must be completed"},
+		{"disabled user", account{"subject4", "disabled@test.com", true}, "", 401, "", true, "User is disabled"},
+		{"redirect not allowed", account{"subject5", "test@test.com", true}, "http://evil.test", 400, "", false, "Redirect URI is not allowed"},
+	}
+	for _, tc := range testCases {
+		r, provider, links, teardownTestCase := setupTestCase(t)
+		w := login(t, r, provider, tc.account, tc.redirectURI)
+		got := map[string]string{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, tc.expectedCode, w.Code, "test "+tc.name+" case")
+		assert.Equal(t, tc.expectedMessage, got["message"], "test "+tc.name+" case")
+		if len(tc.expectedUserID) > 0 {
+			claims := keyring.Claims{}
+			assert.Nil(t, keyring.Parse(keyring.Access, got["accessToken"], &claims), "test "+tc.name+" case")
+			assert.Equal(t, tc.expectedUserID, claims.Audience, "test "+tc.name+" case")
+		}
+		_, err := links.FindIdentityLink("test", tc.account.subject)
+		assert.Equal(t, tc.expectedLinked, err == nil, "test "+tc.name+" case")
+		teardownTestCase(t)
+	}
+}
+
+func TestLinkedAccountLogin(t *testing.T) {
+	r, provider, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	login(t, r, provider, account{"subject1", "test@test.com", true}, "")
+
+	// email at the provider is changed, the link still identify the user
+	w := login(t, r, provider, account{"subject1", "changed@test.com", false}, "http://app.test/callback")
+	assert.Equal(t, http.StatusFound, w.Code, "application should receive the tokens")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "app.test", location.Host)
+	fragment, _ := url.ParseQuery(location.Fragment)
+	claims := keyring.Claims{}
+	assert.Nil(t, keyring.Parse(keyring.Access, fragment.Get("accessToken"), &claims))
+	assert.Equal(t, "testid", claims.Audience, "linked user should be logged in")
+
+	req := httptest.NewRequest("GET", "/api/v1/sso/oidc/test/callback?state=forged&code=subject1code", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "callback without state cookie should be rejected")
+}
+
+func TestCompleteRegistration(t *testing.T) {
+	testCases := []struct {
+		name          string
+		account       account
+		email         string
+		expectedCode  int
+		expectedEmail string
+	}{
+		{"verified email", account{"subject1", "new@test.com", true}, "other@test.com", 200, "new@test.com"},
+		{"unverified email", account{"subject2", "test@test.com", false}, "own@test.com", 200, "own@test.com"},
+		{"unverified email of existing user", account{"subject3", "test@test.com", false}, "test@test.com", 400, ""},
+	}
+	for _, tc := range testCases {
+		r, provider, links, teardownTestCase := setupTestCase(t)
+		w := login(t, r, provider, tc.account, "")
+		got := map[string]string{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		body, _ := json.Marshal(gin.H{
+			"registrationToken": got["registrationToken"], "email": tc.email, "ktpNumber": "3201011505900003", "phoneNumber": "+6281200000003",
+		})
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/sso/register/oidc", strings.NewReader(string(body))))
+		response := struct {
+			User        register.ResponseSaveUser `json:"user"`
+			AccessToken string                    `json:"accessToken"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, tc.expectedCode, w.Code, "test "+tc.name+" case")
+		assert.Equal(t, tc.expectedEmail, response.User.Email, "test "+tc.name+" case")
+		link, err := links.FindIdentityLink("test", tc.account.subject)
+		if tc.expectedCode == 200 {
+			assert.Nil(t, err, "test "+tc.name+" case")
+			assert.Equal(t, response.User.ID, link.UserID, "test "+tc.name+" case")
+			assert.NotEmpty(t, response.AccessToken, "test "+tc.name+" case")
+
+			// registration token can not register the account twice
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/sso/register/oidc", strings.NewReader(string(body))))
+			assert.Equal(t, http.StatusBadRequest, w.Code, "test "+tc.name+" case")
+		} else {
+			assert.Equal(t, db.ErrIdentityLinkNotFound, err, "test "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+
+	r, _, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/sso/register/oidc", strings.NewReader(`{"registrationToken":"invalid"}`)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "invalid registration token should be rejected")
+}
+
+func TestCompleteRegistrationV1(t *testing.T) {
+	r, provider, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	w := login(t, r, provider, account{"subject1", "new@test.com", true}, "")
+	got := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	body, _ := json.Marshal(gin.H{
+		"registrationToken": got["registrationToken"], "ktpNumber": 3201011505900003, "phoneNumber": "+6281200000003",
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/sso/register/oidc", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, w.Code, "KTP number as json number should be taken by API v1")
+	response := struct {
+		User struct {
+			KtpNumber interface{} `json:"ktpNumber"`
+		} `json:"user"`
+	}{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(3201011505900003), response.User.KtpNumber, "API v1 should give KTP number as json number")
+}
+
+// failingLinks is identity link storage failing to save links
+type failingLinks struct {
+	*memory.IdentityLinkRepository
+}
+
+func (failingLinks) CreateIdentityLink(link *db.IdentityLink) error {
+	return errors.New("link storage is down")
+}
+
+func TestCompleteRegistrationLinkFailure(t *testing.T) {
+	r, provider, links, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	w := login(t, r, provider, account{"subject1", "new@test.com", true}, "")
+	got := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	body, _ := json.Marshal(gin.H{
+		"registrationToken": got["registrationToken"], "ktpNumber": "3201011505900003", "phoneNumber": "+6281200000003",
+	})
+
+	oidc.SetIdentityLinkRepository(failingLinks{links})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/sso/register/oidc", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "registration failing to link should fail")
+
+	// user failing to be linked is removed, so its KTP number, email and phone number can register again
+	oidc.SetIdentityLinkRepository(links)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/v2/sso/register/oidc", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusOK, w.Code, "registration should succeed once the account can be linked")
+}
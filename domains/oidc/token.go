@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/keyring"
+)
+
+const (
+	// stateIssuer and registrationIssuer differ from the issuer of access token,
+	// so neither of them can be used as access token
+	stateIssuer        = "SSO_TWINCAPE_OIDC_STATE"
+	registrationIssuer = "SSO_TWINCAPE_OIDC"
+	// stateLifetime is how long the user can stay at the provider before the callback
+	stateLifetime = 10 * time.Minute
+	// registrationLifetime is how long the user can take to complete the registration
+	registrationLifetime = 30 * time.Minute
+)
+
+var errInvalidToken = errors.New("oidc: token is invalid")
+
+func randomString() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// codeChallenge give the S256 PKCE challenge of the verifier
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func newState(providerName string, redirectURI string) (stateClaims, error) {
+	claims := stateClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  providerName,
+			ExpiresAt: time.Now().Add(stateLifetime).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    stateIssuer,
+		},
+		RedirectURI: redirectURI,
+	}
+	var err error
+	if claims.State, err = randomString(); err != nil {
+		return stateClaims{}, err
+	}
+	if claims.Nonce, err = randomString(); err != nil {
+		return stateClaims{}, err
+	}
+	if claims.Verifier, err = randomString(); err != nil {
+		return stateClaims{}, err
+	}
+	return claims, nil
+}
+
+func parseState(providerName string, tokenString string) (stateClaims, error) {
+	claims := stateClaims{}
+	if err := keyring.Parse(keyring.Access, tokenString, &claims); err != nil {
+		return stateClaims{}, err
+	}
+	if claims.Issuer != stateIssuer || claims.Audience != providerName {
+		return stateClaims{}, errInvalidToken
+	}
+	return claims, nil
+}
+
+func signRegistration(providerName string, subject string, userClaims idTokenClaims) (string, error) {
+	claims := registrationClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(registrationLifetime).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    registrationIssuer,
+			Subject:   subject,
+		},
+		Provider: providerName,
+		Name:     userClaims.Name,
+	}
+	if userClaims.EmailVerified {
+		claims.Email = userClaims.Email
+	}
+	return keyring.Sign(keyring.Access, claims)
+}
+
+func parseRegistration(tokenString string) (registrationClaims, error) {
+	claims := registrationClaims{}
+	if err := keyring.Parse(keyring.Access, tokenString, &claims); err != nil {
+		return registrationClaims{}, err
+	}
+	if claims.Issuer != registrationIssuer || len(claims.Provider) == 0 || len(claims.Subject) == 0 {
+		return registrationClaims{}, errInvalidToken
+	}
+	return claims, nil
+}
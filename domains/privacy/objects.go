@@ -0,0 +1,164 @@
+package privacy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+)
+
+// Archive is everything held about a user, given by data export. Password hash is not exported
+type Archive struct {
+	ExportedAt    time.Time               `json:"exportedAt"`
+	User          ArchivedUser            `json:"user"`
+	Sessions      []ArchivedSession       `json:"sessions"`
+	IdentityLinks []ArchivedIdentityLink  `json:"identityLinks"`
+	Groups        []ArchivedGroup         `json:"groups"`
+	APILogs       []apilog.ResponseAPILog `json:"apiLogs"`
+	AuditEvents   []ArchivedAuditEvent    `json:"auditEvents"`
+}
+
+// ArchivedUser is profile of the user in the archive, KTP number is string as in API v2
+type ArchivedUser struct {
+	ID                  string     `json:"id"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	DeletedAt           *time.Time `json:"deletedAt"`
+	Name                string     `json:"name"`
+	Gender              string     `json:"gender"`
+	Email               string     `json:"email"`
+	KtpNumber           string     `json:"ktpNumber"`
+	Address             string     `json:"address"`
+	PhoneNumber         string     `json:"phoneNumber"`
+	OriginalPhoneNumber string     `json:"originalPhoneNumber"`
+	DateOfBirth         time.Time  `json:"dateofBirth"`
+	Cityzenship         string     `json:"cityzenship"`
+	PlaceOfBirth        string     `json:"placeofBirth"`
+	IsAdmin             bool       `json:"isAdmin"`
+	Disabled            bool       `json:"disabled"`
+	ExternalID          string     `json:"externalId"`
+	// Erased tell the personal data of the user is already erased
+	Erased bool `json:"erased"`
+}
+
+// CreateArchive from database
+func (t ArchivedUser) CreateArchive(user db.User) ArchivedUser {
+	t.ID = user.ID
+	t.CreatedAt = user.CreatedAt
+	t.UpdatedAt = user.UpdatedAt
+	t.DeletedAt = user.DeletedAt
+	t.Name = user.Name
+	t.Gender = user.Gender
+	t.Email = user.Email
+	t.KtpNumber = user.KtpNumber
+	t.Address = user.Address
+	t.PhoneNumber = user.PhoneNumber
+	t.OriginalPhoneNumber = user.OriginalPhoneNumber
+	t.DateOfBirth = user.DateOfBirth
+	t.Cityzenship = user.Cityzenship
+	t.PlaceOfBirth = user.PlaceOfBirth
+	t.IsAdmin = user.IsAdmin
+	t.Disabled = user.Disabled
+	t.ExternalID = user.ExternalID
+	t.Erased = user.IsErased()
+	if t.Erased {
+		t.KtpNumber = ""
+	}
+	return t
+}
+
+// ArchivedSession is a login session of the user in the archive
+type ArchivedSession struct {
+	ID         string     `json:"id"`
+	ClientID   string     `json:"clientId"`
+	UserAgent  string     `json:"userAgent"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// CreateArchive from database
+func (t ArchivedSession) CreateArchive(session db.Session) ArchivedSession {
+	t.ID = session.ID
+	t.ClientID = session.ClientID
+	t.UserAgent = session.UserAgent
+	t.IPAddress = session.IPAddress
+	t.CreatedAt = session.CreatedAt
+	t.LastUsedAt = session.LastUsedAt
+	t.RevokedAt = session.RevokedAt
+	return t
+}
+
+// ArchivedIdentityLink is an account of a login provider linked to the user in the archive
+type ArchivedIdentityLink struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateArchive from database
+func (t ArchivedIdentityLink) CreateArchive(link db.IdentityLink) ArchivedIdentityLink {
+	t.Provider = link.Provider
+	t.Subject = link.Subject
+	t.Email = link.Email
+	t.CreatedAt = link.CreatedAt
+	return t
+}
+
+// ArchivedGroup is a group the user is member of in the archive
+type ArchivedGroup struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// ArchivedAuditEvent is an audit event done by or to the user in the archive
+type ArchivedAuditEvent struct {
+	ID        int             `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type"`
+	Outcome   string          `json:"outcome"`
+	Reason    string          `json:"reason"`
+	ActorID   string          `json:"actorId"`
+	SubjectID string          `json:"subjectId"`
+	ClientID  string          `json:"clientId"`
+	ClientIP  string          `json:"clientIp"`
+	UserAgent string          `json:"userAgent"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// CreateArchive from database, metadata which is not json is given as json string
+func (t ArchivedAuditEvent) CreateArchive(event db.AuditEvent) ArchivedAuditEvent {
+	t.ID = event.ID
+	t.Timestamp = event.Timestamp
+	t.Type = event.Type
+	t.Outcome = event.Outcome
+	t.Reason = event.Reason
+	t.ActorID = event.ActorID
+	t.SubjectID = event.SubjectID
+	t.ClientID = event.ClientID
+	t.ClientIP = event.ClientIP
+	t.UserAgent = event.UserAgent
+	t.Metadata = json.RawMessage(event.Metadata)
+	if !json.Valid(t.Metadata) {
+		t.Metadata, _ = json.Marshal(event.Metadata)
+	}
+	return t
+}
+
+// Erasure is result of erasing a user, the number of records erased in each storage
+type Erasure struct {
+	Sessions      int64 `json:"sessions"`
+	IdentityLinks int64 `json:"identityLinks"`
+	APILogs       int   `json:"apiLogs"`
+	// APILogIDs are the api logs redacted, recorded by the audit event so verifying the chain can tell
+	// them from logs redacted without an erasure
+	APILogIDs []int `json:"-"`
+}
+
+// ErasureConfirmation is json request body of the user erasing its own account
+type ErasureConfirmation struct {
+	Password string `json:"password"`
+}
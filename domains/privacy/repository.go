@@ -0,0 +1,68 @@
+package privacy
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by data export and erasure
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	FindUserWithDeleted(id string) (db.User, error)
+	EraseUser(id string) error
+}
+
+// SessionRepository is session storage used by data export and erasure
+type SessionRepository interface {
+	FindSessionsOfUser(userID string) ([]db.Session, error)
+	EraseUserSessions(userID string) (int64, error)
+}
+
+// IdentityLinkRepository is identity link storage used by data export and erasure
+type IdentityLinkRepository interface {
+	FindIdentityLinksOfUser(userID string) ([]db.IdentityLink, error)
+	DeleteIdentityLinksOfUser(userID string) (int64, error)
+}
+
+// GroupRepository is group storage used by data export and erasure
+type GroupRepository interface {
+	FindGroupsOfUser(userID string) ([]db.Group, error)
+	RemoveUserFromGroups(userID string) error
+}
+
+// LogRepository is api log and audit event storage used by data export and erasure
+type LogRepository interface {
+	SearchAPILogs(query db.APILogQuery) ([]db.APILog, error)
+	FindAuditEventsOfUser(userID string) ([]db.AuditEvent, error)
+	RedactAPILogs(userID string) ([]int, error)
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+var links IdentityLinkRepository = db.NewGormIdentityLinkRepository(nil)
+var groups GroupRepository = db.NewGormGroupRepository(nil)
+var logs LogRepository = db.NewGormLogRepository(nil)
+
+// SetUserRepository replace user storage used by data export and erasure
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
+
+// SetSessionRepository replace session storage used by data export and erasure
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
+
+// SetIdentityLinkRepository replace identity link storage used by data export and erasure
+func SetIdentityLinkRepository(repository IdentityLinkRepository) {
+	links = repository
+}
+
+// SetGroupRepository replace group storage used by data export and erasure
+func SetGroupRepository(repository GroupRepository) {
+	groups = repository
+}
+
+// SetLogRepository replace api log and audit event storage used by data export and erasure
+func SetLogRepository(repository LogRepository) {
+	logs = repository
+}
@@ -0,0 +1,188 @@
+package privacy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Export gather everything held about the user, its sessions, linked accounts, groups, api logs and audit events
+func Export(user db.User) (Archive, error) {
+	archive := Archive{
+		ExportedAt:    time.Now().UTC(),
+		User:          ArchivedUser{}.CreateArchive(user),
+		Sessions:      []ArchivedSession{},
+		IdentityLinks: []ArchivedIdentityLink{},
+		Groups:        []ArchivedGroup{},
+		APILogs:       []apilog.ResponseAPILog{},
+		AuditEvents:   []ArchivedAuditEvent{},
+	}
+	userSessions, err := sessions.FindSessionsOfUser(user.ID)
+	if err != nil {
+		return archive, err
+	}
+	for _, session := range userSessions {
+		archive.Sessions = append(archive.Sessions, ArchivedSession{}.CreateArchive(session))
+	}
+	userLinks, err := links.FindIdentityLinksOfUser(user.ID)
+	if err != nil {
+		return archive, err
+	}
+	for _, link := range userLinks {
+		archive.IdentityLinks = append(archive.IdentityLinks, ArchivedIdentityLink{}.CreateArchive(link))
+	}
+	userGroups, err := groups.FindGroupsOfUser(user.ID)
+	if err != nil {
+		return archive, err
+	}
+	for _, group := range userGroups {
+		archive.Groups = append(archive.Groups, ArchivedGroup{ID: group.ID, DisplayName: group.DisplayName})
+	}
+	apiLogs, err := logs.SearchAPILogs(db.APILogQuery{UserID: user.ID})
+	if err != nil {
+		return archive, err
+	}
+	for _, apiLog := range apiLogs {
+		archive.APILogs = append(archive.APILogs, apilog.ResponseAPILog{}.CreateResponse(apiLog))
+	}
+	events, err := logs.FindAuditEventsOfUser(user.ID)
+	if err != nil {
+		return archive, err
+	}
+	for _, event := range events {
+		archive.AuditEvents = append(archive.AuditEvents, ArchivedAuditEvent{}.CreateArchive(event))
+	}
+	return archive, nil
+}
+
+// Erase anonymize the user having the id and erase its personal data in sessions, linked accounts, groups and
+// api logs. Rows referring to the user are kept, and audit events are kept as the record of what was done.
+// The user is erased last, so erasure failing halfway can be run again
+func Erase(userID string) (Erasure, error) {
+	var erasure Erasure
+	var err error
+	if erasure.Sessions, err = sessions.EraseUserSessions(userID); err != nil {
+		return erasure, err
+	}
+	if erasure.IdentityLinks, err = links.DeleteIdentityLinksOfUser(userID); err != nil {
+		return erasure, err
+	}
+	if err = groups.RemoveUserFromGroups(userID); err != nil {
+		return erasure, err
+	}
+	if erasure.APILogIDs, err = logs.RedactAPILogs(userID); err != nil {
+		return erasure, err
+	}
+	erasure.APILogs = len(erasure.APILogIDs)
+	return erasure, users.EraseUser(userID)
+}
+
+// ExportOwnData service handler for the user logged in to download everything held about it as JSON archive
+func ExportOwnData(c *gin.Context) {
+	user, err := users.FindUserByID(c.GetString("userID"))
+	if !findUser(c, err, false) {
+		return
+	}
+	exportData(c, user, false)
+}
+
+// ExportUserData service handler for administrator to download everything held about the user having the id,
+// deleted user included
+func ExportUserData(c *gin.Context) {
+	user, err := users.FindUserWithDeleted(c.Param("id"))
+	if !findUser(c, err, true) {
+		return
+	}
+	exportData(c, user, true)
+}
+
+// EraseOwnAccount service handler for the user logged in to erase its account, the password is asked again
+// for user having one
+func EraseOwnAccount(c *gin.Context) {
+	var input ErasureConfirmation
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Password must be given to erase the account"})
+		return
+	}
+	user, err := users.FindUserByID(c.GetString("userID"))
+	if !findUser(c, err, false) {
+		return
+	}
+	if len(user.Password) > 0 && bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		c.Abort()
+		c.JSON(http.StatusForbidden, gin.H{"message": "Password is not valid"})
+		return
+	}
+	eraseAccount(c, user.ID, false)
+}
+
+// EraseUserAccount service handler for administrator to erase the account of the user having the id,
+// deleted user included
+func EraseUserAccount(c *gin.Context) {
+	user, err := users.FindUserWithDeleted(c.Param("id"))
+	if !findUser(c, err, true) {
+		return
+	}
+	eraseAccount(c, user.ID, true)
+}
+
+// findUser respond the error of finding the user, user logged in which is not found is not valid anymore
+func findUser(c *gin.Context, err error, isAdmin bool) bool {
+	switch {
+	case err == db.ErrUserNotFound && !isAdmin:
+		c.Abort()
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user logged in"})
+	case err == db.ErrUserNotFound:
+		c.Abort()
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+	case err != nil:
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get user data"})
+	default:
+		return true
+	}
+	return false
+}
+
+func exportData(c *gin.Context, user db.User, byAdmin bool) {
+	archive, err := Export(user)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to export user data"})
+		return
+	}
+	audit.Emit(c, audit.Event{
+		Type:      audit.DataExport,
+		ActorID:   c.GetString("userID"),
+		SubjectID: user.ID,
+		Metadata:  map[string]interface{}{"byAdmin": byAdmin},
+	})
+	c.Header("Content-Disposition", `attachment; filename="user-`+user.ID+`.json"`)
+	c.JSON(http.StatusOK, archive)
+}
+
+func eraseAccount(c *gin.Context, userID string, byAdmin bool) {
+	erasure, err := Erase(userID)
+	event := audit.Event{
+		Type:      audit.AccountErasure,
+		ActorID:   c.GetString("userID"),
+		SubjectID: userID,
+		Metadata: map[string]interface{}{"byAdmin": byAdmin, "sessions": erasure.Sessions,
+			"identityLinks": erasure.IdentityLinks, "apiLogs": erasure.APILogs, "apiLogIds": erasure.APILogIDs},
+	}
+	if err != nil {
+		event.Outcome, event.Reason = audit.Failure, "storage_error"
+		audit.Emit(c, event)
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to erase account, erase it again"})
+		return
+	}
+	audit.Emit(c, event)
+	c.JSON(http.StatusOK, gin.H{"erasure": erasure, "message": "Account erased"})
+}
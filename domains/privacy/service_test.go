@@ -0,0 +1,186 @@
+package privacy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/privacy"
+	"github.com/drd-engineering/TwinCape/domains/register"
+)
+
+type repositories struct {
+	users    *memory.UserRepository
+	sessions *memory.SessionRepository
+	links    *memory.IdentityLinkRepository
+	groups   *memory.GroupRepository
+	logs     *memory.LogRepository
+}
+
+func setupTestCase(t *testing.T) repositories {
+	r := repositories{memory.NewUserRepository(), memory.NewSessionRepository(), memory.NewIdentityLinkRepository(),
+		memory.NewGroupRepository(), memory.NewLogRepository()}
+	privacy.SetUserRepository(r.users)
+	privacy.SetSessionRepository(r.sessions)
+	privacy.SetIdentityLinkRepository(r.links)
+	privacy.SetGroupRepository(r.groups)
+	privacy.SetLogRepository(r.logs)
+	audit.SetLogRepository(r.logs)
+
+	password, err := register.HashPassword("testpassword")
+	assert.Nil(t, err)
+	assert.Nil(t, r.users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "3201011505900001",
+		PhoneNumber: "+6281200000000", Password: password}))
+	assert.Nil(t, r.users.CreateUser(&db.User{ID: "otherid", Email: "other@test.com", KtpNumber: "3201011505900002"}))
+	now := time.Now()
+	assert.Nil(t, r.sessions.CreateSession(&db.Session{ID: "sessionid", UserID: "testid", CreatedAt: now, LastUsedAt: now,
+		UserAgent: "test-agent", IPAddress: "10.0.0.1"}))
+	assert.Nil(t, r.links.CreateIdentityLink(&db.IdentityLink{Provider: "google", Subject: "123", UserID: "testid"}))
+	assert.Nil(t, r.groups.CreateGroup(&db.Group{ID: "groupid", DisplayName: "Staff"}))
+	assert.Nil(t, r.groups.AddGroupMembers("groupid", []string{"testid"}))
+	assert.Nil(t, r.logs.CreateAPILogs([]db.APILog{
+		{Timestamp: now, Path: "/api/v2/sso/auth/get-login-details", UserID: "testid", ClientIP: "10.0.0.1"},
+		{Timestamp: now, Path: "/api/v2/sso/auth/get-login-details", UserID: "otherid", ClientIP: "10.0.0.2"},
+	}))
+	assert.Nil(t, r.logs.CreateAuditEvent(&db.AuditEvent{Timestamp: now, Type: audit.LoginSuccess, ActorID: "testid",
+		Metadata: `{"backend":"local"}`}))
+	return r
+}
+
+// loggedInAs set the user id as the token middleware does
+func loggedInAs(userID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", userID)
+	}
+}
+
+func request(r *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(encoded))
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func countEvents(logs *memory.LogRepository, eventType string) int {
+	count := 0
+	for _, event := range logs.AuditEvents() {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestExportData(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		code   int
+	}{
+		{name: "OKOwnData", path: "/t/profile/export", userID: "testid", code: 200},
+		{name: "OKUserData", path: "/t/users/testid/export", userID: "adminid", code: 200},
+		{name: "FailUnknownUserLoggedIn", path: "/t/profile/export", userID: "unknown", code: 401},
+		{name: "FailUnknownUser", path: "/t/users/unknown/export", userID: "adminid", code: 404},
+	}
+	for _, tc := range tests {
+		repositories := setupTestCase(t)
+		r := gin.New()
+		r.GET("/t/profile/export", loggedInAs(tc.userID), privacy.ExportOwnData)
+		r.GET("/t/users/:id/export", loggedInAs(tc.userID), privacy.ExportUserData)
+		w := request(r, "GET", tc.path, nil)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		if tc.code != 200 {
+			continue
+		}
+		assert.Equal(t, `attachment; filename="user-testid.json"`, w.Header().Get("Content-Disposition"), "test "+tc.name+" case")
+		var archive privacy.Archive
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &archive), "test "+tc.name+" case")
+		assert.Equal(t, "test@test.com", archive.User.Email, "test "+tc.name+" case")
+		assert.Equal(t, "3201011505900001", archive.User.KtpNumber, "test "+tc.name+" case")
+		assert.Len(t, archive.Sessions, 1, "test "+tc.name+" case")
+		assert.Len(t, archive.IdentityLinks, 1, "test "+tc.name+" case")
+		assert.Len(t, archive.Groups, 1, "test "+tc.name+" case")
+		if assert.Len(t, archive.APILogs, 1, "only api logs of the user should be exported in test "+tc.name+" case") {
+			assert.Equal(t, "10.0.0.1", archive.APILogs[0].ClientIP, "test "+tc.name+" case")
+		}
+		if assert.Len(t, archive.AuditEvents, 1, "test "+tc.name+" case") {
+			assert.JSONEq(t, `{"backend":"local"}`, string(archive.AuditEvents[0].Metadata), "test "+tc.name+" case")
+		}
+		assert.NotContains(t, w.Body.String(), "testpassword", "test "+tc.name+" case")
+		assert.Equal(t, 1, countEvents(repositories.logs, audit.DataExport), "export should be audited in test "+tc.name+" case")
+	}
+}
+
+func TestEraseAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		body   interface{}
+		code   int
+	}{
+		{name: "OKOwnAccount", path: "/t/profile", userID: "testid",
+			body: map[string]string{"password": "testpassword"}, code: 200},
+		{name: "OKUserAccount", path: "/t/users/testid", userID: "adminid", code: 200},
+		{name: "FailWrongPassword", path: "/t/profile", userID: "testid",
+			body: map[string]string{"password": "wrongpassword"}, code: 403},
+		{name: "FailNoConfirmation", path: "/t/profile", userID: "testid", code: 400},
+		{name: "FailUnknownUser", path: "/t/users/unknown", userID: "adminid", code: 404},
+	}
+	for _, tc := range tests {
+		repositories := setupTestCase(t)
+		r := gin.New()
+		r.DELETE("/t/profile", loggedInAs(tc.userID), privacy.EraseOwnAccount)
+		r.DELETE("/t/users/:id", loggedInAs(tc.userID), privacy.EraseUserAccount)
+		w := request(r, "DELETE", tc.path, tc.body)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		user, err := repositories.users.FindUserWithDeleted("testid")
+		assert.Nil(t, err, "erased user should be kept in test "+tc.name+" case")
+		if tc.code != 200 {
+			assert.False(t, user.IsErased(), "user should not be erased in test "+tc.name+" case")
+			continue
+		}
+		assert.True(t, user.IsErased(), "test "+tc.name+" case")
+		assert.Empty(t, user.Email+user.Name+user.Password, "personal data should be erased in test "+tc.name+" case")
+		_, err = repositories.users.FindUserByID("testid")
+		assert.Equal(t, db.ErrUserNotFound, err, "erased user should not login in test "+tc.name+" case")
+		other, _ := repositories.users.FindUserByID("otherid")
+		assert.Equal(t, "other@test.com", other.Email, "other user should be kept in test "+tc.name+" case")
+
+		session, _ := repositories.sessions.FindSessionByID("sessionid")
+		assert.NotNil(t, session.RevokedAt, "session should be revoked in test "+tc.name+" case")
+		assert.Empty(t, session.IPAddress, "test "+tc.name+" case")
+		links, _ := repositories.links.FindIdentityLinksOfUser("testid")
+		assert.Empty(t, links, "test "+tc.name+" case")
+		groups, _ := repositories.groups.FindGroupsOfUser("testid")
+		assert.Empty(t, groups, "test "+tc.name+" case")
+		apiLogs, _ := repositories.logs.SearchAPILogs(db.APILogQuery{})
+		for _, apiLog := range apiLogs {
+			assert.NotEqual(t, "testid", apiLog.UserID, "api log of the user should be redacted in test "+tc.name+" case")
+			assert.True(t, apiLog.PersonalDataIntact(), "redacted api log should stay verifiable in test "+tc.name+" case")
+		}
+		assert.Len(t, apiLogs, 2, "api logs should be kept in test "+tc.name+" case")
+		assert.Equal(t, 1, countEvents(repositories.logs, audit.AccountErasure), "erasure should be audited in test "+tc.name+" case")
+		for _, event := range repositories.logs.AuditEvents() {
+			if event.Type == audit.AccountErasure {
+				assert.Contains(t, event.Metadata, `"apiLogIds":[1]`, "redacted api logs should be recorded in test "+tc.name+" case")
+			}
+		}
+	}
+}
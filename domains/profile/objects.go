@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/nik"
+)
+
+// ProfileUpdate json data definition for updating profile, missing field is kept as it is. UpdatedAt is
+// updated time of the profile read by the client, the update is rejected when the profile is updated since
+type ProfileUpdate struct {
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Name         *string   `json:"name"`
+	Address      *string   `json:"address"`
+	PhoneNumber  *string   `json:"phoneNumber"`
+	Cityzenship  *string   `json:"cityzenship"`
+	PlaceOfBirth *string   `json:"placeofBirth"`
+	// fields identifying the user, only administrator can change them
+	Email       *string     `json:"email"`
+	KtpNumber   *nik.Number `json:"ktpNumber"`
+	Gender      *string     `json:"gender"`
+	DateOfBirth *string     `json:"dateofBirth"`
+}
+
+// adminOnlyFields give json name of the fields identifying the user which are in the update
+func (t ProfileUpdate) adminOnlyFields() []string {
+	fields := []string{}
+	if t.Email != nil {
+		fields = append(fields, "email")
+	}
+	if t.KtpNumber != nil {
+		fields = append(fields, "ktpNumber")
+	}
+	if t.Gender != nil {
+		fields = append(fields, "gender")
+	}
+	if t.DateOfBirth != nil {
+		fields = append(fields, "dateofBirth")
+	}
+	return fields
+}
+
+// ProfileUpdateV1 is ProfileUpdate of API v1 where KTP number is json number
+type ProfileUpdateV1 struct {
+	ProfileUpdate
+	KtpNumber *int64 `json:"ktpNumber"`
+}
+
+// Upgrade convert to data of the current API
+func (t ProfileUpdateV1) Upgrade() ProfileUpdate {
+	data := t.ProfileUpdate
+	if t.KtpNumber != nil {
+		ktpNumber := nik.Number(strconv.FormatInt(*t.KtpNumber, 10))
+		data.KtpNumber = &ktpNumber
+	}
+	return data
+}
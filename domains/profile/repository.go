@@ -0,0 +1,20 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by profile service handlers
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	UpdateProfile(user *db.User, updatedAt time.Time) error
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+
+// SetUserRepository replace user storage used by profile service handlers
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
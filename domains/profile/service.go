@@ -0,0 +1,250 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/nik"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLengths is maximum number of characters of the text fields
+var maxLengths = map[string]int{
+	"name":         100,
+	"address":      255,
+	"cityzenship":  50,
+	"placeofBirth": 100,
+}
+
+// fieldOfColumn is json name of the field saved in the unique column
+var fieldOfColumn = map[string]string{
+	"ktp_number":   "ktpNumber",
+	"email":        "email",
+	"phone_number": "phoneNumber",
+}
+
+// UpdateProfile service handler for the user logged in to update its own profile,
+// fields identifying the user can only be changed by administrator
+func UpdateProfile(c *gin.Context) {
+	var input ProfileUpdate
+	if bindProfileUpdate(c, &input) {
+		updateProfile(c, c.GetString("userID"), input, false, respondV2)
+	}
+}
+
+// UpdateProfileV1 is UpdateProfile of API v1 taking and giving KTP number as json number
+func UpdateProfileV1(c *gin.Context) {
+	var input ProfileUpdateV1
+	if bindProfileUpdate(c, &input) {
+		updateProfile(c, c.GetString("userID"), input.Upgrade(), false, respondV1)
+	}
+}
+
+// UpdateUserProfile service handler for administrator to update profile of the user having the id
+func UpdateUserProfile(c *gin.Context) {
+	var input ProfileUpdate
+	if bindProfileUpdate(c, &input) {
+		updateProfile(c, c.Param("id"), input, true, respondV2)
+	}
+}
+
+// UpdateUserProfileV1 is UpdateUserProfile of API v1 taking and giving KTP number as json number
+func UpdateUserProfileV1(c *gin.Context) {
+	var input ProfileUpdateV1
+	if bindProfileUpdate(c, &input) {
+		updateProfile(c, c.Param("id"), input.Upgrade(), true, respondV1)
+	}
+}
+
+func respondV2(response authenticator.ResponseLoginDetails) interface{} {
+	return response
+}
+
+func respondV1(response authenticator.ResponseLoginDetails) interface{} {
+	return response.Downgrade()
+}
+
+// bindProfileUpdate decode the request body, unknown fields are rejected so a misspelled field is not ignored
+func bindProfileUpdate(c *gin.Context, input interface{}) bool {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(input); err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid profile: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// updateProfile apply the update to the user having the id, respond convert the profile to the response of the API version
+func updateProfile(c *gin.Context, userID string, input ProfileUpdate, isAdmin bool,
+	respond func(authenticator.ResponseLoginDetails) interface{}) {
+	if input.UpdatedAt.IsZero() {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Profile updated time must not be empty"})
+		return
+	}
+	if fields := input.adminOnlyFields(); !isAdmin && len(fields) > 0 {
+		c.Abort()
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only administrator can change " + strings.Join(fields, ", ")})
+		return
+	}
+	user, err := users.FindUserByID(userID)
+	switch {
+	case err == db.ErrUserNotFound && !isAdmin, err == nil && user.Disabled && !isAdmin:
+		c.Abort()
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid user logged in"})
+		return
+	case err == db.ErrUserNotFound:
+		c.Abort()
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	case err != nil:
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get user data"})
+		return
+	}
+	if !user.UpdatedAt.Equal(input.UpdatedAt) {
+		c.Abort()
+		c.JSON(http.StatusConflict, gin.H{"message": "Profile is updated since it was read, read it again"})
+		return
+	}
+
+	updated, fieldErrors := applyUpdate(user, input)
+	if len(fieldErrors) > 0 {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid profile", "errors": fieldErrors})
+		return
+	}
+	changed := changedFields(user, updated)
+	if len(changed) > 0 {
+		// the updated time read from storage is compared again when saving to catch concurrent updates
+		err = users.UpdateProfile(&updated, user.UpdatedAt)
+		var duplicate *db.DuplicateUserError
+		switch {
+		case errors.As(err, &duplicate):
+			c.Abort()
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid profile",
+				"errors": map[string]string{fieldOfColumn[duplicate.Column]: register.DuplicateMessage(duplicate.Column)}})
+			return
+		case err == db.ErrStaleUser:
+			c.Abort()
+			c.JSON(http.StatusConflict, gin.H{"message": "Profile is updated since it was read, read it again"})
+			return
+		case err != nil:
+			c.Abort()
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save profile"})
+			return
+		}
+		// only the names of the fields are audited, their values are personal data
+		audit.Emit(c, audit.Event{
+			Type:      audit.ProfileUpdate,
+			ActorID:   c.GetString("userID"),
+			SubjectID: user.ID,
+			Metadata:  map[string]interface{}{"fields": changed, "byAdmin": isAdmin},
+		})
+	}
+	response := authenticator.ResponseLoginDetails{}.CreateResponse(updated)
+	c.JSON(http.StatusOK, gin.H{"user": respond(response), "message": "Profile updated"})
+}
+
+// applyUpdate give the user with the fields of the update, or the message of every invalid field by its json name
+func applyUpdate(user db.User, input ProfileUpdate) (db.User, map[string]string) {
+	fieldErrors := map[string]string{}
+	text := func(field string, value *string, target *string) {
+		if value == nil {
+			return
+		}
+		trimmed := strings.TrimSpace(*value)
+		if utf8.RuneCountInString(trimmed) > maxLengths[field] {
+			fieldErrors[field] = "Must be at most " + strconv.Itoa(maxLengths[field]) + " characters"
+			return
+		}
+		*target = trimmed
+	}
+	text("name", input.Name, &user.Name)
+	if input.Name != nil && len(user.Name) == 0 {
+		fieldErrors["name"] = "Name must not be empty"
+	}
+	text("address", input.Address, &user.Address)
+	text("cityzenship", input.Cityzenship, &user.Cityzenship)
+	text("placeofBirth", input.PlaceOfBirth, &user.PlaceOfBirth)
+
+	if input.PhoneNumber != nil && *input.PhoneNumber != user.OriginalPhoneNumber {
+		phoneNumber, message, isValid := register.NormalizePhoneNumber(*input.PhoneNumber)
+		if isValid {
+			user.PhoneNumber, user.OriginalPhoneNumber = phoneNumber, *input.PhoneNumber
+		} else {
+			fieldErrors["phoneNumber"] = message
+		}
+	}
+	if input.Email != nil {
+		email := db.NormalizeEmail(*input.Email)
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			fieldErrors["email"] = "User email is not a valid email address"
+		} else {
+			user.Email = email
+		}
+	}
+
+	ktpNumber, dateOfBirth, gender := nik.Number(user.KtpNumber), user.DateOfBirth, user.Gender
+	if input.KtpNumber != nil {
+		ktpNumber = *input.KtpNumber
+	}
+	if input.Gender != nil {
+		gender = strings.TrimSpace(*input.Gender)
+	}
+	if input.DateOfBirth != nil {
+		dateOfBirth = time.Time{}
+		if len(*input.DateOfBirth) > 0 {
+			var err error
+			if dateOfBirth, err = time.Parse("2006-01-02", *input.DateOfBirth); err != nil {
+				fieldErrors["dateofBirth"] = "Date of birth format: (YYYY-MM-DD"
+				return user, fieldErrors
+			}
+		}
+	}
+	// user registered before KTP number was checked can still change the other fields
+	if string(ktpNumber) != user.KtpNumber || !dateOfBirth.Equal(user.DateOfBirth) || gender != user.Gender {
+		if message, isValid := register.CheckKtpNumber(ktpNumber, dateOfBirth, gender); !isValid {
+			fieldErrors["ktpNumber"] = message
+		}
+		user.KtpNumber, user.DateOfBirth, user.Gender = string(ktpNumber), dateOfBirth, gender
+	}
+	return user, fieldErrors
+}
+
+// changedFields give json name of the fields having different value in the updated user
+func changedFields(user db.User, updated db.User) []string {
+	changed := []string{}
+	fields := []struct {
+		name      string
+		isChanged bool
+	}{
+		{"name", user.Name != updated.Name},
+		{"address", user.Address != updated.Address},
+		{"phoneNumber", user.OriginalPhoneNumber != updated.OriginalPhoneNumber},
+		{"cityzenship", user.Cityzenship != updated.Cityzenship},
+		{"placeofBirth", user.PlaceOfBirth != updated.PlaceOfBirth},
+		{"email", user.Email != updated.Email},
+		{"ktpNumber", user.KtpNumber != updated.KtpNumber},
+		{"gender", user.Gender != updated.Gender},
+		{"dateofBirth", !user.DateOfBirth.Equal(updated.DateOfBirth)},
+	}
+	for _, field := range fields {
+		if field.isChanged {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed
+}
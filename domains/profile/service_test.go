@@ -0,0 +1,173 @@
+package profile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/profile"
+)
+
+func setupTestCase(t *testing.T) (*memory.UserRepository, *memory.LogRepository) {
+	users := memory.NewUserRepository()
+	logs := memory.NewLogRepository()
+	profile.SetUserRepository(users)
+	audit.SetLogRepository(logs)
+	dateOfBirth, _ := time.Parse("2006-01-02", "1990-05-15")
+	assert.Nil(t, users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "3201011505900001",
+		PhoneNumber: "+6281200000000", OriginalPhoneNumber: "+6281200000000", DateOfBirth: dateOfBirth, Gender: "Laki-laki"}))
+	assert.Nil(t, users.CreateUser(&db.User{ID: "otherid", Email: "other@test.com", KtpNumber: "3201011505900002",
+		PhoneNumber: "+6281200000001"}))
+	return users, logs
+}
+
+// loggedInAs set the user id as the token middleware does
+func loggedInAs(userID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", userID)
+	}
+}
+
+func patch(r *gin.Engine, path string, body map[string]interface{}) (int, map[string]interface{}) {
+	encoded, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", path, bytes.NewBuffer(encoded))
+	r.ServeHTTP(w, req)
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	return w.Code, got
+}
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  map[string]interface{}
+		stale bool
+		code  int
+		// errorField is the field expected to be rejected
+		errorField string
+		expects    func(user db.User) bool
+	}{
+		{name: "OKName", body: map[string]interface{}{"name": " New Name "}, code: 200,
+			expects: func(user db.User) bool { return user.Name == "New Name" }},
+		{name: "OKAddressAndPlaceOfBirth", body: map[string]interface{}{"address": "jalan baru", "placeofBirth": "Bandung"}, code: 200,
+			expects: func(user db.User) bool { return user.Address == "jalan baru" && user.PlaceOfBirth == "Bandung" }},
+		{name: "OKPhoneNumber", body: map[string]interface{}{"phoneNumber": "0812-0000-0009"}, code: 200,
+			expects: func(user db.User) bool {
+				return user.PhoneNumber == "+6281200000009" && user.OriginalPhoneNumber == "0812-0000-0009"
+			}},
+		{name: "FailStale", body: map[string]interface{}{"name": "stale"}, stale: true, code: 409},
+		{name: "FailNoUpdatedAt", body: map[string]interface{}{"name": "test", "updatedAt": nil}, code: 400},
+		{name: "FailKTPNumberByUser", body: map[string]interface{}{"ktpNumber": "3201011505900003"}, code: 403},
+		{name: "FailEmailByUser", body: map[string]interface{}{"email": "new@test.com"}, code: 403},
+		{name: "FailUnknownField", body: map[string]interface{}{"isAdmin": true}, code: 400},
+		{name: "FailEmptyName", body: map[string]interface{}{"name": " "}, code: 400, errorField: "name"},
+		{name: "FailLongAddress", body: map[string]interface{}{"address": string(make([]byte, 256))}, code: 400, errorField: "address"},
+		{name: "FailInvalidPhoneNumber", body: map[string]interface{}{"phoneNumber": "0812"}, code: 400, errorField: "phoneNumber"},
+		{name: "FailPhoneNumberOfOtherUser", body: map[string]interface{}{"phoneNumber": "+6281200000001"}, code: 400,
+			errorField: "phoneNumber"},
+	}
+	users, logs := setupTestCase(t)
+	r := gin.New()
+	r.PATCH("/t/profile", loggedInAs("testid"), profile.UpdateProfile)
+	for _, tc := range tests {
+		before, _ := users.FindUserByID("testid")
+		updatedAt := before.UpdatedAt
+		if tc.stale {
+			updatedAt = updatedAt.Add(-time.Second)
+		}
+		if _, ok := tc.body["updatedAt"]; !ok {
+			tc.body["updatedAt"] = updatedAt
+		}
+		code, got := patch(r, "/t/profile", tc.body)
+
+		assert.Equal(t, tc.code, code, "test "+tc.name+" case")
+		assert.NotEmpty(t, got["message"], "test "+tc.name+" case")
+		after, _ := users.FindUserByID("testid")
+		if tc.code != 200 {
+			assert.True(t, before.UpdatedAt.Equal(after.UpdatedAt), "rejected update should not be saved in test "+tc.name+" case")
+			if len(tc.errorField) > 0 {
+				errors, _ := got["errors"].(map[string]interface{})
+				assert.NotEmpty(t, errors[tc.errorField], "field should be rejected in test "+tc.name+" case")
+			}
+			continue
+		}
+		assert.True(t, tc.expects(after), "profile should be updated in test "+tc.name+" case")
+		user, _ := got["user"].(map[string]interface{})
+		assert.Equal(t, after.UpdatedAt.Format(time.RFC3339Nano), user["updatedAt"],
+			"new updated time should be given back in test "+tc.name+" case")
+	}
+
+	events := logs.AuditEvents()
+	updates := 0
+	for _, event := range events {
+		if event.Type == audit.ProfileUpdate {
+			updates++
+			assert.Equal(t, "testid", event.ActorID)
+			assert.Equal(t, "testid", event.SubjectID)
+			assert.NotContains(t, event.Metadata, "New Name", "values of the fields should not be audited")
+		}
+	}
+	assert.Equal(t, 3, updates, "every saved update should be audited")
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       map[string]interface{}
+		code       int
+		errorField string
+		ktpNumber  interface{}
+	}{
+		{name: "OKKTPNumberAndBirthDate", path: "/t/users/testid/profile",
+			body: map[string]interface{}{"ktpNumber": "3201011606910001", "dateofBirth": "1991-06-16"}, code: 200,
+			ktpNumber: "3201011606910001"},
+		{name: "OKEmail", path: "/t/users/testid/profile", body: map[string]interface{}{"email": " New@Test.com"}, code: 200,
+			ktpNumber: "3201011606910001"},
+		{name: "FailGenderNotMatchingKTPNumber", path: "/t/users/testid/profile",
+			body: map[string]interface{}{"gender": "Perempuan"}, code: 400, errorField: "ktpNumber"},
+		{name: "FailBirthDateFormat", path: "/t/users/testid/profile",
+			body: map[string]interface{}{"dateofBirth": "1991-16-06"}, code: 400, errorField: "dateofBirth"},
+		{name: "FailInvalidEmail", path: "/t/users/testid/profile", body: map[string]interface{}{"email": "Test <test@test.com>"},
+			code: 400, errorField: "email"},
+		{name: "FailEmailOfOtherUser", path: "/t/users/testid/profile", body: map[string]interface{}{"email": "Other@test.com"},
+			code: 400, errorField: "email"},
+		{name: "FailKTPNumberOfOtherUser", path: "/t/users/testid/profile",
+			body: map[string]interface{}{"ktpNumber": "3201011505900002", "dateofBirth": "1990-05-15"}, code: 400, errorField: "ktpNumber"},
+		{name: "FailUnknownUser", path: "/t/users/unknown/profile", body: map[string]interface{}{"name": "test"}, code: 404},
+		{name: "OKKTPNumberAsNumberV1", path: "/t/v1/users/testid/profile",
+			body: map[string]interface{}{"ktpNumber": 3201011505900001, "dateofBirth": "1990-05-15"}, code: 200,
+			ktpNumber: float64(3201011505900001)},
+	}
+	users, _ := setupTestCase(t)
+	r := gin.New()
+	r.PATCH("/t/users/:id/profile", loggedInAs("adminid"), profile.UpdateUserProfile)
+	r.PATCH("/t/v1/users/:id/profile", loggedInAs("adminid"), profile.UpdateUserProfileV1)
+	for _, tc := range tests {
+		before, _ := users.FindUserByID("testid")
+		tc.body["updatedAt"] = before.UpdatedAt
+		code, got := patch(r, tc.path, tc.body)
+
+		assert.Equal(t, tc.code, code, "test "+tc.name+" case")
+		if len(tc.errorField) > 0 {
+			errors, _ := got["errors"].(map[string]interface{})
+			assert.NotEmpty(t, errors[tc.errorField], "field should be rejected in test "+tc.name+" case")
+		}
+		if tc.code == 200 {
+			user, _ := got["user"].(map[string]interface{})
+			assert.Equal(t, tc.ktpNumber, user["ktpNumber"], "test "+tc.name+" case")
+		}
+	}
+	found, _ := users.FindUserByEmail("new@test.com")
+	assert.Equal(t, "testid", found.ID, "email should be saved normalized")
+}
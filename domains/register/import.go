@@ -0,0 +1,358 @@
+package register
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/phone"
+	"github.com/gin-gonic/gin"
+)
+
+// Import format available
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ImportBatchSize is number of rows registered together by Import
+const ImportBatchSize = 100
+
+// ImportRow is result of a row of the import, row is counted from 1 without the CSV header
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Email    string `json:"email,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Password string `json:"password,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Duplicate tell the row is rejected since its data is used by another user or an earlier row
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// ImportResult is report of Import, every row read has its result in order
+type ImportResult struct {
+	DryRun  bool        `json:"dryRun"`
+	Created int         `json:"created"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// MaxImportSize is maximum size of import sent to ImportUsers
+const MaxImportSize = 32 << 20
+
+// ImportQuery is query of ImportUsers, the import is the request body
+type ImportQuery struct {
+	Format string `form:"format"`
+	DryRun bool   `form:"dryRun"`
+}
+
+// ImportUsers service handler for administrator to register users from CSV or JSONL in the request body,
+// the report of every row is given even when reading or saving fails in the middle
+func ImportUsers(c *gin.Context) {
+	importUsers(c, Import)
+}
+
+// ImportUsersV1 is ImportUsers of API v1 taking KTP number of JSONL rows as json number
+func ImportUsersV1(c *gin.Context) {
+	importUsers(c, ImportV1)
+}
+
+// importUsers register users read from the request body by read of the API version
+func importUsers(c *gin.Context, read func(io.Reader, string, bool) (ImportResult, error)) {
+	var query ImportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid import query"})
+		return
+	}
+	if len(query.Format) == 0 {
+		query.Format = FormatJSONL
+	}
+	result, err := read(http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportSize), query.Format, query.DryRun)
+	var validationErr *ValidationError
+	// import failing to be read after some rows still saved them, those rows are reported and audited
+	if errors.As(err, &validationErr) && len(result.Rows) == 0 {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": validationErr.Message})
+		return
+	}
+	audit.Emit(c, audit.Event{
+		Type:    audit.AdminAction,
+		ActorID: c.GetString("userID"),
+		Metadata: map[string]interface{}{"action": "import_users", "dryRun": query.DryRun,
+			"created": result.Created, "failed": result.Failed},
+	})
+	if validationErr != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": validationErr.Message, "result": result})
+		return
+	}
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save users", "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Users imported", "result": result})
+}
+
+// importInput is a row read from the import with the error of reading it
+type importInput struct {
+	row  int
+	data UserRegistrationData
+	err  error
+}
+
+// Import register users read from CSV with header of UserRegistrationData json names or from JSONL of
+// UserRegistrationData, rows are checked by the same rules as SaveUser. With dry run the rows are checked
+// against saved users but nothing is saved. Rejected rows are reported in the result, *ValidationError is
+// returned when the import can not be read and other errors when it can not be saved, with the rows done before
+func Import(reader io.Reader, format string, dryRun bool) (ImportResult, error) {
+	return importRows(reader, format, dryRun, func(line []byte) (UserRegistrationData, error) {
+		var data UserRegistrationData
+		err := json.Unmarshal(line, &data)
+		return data, err
+	})
+}
+
+// ImportV1 is Import of API v1 where KTP number of JSONL rows is json number, CSV has no json types so
+// its rows are read as Import does
+func ImportV1(reader io.Reader, format string, dryRun bool) (ImportResult, error) {
+	return importRows(reader, format, dryRun, func(line []byte) (UserRegistrationData, error) {
+		var data UserRegistrationDataV1
+		err := json.Unmarshal(line, &data)
+		return data.Upgrade(), err
+	})
+}
+
+// importRows register users as Import does, decode read UserRegistrationData from a JSONL line
+func importRows(reader io.Reader, format string, dryRun bool, decode func([]byte) (UserRegistrationData, error)) (ImportResult, error) {
+	result := ImportResult{DryRun: dryRun, Rows: []ImportRow{}}
+	var next func() (importInput, bool, error)
+	switch format {
+	case FormatJSONL:
+		next = jsonlRows(reader, decode)
+	case FormatCSV:
+		var err error
+		if next, err = csvRows(reader); err != nil {
+			return result, &ValidationError{Message: err.Error()}
+		}
+	default:
+		return result, &ValidationError{Message: "Import format must be " + FormatJSONL + " or " + FormatCSV}
+	}
+
+	seen := map[string]int{}
+	for {
+		batch := make([]importInput, 0, ImportBatchSize)
+		for len(batch) < ImportBatchSize {
+			input, ok, err := next()
+			if err != nil {
+				return result, &ValidationError{Message: "Failed to read import: " + err.Error()}
+			}
+			if !ok {
+				break
+			}
+			batch = append(batch, input)
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+		rows, err := importBatch(batch, seen, dryRun)
+		for _, row := range rows {
+			if len(row.Error) > 0 {
+				result.Failed++
+			} else if !dryRun {
+				result.Created++
+			}
+		}
+		result.Rows = append(result.Rows, rows...)
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+// importBatch check rows against earlier rows then register them concurrently, seen is the row of every
+// KTP number, email and phone number already read
+func importBatch(batch []importInput, seen map[string]int, dryRun bool) ([]ImportRow, error) {
+	rows := make([]ImportRow, len(batch))
+	valid := make([]int, 0, len(batch))
+	for i, input := range batch {
+		rows[i] = ImportRow{Row: input.row, Email: input.data.Email}
+		if input.err != nil {
+			rows[i].Error = input.err.Error()
+			continue
+		}
+		var validationErr *ValidationError
+		if _, err := validateUser(input.data); errors.As(err, &validationErr) {
+			rows[i].Error = validationErr.Message
+			continue
+		}
+		if message, isDuplicate := isSeen(input, seen); isDuplicate {
+			rows[i].Error, rows[i].Duplicate = message, true
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for _, i := range valid {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var user db.User
+			var err error
+			if dryRun {
+				err = checkUser(batch[i].data)
+			} else {
+				user, rows[i].Password, err = CreateUser(batch[i].data, false)
+				rows[i].ID = user.ID
+			}
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				rows[i].Error, rows[i].Duplicate = validationErr.Message, validationErr.Duplicate
+			} else {
+				errs[i] = err
+			}
+		}(i)
+	}
+	wg.Wait()
+	// rows saved concurrently with the failed ones are still reported so their passwords are not lost
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			rows[i].Error = "Failed to save user"
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return rows, firstErr
+}
+
+// isSeen tell an earlier row has the KTP number, email or phone number of the row, otherwise they are marked seen
+func isSeen(input importInput, seen map[string]int) (string, bool) {
+	// the data is valid so the phone number can be normalized
+	phoneNumber, _ := phone.Normalize(input.data.PhoneNumber)
+	keys := []struct{ column, value string }{
+		{"ktp_number", string(input.data.KtpNumber)},
+		{"email", db.NormalizeEmail(input.data.Email)},
+		{"phone_number", phoneNumber},
+	}
+	for _, key := range keys {
+		if row, ok := seen[key.column+":"+key.value]; ok {
+			return fmt.Sprintf("%s in row %d", duplicateMessages[key.column], row), true
+		}
+	}
+	for _, key := range keys {
+		seen[key.column+":"+key.value] = input.row
+	}
+	return "", false
+}
+
+// checkUser tell the valid data is used by a saved user, as CreateUser would reject it, without saving it
+func checkUser(input UserRegistrationData) error {
+	phoneNumber, _ := phone.Normalize(input.PhoneNumber)
+	checks := []struct {
+		column string
+		isUsed func(string) (bool, error)
+		value  string
+	}{
+		{"ktp_number", users.IsKtpNumberUsed, string(input.KtpNumber)},
+		{"email", users.IsEmailUsed, input.Email},
+		{"phone_number", users.IsPhoneNumberUsed, phoneNumber},
+	}
+	for _, check := range checks {
+		isUsed, err := check.isUsed(check.value)
+		if err != nil {
+			return err
+		}
+		if isUsed {
+			return &ValidationError{Message: duplicateMessages[check.column], Duplicate: true}
+		}
+	}
+	return nil
+}
+
+// jsonlRows read a UserRegistrationData by decode from every line, empty lines are skipped
+func jsonlRows(reader io.Reader, decode func([]byte) (UserRegistrationData, error)) func() (importInput, bool, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	row := 0
+	return func() (importInput, bool, error) {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			row++
+			input := importInput{row: row}
+			var err error
+			if input.data, err = decode(line); err != nil {
+				input.err = errors.New("Row is not valid user data: " + err.Error())
+			}
+			return input, true, nil
+		}
+		return importInput{}, false, scanner.Err()
+	}
+}
+
+// csvRows read a UserRegistrationData from every record, the header name the columns by UserRegistrationData
+// json names and every column must be known
+func csvRows(reader io.Reader) (func() (importInput, bool, error), error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return func() (importInput, bool, error) { return importInput{}, false, nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, name := range []string{"name", "gender", "email", "ktpNumber", "address", "phoneNumber",
+		"dateofBirth", "cityzenship", "placeofBirth"} {
+		known[name] = true
+	}
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if !known[header[i]] {
+			return nil, errors.New("Unknown import column " + header[i])
+		}
+	}
+	csvReader.FieldsPerRecord = len(header)
+	row := 0
+	return func() (importInput, bool, error) {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return importInput{}, false, nil
+		}
+		row++
+		input := importInput{row: row}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			input.err = errors.New("Row is not valid CSV: " + parseErr.Err.Error())
+			return input, true, nil
+		}
+		if err != nil {
+			return input, false, err
+		}
+		// every field is text in UserRegistrationData so the record is decoded as its json object
+		fields := map[string]string{}
+		for i, name := range header {
+			fields[name] = record[i]
+		}
+		encoded, _ := json.Marshal(fields)
+		json.Unmarshal(encoded, &input.data)
+		return input, true, nil
+	}, nil
+}
@@ -0,0 +1,280 @@
+package register_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/register"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		dryRun  bool
+		created int
+		errors  []string
+		isError bool
+	}{
+		{
+			name:   "JSONL",
+			format: register.FormatJSONL,
+			input: `{"name":"test","email":"test@test.com","ktpNumber":"3201011505900001","phoneNumber":"081200000001"}
+
+{"name":"test","email":"Test@Test.com","ktpNumber":"3201011505900002","phoneNumber":"081200000002"}
+{"name":"test","email":"other@test.com","ktpNumber":3201011505900003,"phoneNumber":"081200000003"}
+{"name":"test","email":"other@test.com","ktpNumber":"1111","phoneNumber":"081200000003"}
+{"name":"test","email":"used@test.com","ktpNumber":"3201011505900004","phoneNumber":"081200000004"}`,
+			created: 1,
+			errors: []string{"", "User with same email already exists in row 1", "Row is not valid user data",
+				"User KTP number must be 16 digits", "User with same KTP number already exists"},
+		},
+		{
+			name:   "CSV",
+			format: register.FormatCSV,
+			input: `email, ktpNumber, phoneNumber, dateofBirth
+test@test.com,3201011505900001,081200000001,1990-05-15
+test2@test.com,3201011505900002,081200000001,
+test3@test.com,3201011505900003
+test4@test.com,3201011505900005,081200000005,1990-05-16`,
+			created: 1,
+			errors: []string{"", "User with same phone number already exists in row 1", "Row is not valid CSV",
+				"User date of birth does not match KTP number"},
+		},
+		{
+			name:    "DryRun",
+			format:  register.FormatJSONL,
+			input:   `{"email":"test@test.com","ktpNumber":"3201011505900001","phoneNumber":"081200000001"}` + "\n" + `{"email":"used@test.com","ktpNumber":"3201011505900002","phoneNumber":"081200000002"}`,
+			dryRun:  true,
+			created: 0,
+			errors:  []string{"", "User with same email already exists"},
+		},
+		{name: "FailUnknownColumn", format: register.FormatCSV, input: "email,ktp\ntest@test.com,3201011505900001", isError: true},
+		{name: "FailUnknownFormat", format: "xml", input: "<users/>", isError: true},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		users := memory.NewUserRepository()
+		register.SetUserRepository(users)
+		_, _, err := register.CreateUser(register.UserRegistrationData{Email: "used@test.com",
+			KtpNumber: "3201011505900004", PhoneNumber: "081200000009"}, false)
+		assert.Nil(t, err, "test "+tc.name+" case")
+
+		result, err := register.Import(strings.NewReader(tc.input), tc.format, tc.dryRun)
+		var validationErr *register.ValidationError
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+		if err != nil {
+			assert.ErrorAs(t, err, &validationErr, "unreadable import should be rejected in test "+tc.name+" case")
+			continue
+		}
+		assert.Equal(t, tc.dryRun, result.DryRun, "test "+tc.name+" case")
+		assert.Equal(t, tc.created, result.Created, "test "+tc.name+" case")
+		assert.Equal(t, len(tc.errors)-countEmpty(tc.errors), result.Failed, "test "+tc.name+" case")
+		if !assert.Len(t, result.Rows, len(tc.errors), "every row should be reported in test "+tc.name+" case") {
+			continue
+		}
+		for i, row := range result.Rows {
+			assert.Equal(t, i+1, row.Row, "test "+tc.name+" case")
+			assert.True(t, strings.HasPrefix(row.Error, tc.errors[i]), "row %d should be rejected with %q, got %q in test %s case",
+				row.Row, tc.errors[i], row.Error, tc.name)
+			if len(tc.errors[i]) > 0 {
+				assert.Empty(t, row.ID, "rejected row should not be created in test "+tc.name+" case")
+				continue
+			}
+			if tc.dryRun {
+				assert.Empty(t, row.ID, "dry run should not create user in test "+tc.name+" case")
+				continue
+			}
+			assert.NotEmpty(t, row.ID, "created id should be reported in test "+tc.name+" case")
+			assert.Len(t, row.Password, 8, "generated password should be reported in test "+tc.name+" case")
+			saved, err := users.FindUserByID(row.ID)
+			assert.Nil(t, err, "test "+tc.name+" case")
+			assert.Equal(t, "+6281200000001", saved.PhoneNumber, "test "+tc.name+" case")
+		}
+		_, total, _ := users.FindUsers(db.UserQuery{})
+		assert.Equal(t, tc.created+1, total, "only valid rows should be saved in test "+tc.name+" case")
+	}
+}
+
+func countEmpty(messages []string) int {
+	count := 0
+	for _, message := range messages {
+		if len(message) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func TestImportV1(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		errors []string
+	}{
+		{
+			name:   "JSONL",
+			format: register.FormatJSONL,
+			input: `{"email":"test@test.com","ktpNumber":3201011505900001,"phoneNumber":"081200000001"}
+{"email":"other@test.com","ktpNumber":"3201011505900002","phoneNumber":"081200000002"}
+{"email":"missing@test.com","phoneNumber":"081200000003"}`,
+			errors: []string{"", "Row is not valid user data", "User KTP number must not be empty"},
+		},
+		{
+			name:   "CSV",
+			format: register.FormatCSV,
+			input:  "email,ktpNumber,phoneNumber\ntest@test.com,3201011505900001,081200000001",
+			errors: []string{""},
+		},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		users := memory.NewUserRepository()
+		register.SetUserRepository(users)
+
+		result, err := register.ImportV1(strings.NewReader(tc.input), tc.format, false)
+		assert.Nil(t, err, "test "+tc.name+" case")
+		if !assert.Len(t, result.Rows, len(tc.errors), "every row should be reported in test "+tc.name+" case") {
+			continue
+		}
+		for i, row := range result.Rows {
+			assert.True(t, strings.HasPrefix(row.Error, tc.errors[i]), "row %d should be rejected with %q, got %q in test %s case",
+				row.Row, tc.errors[i], row.Error, tc.name)
+		}
+		saved, err := users.FindUserByID(result.Rows[0].ID)
+		assert.Nil(t, err, "test "+tc.name+" case")
+		assert.Equal(t, "3201011505900001", saved.KtpNumber, "test "+tc.name+" case")
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	register.SetUserRepository(memory.NewUserRepository())
+
+	var input bytes.Buffer
+	rows := register.ImportBatchSize + register.ImportBatchSize/2
+	for i := 1; i <= rows; i++ {
+		fmt.Fprintf(&input, `{"email":"test%d@test.com","ktpNumber":"320101150590%04d","phoneNumber":"0812000%05d"}`+"\n", i, i, i)
+	}
+	// the last row repeat a row of the first batch
+	fmt.Fprintf(&input, `{"email":"test1@test.com","ktpNumber":"3201011505909999","phoneNumber":"081209999999"}`)
+
+	result, err := register.Import(&input, register.FormatJSONL, false)
+	assert.Nil(t, err)
+	assert.Equal(t, rows, result.Created, "every row should be created across batches")
+	assert.Equal(t, 1, result.Failed)
+	if assert.Len(t, result.Rows, rows+1) {
+		last := result.Rows[rows]
+		assert.True(t, last.Duplicate, "row repeating a row of an earlier batch should be duplicate")
+		assert.Equal(t, "User with same email already exists in row 1", last.Error)
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		input   string
+		code    int
+		created float64
+	}{
+		{name: "OK", query: "?format=csv", input: "email,ktpNumber,phoneNumber\ntest@test.com,3201011505900001,081200000001",
+			code: 200, created: 1},
+		{name: "OKDefaultFormat", input: `{"email":"test2@test.com","ktpNumber":"3201011505900002","phoneNumber":"081200000002"}`,
+			code: 200, created: 1},
+		{name: "OKDryRun", query: "?dryRun=true", input: `{"email":"test3@test.com","ktpNumber":"3201011505900003","phoneNumber":"081200000003"}`,
+			code: 200},
+		{name: "FailUnknownFormat", query: "?format=xml", input: "<users/>", code: 400},
+		{name: "FailInvalidQuery", query: "?dryRun=maybe", input: "", code: 400},
+	}
+	r := gin.Default()
+	r.POST("/t/import", register.ImportUsers)
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/t/import"+tc.query, strings.NewReader(tc.input))
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		var got struct {
+			Message string                 `json:"message"`
+			Result  map[string]interface{} `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEmpty(t, got.Message, "test "+tc.name+" case")
+		if tc.code == 200 {
+			assert.Equal(t, tc.created, got.Result["created"], "test "+tc.name+" case")
+			assert.Len(t, got.Result["rows"], 1, "test "+tc.name+" case")
+		}
+	}
+}
+
+func TestImportUsersV1(t *testing.T) {
+	r := gin.Default()
+	r.POST("/t/import", register.ImportUsersV1)
+	set := setupTestCase(t)
+	defer set(t)
+	register.SetUserRepository(memory.NewUserRepository())
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/t/import",
+		strings.NewReader(`{"email":"test@test.com","ktpNumber":3201011505900001,"phoneNumber":"081200000001"}`))
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		Result register.ImportResult `json:"result"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, 1, got.Result.Created, "KTP number as json number should be imported by API v1")
+}
+
+func TestImportUsersReadFailure(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	logs := memory.NewLogRepository()
+	audit.SetLogRepository(logs)
+
+	var input bytes.Buffer
+	for i := 1; i <= register.ImportBatchSize; i++ {
+		fmt.Fprintf(&input, `{"email":"test%d@test.com","ktpNumber":"320101150590%04d","phoneNumber":"0812000%05d"}`+"\n", i, i, i)
+	}
+	// line too long to be read stop the import after the first batch is saved
+	input.WriteString(`{"name":"` + strings.Repeat("a", 2<<20) + `"}`)
+	r := gin.Default()
+	r.POST("/t/import", register.ImportUsers)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/t/import", &input)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	var got struct {
+		Message string                `json:"message"`
+		Result  register.ImportResult `json:"result"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Contains(t, got.Message, "Failed to read import")
+	assert.Equal(t, register.ImportBatchSize, got.Result.Created, "users saved before the failure should be reported")
+	assert.Len(t, got.Result.Rows, register.ImportBatchSize)
+	if events := logs.AuditEvents(); assert.Len(t, events, register.ImportBatchSize+1, "import should be audited") {
+		assert.Contains(t, events[len(events)-1].Metadata, `"import_users"`)
+	}
+}
@@ -1,37 +1,61 @@
 package register
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/nik"
 )
 
 // UserRegistrationData json data definition for User registration
 type UserRegistrationData struct {
-	Name         string `json:"name"`
-	Gender       string `json:"gender"`
-	Email        string `json:"email"`
-	KtpNumber    int64  `json:"ktpNumber"`
-	Address      string `json:"address"`
-	PhoneNumber  string `json:"phoneNumber"`
-	DateOfBirth  string `json:"dateofBirth"`
-	Cityzenship  string `json:"cityzenship"`
-	PlaceOfBirth string `json:"placeofBirth"`
+	Name         string     `json:"name"`
+	Gender       string     `json:"gender"`
+	Email        string     `json:"email"`
+	KtpNumber    nik.Number `json:"ktpNumber"`
+	Address      string     `json:"address"`
+	PhoneNumber  string     `json:"phoneNumber"`
+	DateOfBirth  string     `json:"dateofBirth"`
+	Cityzenship  string     `json:"cityzenship"`
+	PlaceOfBirth string     `json:"placeofBirth"`
+	// Backend is set by authentication backend provisioning the user, it is never read from request
+	Backend string `json:"-"`
+	// ExternalID, Disabled and Password are set by provisioning client, they are never read from request.
+	// Empty password is generated
+	ExternalID string `json:"-"`
+	Disabled   bool   `json:"-"`
+	Password   string `json:"-"`
+}
+
+// UserRegistrationDataV1 is UserRegistrationData of API v1 where KTP number is json number
+type UserRegistrationDataV1 struct {
+	UserRegistrationData
+	KtpNumber int64 `json:"ktpNumber"`
+}
+
+// Upgrade convert to data of the current API, zero KTP number is missing KTP number
+func (t UserRegistrationDataV1) Upgrade() UserRegistrationData {
+	data := t.UserRegistrationData
+	if t.KtpNumber != 0 {
+		data.KtpNumber = nik.Number(strconv.FormatInt(t.KtpNumber, 10))
+	}
+	return data
 }
 
 // ResponseSaveUser json data definition for response from server to http request
 type ResponseSaveUser struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Gender       string    `json:"gender"`
-	Email        string    `json:"email"`
-	KtpNumber    int64     `json:"ktpNumber"`
-	Address      string    `json:"address"`
-	PhoneNumber  string    `json:"phoneNumber"`
-	Password     string    `json:"password"`
-	DateOfBirth  time.Time `json:"dateofBirth"`
-	Cityzenship  string    `json:"cityzenship"`
-	PlaceOfBirth string    `json:"placeofBirth"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Gender       string     `json:"gender"`
+	Email        string     `json:"email"`
+	KtpNumber    nik.Number `json:"ktpNumber"`
+	Address      string     `json:"address"`
+	PhoneNumber  string     `json:"phoneNumber"`
+	Password     string     `json:"password"`
+	DateOfBirth  time.Time  `json:"dateofBirth"`
+	Cityzenship  string     `json:"cityzenship"`
+	PlaceOfBirth string     `json:"placeofBirth"`
 }
 
 // CreateResponse from database
@@ -40,7 +64,7 @@ func (t ResponseSaveUser) CreateResponse(user db.User) ResponseSaveUser {
 	t.Name = user.Name
 	t.Gender = user.Gender
 	t.Email = user.Email
-	t.KtpNumber = user.KtpNumber
+	t.KtpNumber = nik.Number(user.KtpNumber)
 	t.Address = user.Address
 	t.PhoneNumber = user.PhoneNumber
 	t.DateOfBirth = user.DateOfBirth
@@ -48,3 +72,15 @@ func (t ResponseSaveUser) CreateResponse(user db.User) ResponseSaveUser {
 	t.PlaceOfBirth = user.PlaceOfBirth
 	return t
 }
+
+// ResponseSaveUserV1 is ResponseSaveUser of API v1 where KTP number is json number
+type ResponseSaveUserV1 struct {
+	ResponseSaveUser
+	KtpNumber int64 `json:"ktpNumber"`
+}
+
+// Downgrade convert to response of API v1, KTP number which is not digits is given as zero
+func (t ResponseSaveUser) Downgrade() ResponseSaveUserV1 {
+	ktpNumber, _ := strconv.ParseInt(string(t.KtpNumber), 10, 64)
+	return ResponseSaveUserV1{ResponseSaveUser: t, KtpNumber: ktpNumber}
+}
@@ -0,0 +1,20 @@
+package register
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by register service handlers
+type UserRepository interface {
+	IsKtpNumberUsed(ktpNumber string) (bool, error)
+	IsEmailUsed(email string) (bool, error)
+	IsPhoneNumberUsed(phoneNumber string) (bool, error)
+	RegisterUser(user *db.User, newID func() (string, error), attempts int) error
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+
+// SetUserRepository replace user storage used by register service handlers
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
@@ -2,14 +2,16 @@ package register
 
 import (
 	"errors"
-	"math/rand"
 	"net/http"
 	"time"
 
+	"github.com/drd-engineering/TwinCape/audit"
 	"github.com/drd-engineering/TwinCape/db"
 	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/nik"
+	"github.com/drd-engineering/TwinCape/phone"
+	"github.com/drd-engineering/TwinCape/userid"
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -18,119 +20,247 @@ import (
 func SaveUser(c *gin.Context) {
 	var input UserRegistrationData
 	c.ShouldBindJSON(&input)
+	saveUser(c, input, func(response ResponseSaveUser) interface{} { return response })
+}
 
-	var dbInstance = db.GetDb()
-
-	strChan := make(chan string)
-	errChan := make(chan error)
-
-	go createPassword(8, strChan)
+// SaveUserV1 is SaveUser of API v1 taking and giving KTP number as json number
+func SaveUserV1(c *gin.Context) {
+	var input UserRegistrationDataV1
+	c.ShouldBindJSON(&input)
+	saveUser(c, input.Upgrade(), func(response ResponseSaveUser) interface{} { return response.Downgrade() })
+}
 
-	validationMessage, isValid := isDataRegistrationValid(input)
-	if !isValid {
+// saveUser register the user, respond convert the saved user to the response of the API version
+func saveUser(c *gin.Context, input UserRegistrationData, respond func(ResponseSaveUser) interface{}) {
+	userDb, password, err := createUser(input, false)
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		reason := "invalid_data"
+		if validationErr.Duplicate {
+			reason = "duplicate_user"
+		}
+		emitRegistrationFailure(c, reason, validationErr.Message)
 		c.Abort()
-		c.JSON(http.StatusBadRequest, gin.H{"message": validationMessage})
+		c.JSON(http.StatusBadRequest, gin.H{"message": validationErr.Message})
 		return
-	}
-	message, isExist := isUserExist(input, dbInstance)
-	if isExist {
+	case err == ErrNotConfigured:
 		c.Abort()
-		c.JSON(http.StatusBadRequest, gin.H{"message": message})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	case err != nil:
+		emitRegistrationFailure(c, "storage_error", err.Error())
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save user"})
 		return
 	}
+	audit.Emit(c, audit.Event{
+		Type:      audit.Registration,
+		SubjectID: userDb.ID,
+	})
+	responseSaveUser := ResponseSaveUser{}
+	responseSaveUser = responseSaveUser.CreateResponse(userDb)
+	responseSaveUser.Password = password
+	c.JSON(http.StatusOK, gin.H{"user": respond(responseSaveUser), "message": "User saved"})
+}
 
-	go createUniqueID(dbInstance, strChan, errChan)
+// emitRegistrationFailure audit the rejected registration without its data, audit events are kept when the
+// account is erased so they must not hold personal data
+func emitRegistrationFailure(c *gin.Context, reason string, message string) {
+	audit.Emit(c, audit.Event{
+		Type:     audit.Registration,
+		Outcome:  audit.Failure,
+		Reason:   reason,
+		Metadata: map[string]interface{}{"message": message},
+	})
+}
 
-	var userBirthDate time.Time
-	var err error
-	if len(input.DateOfBirth) != 0 {
-		userBirthDate, err = time.Parse("2006-01-02", input.DateOfBirth)
+func isDataRegistrationValid(user UserRegistrationData) (string, bool) {
+	if len(user.KtpNumber) == 0 {
+		return "User KTP number must not be empty", false
 	}
-	if err != nil {
-		c.Abort()
-		c.JSON(http.StatusBadRequest,
-			gin.H{"message": "Date of birth format: (YYYY-MM-DD"})
-		return
+	if len(user.Email) == 0 {
+		return "User email must not be empty", false
+	}
+	if len(user.PhoneNumber) == 0 {
+		return "User phone number must not be empty", false
 	}
-	passwordUser := <-strChan
-	go secureUserPassword(passwordUser, strChan, errChan)
+	if _, message, isValid := NormalizePhoneNumber(user.PhoneNumber); !isValid {
+		return message, false
+	}
+	// invalid date of birth is rejected with its own message after this
+	dateOfBirth, _ := time.Parse("2006-01-02", user.DateOfBirth)
+	return CheckKtpNumber(user.KtpNumber, dateOfBirth, user.Gender)
+}
 
-	storedID := <-strChan
-	err = <-errChan
+var ktpNumberMessages = map[error]string{
+	nik.ErrInvalidLength:     "User KTP number must be 16 digits",
+	nik.ErrInvalidRegion:     "User KTP number has unknown region code",
+	nik.ErrInvalidBirthDate:  "User KTP number has invalid birth date",
+	nik.ErrInvalidSerial:     "User KTP number has invalid serial number",
+	nik.ErrBirthDateMismatch: "User date of birth does not match KTP number",
+	nik.ErrGenderMismatch:    "User gender does not match KTP number",
+}
+
+// CheckKtpNumber check the KTP number is a valid NIK not contradicting date of birth and gender of the user,
+// zero date of birth and gender other than male or female are not checked
+func CheckKtpNumber(ktpNumber nik.Number, dateOfBirth time.Time, gender string) (string, bool) {
+	parsed, err := ktpNumber.Parse()
+	if err == nil {
+		err = parsed.CheckProfile(dateOfBirth, gender)
+	}
 	if err != nil {
-		c.Abort()
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"message": err.Error()})
-		return
+		return ktpNumberMessages[err], false
 	}
+	return "", true
+}
+
+var phoneNumberMessages = map[error]string{
+	phone.ErrInvalidNumber: "User phone number must be digits with optional country code",
+	phone.ErrInvalidLength: "User phone number has too few or too many digits",
+}
 
-	storedPassword := <-strChan
-	err = <-errChan
+// NormalizePhoneNumber give the phone number in E.164, numbers without country code are Indonesian,
+// or the message telling why it is invalid
+func NormalizePhoneNumber(phoneNumber string) (string, string, bool) {
+	normalized, err := phone.Normalize(phoneNumber)
 	if err != nil {
-		c.Abort()
-		c.JSON(http.StatusInternalServerError,
-			gin.H{"message": "Failed process when hashing user password"})
-		return
+		return "", phoneNumberMessages[err], false
 	}
+	return normalized, "", true
+}
 
-	var userDb = db.User{
-		ID:           storedID,
-		Name:         input.Name,
-		Gender:       input.Gender,
-		Email:        input.Email,
-		KtpNumber:    input.KtpNumber,
-		Address:      input.Address,
-		PhoneNumber:  input.PhoneNumber,
-		Password:     storedPassword,
-		DateOfBirth:  userBirthDate,
-		Cityzenship:  input.Cityzenship,
-		PlaceOfBirth: input.PlaceOfBirth,
-	}
-	dbInstance.Create(&userDb)
-	responseSaveUser := ResponseSaveUser{}
-	responseSaveUser = responseSaveUser.CreateResponse(userDb)
-	responseSaveUser.Password = passwordUser
-	c.JSON(http.StatusOK, gin.H{"user": responseSaveUser, "message": "User saved"})
+// ValidationError is failure of CreateUser caused by the data given, other errors are failure of the system
+type ValidationError struct {
+	Message string
+	// Duplicate tell the data is used by another user
+	Duplicate bool
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ErrNotConfigured returned when the base strings of generated passwords and ids are not set
+var ErrNotConfigured = errors.New("Registration is not configured")
+
+// duplicateMessages is the message telling which data is used by another user, by the unique column
+var duplicateMessages = map[string]string{
+	"ktp_number":   "User with same KTP number already exists",
+	"email":        "User with same email already exists",
+	"phone_number": "User with same phone number already exists",
+}
+
+// DuplicateMessage give the message telling the data of the column is used by another user
+func DuplicateMessage(column string) string {
+	return duplicateMessages[column]
+}
+
+// idAttempts is the number of ids generated for a user before giving up when they are used by other users,
+// the id schemes make a used id practically impossible so this only guard against a broken generator
+const idAttempts = 3
+
+// CreateUser register user outside of http request, return the user saved with the password given or generated
+func CreateUser(input UserRegistrationData, isAdmin bool) (db.User, string, error) {
+	userDb, password, err := createUser(input, isAdmin)
+	if err != nil {
+		return db.User{}, "", err
+	}
+	audit.Record(audit.Event{
+		Type:      audit.Registration,
+		SubjectID: userDb.ID,
+		Metadata:  map[string]interface{}{"isAdmin": isAdmin},
+	})
+	return userDb, password, nil
 }
 
-func isUserExist(user UserRegistrationData, dbInstance *gorm.DB) (string, bool) {
-	var existingUserCount int
-	dbInstance.Model(&db.User{}).Where("ktp_number = ?", user.KtpNumber).Count(&existingUserCount)
-	if existingUserCount > 0 {
-		return "User with same KTP number already exists", true
+// createUser save the user with generated id and the password given or generated in one insert. Uniqueness of
+// KTP number, email and phone number is left to the storage so concurrent registrations of the same data can
+// not both succeed
+func createUser(input UserRegistrationData, isAdmin bool) (db.User, string, error) {
+	userBirthDate, err := validateUser(input)
+	if err != nil {
+		return db.User{}, "", err
+	}
+	scheme, err := userid.Configured()
+	if err == userid.ErrNotConfigured {
+		return db.User{}, "", ErrNotConfigured
 	}
-	dbInstance.Model(&db.User{}).Where("email = ?", user.Email).Count(&existingUserCount)
-	if existingUserCount > 0 {
-		return "User with same email already exists", true
+	if err != nil {
+		return db.User{}, "", err
 	}
-	dbInstance.Model(&db.User{}).Where("phone_number = ?", user.PhoneNumber).Count(&existingUserCount)
-	if existingUserCount > 0 {
-		return "User with same phone number already exists", true
+	password := input.Password
+	if len(password) == 0 {
+		if password, err = GeneratePassword(); err != nil {
+			return db.User{}, "", err
+		}
+	}
+	storedPassword, err := HashPassword(password)
+	if err != nil {
+		return db.User{}, "", err
 	}
-	return "", false
-}
 
-func isDataRegistrationValid(user UserRegistrationData) (string, bool) {
-	if user.KtpNumber < 1 {
-		return "User KTP number must not be empty", false
+	// the phone number is valid since the data is checked
+	phoneNumber, _ := phone.Normalize(input.PhoneNumber)
+	userDb := db.User{
+		Name:                input.Name,
+		Gender:              input.Gender,
+		Email:               input.Email,
+		KtpNumber:           string(input.KtpNumber),
+		Address:             input.Address,
+		PhoneNumber:         phoneNumber,
+		OriginalPhoneNumber: input.PhoneNumber,
+		Password:            storedPassword,
+		DateOfBirth:         userBirthDate,
+		Cityzenship:         input.Cityzenship,
+		PlaceOfBirth:        input.PlaceOfBirth,
+		IsAdmin:             isAdmin,
+		Backend:             input.Backend,
+		ExternalID:          input.ExternalID,
+		Disabled:            input.Disabled,
 	}
-	if len(user.Email) == 0 {
-		return "User email must not be empty", false
+	err = users.RegisterUser(&userDb, scheme.NewID, idAttempts)
+	var duplicate *db.DuplicateUserError
+	switch {
+	case errors.As(err, &duplicate) && duplicate.Column == "id":
+		return db.User{}, "", errors.New("UniqueID: failed to generate unique ID")
+	case errors.As(err, &duplicate):
+		return db.User{}, "", &ValidationError{Message: duplicateMessages[duplicate.Column], Duplicate: true}
+	case err != nil:
+		return db.User{}, "", err
 	}
-	if len(user.PhoneNumber) == 0 {
-		return "User phone number must not be empty", false
+	return userDb, password, nil
+}
+
+// validateUser check the data by the rules of registration and give the date of birth, failure is *ValidationError
+func validateUser(input UserRegistrationData) (time.Time, error) {
+	if validationMessage, isValid := isDataRegistrationValid(input); !isValid {
+		return time.Time{}, &ValidationError{Message: validationMessage}
 	}
-	return "", true
+	var userBirthDate time.Time
+	if len(input.DateOfBirth) != 0 {
+		var err error
+		if userBirthDate, err = time.Parse("2006-01-02", input.DateOfBirth); err != nil {
+			return time.Time{}, &ValidationError{Message: "Date of birth format: (YYYY-MM-DD"}
+		}
+	}
+	return userBirthDate, nil
 }
 
-func createPassword(passwordLength int, c chan string) {
-	environments.LoadEnvironmentVariableFile()
+// GeneratePassword create random password for new user or password reset
+func GeneratePassword() (string, error) {
 	passwordBaseString := environments.Get("PASSWORD_BASE_STRING")
-	byteResult := make([]byte, passwordLength)
-	for i := range byteResult {
-		byteResult[i] = passwordBaseString[rand.Int63()%int64(len(passwordBaseString))]
+	if len(passwordBaseString) == 0 {
+		return "", ErrNotConfigured
 	}
-	c <- string(byteResult)
+	return userid.RandomString(8, passwordBaseString)
+}
+
+// HashPassword hash and salt password to be saved
+func HashPassword(password string) (string, error) {
+	c, r := make(chan string, 1), make(chan error, 1)
+	secureUserPassword(password, c, r)
+	return <-c, <-r
 }
 
 func secureUserPassword(password string, c chan string, r chan error) {
@@ -144,26 +274,3 @@ func secureUserPassword(password string, c chan string, r chan error) {
 	c <- string(hashValue)
 	r <- nil
 }
-
-func createUniqueID(dbInstance *gorm.DB, c chan string, r chan error) {
-	environments.LoadEnvironmentVariableFile()
-	idBaseString := environments.Get("ID_BASE_STRING")
-	// max 3 times trial
-	for i := 0; i < 3; i++ {
-		byteResult := make([]byte, 6)
-		for i := range byteResult {
-			byteResult[i] = idBaseString[rand.Int63()%int64(len(idBaseString))]
-		}
-		result := "DRD-" + string(byteResult)
-		var existingUserCount int
-		dbInstance.Model(&db.User{}).Where("id = ?", result).Count(&existingUserCount)
-		if existingUserCount < 1 {
-			c <- result
-			r <- nil
-			return
-		}
-	}
-	// if fail all trial
-	c <- ""
-	r <- errors.New("UniqueID: failed to generate unique ID")
-}
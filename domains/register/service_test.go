@@ -3,29 +3,26 @@ package register_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
 	"runtime"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/drd-engineering/TwinCape/audit"
 	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
 	"github.com/drd-engineering/TwinCape/domains/register"
 	"github.com/drd-engineering/TwinCape/environments"
 )
 
-func dbTestConfig() *db.Config {
-	return &db.Config{
-		Host:     environments.Get("HOST_DB"),
-		Username: environments.Get("USERNAME_DB"),
-		DBName:   environments.Get("DB_NAME"),
-		Password: environments.Get("PASSWORD_DB"),
-	}
-}
 func setupTestCase(t *testing.T) func(t *testing.T) {
 	environments.Set("RELEASE_TYPE", "localhost")
 	_, filename, _, _ := runtime.Caller(0)
@@ -35,11 +32,12 @@ func setupTestCase(t *testing.T) func(t *testing.T) {
 		panic(err)
 	}
 	environments.LoadEnvironmentVariableFile()
-	db.InitPostgre(dbTestConfig())
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	register.SetUserRepository(memory.NewUserRepository())
+	audit.SetLogRepository(memory.NewLogRepository())
 	return func(t *testing.T) {
 		os.Clearenv()
-		dbInstance := db.GetDb()
-		dbInstance.DropTable(db.User{}, db.APILog{})
 	}
 }
 func TestSaveUser(t *testing.T) {
@@ -51,8 +49,8 @@ func TestSaveUser(t *testing.T) {
 	}{
 		{
 			name: "OK",
-			input: []byte(`{"name":"test", "email":"test@test.com","ktpNumber":1111,
-							"address":"jalan test","phoneNumber":"+6200000000000",
+			input: []byte(`{"name":"test", "email":"test@test.com","ktpNumber":"3201012212000001",
+							"address":"jalan test","phoneNumber":"+6281200000000",
 							"dateofBirth":"2000-12-22","cityzenship":"WNI","placeofBirth":"Jakarta"}`),
 			code: 200,
 			body: []string{"message", "user"},
@@ -60,7 +58,7 @@ func TestSaveUser(t *testing.T) {
 		{
 			name: "FailNoKTPNumber",
 			input: []byte(`{"name":"test", "email":"test@test.com",
-							"address":"jalan test","phoneNumber":"+6200000000000",
+							"address":"jalan test","phoneNumber":"+6281200000000",
 							"dateofBirth":"2000-12-22","cityzenship":"WNI","placeofBirth":"Jakarta"}`),
 			code: 400,
 			body: []string{"message"},
@@ -68,51 +66,114 @@ func TestSaveUser(t *testing.T) {
 		{
 			name: "FailNoPhoneNumber",
 			input: []byte(`{"name":"test", "email":"test@test.com",
-							"ktpNumber":1111,"address":"jalan test",
+							"ktpNumber":"3201012212000001","address":"jalan test",
 							"dateofBirth":"2000-12-22","cityzenship":"WNI","placeofBirth":"Jakarta"}`),
 			code: 400,
 			body: []string{"message"},
 		},
 		{
 			name: "FailNoEmail",
-			input: []byte(`{"name":"test", "ktpNumber":1111,
-							"address":"jalan test","phoneNumber":"+6200000000000",
+			input: []byte(`{"name":"test", "ktpNumber":"3201012212000001",
+							"address":"jalan test","phoneNumber":"+6281200000000",
 							"dateofBirth":"2000-12-22","cityzenship":"WNI","placeofBirth":"Jakarta"}`),
 			code: 400,
 			body: []string{"message"},
 		},
 		{
 			name: "OKDataIncomplete",
-			input: []byte(`{"name":"test", "email":"test2@test.com","ktpNumber":1112,
-							"address":"jalan test","phoneNumber":"+6200000000001"}`),
+			input: []byte(`{"name":"test", "email":"test2@test.com","ktpNumber":"3201011505900002",
+							"address":"jalan test","phoneNumber":"+6281200000001"}`),
 			code: 200,
 			body: []string{"message", "user"},
 		},
+		{
+			name: "FailSameEmailOtherCase",
+			input: []byte(`{"name":"test", "email":" Test@Test.com","ktpNumber":"3201011505900003",
+							"address":"jalan test","phoneNumber":"+6281200000002"}`),
+			code: 400,
+			body: []string{"message"},
+		},
 		{
 			name: "FailSameEmail",
-			input: []byte(`{"name":"test", "email":"test@test.com","ktpNumber":1113,
-							"address":"jalan test","phoneNumber":"+6200000000002"}`),
+			input: []byte(`{"name":"test", "email":"test@test.com","ktpNumber":"3201011505900003",
+							"address":"jalan test","phoneNumber":"+6281200000002"}`),
 			code: 400,
 			body: []string{"message"},
 		},
 		{
 			name: "FailSameKTPNumber",
-			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":1111,
-							"address":"jalan test","phoneNumber":"+6200000000002"}`),
+			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":"3201012212000001",
+							"address":"jalan test","phoneNumber":"+6281200000002"}`),
 			code: 400,
 			body: []string{"message"},
 		},
 		{
 			name: "FailSamePhoneNumber",
-			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":1113,
-							"address":"jalan test","phoneNumber":"+6200000000000"}`),
+			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":"3201011505900003",
+							"address":"jalan test","phoneNumber":"+6281200000000"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailSamePhoneNumberNationalFormat",
+			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":"3201011505900003",
+							"address":"jalan test","phoneNumber":"0812-0000-0000"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailInvalidPhoneNumber",
+			input: []byte(`{"name":"test", "email":"test3@test.com","ktpNumber":"3201011505900003",
+							"address":"jalan test","phoneNumber":"0812"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailKTPNumberNegative",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":"-320101150590001",
+							"address":"jalan test","phoneNumber":"+6281200000005"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailKTPNumberAsNumber",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":3201011505900005,
+							"address":"jalan test","phoneNumber":"+6281200000005"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailKTPNumberNotNIK",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":"1111",
+							"address":"jalan test","phoneNumber":"+6281200000005"}`),
 			code: 400,
 			body: []string{"message"},
 		},
+		{
+			name: "FailBirthDateNotMatchingKTPNumber",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":"3201011505900005",
+							"address":"jalan test","phoneNumber":"+6281200000005","dateofBirth":"1990-05-16"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "FailGenderNotMatchingKTPNumber",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":"3201011505900005",
+							"address":"jalan test","phoneNumber":"+6281200000005","gender":"Perempuan"}`),
+			code: 400,
+			body: []string{"message"},
+		},
+		{
+			name: "OKProfileMatchingKTPNumber",
+			input: []byte(`{"name":"test", "email":"nik@test.com","ktpNumber":"3201015505900005",
+							"address":"jalan test","phoneNumber":"+6281200000005","dateofBirth":"1990-05-15","gender":"Perempuan"}`),
+			code: 200,
+			body: []string{"message", "user"},
+		},
 		{
 			name: "FailedBecauseFalseBirthDateFormat",
-			input: []byte(`{"name":"test", "email":"est@test.com","ktpNumber":11911,
-							"address":"jalan test","phoneNumber":"+6200000090000",
+			input: []byte(`{"name":"test", "email":"est@test.com","ktpNumber":"3201011505900004",
+							"address":"jalan test","phoneNumber":"+6281200090000",
 							"dateofBirth":"2000-30-12","cityzenship":"WNI","placeofBirth":"Jakarta"}`),
 			code: 400,
 			body: []string{"message"},
@@ -123,6 +184,8 @@ func TestSaveUser(t *testing.T) {
 
 	set := setupTestCase(t)
 	defer set(t)
+	logs := memory.NewLogRepository()
+	audit.SetLogRepository(logs)
 	for _, tc := range tests {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/t/saveUser", bytes.NewBuffer(tc.input))
@@ -140,4 +203,159 @@ func TestSaveUser(t *testing.T) {
 			assert.NotEmpty(t, val, "the value of json data should not be empty in test "+tc.name+" case")
 		}
 	}
+	// audit events outlive erasure of the account, they must not hold its email
+	assert.NotEmpty(t, logs.AuditEvents(), "registrations should be audited")
+	for _, event := range logs.AuditEvents() {
+		assert.NotContains(t, event.Metadata, "test@test.com", "registration audit should not hold the email")
+	}
+}
+
+func TestSaveUserConcurrently(t *testing.T) {
+	r := gin.Default()
+	r.POST("/t/saveUser", register.SaveUser)
+	set := setupTestCase(t)
+	defer set(t)
+	users := memory.NewUserRepository()
+	register.SetUserRepository(users)
+
+	// every registration has the same email, only one of them can be saved
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := fmt.Sprintf(`{"name":"test", "email":"test@test.com","ktpNumber":"320101150590%04d",
+				"address":"jalan test","phoneNumber":"+62812000000%02d"}`, i+1, i)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/t/saveUser", bytes.NewBufferString(input))
+			r.ServeHTTP(w, req)
+			codes <- w.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	saved := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			saved++
+		} else {
+			assert.Equal(t, http.StatusBadRequest, code, "duplicate registration should be rejected")
+		}
+	}
+	assert.Equal(t, 1, saved, "only one registration should be saved")
+	_, total, _ := users.FindUsers(db.UserQuery{Email: "test@test.com"})
+	assert.Equal(t, 1, total, "only one user should be stored")
+}
+
+// failingUserRepository is user storage failing every insert
+type failingUserRepository struct {
+	*memory.UserRepository
+}
+
+func (failingUserRepository) RegisterUser(user *db.User, newID func() (string, error), attempts int) error {
+	return errors.New("insert failed")
+}
+
+func TestSaveUserFailingStorage(t *testing.T) {
+	r := gin.Default()
+	r.POST("/t/saveUser", register.SaveUser)
+	set := setupTestCase(t)
+	defer set(t)
+	register.SetUserRepository(failingUserRepository{memory.NewUserRepository()})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/t/saveUser", bytes.NewBufferString(`{"name":"test", "email":"test@test.com",
+		"ktpNumber":"3201012212000001","address":"jalan test","phoneNumber":"+6281200000000"}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "failed insert should not be reported as saved")
+	assert.JSONEq(t, `{"message":"Failed to save user"}`, w.Body.String())
+}
+
+func TestSaveUserV1(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []byte
+		code      int
+		ktpNumber interface{}
+	}{
+		{
+			name: "OKKTPNumberAsNumber",
+			input: []byte(`{"name":"test", "email":"test@test.com","ktpNumber":3201011505900001,
+							"address":"jalan test","phoneNumber":"+6281200000000"}`),
+			code:      200,
+			ktpNumber: float64(3201011505900001),
+		},
+		{
+			name: "FailNoKTPNumber",
+			input: []byte(`{"name":"test", "email":"test2@test.com",
+							"address":"jalan test","phoneNumber":"+6281200000001"}`),
+			code: 400,
+		},
+		{
+			name: "FailKTPNumberNegative",
+			input: []byte(`{"name":"test", "email":"test2@test.com","ktpNumber":-3201011505900002,
+							"address":"jalan test","phoneNumber":"+6281200000001"}`),
+			code: 400,
+		},
+	}
+	r := gin.Default()
+	r.POST("/t/saveUser", register.SaveUserV1)
+
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/t/saveUser", bytes.NewBuffer(tc.input))
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		var got struct {
+			User map[string]interface{} `json:"user"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if tc.code == 200 {
+			assert.Equal(t, tc.ktpNumber, got.User["ktpNumber"], "KTP number should be json number in test "+tc.name+" case")
+		}
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       register.UserRegistrationData
+		isAdmin     bool
+		isError     bool
+		phoneNumber string
+	}{
+		{name: "OKAdmin", input: register.UserRegistrationData{Name: "admin", Email: "admin@test.com",
+			KtpNumber: "3201012212000001", PhoneNumber: "+6281200000000", DateOfBirth: "2000-12-22"}, isAdmin: true},
+		{name: "OKUser", input: register.UserRegistrationData{Name: "test", Email: "test@test.com",
+			KtpNumber: "3201011505900002", PhoneNumber: "0812 0000 0001"}, phoneNumber: "+6281200000001"},
+		{name: "FailNoEmail", input: register.UserRegistrationData{KtpNumber: "3201011505900003", PhoneNumber: "+6281200000002"}, isError: true},
+		{name: "FailSameKTPNumber", input: register.UserRegistrationData{Email: "other@test.com",
+			KtpNumber: "3201012212000001", PhoneNumber: "+6281200000002"}, isError: true},
+		{name: "FailKTPNumberNotNIK", input: register.UserRegistrationData{Email: "other@test.com",
+			KtpNumber: "1114", PhoneNumber: "+6281200000002"}, isError: true},
+		{name: "FailBirthDateFormat", input: register.UserRegistrationData{Email: "other@test.com",
+			KtpNumber: "3201011505900003", PhoneNumber: "+6281200000002", DateOfBirth: "2000-30-12"}, isError: true},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	for _, tc := range tests {
+		user, password, err := register.CreateUser(tc.input, tc.isAdmin)
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+		if err == nil {
+			assert.NotEmpty(t, user.ID, "id should be generated in test "+tc.name+" case")
+			assert.Len(t, password, 8, "password should be generated in test "+tc.name+" case")
+			assert.NotEqual(t, password, user.Password, "password should be saved hashed in test "+tc.name+" case")
+			assert.Equal(t, tc.isAdmin, user.IsAdmin, "test "+tc.name+" case")
+			if len(tc.phoneNumber) > 0 {
+				assert.Equal(t, tc.phoneNumber, user.PhoneNumber, "phone number should be normalized in test "+tc.name+" case")
+				assert.Equal(t, tc.input.PhoneNumber, user.OriginalPhoneNumber, "test "+tc.name+" case")
+			}
+		}
+	}
 }
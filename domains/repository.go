@@ -0,0 +1,99 @@
+package domains
+
+import (
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/domains/account"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/client"
+	"github.com/drd-engineering/TwinCape/domains/oidc"
+	"github.com/drd-engineering/TwinCape/domains/privacy"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/domains/saml"
+	"github.com/drd-engineering/TwinCape/domains/scim"
+	"github.com/drd-engineering/TwinCape/domains/session"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/routes"
+)
+
+// UserRepository is user storage needed by every domain
+type UserRepository interface {
+	account.UserRepository
+	authenticator.UserRepository
+	register.UserRepository
+	oidc.UserRepository
+	privacy.UserRepository
+	routes.UserRepository
+	saml.UserRepository
+	scim.UserRepository
+}
+
+// LogRepository is api log and audit event storage needed by every domain
+type LogRepository interface {
+	apilog.LogRepository
+	audit.LogRepository
+	privacy.LogRepository
+	routes.LogRepository
+}
+
+// ClientRepository is client storage needed by every domain
+type ClientRepository interface {
+	client.ClientRepository
+	routes.ClientRepository
+	scim.ClientRepository
+}
+
+// SessionRepository is session storage needed by every domain
+type SessionRepository interface {
+	authenticator.SessionRepository
+	saml.SessionRepository
+	scim.SessionRepository
+	session.SessionRepository
+	privacy.SessionRepository
+	routes.SessionRepository
+}
+
+// IdentityLinkRepository is identity link storage needed by every domain
+type IdentityLinkRepository interface {
+	oidc.IdentityLinkRepository
+	privacy.IdentityLinkRepository
+}
+
+// GroupRepository is group storage needed by every domain
+type GroupRepository interface {
+	privacy.GroupRepository
+	scim.GroupRepository
+}
+
+// SetRepositories replace storage used by every domain, the authorization middleware, the audit emitter and the key ring
+func SetRepositories(users UserRepository, logs LogRepository, clients ClientRepository, keys keyring.KeyRepository,
+	sessions SessionRepository, serviceProviders saml.ServiceProviderRepository, identityLinks IdentityLinkRepository,
+	groups GroupRepository) {
+	account.SetUserRepository(users)
+	authenticator.SetUserRepository(users)
+	oidc.SetUserRepository(users)
+	register.SetUserRepository(users)
+	routes.SetUserRepository(users)
+	saml.SetUserRepository(users)
+	scim.SetUserRepository(users)
+	apilog.SetLogRepository(logs)
+	audit.SetLogRepository(logs)
+	routes.SetLogRepository(logs)
+	client.SetClientRepository(clients)
+	routes.SetClientRepository(clients)
+	scim.SetClientRepository(clients)
+	keyring.SetKeyRepository(keys)
+	authenticator.SetSessionRepository(sessions)
+	saml.SetSessionRepository(sessions)
+	scim.SetSessionRepository(sessions)
+	session.SetSessionRepository(sessions)
+	routes.SetSessionRepository(sessions)
+	saml.SetServiceProviderRepository(serviceProviders)
+	oidc.SetIdentityLinkRepository(identityLinks)
+	scim.SetGroupRepository(groups)
+	privacy.SetUserRepository(users)
+	privacy.SetSessionRepository(sessions)
+	privacy.SetIdentityLinkRepository(identityLinks)
+	privacy.SetGroupRepository(groups)
+	privacy.SetLogRepository(logs)
+}
@@ -1,29 +1,112 @@
 package domains
 
 import (
+	"github.com/drd-engineering/TwinCape/domains/apilog"
 	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/oidc"
+	"github.com/drd-engineering/TwinCape/domains/privacy"
+	"github.com/drd-engineering/TwinCape/domains/profile"
 	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/domains/saml"
+	"github.com/drd-engineering/TwinCape/domains/scim"
+	"github.com/drd-engineering/TwinCape/domains/session"
 	"github.com/drd-engineering/TwinCape/routes"
+	"github.com/gin-gonic/gin"
 )
 
 //InitiateRoutes is method used to create routing for all the domains available
 func InitiateRoutes() {
 	r := routes.GetInstance()
-	apiRoutes := r.Group("/api/v1/sso")
+	// API v1 keep giving KTP number as json number to clients made before v2 gave it as string
+	initiateAPIRoutes(r.Group("/api/v1/sso"), apiHandlers{
+		saveUser:             register.SaveUserV1,
+		completeRegistration: oidc.CompleteRegistrationV1,
+		getLoginDetails:      authenticator.GetLoginDetailsV1,
+		updateProfile:        profile.UpdateProfileV1,
+		updateUserProfile:    profile.UpdateUserProfileV1,
+		importUsers:          register.ImportUsersV1,
+	})
+	initiateAPIRoutes(r.Group("/api/v2/sso"), apiHandlers{
+		saveUser:             register.SaveUser,
+		completeRegistration: oidc.CompleteRegistration,
+		getLoginDetails:      authenticator.GetLoginDetails,
+		updateProfile:        profile.UpdateProfile,
+		updateUserProfile:    profile.UpdateUserProfile,
+		importUsers:          register.ImportUsers,
+	})
+	// browser sent by service provider can not identify the application, the service provider
+	// is identified by the SAML request instead
+	routeforSAML := r.Group("/api/v1/sso/saml")
 	{
-		apiRoutes.Use(routes.DRDApplicationIdentification())
+		routeforSAML.GET("/metadata", saml.Metadata)
+		routeforSAML.GET("/sso", saml.SingleSignOn)
+		routeforSAML.POST("/sso", saml.SingleSignOn)
+	}
+	// browser sent back by the provider can not identify the application either,
+	// the login is identified by the state cookie instead
+	routeforOIDC := r.Group("/api/v1/sso/oidc")
+	{
+		routeforOIDC.GET("/:provider/login", oidc.Login)
+		routeforOIDC.GET("/:provider/callback", oidc.Callback)
+	}
+	// provisioning clients such as HR systems can only send bearer token, they are identified by it
+	routeforSCIM := r.Group("/api/v1/sso/scim/v2")
+	routeforSCIM.Use(scim.ClientBearer())
+	{
+		routeforSCIM.POST("/Users", scim.CreateUser)
+		routeforSCIM.GET("/Users", scim.ListUsers)
+		routeforSCIM.GET("/Users/:id", scim.GetUser)
+		routeforSCIM.PATCH("/Users/:id", scim.PatchUser)
+		routeforSCIM.DELETE("/Users/:id", scim.DeleteUser)
+		routeforSCIM.POST("/Groups", scim.CreateGroup)
+		routeforSCIM.GET("/Groups", scim.ListGroups)
+		routeforSCIM.GET("/Groups/:id", scim.GetGroup)
+		routeforSCIM.PATCH("/Groups/:id", scim.PatchGroup)
+		routeforSCIM.DELETE("/Groups/:id", scim.DeleteGroup)
+	}
+	return
+}
 
-		routeforRegistration := apiRoutes.Group("/register")
-		routeforRegistration.POST("/save-user", register.SaveUser)
+// apiHandlers is the handlers taking or giving KTP number, they differ by API version
+type apiHandlers struct {
+	saveUser             gin.HandlerFunc
+	completeRegistration gin.HandlerFunc
+	getLoginDetails      gin.HandlerFunc
+	updateProfile        gin.HandlerFunc
+	updateUserProfile    gin.HandlerFunc
+	importUsers          gin.HandlerFunc
+}
 
-		routeforAuth := apiRoutes.Group("/auth")
-		routeforAuth.POST("/login", authenticator.Login)
-		routeforAuth.POST("/refresh-token", authenticator.RefreshToken)
-		routeforAuth.Use(routes.AuthorizationBearer())
-		{
-			routeforAuth.POST("/check-token", authenticator.CheckToken)
-			routeforAuth.POST("/get-login-details", authenticator.GetLoginDetails)
-		}
+// initiateAPIRoutes create routing of the API called by applications
+func initiateAPIRoutes(apiRoutes *gin.RouterGroup, handlers apiHandlers) {
+	apiRoutes.Use(routes.DRDApplicationIdentification())
+
+	routeforRegistration := apiRoutes.Group("/register")
+	routeforRegistration.POST("/save-user", handlers.saveUser)
+	routeforRegistration.POST("/oidc", handlers.completeRegistration)
+
+	routeforAuth := apiRoutes.Group("/auth")
+	routeforAuth.POST("/login", authenticator.Login)
+	routeforAuth.POST("/refresh-token", authenticator.RefreshToken)
+	routeforAuth.Use(routes.AuthorizationBearer())
+	{
+		routeforAuth.POST("/check-token", authenticator.CheckToken)
+		routeforAuth.POST("/get-login-details", handlers.getLoginDetails)
+		routeforAuth.PATCH("/profile", handlers.updateProfile)
+		routeforAuth.DELETE("/profile", privacy.EraseOwnAccount)
+		routeforAuth.GET("/profile/export", privacy.ExportOwnData)
+		routeforAuth.GET("/sessions", session.ListSessions)
+		routeforAuth.DELETE("/sessions", session.RevokeOtherSessions)
+		routeforAuth.DELETE("/sessions/:id", session.RevokeSession)
+	}
+
+	routeforAdmin := apiRoutes.Group("/admin")
+	routeforAdmin.Use(routes.AuthorizationBearer(), routes.AdminOnly())
+	{
+		routeforAdmin.GET("/api-logs", apilog.SearchAPILogs)
+		routeforAdmin.POST("/users/import", handlers.importUsers)
+		routeforAdmin.PATCH("/users/:id/profile", handlers.updateUserProfile)
+		routeforAdmin.DELETE("/users/:id", privacy.EraseUserAccount)
+		routeforAdmin.GET("/users/:id/export", privacy.ExportUserData)
 	}
-	return
 }
@@ -1,12 +1,222 @@
 package domains_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
 	"github.com/drd-engineering/TwinCape/domains"
+	"github.com/drd-engineering/TwinCape/domains/saml"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/routes"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
+// routes can be added only once to the gin engine singleton
+var initiateOnce sync.Once
+
+func initiateRoutes() {
+	initiateOnce.Do(domains.InitiateRoutes)
+}
+
 func TestInitiateRoute(t *testing.T) {
-	assert.NotPanics(t, func() { domains.InitiateRoutes() }, "initiating route should never be panic")
+	assert.NotPanics(t, func() { initiateRoutes() }, "initiating route should never be panic")
+}
+
+func TestRepositoriesImplemented(t *testing.T) {
+	var _ domains.UserRepository = db.NewGormUserRepository(nil)
+	var _ domains.LogRepository = db.NewGormLogRepository(nil)
+	var _ domains.UserRepository = memory.NewUserRepository()
+	var _ domains.LogRepository = memory.NewLogRepository()
+	var _ domains.ClientRepository = db.NewGormClientRepository(nil)
+	var _ domains.ClientRepository = memory.NewClientRepository()
+	var _ keyring.KeyRepository = db.NewGormKeyRepository(nil)
+	var _ keyring.KeyRepository = memory.NewKeyRepository()
+	var _ domains.SessionRepository = db.NewGormSessionRepository(nil)
+	var _ domains.SessionRepository = memory.NewSessionRepository()
+	var _ saml.ServiceProviderRepository = db.NewGormServiceProviderRepository(nil)
+	var _ saml.ServiceProviderRepository = memory.NewServiceProviderRepository()
+	var _ domains.IdentityLinkRepository = db.NewGormIdentityLinkRepository(nil)
+	var _ domains.IdentityLinkRepository = memory.NewIdentityLinkRepository()
+	var _ domains.GroupRepository = db.NewGormGroupRepository(nil)
+	var _ domains.GroupRepository = memory.NewGroupRepository()
+}
+
+func callAPI(t *testing.T, method string, url string, body interface{}, token string) (int, gin.H) {
+	jsonBody, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Drd-Identification", environments.Get("DRD_IDENTIFICATION"))
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	routes.GetInstance().ServeHTTP(w, req)
+	var got gin.H
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, got
+}
+
+func TestAPIUsingMemoryRepositories(t *testing.T) {
+	environments.Set("DRD_IDENTIFICATION", "testidentification")
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	environments.Set("REFRESH_SECRET_KEY", "testrefreshkey")
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	users := memory.NewUserRepository()
+	logs := memory.NewLogRepository()
+	domains.SetRepositories(users, logs, memory.NewClientRepository(), memory.NewKeyRepository(),
+		memory.NewSessionRepository(), memory.NewServiceProviderRepository(), memory.NewIdentityLinkRepository(),
+		memory.NewGroupRepository())
+	initiateRoutes()
+
+	code, got := callAPI(t, "POST", "/api/v1/sso/register/save-user", gin.H{
+		"name": "test", "email": "test@test.com", "ktpNumber": 3201011505900001, "phoneNumber": "+6281200000000",
+	}, "")
+	assert.Equal(t, 200, code, "registration should succeed")
+	user := got["user"].(map[string]interface{})
+
+	code, got = callAPI(t, "POST", "/api/v1/sso/auth/login", gin.H{
+		"email": "test@test.com", "password": user["password"],
+	}, "")
+	assert.Equal(t, 200, code, "login using the generated password should succeed")
+	accessToken, _ := got["accessToken"].(string)
+
+	code, got = callAPI(t, "POST", "/api/v1/sso/auth/get-login-details", gin.H{}, accessToken)
+	assert.Equal(t, 200, code, "logged in user should get the details")
+	assert.Equal(t, user["id"], got["user"].(map[string]interface{})["id"])
+	assert.Equal(t, float64(3201011505900001), got["user"].(map[string]interface{})["ktpNumber"],
+		"API v1 should give KTP number as json number")
+
+	code, got = callAPI(t, "POST", "/api/v2/sso/auth/get-login-details", gin.H{}, accessToken)
+	assert.Equal(t, 200, code, "logged in user should get the details from API v2")
+	assert.Equal(t, "3201011505900001", got["user"].(map[string]interface{})["ktpNumber"],
+		"API v2 should give KTP number as string")
+
+	code, _ = callAPI(t, "GET", "/api/v1/sso/admin/api-logs", nil, accessToken)
+	assert.Equal(t, 403, code, "user who is not administrator should be forbidden")
+
+	auditTypes := []string{}
+	for _, event := range logs.AuditEvents() {
+		auditTypes = append(auditTypes, event.Type)
+	}
+	assert.Equal(t, []string{"registration", "login_success"}, auditTypes, "registration and login should be audited")
+}
+
+func TestSessionsUsingMemoryRepositories(t *testing.T) {
+	environments.Set("DRD_IDENTIFICATION", "testidentification")
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	environments.Set("REFRESH_SECRET_KEY", "testrefreshkey")
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	domains.SetRepositories(memory.NewUserRepository(), memory.NewLogRepository(), memory.NewClientRepository(),
+		memory.NewKeyRepository(), memory.NewSessionRepository(), memory.NewServiceProviderRepository(), memory.NewIdentityLinkRepository(),
+		memory.NewGroupRepository())
+	initiateRoutes()
+
+	_, got := callAPI(t, "POST", "/api/v1/sso/register/save-user", gin.H{
+		"name": "test", "email": "session@test.com", "ktpNumber": 3201011505900002, "phoneNumber": "+6281200000001",
+	}, "")
+	user := got["user"].(map[string]interface{})
+	login := gin.H{"email": "session@test.com", "password": user["password"]}
+	_, oldDevice := callAPI(t, "POST", "/api/v1/sso/auth/login", login, "")
+	_, newDevice := callAPI(t, "POST", "/api/v1/sso/auth/login", login, "")
+	accessToken, _ := newDevice["accessToken"].(string)
+
+	code, got := callAPI(t, "GET", "/api/v1/sso/auth/sessions", nil, accessToken)
+	assert.Equal(t, 200, code, "logged in user should list the sessions")
+	listed, _ := got["sessions"].([]interface{})
+	assert.Len(t, listed, 2, "every login should start a session")
+	current := 0
+	for _, session := range listed {
+		if session.(map[string]interface{})["current"] == true {
+			current++
+		}
+	}
+	assert.Equal(t, 1, current, "only the session requesting should be current")
+
+	code, got = callAPI(t, "DELETE", "/api/v1/sso/auth/sessions", nil, accessToken)
+	assert.Equal(t, 200, code, "other sessions should be revoked")
+	assert.Equal(t, float64(1), got["revoked"])
+
+	code, _ = callAPI(t, "POST", "/api/v1/sso/auth/refresh-token", gin.H{"refreshToken": oldDevice["refreshToken"]}, "")
+	assert.Equal(t, 401, code, "refresh token of revoked session should be rejected")
+	code, _ = callAPI(t, "GET", "/api/v1/sso/auth/sessions", nil, oldDevice["accessToken"].(string))
+	assert.Equal(t, 401, code, "access token of revoked session should be rejected before it expires")
+	code, refreshed := callAPI(t, "POST", "/api/v1/sso/auth/refresh-token", gin.H{"refreshToken": newDevice["refreshToken"]}, "")
+	assert.Equal(t, 200, code, "refresh token of current session should still work")
+	refreshedToken, _ := refreshed["accessToken"].(string)
+	assert.NotEmpty(t, refreshed["refreshToken"])
+
+	code, got = callAPI(t, "GET", "/api/v1/sso/auth/sessions", nil, refreshedToken)
+	assert.Equal(t, 200, code)
+	listed, _ = got["sessions"].([]interface{})
+	if assert.Len(t, listed, 1, "revoked session should not be listed") {
+		currentID := listed[0].(map[string]interface{})["id"].(string)
+		code, _ = callAPI(t, "DELETE", "/api/v1/sso/auth/sessions/unknown", nil, refreshedToken)
+		assert.Equal(t, 404, code, "unknown session should not be found")
+		code, _ = callAPI(t, "DELETE", "/api/v1/sso/auth/sessions/"+currentID, nil, refreshedToken)
+		assert.Equal(t, 200, code, "current session should be revoked")
+	}
+	code, _ = callAPI(t, "POST", "/api/v1/sso/auth/refresh-token", gin.H{"refreshToken": refreshed["refreshToken"]}, "")
+	assert.Equal(t, 401, code, "refresh token of revoked current session should be rejected")
+	code, _ = callAPI(t, "GET", "/api/v1/sso/auth/sessions", nil, refreshedToken)
+	assert.Equal(t, 401, code, "access token of revoked current session should be rejected")
+}
+
+func TestErasureLeavesNoLoginInAuditEvents(t *testing.T) {
+	environments.Set("DRD_IDENTIFICATION", "testidentification")
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	environments.Set("REFRESH_SECRET_KEY", "testrefreshkey")
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("AUDIT_LOGIN_KEY", "testauditloginkey")
+	defer environments.Set("AUDIT_LOGIN_KEY", "")
+	logs := memory.NewLogRepository()
+	domains.SetRepositories(memory.NewUserRepository(), logs, memory.NewClientRepository(), memory.NewKeyRepository(),
+		memory.NewSessionRepository(), memory.NewServiceProviderRepository(), memory.NewIdentityLinkRepository(),
+		memory.NewGroupRepository())
+	initiateRoutes()
+
+	_, got := callAPI(t, "POST", "/api/v2/sso/register/save-user", gin.H{
+		"name": "test", "email": "erase@test.com", "ktpNumber": "3201011505900003", "phoneNumber": "+6281200000009",
+	}, "")
+	user := got["user"].(map[string]interface{})
+	for _, login := range []gin.H{
+		{"email": "ERASE@test.com", "password": "wrongpassword"},
+		{"phoneNumber": "081200000009", "password": "wrongpassword"},
+		{"email": "unknown@test.com", "password": "wrongpassword"},
+		{"phoneNumber": "081200000008", "password": "wrongpassword"},
+	} {
+		code, _ := callAPI(t, "POST", "/api/v2/sso/auth/login", login, "")
+		assert.Equal(t, 401, code, "login with wrong password should fail")
+	}
+	failures := 0
+	for _, event := range logs.AuditEvents() {
+		if event.Type == "login_failure" && event.SubjectID == user["id"] {
+			failures++
+		}
+	}
+	assert.Equal(t, 2, failures, "failed login matching the user should be recorded as done to the user")
+
+	_, got = callAPI(t, "POST", "/api/v2/sso/auth/login", gin.H{"email": "erase@test.com", "password": user["password"]}, "")
+	accessToken, _ := got["accessToken"].(string)
+	code, _ := callAPI(t, "DELETE", "/api/v2/sso/auth/profile", gin.H{"password": user["password"]}, accessToken)
+	assert.Equal(t, 200, code, "account should be erased")
+
+	for _, event := range logs.AuditEvents() {
+		recorded := event.ActorID + " " + event.SubjectID + " " + event.Metadata
+		for _, login := range []string{"erase@test.com", "ERASE@test.com", "6281200000009", "081200000009",
+			"unknown@test.com", "6281200000008", "081200000008"} {
+			assert.NotContains(t, recorded, login, "audit event "+event.Type+" should not hold the login")
+		}
+	}
 }
@@ -0,0 +1,83 @@
+package saml
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserFields is every user field a SAML attribute can be mapped to, named as in the login details response
+var UserFields = map[string]func(db.User) string{
+	"id":           func(user db.User) string { return user.ID },
+	"name":         func(user db.User) string { return user.Name },
+	"gender":       func(user db.User) string { return user.Gender },
+	"email":        func(user db.User) string { return user.Email },
+	"ktpNumber":    func(user db.User) string { return user.KtpNumber },
+	"address":      func(user db.User) string { return user.Address },
+	"phoneNumber":  func(user db.User) string { return user.PhoneNumber },
+	"dateofBirth":  func(user db.User) string { return user.DateOfBirth.Format("2006-01-02") },
+	"cityzenship":  func(user db.User) string { return user.Cityzenship },
+	"placeofBirth": func(user db.User) string { return user.PlaceOfBirth },
+	"isAdmin":      func(user db.User) string { return strconv.FormatBool(user.IsAdmin) },
+}
+
+// DefaultAttributeMapping is used for service provider registered without attribute mapping
+var DefaultAttributeMapping = map[string]string{"uid": "id", "email": "email", "name": "name"}
+
+// ParseAttributeMapping read attribute mapping saved in db, empty mapping means DefaultAttributeMapping
+func ParseAttributeMapping(mapping string) (map[string]string, error) {
+	if len(mapping) == 0 {
+		return DefaultAttributeMapping, nil
+	}
+	attributeMapping := map[string]string{}
+	if err := json.Unmarshal([]byte(mapping), &attributeMapping); err != nil {
+		return nil, fmt.Errorf("saml: invalid attribute mapping: %w", err)
+	}
+	return attributeMapping, validateAttributeMapping(attributeMapping)
+}
+
+func validateAttributeMapping(attributeMapping map[string]string) error {
+	for attribute, field := range attributeMapping {
+		if _, ok := UserFields[field]; !ok {
+			return fmt.Errorf("saml: attribute %s is mapped to unknown user field %s", attribute, field)
+		}
+	}
+	return nil
+}
+
+// makeAttributes give the SAML attributes of the user following the mapping, sorted by name
+func makeAttributes(user db.User, attributeMapping map[string]string) []gosaml.Attribute {
+	names := make([]string, 0, len(attributeMapping))
+	for name := range attributeMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attributes := make([]gosaml.Attribute, 0, len(names))
+	for _, name := range names {
+		attributes = append(attributes, gosaml.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values: []gosaml.AttributeValue{{
+				Type:  "xs:string",
+				Value: UserFields[attributeMapping[name]](user),
+			}},
+		})
+	}
+	return attributes
+}
+
+// assertionMaker make assertion having only the mapped attributes, the default maker also add
+// attributes requested by the service provider from session fields which are left empty
+type assertionMaker struct{}
+
+func (assertionMaker) MakeAssertion(req *gosaml.IdpAuthnRequest, session *gosaml.Session) error {
+	if err := (gosaml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		return err
+	}
+	req.Assertion.AttributeStatements = []gosaml.AttributeStatement{{Attributes: session.CustomAttributes}}
+	return nil
+}
@@ -0,0 +1,169 @@
+package saml
+
+import (
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/phone"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionCookie keep the session of user logged in through SAML, so other service providers
+// do not ask the user to login again while the token in it is valid
+const sessionCookie = "twincape_saml_session"
+
+// cookieIssuer is issuer of the token in session cookie, it differ from the issuer of access
+// and refresh token so the cookie can not be used as one of them
+const cookieIssuer = "SSO_TWINCAPE_SAML"
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Login</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+<input type="hidden" name="SAMLRequest" value="{{.SAMLRequest}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+<label>ID, email or phone number <input type="text" name="login" value="{{.Login}}"></label>
+<label>Password <input type="password" name="password"></label>
+<input type="submit" value="Login">
+</form>
+</body>
+</html>`))
+
+// sessionProvider authenticate user of the SAML request, using the session cookie
+// or the login form posted, through the same login rules as authenticator.Login
+type sessionProvider struct {
+	c               *gin.Context
+	serviceProvider db.ServiceProvider
+}
+
+func (p sessionProvider) GetSession(w http.ResponseWriter, r *http.Request, req *gosaml.IdpAuthnRequest) *gosaml.Session {
+	attributeMapping, err := ParseAttributeMapping(p.serviceProvider.AttributeMapping)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil
+	}
+	user, session, ok := p.cookieSession(r)
+	if !ok {
+		login := r.PostFormValue("login")
+		if r.Method != http.MethodPost || len(login) == 0 {
+			renderLogin(w, req, login, "", http.StatusOK)
+			return nil
+		}
+		input := authenticator.UserLogin{Password: r.PostFormValue("password")}
+		// user ID has letters, so login which is a valid phone number is not an ID
+		if strings.Contains(login, "@") {
+			input.Email = login
+		} else if _, err := phone.Normalize(login); err == nil {
+			input.PhoneNumber = login
+		} else {
+			input.ID = login
+		}
+		user, session, err = authenticator.Authenticate(p.c, input)
+		if err != nil {
+			loginErr := err.(*authenticator.LoginError)
+			renderLogin(w, req, login, loginErr.Message, loginErr.Status)
+			return nil
+		}
+		if err := setSessionCookie(w, req, user.ID, session.ID); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return nil
+		}
+	}
+	return &gosaml.Session{
+		ID:               session.ID,
+		CreateTime:       session.CreatedAt,
+		ExpireTime:       time.Now().Add(keyring.TokenLifetime[keyring.Access]),
+		Index:            session.ID,
+		NameID:           user.ID,
+		CustomAttributes: makeAttributes(user, attributeMapping),
+	}
+}
+
+// cookieSession give user and session of the session cookie when it is valid and the session is not revoked
+func (p sessionProvider) cookieSession(r *http.Request) (db.User, db.Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return db.User{}, db.Session{}, false
+	}
+	claims := keyring.Claims{}
+	if err := keyring.Parse(keyring.Access, cookie.Value, &claims); err != nil || claims.Issuer != cookieIssuer {
+		return db.User{}, db.Session{}, false
+	}
+	session, err := sessions.FindSessionByID(claims.SessionID)
+	if err != nil || session.RevokedAt != nil || session.UserID != claims.Audience {
+		return db.User{}, db.Session{}, false
+	}
+	user, err := users.FindUserByID(session.UserID)
+	if err != nil || user.Disabled {
+		return db.User{}, db.Session{}, false
+	}
+	session.LastUsedAt = time.Now()
+	if err := sessions.TouchSession(session.ID, session.LastUsedAt); err != nil {
+		return db.User{}, db.Session{}, false
+	}
+	audit.Emit(p.c, audit.Event{
+		Type:      audit.LoginSuccess,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Metadata:  map[string]interface{}{"loginWith": "saml_session", "sessionID": session.ID},
+	})
+	return user, session, true
+}
+
+func setSessionCookie(w http.ResponseWriter, req *gosaml.IdpAuthnRequest, userID string, sessionID string) error {
+	lifetime := keyring.TokenLifetime[keyring.Access]
+	token, err := keyring.Sign(keyring.Access, keyring.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  userID,
+			ExpiresAt: time.Now().Add(lifetime).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    cookieIssuer,
+			Subject:   "SSO_SAML",
+		},
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return err
+	}
+	// service provider post the request from its own site, cookie must be sent cross site for it
+	secure := req.IDP.SSOURL.Scheme == "https"
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     basePath,
+		MaxAge:   int(lifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+	return nil
+}
+
+// renderLogin write login form posting the SAML request back with the login details,
+// the request is always posted so it is encoded for HTTP-POST binding whatever binding it came with
+func renderLogin(w http.ResponseWriter, req *gosaml.IdpAuthnRequest, login string, message string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	loginPage.Execute(w, map[string]string{
+		"Action":      req.IDP.SSOURL.String(),
+		"SAMLRequest": base64.StdEncoding.EncodeToString(req.RequestBuffer),
+		"RelayState":  req.RelayState,
+		"Login":       login,
+		"Message":     message,
+	})
+}
@@ -0,0 +1,111 @@
+package saml
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+)
+
+// basePath is path of the SAML routes added by InitiateRoutes
+const basePath = "/api/v1/sso/saml"
+
+// ErrNotConfigured returned when the identity provider certificate, key or URL is not set
+var ErrNotConfigured = errors.New("saml: SAML_BASE_URL, SAML_CERTIFICATE_FILE and SAML_PRIVATE_KEY_FILE must be set")
+
+type providerConfig struct {
+	baseURL         string
+	certificateFile string
+	privateKeyFile  string
+}
+
+var providerLock sync.Mutex
+var loadedConfig providerConfig
+var loadedProvider *gosaml.IdentityProvider
+
+// identityProvider give the identity provider configured by environment variable,
+// certificate and key are read again only when the configuration change
+func identityProvider() (*gosaml.IdentityProvider, error) {
+	config := providerConfig{
+		baseURL:         strings.TrimSuffix(environments.Get("SAML_BASE_URL"), "/"),
+		certificateFile: environments.Get("SAML_CERTIFICATE_FILE"),
+		privateKeyFile:  environments.Get("SAML_PRIVATE_KEY_FILE"),
+	}
+	if len(config.baseURL) == 0 || len(config.certificateFile) == 0 || len(config.privateKeyFile) == 0 {
+		return nil, ErrNotConfigured
+	}
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	if loadedProvider != nil && loadedConfig == config {
+		provider := *loadedProvider
+		return &provider, nil
+	}
+	keyPair, err := tls.LoadX509KeyPair(config.certificateFile, config.privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	// assertions are signed through goxmldsig which only support RSA key
+	if _, ok := keyPair.PrivateKey.(*rsa.PrivateKey); !ok {
+		return nil, errors.New("saml: private key must be RSA key")
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, err := url.Parse(config.baseURL + basePath + "/metadata")
+	if err != nil {
+		return nil, err
+	}
+	ssoURL, err := url.Parse(config.baseURL + basePath + "/sso")
+	if err != nil {
+		return nil, err
+	}
+	loadedProvider = &gosaml.IdentityProvider{
+		Key:                     keyPair.PrivateKey,
+		Logger:                  logger.DefaultLogger,
+		Certificate:             certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: serviceProviderProvider{},
+		AssertionMaker:          assertionMaker{},
+	}
+	loadedConfig = config
+	provider := *loadedProvider
+	return &provider, nil
+}
+
+// serviceProviderProvider give metadata of service provider registered and not disabled
+type serviceProviderProvider struct{}
+
+func (serviceProviderProvider) GetServiceProvider(r *http.Request, serviceProviderID string) (*gosaml.EntityDescriptor, error) {
+	serviceProvider, err := serviceProviders.FindServiceProviderByID(serviceProviderID)
+	if err == db.ErrServiceProviderNotFound || (err == nil && serviceProvider.Disabled) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata([]byte(serviceProvider.Metadata))
+}
+
+func parseMetadata(metadata []byte) (*gosaml.EntityDescriptor, error) {
+	entity := &gosaml.EntityDescriptor{}
+	if err := xml.Unmarshal(metadata, entity); err != nil {
+		return nil, err
+	}
+	if len(entity.EntityID) == 0 || len(entity.SPSSODescriptors) == 0 {
+		return nil, errors.New("saml: metadata must be entity descriptor of a service provider")
+	}
+	return entity, nil
+}
@@ -0,0 +1,43 @@
+package saml
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ServiceProviderRepository is SAML service provider storage used by the identity provider
+type ServiceProviderRepository interface {
+	FindServiceProviderByID(id string) (db.ServiceProvider, error)
+	SaveServiceProvider(serviceProvider *db.ServiceProvider) error
+}
+
+// UserRepository is user storage used by the identity provider
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+}
+
+// SessionRepository is session storage used by the identity provider
+type SessionRepository interface {
+	FindSessionByID(id string) (db.Session, error)
+	TouchSession(id string, usedAt time.Time) error
+}
+
+var serviceProviders ServiceProviderRepository = db.NewGormServiceProviderRepository(nil)
+var users UserRepository = db.NewGormUserRepository(nil)
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+
+// SetServiceProviderRepository replace service provider storage used by the identity provider
+func SetServiceProviderRepository(repository ServiceProviderRepository) {
+	serviceProviders = repository
+}
+
+// SetUserRepository replace user storage used by the identity provider
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
+
+// SetSessionRepository replace session storage used by the identity provider
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
@@ -0,0 +1,107 @@
+package saml
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/gin-gonic/gin"
+)
+
+// Metadata service handler giving metadata of the identity provider to register it in service providers
+func Metadata(c *gin.Context) {
+	provider, err := identityProvider()
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	provider.ServeMetadata(c.Writer, c.Request)
+}
+
+// SingleSignOn service handler receiving authentication request of service provider through
+// HTTP-Redirect or HTTP-POST binding, it ask the user to login then post signed assertion
+// to the assertion consumer service of the service provider
+func SingleSignOn(c *gin.Context) {
+	provider, err := identityProvider()
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": err.Error()})
+		return
+	}
+	req, err := gosaml.NewIdpAuthnRequest(provider, c.Request)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid SAML request"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.Abort()
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	serviceProvider, err := serviceProviders.FindServiceProviderByID(req.ServiceProviderMetadata.EntityID)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get service provider"})
+		return
+	}
+	// sessions and audit events record the service provider as the client
+	c.Set("clientID", serviceProvider.ID)
+	provider.SessionProvider = sessionProvider{c: c, serviceProvider: serviceProvider}
+	session := provider.SessionProvider.GetSession(c.Writer, c.Request, req)
+	if session == nil {
+		return
+	}
+	if err := provider.AssertionMaker.MakeAssertion(req, session); err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to make assertion"})
+		return
+	}
+	if err := req.WriteResponse(c.Writer); err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to write assertion"})
+		return
+	}
+}
+
+// RegisterServiceProvider allow the service provider of the metadata to login users, attribute mapping
+// is SAML attribute name to user field and empty mapping means DefaultAttributeMapping.
+// Registering the same entity ID again replace its metadata and mapping
+func RegisterServiceProvider(name string, metadata []byte, attributeMapping map[string]string) (db.ServiceProvider, error) {
+	if len(name) == 0 {
+		return db.ServiceProvider{}, errors.New("Service provider name must not be empty")
+	}
+	entity, err := parseMetadata(metadata)
+	if err != nil {
+		return db.ServiceProvider{}, err
+	}
+	if err := validateAttributeMapping(attributeMapping); err != nil {
+		return db.ServiceProvider{}, err
+	}
+	mapping := ""
+	if len(attributeMapping) > 0 {
+		mappingJSON, err := json.Marshal(attributeMapping)
+		if err != nil {
+			return db.ServiceProvider{}, err
+		}
+		mapping = string(mappingJSON)
+	}
+	serviceProvider := db.ServiceProvider{
+		ID:               entity.EntityID,
+		Name:             name,
+		Metadata:         string(metadata),
+		AttributeMapping: mapping,
+	}
+	if err := serviceProviders.SaveServiceProvider(&serviceProvider); err != nil {
+		return db.ServiceProvider{}, err
+	}
+	audit.Record(audit.Event{
+		Type:     audit.AdminAction,
+		Metadata: map[string]interface{}{"action": "register_service_provider", "entityID": entity.EntityID, "name": name},
+	})
+	return serviceProvider, nil
+}
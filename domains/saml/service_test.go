@@ -0,0 +1,253 @@
+package saml_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"html"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/authenticator"
+	"github.com/drd-engineering/TwinCape/domains/saml"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func makeKeyPair(t *testing.T, dir string, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	ioutil.WriteFile(path.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(path.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	return key, certificate
+}
+
+func setupTestCase(t *testing.T) (*gin.Engine, *gosaml.ServiceProvider, func(t *testing.T)) {
+	dir := t.TempDir()
+	makeKeyPair(t, dir, "idp")
+	environments.Set("SAML_BASE_URL", "http://idp.test")
+	environments.Set("SAML_CERTIFICATE_FILE", path.Join(dir, "idp.crt"))
+	environments.Set("SAML_PRIVATE_KEY_FILE", path.Join(dir, "idp.key"))
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+
+	users := memory.NewUserRepository()
+	sessions := memory.NewSessionRepository()
+	authenticator.SetUserRepository(users)
+	authenticator.SetSessionRepository(sessions)
+	saml.SetUserRepository(users)
+	saml.SetSessionRepository(sessions)
+	saml.SetServiceProviderRepository(memory.NewServiceProviderRepository())
+	audit.SetLogRepository(memory.NewLogRepository())
+	keyring.SetKeyRepository(memory.NewKeyRepository())
+	password, _ := bcrypt.GenerateFromPassword([]byte("testing"), 6)
+	users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "1", PhoneNumber: "+6281200000001",
+		Password: string(password)})
+	users.CreateUser(&db.User{ID: "disabledid", Email: "disabled@test.com", KtpNumber: "2", Password: string(password), Disabled: true})
+
+	r := gin.New()
+	r.GET("/api/v1/sso/saml/metadata", saml.Metadata)
+	r.GET("/api/v1/sso/saml/sso", saml.SingleSignOn)
+	r.POST("/api/v1/sso/saml/sso", saml.SingleSignOn)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/sso/saml/metadata", nil))
+	idpMetadata := &gosaml.EntityDescriptor{}
+	if err := xml.Unmarshal(w.Body.Bytes(), idpMetadata); err != nil {
+		t.Fatal(err)
+	}
+	spKey, spCertificate := makeKeyPair(t, dir, "sp")
+	metadataURL, _ := url.Parse("http://sp.test/metadata")
+	acsURL, _ := url.Parse("http://sp.test/acs")
+	serviceProvider := &gosaml.ServiceProvider{
+		EntityID:    metadataURL.String(),
+		Key:         spKey,
+		Certificate: spCertificate,
+		MetadataURL: *metadataURL,
+		AcsURL:      *acsURL,
+		IDPMetadata: idpMetadata,
+	}
+	return r, serviceProvider, func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func registerServiceProvider(t *testing.T, serviceProvider *gosaml.ServiceProvider) {
+	metadata, _ := xml.Marshal(serviceProvider.Metadata())
+	_, err := saml.RegisterServiceProvider("test", metadata, map[string]string{"mail": "email", "displayName": "name"})
+	assert.Nil(t, err)
+}
+
+var hiddenInput = regexp.MustCompile(`name="(SAMLRequest|SAMLResponse)" value="([^"]*)"`)
+
+func formValue(t *testing.T, body string, name string) string {
+	for _, match := range hiddenInput.FindAllStringSubmatch(body, -1) {
+		if match[1] == name {
+			return html.UnescapeString(match[2])
+		}
+	}
+	return ""
+}
+
+func TestMetadataNotConfigured(t *testing.T) {
+	r, _, set := setupTestCase(t)
+	defer set(t)
+	environments.Set("SAML_BASE_URL", "")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/sso/saml/metadata", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "metadata should not be given without configuration")
+}
+
+func TestSingleSignOn(t *testing.T) {
+	tests := []struct {
+		name       string
+		login      string
+		password   string
+		register   bool
+		startCode  int
+		loginCode  int
+		isAsserted bool
+	}{
+		{name: "SuccessLoginUseId", login: "testid", password: "testing", register: true,
+			startCode: 200, loginCode: 200, isAsserted: true},
+		{name: "SuccessLoginUseEmail", login: "test@test.com", password: "testing", register: true,
+			startCode: 200, loginCode: 200, isAsserted: true},
+		{name: "SuccessLoginUsePhoneNumber", login: "0812-0000-0001", password: "testing", register: true,
+			startCode: 200, loginCode: 200, isAsserted: true},
+		{name: "FailedPasswordNotMatch", login: "testid", password: "tesing", register: true,
+			startCode: 200, loginCode: 401},
+		{name: "FailedUserDisabled", login: "disabledid", password: "testing", register: true,
+			startCode: 200, loginCode: 401},
+		{name: "FailedServiceProviderNotRegistered", register: false, startCode: 400},
+	}
+	for _, tc := range tests {
+		r, serviceProvider, set := setupTestCase(t)
+		if tc.register {
+			registerServiceProvider(t, serviceProvider)
+		}
+		authnRequest, err := serviceProvider.MakeAuthenticationRequest(serviceProvider.GetSSOBindingLocation(gosaml.HTTPRedirectBinding),
+			gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+		assert.Nil(t, err)
+		redirectURL, _ := authnRequest.Redirect("relay", serviceProvider)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", redirectURL.RequestURI(), nil))
+		assert.Equal(t, tc.startCode, w.Code, "test "+tc.name+" case")
+		if w.Code != http.StatusOK {
+			set(t)
+			continue
+		}
+		samlRequest := formValue(t, w.Body.String(), "SAMLRequest")
+		assert.NotEmpty(t, samlRequest, "login form should post the SAML request back in test "+tc.name+" case")
+
+		form := url.Values{"SAMLRequest": {samlRequest}, "RelayState": {"relay"}, "login": {tc.login}, "password": {tc.password}}
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/sso/saml/sso", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tc.loginCode, w.Code, "test "+tc.name+" case")
+		samlResponse := formValue(t, w.Body.String(), "SAMLResponse")
+		assert.Equal(t, tc.isAsserted, len(samlResponse) > 0, "test "+tc.name+" case")
+		if !tc.isAsserted {
+			set(t)
+			continue
+		}
+
+		acsRequest := httptest.NewRequest("POST", "http://sp.test/acs", nil)
+		acsRequest.PostForm = url.Values{"SAMLResponse": {samlResponse}}
+		assertion, err := serviceProvider.ParseResponse(acsRequest, []string{authnRequest.ID})
+		if assert.Nil(t, err, "assertion should be valid for the service provider in test "+tc.name+" case") {
+			assert.Equal(t, "testid", assertion.Subject.NameID.Value)
+			attributes := map[string]string{}
+			for _, attribute := range assertion.AttributeStatements[0].Attributes {
+				attributes[attribute.Name] = attribute.Values[0].Value
+			}
+			assert.Equal(t, map[string]string{"mail": "test@test.com", "displayName": "test"}, attributes,
+				"only mapped attributes should be asserted in test "+tc.name+" case")
+		}
+
+		// the session cookie let the user skip the login form on the next request
+		cookies := w.Result().Cookies()
+		assert.NotEmpty(t, cookies, "session cookie should be set in test "+tc.name+" case")
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", redirectURL.RequestURI(), nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		r.ServeHTTP(w, req)
+		assert.NotEmpty(t, formValue(t, w.Body.String(), "SAMLResponse"),
+			"user having session cookie should be asserted without login in test "+tc.name+" case")
+		set(t)
+	}
+}
+
+func TestRegisterServiceProvider(t *testing.T) {
+	_, serviceProvider, set := setupTestCase(t)
+	defer set(t)
+	metadata, _ := xml.Marshal(serviceProvider.Metadata())
+	tests := []struct {
+		name       string
+		spName     string
+		metadata   []byte
+		attributes map[string]string
+		isError    bool
+	}{
+		{name: "OK", spName: "test", metadata: metadata, attributes: map[string]string{"mail": "email"}},
+		{name: "OKDefaultAttributes", spName: "test", metadata: metadata},
+		{name: "FailedEmptyName", metadata: metadata, isError: true},
+		{name: "FailedInvalidMetadata", spName: "test", metadata: []byte("<EntityDescriptor/>"), isError: true},
+		{name: "FailedUnknownField", spName: "test", metadata: metadata, attributes: map[string]string{"mail": "password"}, isError: true},
+	}
+	for _, tc := range tests {
+		saved, err := saml.RegisterServiceProvider(tc.spName, tc.metadata, tc.attributes)
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+		if err == nil {
+			assert.Equal(t, serviceProvider.EntityID, saved.ID, "entity ID should be the id in test "+tc.name+" case")
+		}
+	}
+}
+
+func TestLoginFormEncodeRedirectRequest(t *testing.T) {
+	r, serviceProvider, set := setupTestCase(t)
+	defer set(t)
+	registerServiceProvider(t, serviceProvider)
+	redirectURL, err := serviceProvider.MakeRedirectAuthenticationRequest("relay")
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", redirectURL.RequestURI(), nil))
+	decoded, err := base64.StdEncoding.DecodeString(formValue(t, w.Body.String(), "SAMLRequest"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(decoded), "AuthnRequest", "deflated request should be posted back as plain XML")
+}
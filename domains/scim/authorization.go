@@ -0,0 +1,55 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+)
+
+// ClientBearer is authorization middleware for provisioning client, the client registered by "client create"
+// send "<client id>.<secret>" as bearer token and must be listed in SCIM_CLIENT_IDS
+func ClientBearer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		clientID, secret, ok := splitToken(token)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "", "Please provide client credentials as bearer token")
+			return
+		}
+		client, err := clients.FindClientByID(clientID)
+		if err != nil && err != db.ErrClientNotFound {
+			respondError(c, http.StatusInternalServerError, "", "Failed to get client")
+			return
+		}
+		if err != nil || client.Disabled || !client.VerifySecret(secret) {
+			respondError(c, http.StatusUnauthorized, "", "Invalid client credentials")
+			return
+		}
+		if !isProvisioningClient(client.ID) {
+			respondError(c, http.StatusForbidden, "", "Client is not allowed to provision users")
+			return
+		}
+		c.Set("clientID", client.ID)
+		c.Next()
+	}
+}
+
+func splitToken(token string) (string, string, bool) {
+	separator := strings.Index(token, ".")
+	if separator < 1 || separator == len(token)-1 {
+		return "", "", false
+	}
+	return token[:separator], token[separator+1:], true
+}
+
+func isProvisioningClient(clientID string) bool {
+	for _, allowed := range strings.Split(environments.Get("SCIM_CLIENT_IDS"), ",") {
+		if strings.TrimSpace(allowed) == clientID {
+			return true
+		}
+	}
+	return false
+}
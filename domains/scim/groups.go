@@ -0,0 +1,377 @@
+package scim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateGroup service handler creating group with its members
+func CreateGroup(c *gin.Context) {
+	var input Group
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, http.StatusBadRequest, invalidSyntax, "Request body is not a group resource")
+		return
+	}
+	memberIDs := []string{}
+	for _, member := range input.Members {
+		memberIDs = append(memberIDs, member.Value)
+	}
+	if !checkGroup(c, db.Group{}, db.Group{DisplayName: input.DisplayName}, memberIDs) {
+		return
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save group")
+		return
+	}
+	group := db.Group{ID: hex.EncodeToString(idBytes), DisplayName: input.DisplayName, ExternalID: input.ExternalID}
+	if err := groups.CreateGroup(&group); err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save group")
+		return
+	}
+	if err := groups.AddGroupMembers(group.ID, memberIDs); err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save group members")
+		return
+	}
+	emitChange(c, "scim_create_group", group.ID)
+	c.Header("Location", location(c, "Groups", group.ID))
+	respond(c, http.StatusCreated, makeGroup(c, group, memberIDs))
+}
+
+// GetGroup service handler giving the group having the id, members are left out
+// when excludedAttributes has members
+func GetGroup(c *gin.Context) {
+	group, ok := findGroup(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	memberIDs, ok := findMembers(c, group.ID)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, makeGroup(c, group, memberIDs))
+}
+
+// ListGroups service handler giving groups matching filter on displayName or externalId
+func ListGroups(c *gin.Context) {
+	startIndex, offset, limit := page(c)
+	query := db.GroupQuery{Offset: offset, Limit: limit}
+	if filter := c.Query("filter"); len(filter) > 0 {
+		attribute, value, ok := parseFilter(filter)
+		if !ok {
+			respondError(c, http.StatusBadRequest, invalidFilter, "Only filter \"attribute eq value\" is supported")
+			return
+		}
+		switch attribute {
+		case "displayname":
+			query.DisplayName = value
+		case "externalid":
+			query.ExternalID = value
+		case "id":
+			listGroupByID(c, startIndex, limit, value)
+			return
+		default:
+			respondError(c, http.StatusBadRequest, invalidFilter, "Groups can not be filtered by "+attribute)
+			return
+		}
+	}
+	found, total, err := groups.FindGroups(query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get groups")
+		return
+	}
+	resources := []interface{}{}
+	for _, group := range found {
+		memberIDs, ok := findMembers(c, group.ID)
+		if !ok {
+			return
+		}
+		resources = append(resources, makeGroup(c, group, memberIDs))
+	}
+	respondList(c, startIndex, total, resources)
+}
+
+func listGroupByID(c *gin.Context, startIndex int, limit int, id string) {
+	group, err := groups.FindGroupByID(id)
+	if err != nil && err != db.ErrGroupNotFound {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get groups")
+		return
+	}
+	resources := []interface{}{}
+	total := 0
+	if err == nil {
+		total = 1
+		if startIndex == 1 && limit > 0 {
+			memberIDs, ok := findMembers(c, group.ID)
+			if !ok {
+				return
+			}
+			resources = append(resources, makeGroup(c, group, memberIDs))
+		}
+	}
+	respondList(c, startIndex, total, resources)
+}
+
+// PatchGroup service handler changing display name, external id or members of the group
+func PatchGroup(c *gin.Context) {
+	var request PatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Operations) == 0 {
+		respondError(c, http.StatusBadRequest, invalidSyntax, "Request body is not a patch operation")
+		return
+	}
+	original, ok := findGroup(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	originalMemberIDs, ok := findMembers(c, original.ID)
+	if !ok {
+		return
+	}
+	group := original
+	members := map[string]bool{}
+	for _, memberID := range originalMemberIDs {
+		members[memberID] = true
+	}
+	for _, operation := range request.Operations {
+		var err *patchError
+		switch op := strings.ToLower(operation.Op); op {
+		case "add", "replace":
+			if len(operation.Path) == 0 {
+				err = setGroupValues(&group, members, op, operation.Value)
+			} else {
+				err = setGroupAttribute(&group, members, op, operation.Path, operation.Value)
+			}
+		case "remove":
+			err = removeGroupAttribute(&group, members, operation.Path, operation.Value)
+		default:
+			err = &patchError{invalidSyntax, "Unknown operation " + operation.Op}
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.scimType, err.detail)
+			return
+		}
+	}
+	added, removed := []string{}, []string{}
+	for memberID := range members {
+		if !contains(originalMemberIDs, memberID) {
+			added = append(added, memberID)
+		}
+	}
+	for _, memberID := range originalMemberIDs {
+		if !members[memberID] {
+			removed = append(removed, memberID)
+		}
+	}
+	if !checkGroup(c, original, group, added) {
+		return
+	}
+	err := groups.UpdateGroup(&group)
+	if err == nil {
+		err = groups.AddGroupMembers(group.ID, added)
+	}
+	if err == nil {
+		err = groups.RemoveGroupMembers(group.ID, removed)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save group")
+		return
+	}
+	memberIDs, ok := findMembers(c, group.ID)
+	if !ok {
+		return
+	}
+	emitChange(c, "scim_update_group", group.ID)
+	respond(c, http.StatusOK, makeGroup(c, group, memberIDs))
+}
+
+// DeleteGroup service handler deleting the group, its members are not deleted
+func DeleteGroup(c *gin.Context) {
+	id := c.Param("id")
+	err := groups.DeleteGroup(id)
+	if err == db.ErrGroupNotFound {
+		respondError(c, http.StatusNotFound, "", "Group not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to delete group")
+		return
+	}
+	emitChange(c, "scim_delete_group", id)
+	c.Status(http.StatusNoContent)
+}
+
+func findGroup(c *gin.Context, id string) (db.Group, bool) {
+	group, err := groups.FindGroupByID(id)
+	if err == db.ErrGroupNotFound {
+		respondError(c, http.StatusNotFound, "", "Group not found")
+		return group, false
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get group")
+		return group, false
+	}
+	return group, true
+}
+
+// findMembers give id of the group members, none when excludedAttributes has members
+func findMembers(c *gin.Context, groupID string) ([]string, bool) {
+	for _, excluded := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(excluded), "members") {
+			return nil, true
+		}
+	}
+	memberIDs, err := groups.FindGroupMembers(groupID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get group members")
+		return nil, false
+	}
+	return memberIDs, true
+}
+
+// checkGroup check display name is given and not used by other group, and new members are users
+func checkGroup(c *gin.Context, original db.Group, group db.Group, addedMemberIDs []string) bool {
+	if len(group.DisplayName) == 0 {
+		respondError(c, http.StatusBadRequest, invalidValue, "Group display name must not be empty")
+		return false
+	}
+	if group.DisplayName != original.DisplayName {
+		_, total, err := groups.FindGroups(db.GroupQuery{DisplayName: group.DisplayName})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "", "Failed to check existing group")
+			return false
+		}
+		if total > 0 {
+			respondError(c, http.StatusConflict, uniqueness, "Group with same display name already exists")
+			return false
+		}
+	}
+	for _, memberID := range addedMemberIDs {
+		_, err := users.FindUserByID(memberID)
+		if err == db.ErrUserNotFound {
+			respondError(c, http.StatusBadRequest, invalidValue, "Member "+memberID+" is not a user")
+			return false
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "", "Failed to get group member")
+			return false
+		}
+	}
+	return true
+}
+
+func makeGroup(c *gin.Context, group db.Group, memberIDs []string) Group {
+	resource := Group{
+		Schemas:     []string{GroupSchema},
+		ID:          group.ID,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     location(c, "Groups", group.ID),
+		},
+	}
+	for _, memberID := range memberIDs {
+		resource.Members = append(resource.Members, MultiValued{Value: memberID, Ref: location(c, "Users", memberID)})
+	}
+	return resource
+}
+
+// setGroupValues set attributes of operation without path, the value is object of attributes by their path
+func setGroupValues(group *db.Group, members map[string]bool, op string, value json.RawMessage) *patchError {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &values); err != nil {
+		return &patchError{invalidValue, "Value of operation without path must be an object"}
+	}
+	for path, attributeValue := range values {
+		if strings.EqualFold(path, "schemas") {
+			continue
+		}
+		if err := setGroupAttribute(group, members, op, path, attributeValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setGroupAttribute(group *db.Group, members map[string]bool, op string, path string, value json.RawMessage) *patchError {
+	var err error
+	switch path = strings.ToLower(strings.TrimSpace(path)); path {
+	case "displayname":
+		err = json.Unmarshal(value, &group.DisplayName)
+	case "externalid":
+		err = json.Unmarshal(value, &group.ExternalID)
+	case "members":
+		values := []MultiValued{}
+		if err = json.Unmarshal(value, &values); err != nil {
+			break
+		}
+		if op == "replace" {
+			for memberID := range members {
+				delete(members, memberID)
+			}
+		}
+		for _, member := range values {
+			members[member.Value] = true
+		}
+	default:
+		return &patchError{invalidPath, "Attribute " + path + " can not be changed"}
+	}
+	if err != nil {
+		return &patchError{invalidValue, "Invalid value of " + path}
+	}
+	return nil
+}
+
+// removeGroupAttribute remove external id or members, members to remove are selected
+// by filter in the path such as members[value eq "id"] or by the value, none of them remove every member
+func removeGroupAttribute(group *db.Group, members map[string]bool, path string, value json.RawMessage) *patchError {
+	path = strings.TrimSpace(path)
+	lowerPath := strings.ToLower(path)
+	switch {
+	case len(path) == 0:
+		return &patchError{noTarget, "Path of remove operation must not be empty"}
+	case lowerPath == "externalid":
+		group.ExternalID = ""
+	case lowerPath == "members":
+		values := []MultiValued{}
+		if len(value) > 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, &values); err != nil {
+				return &patchError{invalidValue, "Invalid value of members"}
+			}
+		}
+		if len(values) == 0 {
+			for memberID := range members {
+				delete(members, memberID)
+			}
+		}
+		for _, member := range values {
+			delete(members, member.Value)
+		}
+	case strings.HasPrefix(lowerPath, "members[") && strings.HasSuffix(lowerPath, "]"):
+		attribute, memberID, ok := parseFilter(path[len("members[") : len(path)-1])
+		if !ok || attribute != "value" {
+			return &patchError{invalidFilter, "Members to remove must be selected by value"}
+		}
+		delete(members, memberID)
+	default:
+		return &patchError{invalidPath, "Attribute " + path + " can not be removed"}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package scim_test
+
+import (
+	"testing"
+
+	"github.com/drd-engineering/TwinCape/domains/scim"
+	"github.com/stretchr/testify/assert"
+)
+
+func memberValues(got map[string]interface{}) []string {
+	values := []string{}
+	members, _ := got["members"].([]interface{})
+	for _, member := range members {
+		values = append(values, member.(map[string]interface{})["value"].(string))
+	}
+	return values
+}
+
+func TestCreateGroup(t *testing.T) {
+	testCases := []struct {
+		name             string
+		body             string
+		expectedCode     int
+		expectedScimType string
+	}{
+		{"valid group", `{"schemas":["` + scim.GroupSchema + `"],"displayName":"staff","members":[{"value":"testid"}]}`, 201, ""},
+		{"unknown member", `{"displayName":"staff","members":[{"value":"unknown"}]}`, 400, "invalidValue"},
+		{"missing display name", `{"members":[]}`, 400, "invalidValue"},
+	}
+	for _, tc := range testCases {
+		r, _, _, teardownTestCase := setupTestCase(t)
+		code, got := callSCIM(r, "POST", "/Groups", tc.body, provisioningToken)
+		assert.Equal(t, tc.expectedCode, code, "test "+tc.name+" case")
+		if code != 201 {
+			assert.Equal(t, tc.expectedScimType, got["scimType"], "test "+tc.name+" case")
+		} else {
+			assert.Equal(t, []string{"testid"}, memberValues(got), "test "+tc.name+" case")
+			code, _ = callSCIM(r, "POST", "/Groups", tc.body, provisioningToken)
+			assert.Equal(t, 409, code, "same display name should be rejected in "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+func TestPatchGroup(t *testing.T) {
+	testCases := []struct {
+		name            string
+		operations      string
+		expectedCode    int
+		expectedMembers []string
+		expectedName    string
+	}{
+		{"add member", `[{"op":"add","path":"members","value":[{"value":"otherid"}]}]`, 200, []string{"otherid", "testid"}, "staff"},
+		{"remove member by filter", `[{"op":"remove","path":"members[value eq \"testid\"]"}]`, 200, []string{}, "staff"},
+		{"remove member by value", `[{"op":"remove","path":"members","value":[{"value":"testid"}]}]`, 200, []string{}, "staff"},
+		{"replace members", `[{"op":"replace","path":"members","value":[{"value":"otherid"}]}]`, 200, []string{"otherid"}, "staff"},
+		{"rename without path", `[{"op":"replace","value":{"displayName":"employees"}}]`, 200, []string{"testid"}, "employees"},
+		{"unknown member", `[{"op":"add","path":"members","value":[{"value":"unknown"}]}]`, 400, nil, ""},
+		{"display name used", `[{"op":"replace","path":"displayName","value":"admins"}]`, 409, nil, ""},
+	}
+	for _, tc := range testCases {
+		r, _, _, teardownTestCase := setupTestCase(t)
+		_, created := callSCIM(r, "POST", "/Groups", `{"displayName":"staff","members":[{"value":"testid"}]}`, provisioningToken)
+		callSCIM(r, "POST", "/Groups", `{"displayName":"admins"}`, provisioningToken)
+		id := created["id"].(string)
+		code, got := callSCIM(r, "PATCH", "/Groups/"+id, `{"schemas":["`+scim.PatchOpSchema+`"],"Operations":`+tc.operations+`}`, provisioningToken)
+		assert.Equal(t, tc.expectedCode, code, "test "+tc.name+" case")
+		if code == 200 {
+			assert.Equal(t, tc.expectedMembers, memberValues(got), "test "+tc.name+" case")
+			assert.Equal(t, tc.expectedName, got["displayName"], "test "+tc.name+" case")
+		} else {
+			_, got = callSCIM(r, "GET", "/Groups/"+id, "", provisioningToken)
+			assert.Equal(t, []string{"testid"}, memberValues(got), "group should not be changed in "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+func TestListAndDeleteGroups(t *testing.T) {
+	r, _, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	_, created := callSCIM(r, "POST", "/Groups", `{"displayName":"staff","externalId":"hr-staff","members":[{"value":"testid"}]}`, provisioningToken)
+	callSCIM(r, "POST", "/Groups", `{"displayName":"admins"}`, provisioningToken)
+	id := created["id"].(string)
+
+	code, got := callSCIM(r, "GET", "/Groups?filter=externalId+eq+%22hr-staff%22", "", provisioningToken)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, float64(1), got["totalResults"], "only group having the external id should be found")
+	code, got = callSCIM(r, "GET", "/Groups/"+id+"?excludedAttributes=members", "", provisioningToken)
+	assert.Equal(t, 200, code)
+	assert.Nil(t, got["members"], "excluded members should not be given")
+
+	// deleted member leave its groups
+	callSCIM(r, "DELETE", "/Users/testid", "", provisioningToken)
+	_, got = callSCIM(r, "GET", "/Groups/"+id, "", provisioningToken)
+	assert.Empty(t, memberValues(got), "deleted user should leave the group")
+
+	code, _ = callSCIM(r, "DELETE", "/Groups/"+id, "", provisioningToken)
+	assert.Equal(t, 204, code)
+	code, _ = callSCIM(r, "GET", "/Groups/"+id, "", provisioningToken)
+	assert.Equal(t, 404, code, "deleted group should not be found")
+	_, got = callSCIM(r, "GET", "/Groups", "", provisioningToken)
+	assert.Equal(t, float64(1), got["totalResults"])
+}
@@ -0,0 +1,104 @@
+package scim
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Schema URNs of the resources and messages
+const (
+	UserSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	UserExtensionSchema = "urn:ietf:params:scim:schemas:extension:twincape:2.0:User"
+	GroupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Meta is metadata of a resource
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// Name is name of a user, only the formatted name is kept
+type Name struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+// MultiValued is an item of multi valued attribute such as emails or group members
+type MultiValued struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// UserExtension is user data of SSO System having no attribute in the core schema
+type UserExtension struct {
+	KtpNumber    string `json:"ktpNumber,omitempty"`
+	Gender       string `json:"gender,omitempty"`
+	Address      string `json:"address,omitempty"`
+	DateOfBirth  string `json:"dateOfBirth,omitempty"`
+	Citizenship  string `json:"citizenship,omitempty"`
+	PlaceOfBirth string `json:"placeOfBirth,omitempty"`
+}
+
+// User is SCIM user resource, userName is the email of the user
+type User struct {
+	Schemas      []string       `json:"schemas"`
+	ID           string         `json:"id,omitempty"`
+	ExternalID   string         `json:"externalId,omitempty"`
+	UserName     string         `json:"userName"`
+	Name         *Name          `json:"name,omitempty"`
+	DisplayName  string         `json:"displayName,omitempty"`
+	Active       *bool          `json:"active,omitempty"`
+	Password     string         `json:"password,omitempty"`
+	Emails       []MultiValued  `json:"emails,omitempty"`
+	PhoneNumbers []MultiValued  `json:"phoneNumbers,omitempty"`
+	Extension    *UserExtension `json:"urn:ietf:params:scim:schemas:extension:twincape:2.0:User,omitempty"`
+	Meta         *Meta          `json:"meta,omitempty"`
+}
+
+// Group is SCIM group resource
+type Group struct {
+	Schemas     []string      `json:"schemas"`
+	ID          string        `json:"id,omitempty"`
+	ExternalID  string        `json:"externalId,omitempty"`
+	DisplayName string        `json:"displayName"`
+	Members     []MultiValued `json:"members,omitempty"`
+	Meta        *Meta         `json:"meta,omitempty"`
+}
+
+// ListResponse is response of resources query
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// Error is response of failed request
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// PatchRequest is request body of PATCH
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is an operation of PATCH, operation without path has value of attributes by their path
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
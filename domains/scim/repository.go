@@ -0,0 +1,65 @@
+package scim
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by SCIM provisioning
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+	FindUserByEmail(email string) (db.User, error)
+	FindUsers(query db.UserQuery) ([]db.User, int, error)
+	IsKtpNumberUsed(ktpNumber string) (bool, error)
+	IsPhoneNumberUsed(phoneNumber string) (bool, error)
+	UpdateUser(user *db.User) error
+	UpdatePassword(id string, password string) error
+	DeleteUser(id string) error
+}
+
+// GroupRepository is group storage used by SCIM provisioning
+type GroupRepository interface {
+	CreateGroup(group *db.Group) error
+	FindGroupByID(id string) (db.Group, error)
+	FindGroups(query db.GroupQuery) ([]db.Group, int, error)
+	UpdateGroup(group *db.Group) error
+	DeleteGroup(id string) error
+	FindGroupMembers(groupID string) ([]string, error)
+	AddGroupMembers(groupID string, userIDs []string) error
+	RemoveGroupMembers(groupID string, userIDs []string) error
+	RemoveUserFromGroups(userID string) error
+}
+
+// SessionRepository is session storage used to logout users deactivated by SCIM provisioning
+type SessionRepository interface {
+	RevokeOtherSessions(userID string, exceptID string) (int64, error)
+}
+
+// ClientRepository is client storage used to authenticate the provisioning client
+type ClientRepository interface {
+	FindClientByID(id string) (db.Client, error)
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+var groups GroupRepository = db.NewGormGroupRepository(nil)
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+var clients ClientRepository = db.NewGormClientRepository(nil)
+
+// SetUserRepository replace user storage used by SCIM provisioning
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
+
+// SetGroupRepository replace group storage used by SCIM provisioning
+func SetGroupRepository(repository GroupRepository) {
+	groups = repository
+}
+
+// SetSessionRepository replace session storage used by SCIM provisioning
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
+
+// SetClientRepository replace client storage used by SCIM provisioning
+func SetClientRepository(repository ClientRepository) {
+	clients = repository
+}
@@ -0,0 +1,102 @@
+package scim
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// basePath is path of the SCIM endpoints added by InitiateRoutes
+const basePath = "/api/v1/sso/scim/v2"
+
+// maxResults is the most resources given by a query
+const maxResults = 100
+
+// Error types of SCIM error response
+const (
+	invalidFilter = "invalidFilter"
+	invalidSyntax = "invalidSyntax"
+	invalidPath   = "invalidPath"
+	invalidValue  = "invalidValue"
+	noTarget      = "noTarget"
+	uniqueness    = "uniqueness"
+)
+
+func respond(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json")
+	c.JSON(status, body)
+}
+
+func respondError(c *gin.Context, status int, scimType string, detail string) {
+	c.Abort()
+	respond(c, status, Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+// page give offset and limit of the query from startIndex and count, startIndex is one based
+func page(c *gin.Context) (startIndex int, offset int, limit int) {
+	startIndex, err := strconv.Atoi(c.Query("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	limit, err = strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(maxResults)))
+	if err != nil || limit > maxResults {
+		limit = maxResults
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return startIndex, startIndex - 1, limit
+}
+
+func respondList(c *gin.Context, startIndex int, total int, resources []interface{}) {
+	respond(c, http.StatusOK, ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+var equalityFilter = regexp.MustCompile(`^\s*([A-Za-z][\w.:$-]*)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseFilter give attribute and value of filter "attribute eq value", the only filter supported,
+// attribute is lower cased since SCIM attribute names are case insensitive
+func parseFilter(filter string) (string, string, bool) {
+	match := equalityFilter.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", false
+	}
+	value, err := strconv.Unquote(match[2])
+	if err != nil {
+		return "", "", false
+	}
+	return strings.ToLower(match[1]), value, true
+}
+
+// location give URL of the resource
+func location(c *gin.Context, resourceType string, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + basePath + "/" + resourceType + "/" + id
+}
+
+// emitChange record change made by the provisioning client, the client is recorded by audit.Emit
+func emitChange(c *gin.Context, action string, subjectID string) {
+	audit.Emit(c, audit.Event{
+		Type:      audit.AdminAction,
+		SubjectID: subjectID,
+		Metadata:  map[string]interface{}{"action": action},
+	})
+}
@@ -0,0 +1,483 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/nik"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUser service handler creating user through the same rules as register.SaveUser,
+// KTP number is given in the extension schema and the generated password is not shown
+func CreateUser(c *gin.Context) {
+	var input User
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, http.StatusBadRequest, invalidSyntax, "Request body is not a user resource")
+		return
+	}
+	data := register.UserRegistrationData{
+		Name:        input.DisplayName,
+		Email:       primaryValue(input.Emails),
+		PhoneNumber: primaryValue(input.PhoneNumbers),
+		ExternalID:  input.ExternalID,
+		Disabled:    input.Active != nil && !*input.Active,
+		Password:    input.Password,
+	}
+	if input.Name != nil && len(input.Name.Formatted) > 0 {
+		data.Name = input.Name.Formatted
+	}
+	if len(data.Email) == 0 {
+		data.Email = input.UserName
+	}
+	if input.Extension != nil {
+		data.KtpNumber = nik.Number(input.Extension.KtpNumber)
+		data.Gender = input.Extension.Gender
+		data.Address = input.Extension.Address
+		data.DateOfBirth = input.Extension.DateOfBirth
+		data.Cityzenship = input.Extension.Citizenship
+		data.PlaceOfBirth = input.Extension.PlaceOfBirth
+	}
+	user, _, err := register.CreateUser(data, false)
+	var validationErr *register.ValidationError
+	if errors.As(err, &validationErr) {
+		if validationErr.Duplicate {
+			respondError(c, http.StatusConflict, uniqueness, validationErr.Message)
+		} else {
+			respondError(c, http.StatusBadRequest, invalidValue, validationErr.Message)
+		}
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save user")
+		return
+	}
+	emitChange(c, "scim_create_user", user.ID)
+	c.Header("Location", location(c, "Users", user.ID))
+	respond(c, http.StatusCreated, makeUser(c, user))
+}
+
+// GetUser service handler giving the user having the id
+func GetUser(c *gin.Context) {
+	user, ok := findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, makeUser(c, user))
+}
+
+// ListUsers service handler giving users matching filter on userName, emails or externalId
+func ListUsers(c *gin.Context) {
+	startIndex, offset, limit := page(c)
+	query := db.UserQuery{Offset: offset, Limit: limit}
+	if filter := c.Query("filter"); len(filter) > 0 {
+		attribute, value, ok := parseFilter(filter)
+		if !ok {
+			respondError(c, http.StatusBadRequest, invalidFilter, "Only filter \"attribute eq value\" is supported")
+			return
+		}
+		switch attribute {
+		case "username", "emails", "emails.value":
+			query.Email = value
+		case "externalid":
+			query.ExternalID = value
+		case "id":
+			listUserByID(c, startIndex, limit, value)
+			return
+		default:
+			respondError(c, http.StatusBadRequest, invalidFilter, "Users can not be filtered by "+attribute)
+			return
+		}
+	}
+	found, total, err := users.FindUsers(query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get users")
+		return
+	}
+	resources := []interface{}{}
+	for _, user := range found {
+		resources = append(resources, makeUser(c, user))
+	}
+	respondList(c, startIndex, total, resources)
+}
+
+func listUserByID(c *gin.Context, startIndex int, limit int, id string) {
+	user, err := users.FindUserByID(id)
+	if err != nil && err != db.ErrUserNotFound {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get users")
+		return
+	}
+	resources := []interface{}{}
+	if err == nil && startIndex == 1 && limit > 0 {
+		resources = append(resources, makeUser(c, user))
+	}
+	total := 0
+	if err == nil {
+		total = 1
+	}
+	respondList(c, startIndex, total, resources)
+}
+
+// PatchUser service handler changing attributes of the user, deactivated user is logged out of every session
+func PatchUser(c *gin.Context) {
+	var request PatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Operations) == 0 {
+		respondError(c, http.StatusBadRequest, invalidSyntax, "Request body is not a patch operation")
+		return
+	}
+	original, ok := findChangeableUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	user := original
+	for _, operation := range request.Operations {
+		var err *patchError
+		switch strings.ToLower(operation.Op) {
+		case "add", "replace":
+			if len(operation.Path) == 0 {
+				err = setUserValues(&user, operation.Value)
+			} else {
+				err = setUserAttribute(&user, operation.Path, operation.Value)
+			}
+		case "remove":
+			err = removeUserAttribute(&user, operation.Path)
+		default:
+			err = &patchError{invalidSyntax, "Unknown operation " + operation.Op}
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.scimType, err.detail)
+			return
+		}
+	}
+	if !checkUser(c, original, &user) {
+		return
+	}
+	if err := users.UpdateUser(&user); err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to save user")
+		return
+	}
+	if user.Disabled && !original.Disabled {
+		if _, err := sessions.RevokeOtherSessions(user.ID, ""); err != nil {
+			respondError(c, http.StatusInternalServerError, "", "Failed to revoke sessions of the user")
+			return
+		}
+	}
+	emitChange(c, "scim_update_user", user.ID)
+	respond(c, http.StatusOK, makeUser(c, user))
+}
+
+// DeleteUser service handler deleting the user, it is removed from its groups and logged out of every session
+func DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := findChangeableUser(c, id); !ok {
+		return
+	}
+	err := users.DeleteUser(id)
+	if err == db.ErrUserNotFound {
+		respondError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err == nil {
+		err = groups.RemoveUserFromGroups(id)
+	}
+	if err == nil {
+		_, err = sessions.RevokeOtherSessions(id, "")
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+	emitChange(c, "scim_delete_user", id)
+	c.Status(http.StatusNoContent)
+}
+
+func findUser(c *gin.Context, id string) (db.User, bool) {
+	user, err := users.FindUserByID(id)
+	if err == db.ErrUserNotFound {
+		respondError(c, http.StatusNotFound, "", "User not found")
+		return user, false
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to get user")
+		return user, false
+	}
+	return user, true
+}
+
+// findChangeableUser find the user having the id as findUser, administrator is refused since provisioning
+// client must not be able to take over or lock out administrator accounts
+func findChangeableUser(c *gin.Context, id string) (db.User, bool) {
+	user, ok := findUser(c, id)
+	if ok && user.IsAdmin {
+		respondError(c, http.StatusForbidden, "", "Administrator can not be changed by provisioning")
+		return user, false
+	}
+	return user, ok
+}
+
+// checkUser check the user changed by patch follows registration rules, changed email and phone number are normalized
+func checkUser(c *gin.Context, original db.User, user *db.User) bool {
+	user.Email = db.NormalizeEmail(user.Email)
+	switch {
+	case len(user.KtpNumber) == 0:
+		respondError(c, http.StatusBadRequest, invalidValue, "User KTP number must not be empty")
+		return false
+	case len(user.Email) == 0:
+		respondError(c, http.StatusBadRequest, invalidValue, "User email must not be empty")
+		return false
+	case len(user.PhoneNumber) == 0:
+		respondError(c, http.StatusBadRequest, invalidValue, "User phone number must not be empty")
+		return false
+	}
+	if user.PhoneNumber != original.PhoneNumber {
+		phoneNumber, message, isValid := register.NormalizePhoneNumber(user.PhoneNumber)
+		if !isValid {
+			respondError(c, http.StatusBadRequest, invalidValue, message)
+			return false
+		}
+		user.OriginalPhoneNumber = user.PhoneNumber
+		user.PhoneNumber = phoneNumber
+	}
+	// user registered before KTP number was checked can still change other attributes
+	if user.KtpNumber != original.KtpNumber || !user.DateOfBirth.Equal(original.DateOfBirth) || user.Gender != original.Gender {
+		if message, isValid := register.CheckKtpNumber(nik.Number(user.KtpNumber), user.DateOfBirth, user.Gender); !isValid {
+			respondError(c, http.StatusBadRequest, invalidValue, message)
+			return false
+		}
+	}
+	var isUsed bool
+	var err error
+	var message string
+	if user.KtpNumber != original.KtpNumber {
+		isUsed, err = users.IsKtpNumberUsed(user.KtpNumber)
+		message = "User with same KTP number already exists"
+	}
+	if err == nil && !isUsed && user.Email != original.Email {
+		_, err = users.FindUserByEmail(user.Email)
+		isUsed = err == nil
+		if err == db.ErrUserNotFound {
+			err = nil
+		}
+		message = "User with same email already exists"
+	}
+	if err == nil && !isUsed && user.PhoneNumber != original.PhoneNumber {
+		isUsed, err = users.IsPhoneNumberUsed(user.PhoneNumber)
+		message = "User with same phone number already exists"
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "", "Failed to check existing user")
+		return false
+	}
+	if isUsed {
+		respondError(c, http.StatusConflict, uniqueness, message)
+		return false
+	}
+	return true
+}
+
+func makeUser(c *gin.Context, user db.User) User {
+	active := !user.Disabled
+	resource := User{
+		Schemas:     []string{UserSchema, UserExtensionSchema},
+		ID:          user.ID,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		Name:        &Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Active:      &active,
+		Emails:      []MultiValued{{Value: user.Email, Type: "work", Primary: true}},
+		Extension: &UserExtension{
+			KtpNumber:    user.KtpNumber,
+			Gender:       user.Gender,
+			Address:      user.Address,
+			Citizenship:  user.Cityzenship,
+			PlaceOfBirth: user.PlaceOfBirth,
+		},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     location(c, "Users", user.ID),
+		},
+	}
+	if len(user.PhoneNumber) > 0 {
+		resource.PhoneNumbers = []MultiValued{{Value: user.PhoneNumber, Type: "mobile", Primary: true}}
+	}
+	if !user.DateOfBirth.IsZero() {
+		resource.Extension.DateOfBirth = user.DateOfBirth.Format("2006-01-02")
+	}
+	return resource
+}
+
+// primaryValue give value of the primary item, or the first item when none is primary
+func primaryValue(values []MultiValued) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// patchError is failure of a patch operation
+type patchError struct {
+	scimType string
+	detail   string
+}
+
+// normalizePath lower case the path and remove value filter, every multi valued attribute
+// of user has a single value so the filter always select it
+func normalizePath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	if start := strings.Index(path, "["); start >= 0 {
+		if end := strings.Index(path, "]"); end > start {
+			path = path[:start] + path[end+1:]
+		}
+	}
+	return path
+}
+
+// setUserValues set attributes of operation without path, the value is object of attributes by their path
+func setUserValues(user *db.User, value json.RawMessage) *patchError {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &values); err != nil {
+		return &patchError{invalidValue, "Value of operation without path must be an object"}
+	}
+	for path, attributeValue := range values {
+		if strings.EqualFold(path, "schemas") {
+			continue
+		}
+		if err := setUserAttribute(user, path, attributeValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setUserAttribute(user *db.User, path string, value json.RawMessage) *patchError {
+	path = normalizePath(path)
+	extensionPrefix := strings.ToLower(UserExtensionSchema) + ":"
+	if path == strings.ToLower(UserExtensionSchema) {
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal(value, &values); err != nil {
+			return &patchError{invalidValue, "Value of " + UserExtensionSchema + " must be an object"}
+		}
+		for attribute, attributeValue := range values {
+			if err := setUserAttribute(user, extensionPrefix+attribute, attributeValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	switch path {
+	case "active":
+		var active bool
+		active, err = decodeBool(value)
+		user.Disabled = !active
+	case "username", "emails.value":
+		err = json.Unmarshal(value, &user.Email)
+	case "emails":
+		user.Email, err = decodeMultiValued(value)
+	case "displayname", "name.formatted":
+		err = json.Unmarshal(value, &user.Name)
+	case "name":
+		name := Name{}
+		err = json.Unmarshal(value, &name)
+		user.Name = name.Formatted
+	case "externalid":
+		err = json.Unmarshal(value, &user.ExternalID)
+	case "phonenumbers.value":
+		err = json.Unmarshal(value, &user.PhoneNumber)
+	case "phonenumbers":
+		user.PhoneNumber, err = decodeMultiValued(value)
+	case extensionPrefix + "ktpnumber":
+		user.KtpNumber, err = decodeDigits(value)
+	case extensionPrefix + "gender":
+		err = json.Unmarshal(value, &user.Gender)
+	case extensionPrefix + "address":
+		err = json.Unmarshal(value, &user.Address)
+	case extensionPrefix + "dateofbirth":
+		var dateOfBirth string
+		if err = json.Unmarshal(value, &dateOfBirth); err == nil {
+			user.DateOfBirth, err = time.Parse("2006-01-02", dateOfBirth)
+		}
+	case extensionPrefix + "citizenship":
+		err = json.Unmarshal(value, &user.Cityzenship)
+	case extensionPrefix + "placeofbirth":
+		err = json.Unmarshal(value, &user.PlaceOfBirth)
+	default:
+		return &patchError{invalidPath, "Attribute " + path + " can not be changed"}
+	}
+	if err != nil {
+		return &patchError{invalidValue, "Invalid value of " + path}
+	}
+	return nil
+}
+
+func removeUserAttribute(user *db.User, path string) *patchError {
+	path = normalizePath(path)
+	extensionPrefix := strings.ToLower(UserExtensionSchema) + ":"
+	switch path {
+	case "":
+		return &patchError{noTarget, "Path of remove operation must not be empty"}
+	case "externalid":
+		user.ExternalID = ""
+	case "displayname", "name", "name.formatted":
+		user.Name = ""
+	case extensionPrefix + "gender":
+		user.Gender = ""
+	case extensionPrefix + "address":
+		user.Address = ""
+	case extensionPrefix + "dateofbirth":
+		user.DateOfBirth = time.Time{}
+	case extensionPrefix + "citizenship":
+		user.Cityzenship = ""
+	case extensionPrefix + "placeofbirth":
+		user.PlaceOfBirth = ""
+	default:
+		return &patchError{invalidPath, "Attribute " + path + " can not be removed"}
+	}
+	return nil
+}
+
+// decodeBool accept boolean as string too, some clients send "False"
+func decodeBool(value json.RawMessage) (bool, error) {
+	var boolean bool
+	if err := json.Unmarshal(value, &boolean); err == nil {
+		return boolean, nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(text)
+}
+
+// decodeDigits accept digits given as json number too
+func decodeDigits(value json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text, nil
+	}
+	var number json.Number
+	err := json.Unmarshal(value, &number)
+	return number.String(), err
+}
+
+func decodeMultiValued(value json.RawMessage) (string, error) {
+	values := []MultiValued{}
+	if err := json.Unmarshal(value, &values); err != nil {
+		return "", err
+	}
+	return primaryValue(values), nil
+}
@@ -0,0 +1,303 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/domains/scim"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const provisioningToken = "scimclient.scimsecret"
+
+func setupTestCase(t *testing.T) (*gin.Engine, *memory.UserRepository, *memory.SessionRepository, func(t *testing.T)) {
+	environments.Set("PASSWORD_BASE_STRING", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("ID_BASE_STRING", "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
+	environments.Set("SCIM_CLIENT_IDS", "scimclient")
+
+	users := memory.NewUserRepository()
+	sessions := memory.NewSessionRepository()
+	clients := memory.NewClientRepository()
+	register.SetUserRepository(users)
+	scim.SetUserRepository(users)
+	scim.SetSessionRepository(sessions)
+	scim.SetGroupRepository(memory.NewGroupRepository())
+	scim.SetClientRepository(clients)
+	audit.SetLogRepository(memory.NewLogRepository())
+	clients.CreateClient(&db.Client{ID: "scimclient", SecretHash: db.HashClientSecret("scimsecret")})
+	clients.CreateClient(&db.Client{ID: "otherclient", SecretHash: db.HashClientSecret("othersecret")})
+	users.CreateUser(&db.User{ID: "testid", Name: "test", Email: "test@test.com", KtpNumber: "1", PhoneNumber: "+6281200000001", ExternalID: "hr-1"})
+	users.CreateUser(&db.User{ID: "otherid", Name: "other", Email: "other@test.com", KtpNumber: "2", PhoneNumber: "+6281200000002"})
+
+	r := gin.New()
+	routeforSCIM := r.Group("/api/v1/sso/scim/v2")
+	routeforSCIM.Use(scim.ClientBearer())
+	routeforSCIM.POST("/Users", scim.CreateUser)
+	routeforSCIM.GET("/Users", scim.ListUsers)
+	routeforSCIM.GET("/Users/:id", scim.GetUser)
+	routeforSCIM.PATCH("/Users/:id", scim.PatchUser)
+	routeforSCIM.DELETE("/Users/:id", scim.DeleteUser)
+	routeforSCIM.POST("/Groups", scim.CreateGroup)
+	routeforSCIM.GET("/Groups", scim.ListGroups)
+	routeforSCIM.GET("/Groups/:id", scim.GetGroup)
+	routeforSCIM.PATCH("/Groups/:id", scim.PatchGroup)
+	routeforSCIM.DELETE("/Groups/:id", scim.DeleteGroup)
+	return r, users, sessions, func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func callSCIM(r *gin.Engine, method string, path string, body string, token string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, "/api/v1/sso/scim/v2"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/scim+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	got := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	return w.Code, got
+}
+
+func TestClientBearer(t *testing.T) {
+	testCases := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"provisioning client", provisioningToken, 200},
+		{"wrong secret", "scimclient.wrongsecret", 401},
+		{"unknown client", "unknown.scimsecret", 401},
+		{"malformed token", "scimsecret", 401},
+		{"client not allowed to provision", "otherclient.othersecret", 403},
+	}
+	for _, tc := range testCases {
+		r, _, _, teardownTestCase := setupTestCase(t)
+		code, got := callSCIM(r, "GET", "/Users", "", tc.token)
+		assert.Equal(t, tc.expectedCode, code, "test "+tc.name+" case")
+		if code != 200 {
+			assert.Equal(t, []interface{}{scim.ErrorSchema}, got["schemas"], "test "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	testCases := []struct {
+		name             string
+		body             string
+		expectedCode     int
+		expectedScimType string
+	}{
+		{"valid user", `{"schemas":["` + scim.UserSchema + `"],"userName":"new@test.com","externalId":"hr-2","name":{"formatted":"new"},
+			"emails":[{"value":"new@test.com","primary":true}],"phoneNumbers":[{"value":"+6281200000003"}],
+			"` + scim.UserExtensionSchema + `":{"ktpNumber":"3201011505900003","dateOfBirth":"1990-05-15"}}`, 201, ""},
+		{"inactive user", `{"userName":"new@test.com","active":false,"phoneNumbers":[{"value":"+6281200000003"}],
+			"` + scim.UserExtensionSchema + `":{"ktpNumber":"3201011505900003"}}`, 201, ""},
+		{"missing KTP number", `{"userName":"new@test.com","phoneNumbers":[{"value":"+6281200000003"}]}`, 400, "invalidValue"},
+		{"email used", `{"userName":"test@test.com","phoneNumbers":[{"value":"+6281200000003"}],
+			"` + scim.UserExtensionSchema + `":{"ktpNumber":"3201011505900003"}}`, 409, "uniqueness"},
+		{"invalid json", `{"userName":`, 400, "invalidSyntax"},
+	}
+	for _, tc := range testCases {
+		r, users, _, teardownTestCase := setupTestCase(t)
+		code, got := callSCIM(r, "POST", "/Users", tc.body, provisioningToken)
+		assert.Equal(t, tc.expectedCode, code, "test "+tc.name+" case")
+		if code == 201 {
+			user, err := users.FindUserByID(got["id"].(string))
+			assert.Nil(t, err, "test "+tc.name+" case")
+			assert.Equal(t, "new@test.com", got["userName"], "test "+tc.name+" case")
+			assert.Equal(t, !user.Disabled, got["active"], "test "+tc.name+" case")
+			assert.Equal(t, got["externalId"] == "hr-2", user.ExternalID == "hr-2", "test "+tc.name+" case")
+		} else {
+			assert.Equal(t, tc.expectedScimType, got["scimType"], "test "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+// insertOnlyUsers is user storage failing every update, so only data saved by the insert is kept
+type insertOnlyUsers struct {
+	*memory.UserRepository
+}
+
+func (insertOnlyUsers) UpdateUser(user *db.User) error {
+	return errors.New("update is not allowed")
+}
+
+func (insertOnlyUsers) UpdatePassword(id string, password string) error {
+	return errors.New("update is not allowed")
+}
+
+func TestCreateUserInOneInsert(t *testing.T) {
+	r, users, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	register.SetUserRepository(insertOnlyUsers{users})
+	scim.SetUserRepository(insertOnlyUsers{users})
+
+	code, got := callSCIM(r, "POST", "/Users", `{"userName":"new@test.com","externalId":"hr-2","active":false,
+		"password":"Provisioned1","phoneNumbers":[{"value":"+6281200000003"}],"`+scim.UserExtensionSchema+`":{"ktpNumber":"3201011505900003"}}`,
+		provisioningToken)
+	assert.Equal(t, 201, code, "user should be created without updating it")
+	user, err := users.FindUserByID(got["id"].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, "hr-2", user.ExternalID)
+	assert.True(t, user.Disabled)
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Provisioned1")), "password given should be saved")
+}
+
+func TestListUsers(t *testing.T) {
+	testCases := []struct {
+		name          string
+		query         string
+		expectedCode  int
+		expectedTotal float64
+		expectedItems int
+	}{
+		{"every user", "", 200, 2, 2},
+		{"paginated", "?startIndex=2&count=1", 200, 2, 1},
+		{"count only", "?count=0", 200, 2, 0},
+		{"filter by userName", `?filter=userName eq "test@test.com"`, 200, 1, 1},
+		{"filter by userName in other case", `?filter=userName eq "Test@Test.com"`, 200, 1, 1},
+		{"filter by externalId", `?filter=externalId eq "hr-1"`, 200, 1, 1},
+		{"filter by id", `?filter=id eq "otherid"`, 200, 1, 1},
+		{"filter not matching", `?filter=userName eq "unknown@test.com"`, 200, 0, 0},
+		{"unsupported operator", `?filter=userName co "test"`, 400, 0, 0},
+		{"unsupported attribute", `?filter=title eq "test"`, 400, 0, 0},
+	}
+	for _, tc := range testCases {
+		r, _, _, teardownTestCase := setupTestCase(t)
+		req := httptest.NewRequest("GET", "/api/v1/sso/scim/v2/Users"+strings.ReplaceAll(strings.ReplaceAll(tc.query, " ", "%20"), `"`, "%22"), nil)
+		req.Header.Set("Authorization", "Bearer "+provisioningToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		got := map[string]interface{}{}
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, tc.expectedCode, w.Code, "test "+tc.name+" case")
+		assert.Equal(t, "application/scim+json", w.Header().Get("Content-Type"), "test "+tc.name+" case")
+		if w.Code == 200 {
+			assert.Equal(t, []interface{}{scim.ListResponseSchema}, got["schemas"], "test "+tc.name+" case")
+			assert.Equal(t, tc.expectedTotal, got["totalResults"], "test "+tc.name+" case")
+			assert.Len(t, got["Resources"], tc.expectedItems, "test "+tc.name+" case")
+		} else {
+			assert.Equal(t, "invalidFilter", got["scimType"], "test "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	testCases := []struct {
+		name             string
+		operations       string
+		expectedCode     int
+		expectedScimType string
+		check            func(t *testing.T, user db.User)
+	}{
+		{"deactivate", `[{"op":"replace","path":"active","value":false}]`, 200, "", func(t *testing.T, user db.User) {
+			assert.True(t, user.Disabled, "user should be disabled")
+		}},
+		{"deactivate without path", `[{"op":"Replace","value":{"active":"False"}}]`, 200, "", func(t *testing.T, user db.User) {
+			assert.True(t, user.Disabled, "user should be disabled")
+		}},
+		{"change attributes", `[{"op":"replace","path":"name.formatted","value":"changed"},
+			{"op":"replace","path":"emails[type eq \"work\"].value","value":"changed@test.com"},
+			{"op":"add","path":"` + scim.UserExtensionSchema + `:address","value":"Jakarta"},
+			{"op":"remove","path":"externalId"}]`, 200, "", func(t *testing.T, user db.User) {
+			assert.Equal(t, "changed", user.Name)
+			assert.Equal(t, "changed@test.com", user.Email)
+			assert.Equal(t, "Jakarta", user.Address)
+			assert.Empty(t, user.ExternalID)
+			assert.Equal(t, "+6281200000001", user.PhoneNumber, "phone number should be kept")
+		}},
+		{"valid KTP number", `[{"op":"replace","path":"` + scim.UserExtensionSchema + `:ktpNumber","value":"3201011505900009"},
+			{"op":"replace","path":"` + scim.UserExtensionSchema + `:dateOfBirth","value":"1990-05-15"}]`, 200, "", func(t *testing.T, user db.User) {
+			assert.Equal(t, "3201011505900009", user.KtpNumber)
+		}},
+		{"KTP number not NIK", `[{"op":"replace","path":"` + scim.UserExtensionSchema + `:ktpNumber","value":12345}]`, 400, "invalidValue", nil},
+		{"gender contradicting KTP number", `[{"op":"replace","path":"` + scim.UserExtensionSchema + `:ktpNumber","value":3201011505900009},
+			{"op":"replace","path":"` + scim.UserExtensionSchema + `:gender","value":"female"}]`, 400, "invalidValue", nil},
+		{"phone number in national format", `[{"op":"replace","path":"phoneNumbers","value":[{"value":"0812-0000-0009","primary":true}]}]`,
+			200, "", func(t *testing.T, user db.User) {
+				assert.Equal(t, "+6281200000009", user.PhoneNumber, "phone number should be normalized")
+				assert.Equal(t, "0812-0000-0009", user.OriginalPhoneNumber)
+			}},
+		{"phone number of other user in national format", `[{"op":"replace","path":"phoneNumbers.value","value":"0812 0000 0002"}]`,
+			409, "uniqueness", nil},
+		{"invalid phone number", `[{"op":"replace","path":"phoneNumbers.value","value":"0812"}]`, 400, "invalidValue", nil},
+		{"email in other case", `[{"op":"replace","path":"userName","value":"TEST@test.com"}]`, 200, "", func(t *testing.T, user db.User) {
+			assert.Equal(t, "test@test.com", user.Email, "email should be saved lowercased")
+		}},
+		{"email of other user in other case", `[{"op":"replace","path":"userName","value":"Other@Test.com"}]`, 409, "uniqueness", nil},
+		{"email of other user", `[{"op":"replace","path":"userName","value":"other@test.com"}]`, 409, "uniqueness", nil},
+		{"remove required attribute", `[{"op":"remove","path":"userName"}]`, 400, "invalidPath", nil},
+		{"unknown attribute", `[{"op":"replace","path":"title","value":"test"}]`, 400, "invalidPath", nil},
+		{"invalid value", `[{"op":"replace","path":"active","value":"maybe"}]`, 400, "invalidValue", nil},
+	}
+	for _, tc := range testCases {
+		r, users, sessions, teardownTestCase := setupTestCase(t)
+		sessions.CreateSession(&db.Session{ID: "testsession", UserID: "testid", CreatedAt: time.Now(), LastUsedAt: time.Now()})
+		code, got := callSCIM(r, "PATCH", "/Users/testid", `{"schemas":["`+scim.PatchOpSchema+`"],"Operations":`+tc.operations+`}`, provisioningToken)
+		assert.Equal(t, tc.expectedCode, code, "test "+tc.name+" case")
+		user, _ := users.FindUserByID("testid")
+		session, _ := sessions.FindSessionByID("testsession")
+		if tc.check != nil {
+			tc.check(t, user)
+			assert.Equal(t, user.Disabled, session.RevokedAt != nil, "test "+tc.name+" case")
+		} else {
+			assert.Equal(t, tc.expectedScimType, got["scimType"], "test "+tc.name+" case")
+			assert.Equal(t, "test@test.com", user.Email, "test "+tc.name+" case")
+		}
+		teardownTestCase(t)
+	}
+}
+
+func TestGetAndDeleteUser(t *testing.T) {
+	r, _, sessions, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	sessions.CreateSession(&db.Session{ID: "testsession", UserID: "testid", CreatedAt: time.Now(), LastUsedAt: time.Now()})
+
+	code, got := callSCIM(r, "GET", "/Users/testid", "", provisioningToken)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "test@test.com", got["userName"])
+	assert.Equal(t, "http://example.com/api/v1/sso/scim/v2/Users/testid", got["meta"].(map[string]interface{})["location"])
+	assert.Equal(t, "1", got[scim.UserExtensionSchema].(map[string]interface{})["ktpNumber"])
+
+	code, _ = callSCIM(r, "DELETE", "/Users/testid", "", provisioningToken)
+	assert.Equal(t, 204, code, "user should be deleted")
+	code, got = callSCIM(r, "GET", "/Users/testid", "", provisioningToken)
+	assert.Equal(t, 404, code, "deleted user should not be found")
+	assert.Equal(t, "404", got["status"])
+	session, _ := sessions.FindSessionByID("testsession")
+	assert.NotNil(t, session.RevokedAt, "session of deleted user should be revoked")
+	code, _ = callSCIM(r, "DELETE", "/Users/testid", "", provisioningToken)
+	assert.Equal(t, 404, code, "deleted user should not be deleted again")
+}
+
+func TestAdministratorNotChanged(t *testing.T) {
+	r, users, _, teardownTestCase := setupTestCase(t)
+	defer teardownTestCase(t)
+	users.CreateUser(&db.User{ID: "adminid", Name: "admin", Email: "admin@test.com", KtpNumber: "3", PhoneNumber: "+6281200000004", IsAdmin: true})
+
+	code, _ := callSCIM(r, "PATCH", "/Users/adminid", `{"schemas":["`+scim.PatchOpSchema+`"],
+		"Operations":[{"op":"replace","path":"active","value":false}]}`, provisioningToken)
+	assert.Equal(t, 403, code, "administrator should not be patched")
+	code, _ = callSCIM(r, "DELETE", "/Users/adminid", "", provisioningToken)
+	assert.Equal(t, 403, code, "administrator should not be deleted")
+	admin, err := users.FindUserByID("adminid")
+	assert.Nil(t, err, "administrator should be kept")
+	assert.False(t, admin.Disabled, "administrator should stay active")
+	code, _ = callSCIM(r, "GET", "/Users/adminid", "", provisioningToken)
+	assert.Equal(t, 200, code, "administrator should still be read")
+}
@@ -0,0 +1,31 @@
+package session
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// ResponseSession is session data given to the user owning it
+type ResponseSession struct {
+	ID         string    `json:"id"`
+	ClientID   string    `json:"clientId"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	// Current tell the session is the one of the token used to request
+	Current bool `json:"current"`
+}
+
+// CreateResponse from database
+func (t ResponseSession) CreateResponse(session db.Session, currentID string) ResponseSession {
+	t.ID = session.ID
+	t.ClientID = session.ClientID
+	t.UserAgent = session.UserAgent
+	t.IPAddress = session.IPAddress
+	t.CreatedAt = session.CreatedAt
+	t.LastUsedAt = session.LastUsedAt
+	t.Current = session.ID == currentID
+	return t
+}
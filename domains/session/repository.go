@@ -0,0 +1,21 @@
+package session
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// SessionRepository is session storage used by session management
+type SessionRepository interface {
+	FindActiveSessions(userID string, since time.Time) ([]db.Session, error)
+	RevokeSession(userID string, id string) error
+	RevokeOtherSessions(userID string, exceptID string) (int64, error)
+}
+
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+
+// SetSessionRepository replace session storage used by session management
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/gin-gonic/gin"
+)
+
+// ListSessions service handler for user logged in to list their active sessions,
+// session not refreshed for the refresh token lifetime can not be used anymore so it is left out
+func ListSessions(c *gin.Context) {
+	userID := c.GetString("userID")
+	since := time.Now().Add(-keyring.TokenLifetime[keyring.Refresh])
+	activeSessions, err := sessions.FindActiveSessions(userID, since)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get sessions"})
+		return
+	}
+	currentID := c.GetString("sessionID")
+	response := make([]ResponseSession, 0, len(activeSessions))
+	for _, session := range activeSessions {
+		response = append(response, ResponseSession{}.CreateResponse(session, currentID))
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response, "message": "Sessions found"})
+}
+
+// RevokeSession service handler for user logged in to revoke one of their sessions,
+// refresh token of the session is rejected from now on and its access token expire soon after
+func RevokeSession(c *gin.Context) {
+	userID := c.GetString("userID")
+	sessionID := c.Param("id")
+	err := sessions.RevokeSession(userID, sessionID)
+	if err == db.ErrSessionNotFound {
+		c.Abort()
+		c.JSON(http.StatusNotFound, gin.H{"message": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to revoke session"})
+		return
+	}
+	audit.Emit(c, audit.Event{
+		Type:      audit.SessionRevoked,
+		ActorID:   userID,
+		SubjectID: userID,
+		Metadata:  map[string]interface{}{"sessionID": sessionID},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions service handler for user logged in to revoke every session except the one requesting
+func RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetString("userID")
+	currentID := c.GetString("sessionID")
+	revoked, err := sessions.RevokeOtherSessions(userID, currentID)
+	if err != nil {
+		c.Abort()
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to revoke sessions"})
+		return
+	}
+	audit.Emit(c, audit.Event{
+		Type:      audit.SessionRevoked,
+		ActorID:   userID,
+		SubjectID: userID,
+		Metadata:  map[string]interface{}{"exceptSessionID": currentID, "revoked": revoked},
+	})
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked, "message": "Other sessions revoked"})
+}
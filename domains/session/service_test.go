@@ -0,0 +1,136 @@
+package session_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/domains/session"
+)
+
+func setupTestCase(t *testing.T) (*memory.SessionRepository, *memory.LogRepository) {
+	sessions := memory.NewSessionRepository()
+	logs := memory.NewLogRepository()
+	session.SetSessionRepository(sessions)
+	audit.SetLogRepository(logs)
+
+	now := time.Now()
+	revokedAt := now
+	testSessions := []db.Session{
+		{ID: "current", UserID: "testid", CreatedAt: now, LastUsedAt: now, UserAgent: "test-agent"},
+		{ID: "other", UserID: "testid", CreatedAt: now, LastUsedAt: now},
+		{ID: "stale", UserID: "testid", CreatedAt: now.AddDate(0, -1, 0), LastUsedAt: now.AddDate(0, -1, 0)},
+		{ID: "revoked", UserID: "testid", CreatedAt: now, LastUsedAt: now, RevokedAt: &revokedAt},
+		{ID: "otheruser", UserID: "otherid", CreatedAt: now, LastUsedAt: now},
+	}
+	for i := range testSessions {
+		assert.Nil(t, sessions.CreateSession(&testSessions[i]))
+	}
+	return sessions, logs
+}
+
+// loggedInAs set the user and session as the token middleware does
+func loggedInAs(userID string, sessionID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		ids     []string
+		current string
+	}{
+		{name: "OKActiveSessions", userID: "testid", ids: []string{"current", "other"}, current: "current"},
+		{name: "OKOtherUser", userID: "otherid", ids: []string{"otheruser"}},
+		{name: "OKNoSession", userID: "unknown", ids: []string{}},
+	}
+	for _, tc := range tests {
+		setupTestCase(t)
+		r := gin.New()
+		r.GET("/t/sessions", loggedInAs(tc.userID, "current"), session.ListSessions)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/sessions", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, 200, w.Code, "test "+tc.name+" case")
+		var got struct {
+			Sessions []session.ResponseSession `json:"sessions"`
+		}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &got), "test "+tc.name+" case")
+		ids := []string{}
+		current := ""
+		for _, listed := range got.Sessions {
+			ids = append(ids, listed.ID)
+			if listed.Current {
+				current = listed.ID
+			}
+		}
+		assert.ElementsMatch(t, tc.ids, ids, "only active sessions of the user should be listed in test "+tc.name+" case")
+		assert.Equal(t, tc.current, current, "test "+tc.name+" case")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionID string
+		code      int
+	}{
+		{name: "OKOtherSession", sessionID: "other", code: 200},
+		{name: "OKCurrentSession", sessionID: "current", code: 200},
+		{name: "FailedSessionOfOtherUser", sessionID: "otheruser", code: 404},
+		{name: "FailedUnknownSession", sessionID: "unknown", code: 404},
+	}
+	for _, tc := range tests {
+		sessions, logs := setupTestCase(t)
+		r := gin.New()
+		r.DELETE("/t/sessions/:id", loggedInAs("testid", "current"), session.RevokeSession)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/t/sessions/"+tc.sessionID, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+		revoked, _ := sessions.FindSessionByID(tc.sessionID)
+		assert.Equal(t, tc.code == 200, revoked.RevokedAt != nil, "test "+tc.name+" case")
+		events := logs.AuditEvents()
+		if tc.code == 200 && assert.Len(t, events, 1, "revocation should be audited in test "+tc.name+" case") {
+			assert.Equal(t, audit.SessionRevoked, events[0].Type, "test "+tc.name+" case")
+		}
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	sessions, logs := setupTestCase(t)
+	r := gin.New()
+	r.DELETE("/t/sessions", loggedInAs("testid", "current"), session.RevokeOtherSessions)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/t/sessions", nil)
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	var got struct {
+		Revoked int `json:"revoked"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, 2, got.Revoked, "other sessions not revoked yet should be revoked")
+	for _, tc := range []struct {
+		id      string
+		revoked bool
+	}{{"current", false}, {"other", true}, {"stale", true}, {"otheruser", false}} {
+		found, _ := sessions.FindSessionByID(tc.id)
+		assert.Equal(t, tc.revoked, found.RevokedAt != nil, "test "+tc.id+" session")
+	}
+	assert.Len(t, logs.AuditEvents(), 1, "revocation should be audited")
+}
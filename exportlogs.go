@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+)
+
+// exportLogs is command to write api logs in a time range to file for long-term storage
+func exportLogs(args []string) error {
+	command := flag.NewFlagSet("export-logs", flag.ContinueOnError)
+	fromFlag := command.String("from", "", "start of time range (RFC3339), inclusive")
+	toFlag := command.String("to", "", "end of time range (RFC3339), exclusive")
+	format := command.String("format", apilog.FormatJSONL, "export format: jsonl or csv")
+	output := command.String("out", "", "output file, default is standard output")
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	var from, to time.Time
+	var err error
+	if len(*fromFlag) > 0 {
+		if from, err = time.Parse(time.RFC3339, *fromFlag); err != nil {
+			return errors.New("from format: RFC3339 (2006-01-02T15:04:05Z07:00)")
+		}
+	}
+	if len(*toFlag) > 0 {
+		if to, err = time.Parse(time.RFC3339, *toFlag); err != nil {
+			return errors.New("to format: RFC3339 (2006-01-02T15:04:05Z07:00)")
+		}
+	}
+
+	var writer io.Writer = os.Stdout
+	if len(*output) > 0 {
+		file, err := os.OpenFile(*output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	result, err := apilog.Export(writer, from, to, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d API logs\n", result.Total)
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package fieldcrypt encrypt personal data saved in database with AES-GCM and compute blind indexes of it,
+// so the data can still be looked up and kept unique without saving it as plaintext
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// Prefix start every encrypted value, followed by the key version, a colon and base64 of nonce and ciphertext.
+// Value without it is plaintext saved before encryption was configured
+const Prefix = "enc:"
+
+// KeySize is size of AES-256 keys and of the blind index key
+const KeySize = 32
+
+// Errors of keys and encrypted values
+var (
+	ErrUnknownVersion   = errors.New("fieldcrypt: value is encrypted by unknown key version")
+	ErrMalformed        = errors.New("fieldcrypt: encrypted value is malformed")
+	ErrInvalidKeys      = errors.New("fieldcrypt: keys must be base64 of 32 bytes with current version among them")
+	ErrDecryptionFailed = errors.New("fieldcrypt: value can not be decrypted, it is changed or moved from another field or row")
+)
+
+// KeyProvider give the keys of personal data. Encryption keys are versioned so data encrypted by a retired
+// key stays readable, the blind index key is never rotated so indexes of the same value stay equal
+type KeyProvider interface {
+	// EncryptionKeys give every encryption key by version and the version of the key encrypting new data
+	EncryptionKeys() (map[string][]byte, string, error)
+	IndexKey() ([]byte, error)
+}
+
+// FileKeyProvider read the keys from JSON file written as
+// {"current":"2","keys":{"1":"<base64>","2":"<base64>"},"indexKey":"<base64>"}
+type FileKeyProvider struct {
+	Path string
+}
+
+type keyFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"indexKey"`
+}
+
+func (p FileKeyProvider) read() (keyFile, error) {
+	var file keyFile
+	content, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return file, err
+	}
+	err = json.Unmarshal(content, &file)
+	return file, err
+}
+
+// EncryptionKeys give every key in the file by version and the current version
+func (p FileKeyProvider) EncryptionKeys() (map[string][]byte, string, error) {
+	file, err := p.read()
+	if err != nil {
+		return nil, "", err
+	}
+	keys := map[string][]byte{}
+	for version, encoded := range file.Keys {
+		if keys[version], err = decodeKey(encoded); err != nil || strings.Contains(version, ":") {
+			return nil, "", ErrInvalidKeys
+		}
+	}
+	return keys, file.Current, nil
+}
+
+// IndexKey give the blind index key in the file
+func (p FileKeyProvider) IndexKey() ([]byte, error) {
+	file, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(file.IndexKey)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKeys
+	}
+	return key, nil
+}
+
+// Cipher encrypt and decrypt values of personal data fields with the keys read once from a KeyProvider
+type Cipher struct {
+	aeads    map[string]cipher.AEAD
+	current  string
+	indexKey []byte
+}
+
+// NewCipher read the keys from the provider
+func NewCipher(provider KeyProvider) (*Cipher, error) {
+	keys, current, err := provider.EncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, ErrInvalidKeys
+	}
+	c := &Cipher{aeads: map[string]cipher.AEAD{}, current: current}
+	for version, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if c.aeads[version], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if c.indexKey, err = provider.IndexKey(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CurrentPrefix is the start of values encrypted by the current key
+func (c *Cipher) CurrentPrefix() string {
+	return Prefix + c.current + ":"
+}
+
+// associatedData authenticate the field name and the id of the row with the value
+func associatedData(field string, rowID string) []byte {
+	return []byte(field + "\x00" + rowID)
+}
+
+// Encrypt the value of the field of the row having rowID by the current key, the field name and the row id are
+// authenticated so a value copied to another field or another row can not be decrypted. Empty value stays empty
+func (c *Cipher) Encrypt(field string, rowID string, value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	aead := c.aeads[c.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), associatedData(field, rowID))
+	return c.CurrentPrefix() + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt the value of the field of the row having rowID by the key of its version, plaintext value is given as it is
+func (c *Cipher) Decrypt(field string, rowID string, value string) (string, error) {
+	if !strings.HasPrefix(value, Prefix) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, Prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrMalformed
+	}
+	aead, ok := c.aeads[parts[0]]
+	if !ok {
+		return "", ErrUnknownVersion
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	opened, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], associatedData(field, rowID))
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+	return string(opened), nil
+}
+
+// BlindIndex give the deterministic index of the value of the field, equal values of the same field
+// have equal index while the value can not be found from it. Empty value has empty index
+func (c *Cipher) BlindIndex(field string, value string) string {
+	if len(value) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,92 @@
+package fieldcrypt_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/fieldcrypt"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), fieldcrypt.KeySize)))
+}
+
+func writeKeys(t *testing.T, content string) fieldcrypt.FileKeyProvider {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fieldcrypt.FileKeyProvider{Path: path}
+}
+
+func TestNewCipher(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		isError bool
+	}{
+		{"valid", `{"current":"1","keys":{"1":"` + key('a') + `"},"indexKey":"` + key('i') + `"}`, false},
+		{"unknown current version", `{"current":"2","keys":{"1":"` + key('a') + `"},"indexKey":"` + key('i') + `"}`, true},
+		{"short key", `{"current":"1","keys":{"1":"c2hvcnQ="},"indexKey":"` + key('i') + `"}`, true},
+		{"colon in version", `{"current":"a:1","keys":{"a:1":"` + key('a') + `"},"indexKey":"` + key('i') + `"}`, true},
+		{"no index key", `{"current":"1","keys":{"1":"` + key('a') + `"}}`, true},
+		{"not json", `current=1`, true},
+	}
+	for _, tc := range testCases {
+		_, err := fieldcrypt.NewCipher(writeKeys(t, tc.content))
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+	}
+}
+
+func TestCipher(t *testing.T) {
+	old, err := fieldcrypt.NewCipher(writeKeys(t, `{"current":"1","keys":{"1":"`+key('a')+`"},"indexKey":"`+key('i')+`"}`))
+	assert.Nil(t, err)
+	rotated, err := fieldcrypt.NewCipher(writeKeys(t,
+		`{"current":"2","keys":{"1":"`+key('a')+`","2":"`+key('b')+`"},"indexKey":"`+key('i')+`"}`))
+	assert.Nil(t, err)
+
+	encrypted, err := old.Encrypt("address", "testid", "jalan test")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, old.CurrentPrefix()), "value should be prefixed by its key version")
+	assert.NotContains(t, encrypted, "jalan test")
+	again, _ := old.Encrypt("address", "testid", "jalan test")
+	assert.NotEqual(t, encrypted, again, "same value should be encrypted differently")
+
+	testCases := []struct {
+		name      string
+		cipher    *fieldcrypt.Cipher
+		field     string
+		rowID     string
+		value     string
+		expected  string
+		expectErr error
+	}{
+		{"same key", old, "address", "testid", encrypted, "jalan test", nil},
+		{"retired key after rotation", rotated, "address", "testid", encrypted, "jalan test", nil},
+		{"plaintext", rotated, "address", "testid", "jalan lama", "jalan lama", nil},
+		{"moved to other field", old, "placeOfBirth", "testid", encrypted, "", fieldcrypt.ErrDecryptionFailed},
+		{"moved to other row", old, "address", "otherid", encrypted, "", fieldcrypt.ErrDecryptionFailed},
+		{"changed", old, "address", "testid", encrypted[:len(encrypted)-2] + "AA", "", fieldcrypt.ErrDecryptionFailed},
+		{"unknown version", old, "address", "testid", "enc:9:AAAA", "", fieldcrypt.ErrUnknownVersion},
+		{"no version", old, "address", "testid", "enc:AAAA", "", fieldcrypt.ErrMalformed},
+		{"not base64", old, "address", "testid", "enc:1:!!", "", fieldcrypt.ErrMalformed},
+	}
+	for _, tc := range testCases {
+		decrypted, err := tc.cipher.Decrypt(tc.field, tc.rowID, tc.value)
+		assert.Equal(t, tc.expectErr, err, "test "+tc.name+" case")
+		assert.Equal(t, tc.expected, decrypted, "test "+tc.name+" case")
+	}
+
+	empty, _ := old.Encrypt("address", "testid", "")
+	assert.Empty(t, empty, "empty value should stay empty")
+	assert.Equal(t, old.BlindIndex("ktpNumber", "3201011505900001"), rotated.BlindIndex("ktpNumber", "3201011505900001"),
+		"blind index should not change by rotating encryption key")
+	assert.NotEqual(t, old.BlindIndex("ktpNumber", "3201011505900001"), old.BlindIndex("phoneNumber", "3201011505900001"),
+		"blind index should differ by field")
+	assert.Empty(t, old.BlindIndex("ktpNumber", ""))
+}
@@ -1,12 +1,18 @@
 module github.com/drd-engineering/TwinCape
 
-go 1.14
+go 1.16
 
 require (
+	github.com/coreos/go-oidc/v3 v3.1.0
+	github.com/crewjam/saml v0.4.6
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.6.3
+	github.com/go-ldap/ldap/v3 v3.4.4
 	github.com/jinzhu/gorm v1.9.16
 	github.com/joho/godotenv v1.3.0
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	github.com/lib/pq v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.0
+	github.com/stretchr/testify v1.7.2
+	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 )
@@ -0,0 +1,187 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+)
+
+// Purpose of signing key
+const (
+	Access  = "access"
+	Refresh = "refresh"
+)
+
+// Purposes is every purpose of signing key
+var Purposes = []string{Access, Refresh}
+
+// TokenLifetime is how long token signed for each purpose is valid,
+// retired key keep verifying tokens as long as that
+var TokenLifetime = map[string]time.Duration{
+	Access:  30 * time.Minute,
+	Refresh: 7 * 24 * time.Hour,
+}
+
+// legacyKeys are environment variable keys used before the keys are kept in db,
+// tokens signed by them have no kid header
+var legacyKeys = map[string]string{
+	Access:  "ACCESS_SECRET_KEY",
+	Refresh: "REFRESH_SECRET_KEY",
+}
+
+// ErrUnknownKey returned when token is signed by key unknown or already expired
+var ErrUnknownKey = errors.New("keyring: signing key is unknown or expired")
+
+// ErrNoKey returned when there is no key to sign token of the purpose
+var ErrNoKey = errors.New("keyring: there is no signing key")
+
+const (
+	// cacheDuration is how long keys are kept in memory before reading db again
+	cacheDuration = time.Minute
+	// reloadInterval is the minimum time between two reads caused by unknown kid,
+	// so forged kids can not flood the db
+	reloadInterval = 5 * time.Second
+)
+
+type cachedKeys struct {
+	keys     []db.SigningKey
+	loadedAt time.Time
+}
+
+var cacheLock sync.Mutex
+var cache = map[string]cachedKeys{}
+
+// SigningKey give the active key of the purpose with its kid,
+// empty kid means the legacy key from environment variable
+func SigningKey(purpose string) (string, []byte, error) {
+	keys, err := loadKeys(purpose, false)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, key := range keys {
+		if key.RetiredAt == nil {
+			return key.ID, []byte(key.Secret), nil
+		}
+	}
+	if legacyKey := environments.Get(legacyKeys[purpose]); len(legacyKey) > 0 {
+		return "", []byte(legacyKey), nil
+	}
+	return "", nil, ErrNoKey
+}
+
+// VerificationKey give the key having the kid if it is not expired,
+// empty kid means token signed by the legacy key before the first rotation
+func VerificationKey(purpose string, kid string) ([]byte, error) {
+	keys, err := loadKeys(purpose, false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if len(kid) == 0 {
+		legacyKey := environments.Get(legacyKeys[purpose])
+		// legacy key is retired by the first key saved in db
+		if len(legacyKey) == 0 || (len(keys) > 0 && now.After(keys[len(keys)-1].CreatedAt.Add(TokenLifetime[purpose]))) {
+			return nil, ErrUnknownKey
+		}
+		return []byte(legacyKey), nil
+	}
+	key, ok := findKey(keys, kid)
+	if !ok {
+		// the key may be created by another instance after the keys are cached
+		if keys, err = loadKeys(purpose, true); err != nil {
+			return nil, err
+		}
+		key, ok = findKey(keys, kid)
+	}
+	if !ok || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrUnknownKey
+	}
+	return []byte(key.Secret), nil
+}
+
+func findKey(keys []db.SigningKey, kid string) (db.SigningKey, bool) {
+	for _, key := range keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return db.SigningKey{}, false
+}
+
+// Rotate create new active key of the purpose, the previous active key is retired
+// but still verify tokens until their lifetime is over
+func Rotate(purpose string) (db.SigningKey, error) {
+	lifetime, ok := TokenLifetime[purpose]
+	if !ok {
+		return db.SigningKey{}, fmt.Errorf("keyring: unknown purpose %s", purpose)
+	}
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return db.SigningKey{}, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return db.SigningKey{}, err
+	}
+	now := time.Now().UTC()
+	key := db.SigningKey{
+		ID:        hex.EncodeToString(idBytes),
+		CreatedAt: now,
+		Purpose:   purpose,
+		Secret:    base64.RawURLEncoding.EncodeToString(secretBytes),
+	}
+	if err := keys.RotateSigningKey(&key, now.Add(lifetime)); err != nil {
+		return db.SigningKey{}, err
+	}
+	clearCache(purpose)
+	audit.Record(audit.Event{
+		Type:     audit.AdminAction,
+		Metadata: map[string]interface{}{"action": "rotate_signing_key", "purpose": purpose, "kid": key.ID},
+	})
+	return key, nil
+}
+
+// RotateIfOlder rotate key of the purpose when the active key is older than maxAge or there is none
+func RotateIfOlder(purpose string, maxAge time.Duration) (bool, error) {
+	keys, err := loadKeys(purpose, true)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if key.RetiredAt == nil && time.Since(key.CreatedAt) < maxAge {
+			return false, nil
+		}
+	}
+	_, err = Rotate(purpose)
+	return err == nil, err
+}
+
+func loadKeys(purpose string, reload bool) ([]db.SigningKey, error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	cached, ok := cache[purpose]
+	age := time.Since(cached.loadedAt)
+	if ok && age < cacheDuration && (!reload || age < reloadInterval) {
+		return cached.keys, nil
+	}
+	loaded, err := keys.FindSigningKeys(purpose)
+	if err != nil {
+		return nil, err
+	}
+	cache[purpose] = cachedKeys{keys: loaded, loadedAt: time.Now()}
+	return loaded, nil
+}
+
+func clearCache(purpose string) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	delete(cache, purpose)
+}
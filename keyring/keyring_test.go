@@ -0,0 +1,108 @@
+package keyring_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
+)
+
+func setupTestCase(t *testing.T) (*memory.KeyRepository, func(t *testing.T)) {
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	keys := memory.NewKeyRepository()
+	keyring.SetKeyRepository(keys)
+	audit.SetLogRepository(memory.NewLogRepository())
+	return keys, func(t *testing.T) {
+		os.Clearenv()
+	}
+}
+
+func signTestToken(t *testing.T) string {
+	token, err := keyring.Sign(keyring.Access, jwt.StandardClaims{Audience: "testid", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	assert.Nil(t, err)
+	return token
+}
+
+func kidOf(token string) string {
+	parsed, _, _ := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestRotationKeepIssuedTokensValid(t *testing.T) {
+	_, set := setupTestCase(t)
+	defer set(t)
+
+	legacyToken := signTestToken(t)
+	assert.Empty(t, kidOf(legacyToken), "token signed by legacy key should have no kid")
+
+	first, err := keyring.Rotate(keyring.Access)
+	assert.Nil(t, err)
+	firstToken := signTestToken(t)
+	assert.Equal(t, first.ID, kidOf(firstToken), "token should be signed by the new key")
+
+	second, err := keyring.Rotate(keyring.Access)
+	assert.Nil(t, err)
+	assert.Equal(t, second.ID, kidOf(signTestToken(t)), "token should be signed by the newest key")
+
+	for name, token := range map[string]string{"legacy": legacyToken, "retired": firstToken, "active": signTestToken(t)} {
+		claims := jwt.StandardClaims{}
+		assert.Nil(t, keyring.Parse(keyring.Access, token, &claims), "token signed by "+name+" key should be valid")
+		assert.Equal(t, "testid", claims.Audience)
+	}
+	assert.Error(t, keyring.Parse(keyring.Refresh, firstToken, &jwt.StandardClaims{}),
+		"token signed for other purpose should be rejected")
+}
+
+func TestVerificationKeyExpired(t *testing.T) {
+	keys, set := setupTestCase(t)
+	defer set(t)
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+	oldKey := db.SigningKey{ID: "oldkid", CreatedAt: longAgo, Purpose: keyring.Access, Secret: "oldsecret"}
+	keys.RotateSigningKey(&oldKey, longAgo)
+	newKey := db.SigningKey{ID: "newkid", CreatedAt: longAgo.Add(time.Hour), Purpose: keyring.Access, Secret: "newsecret"}
+	keys.RotateSigningKey(&newKey, longAgo.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		kid     string
+		isError bool
+	}{
+		{name: "OKActive", kid: "newkid"},
+		{name: "FailedExpired", kid: "oldkid", isError: true},
+		{name: "FailedLegacyRetired", kid: "", isError: true},
+		{name: "FailedUnknown", kid: "unknown", isError: true},
+	}
+	for _, tc := range tests {
+		_, err := keyring.VerificationKey(keyring.Access, tc.kid)
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+	}
+}
+
+func TestRotateIfOlder(t *testing.T) {
+	_, set := setupTestCase(t)
+	defer set(t)
+	rotated, err := keyring.RotateIfOlder(keyring.Access, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, rotated, "key should be created when there is none")
+	rotated, _ = keyring.RotateIfOlder(keyring.Access, time.Hour)
+	assert.False(t, rotated, "young key should not be rotated")
+	_, err = keyring.Rotate("unknown")
+	assert.Error(t, err, "unknown purpose should be rejected")
+}
+
+func TestSigningKeyWithoutKey(t *testing.T) {
+	_, set := setupTestCase(t)
+	defer set(t)
+	os.Clearenv()
+	_, _, err := keyring.SigningKey(keyring.Access)
+	assert.Equal(t, keyring.ErrNoKey, err, "there should be no key without legacy key nor rotation")
+}
@@ -0,0 +1,23 @@
+package keyring
+
+import (
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// KeyRepository is signing key storage used by key ring
+type KeyRepository interface {
+	FindSigningKeys(purpose string) ([]db.SigningKey, error)
+	RotateSigningKey(key *db.SigningKey, expiresAt time.Time) error
+}
+
+var keys KeyRepository = db.NewGormKeyRepository(nil)
+
+// SetKeyRepository replace signing key storage used by key ring, cached keys are dropped
+func SetKeyRepository(repository KeyRepository) {
+	keys = repository
+	for _, purpose := range Purposes {
+		clearCache(purpose)
+	}
+}
@@ -0,0 +1,50 @@
+package keyring
+
+import (
+	"fmt"
+	"time"
+)
+
+// RotationConfig define how often signing keys are rotated
+type RotationConfig struct {
+	// MaxAge is age of active key to be rotated, zero disable the rotation
+	MaxAge time.Duration
+	// Interval is time between two checks of key age
+	Interval time.Duration
+}
+
+// StartRotation rotate signing keys older than MaxAge periodically in background until the returned stop function is called
+func StartRotation(config RotationConfig) (stop func()) {
+	if config.MaxAge <= 0 {
+		return func() {}
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			for _, purpose := range Purposes {
+				rotated, err := RotateIfOlder(purpose, config.MaxAge)
+				if err != nil {
+					fmt.Println("Failed to rotate " + purpose + " signing key: " + err.Error())
+				} else if rotated {
+					fmt.Println("Rotated " + purpose + " signing key")
+				}
+			}
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
@@ -0,0 +1,39 @@
+package keyring
+
+import (
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Claims is claims of token issued by the service, SessionID bind the token to the session it was issued for
+type Claims struct {
+	jwt.StandardClaims
+	SessionID string `json:"sid,omitempty"`
+}
+
+// Sign create token of the claims signed by the active key of the purpose, with its kid in the header
+func Sign(purpose string, claims jwt.Claims) (string, error) {
+	kid, key, err := SigningKey(purpose)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// Parse verify token signed by any not expired key of the purpose and fill the claims
+func Parse(purpose string, tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		//Make sure that the token method conform to "SigningMethodHMAC"
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return VerificationKey(purpose, kid)
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package logchain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/jinzhu/gorm"
+)
+
+// CheckpointConfig define how often checkpoints are created
+type CheckpointConfig struct {
+	Key      []byte
+	Interval time.Duration
+}
+
+// StartCheckpoints sign the last log of every table periodically in background until the returned stop function is called
+func StartCheckpoints(config CheckpointConfig) (stop func()) {
+	if len(config.Key) == 0 {
+		fmt.Println("LOG_CHECKPOINT_KEY is empty, log checkpoints are not created")
+		return func() {}
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			for _, table := range Tables {
+				if _, err := CreateCheckpoint(table, config.Key); err != nil {
+					fmt.Println("Failed to create checkpoint of " + table + ": " + err.Error())
+				}
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// CreateCheckpoint save signed hash of the last log in the table,
+// nothing is saved when there is no new log since the previous checkpoint
+func CreateCheckpoint(table string, key []byte) (db.LogCheckpoint, error) {
+	checkpoint := db.LogCheckpoint{LogTable: table}
+	dbInstance := db.GetDb()
+	if dbInstance == nil {
+		return checkpoint, db.ErrNotInitialized
+	}
+	var last struct {
+		ID   int
+		Hash string
+	}
+	err := dbInstance.Table(table).Select("id, hash").Order("id desc").Limit(1).Scan(&last).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+	var previous db.LogCheckpoint
+	dbInstance.Where("log_table = ?", table).Order("id desc").First(&previous)
+	if previous.LastID == last.ID {
+		return previous, nil
+	}
+
+	checkpoint.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	checkpoint.LastID = last.ID
+	checkpoint.LastHash = last.Hash
+	checkpoint.Signature = Sign(checkpoint, key)
+	return checkpoint, dbInstance.Create(&checkpoint).Error
+}
+
+// Sign compute HMAC-SHA256 of checkpoint content
+func Sign(checkpoint db.LogCheckpoint, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(checkpoint.LogTable + "|" + strconv.Itoa(checkpoint.LastID) + "|" + checkpoint.LastHash + "|" +
+		strconv.FormatInt(checkpoint.CreatedAt.UTC().Truncate(time.Microsecond).UnixNano(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature tell the checkpoint is signed using the key
+func VerifySignature(checkpoint db.LogCheckpoint, key []byte) bool {
+	return hmac.Equal([]byte(Sign(checkpoint, key)), []byte(checkpoint.Signature))
+}
@@ -0,0 +1,25 @@
+package logchain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/logchain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	checkpoint := db.LogCheckpoint{CreatedAt: time.Now(), LogTable: db.APILogTable, LastID: 10, LastHash: "abc"}
+	checkpoint.Signature = logchain.Sign(checkpoint, []byte("testkey"))
+
+	assert.True(t, logchain.VerifySignature(checkpoint, []byte("testkey")), "signature should be valid using the same key")
+	assert.False(t, logchain.VerifySignature(checkpoint, []byte("otherkey")), "signature should be invalid using other key")
+	checkpoint.LastID = 11
+	assert.False(t, logchain.VerifySignature(checkpoint, []byte("testkey")), "signature should be invalid after checkpoint changed")
+}
+
+func TestStartCheckpointsWithoutKey(t *testing.T) {
+	stop := logchain.StartCheckpoints(logchain.CheckpointConfig{})
+	assert.NotPanics(t, stop, "stopping disabled checkpoints should never be panic")
+}
@@ -0,0 +1,209 @@
+package logchain
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// Tables is every log table protected by hash chain
+var Tables = []string{db.APILogTable, db.AuditEventTable}
+
+// Report is result of verifying chain of a log table
+type Report struct {
+	Table   string
+	Checked int
+	FirstID int
+	LastID  int
+	// BrokenID is id of the first log breaking the chain, zero when the chain is intact
+	BrokenID int
+	Problem  string
+	// CheckpointsChecked is number of checkpoints compared with the logs
+	CheckpointsChecked int
+}
+
+// Intact tell the chain has no broken link
+func (r Report) Intact() bool {
+	return len(r.Problem) == 0
+}
+
+func (r Report) String() string {
+	if r.Intact() {
+		return fmt.Sprintf("%s: %d logs (id %d to %d) and %d checkpoints verified, chain is intact",
+			r.Table, r.Checked, r.FirstID, r.LastID, r.CheckpointsChecked)
+	}
+	return fmt.Sprintf("%s: chain is broken at id %d: %s", r.Table, r.BrokenID, r.Problem)
+}
+
+type link struct {
+	ID          int
+	PrevHash    string
+	Hash        string
+	ContentHash string
+	// PersonalDataIntact tell personal data not covered by the content hash match its own hash
+	PersonalDataIntact bool
+	// Redacted tell personal data is erased, which must be recorded by an account erasure
+	Redacted bool
+}
+
+// Verify walk the log table ordered by id and report the first broken link,
+// checkpoint signatures are verified when key is not empty. The first log must start the chain or follow
+// the last checkpoint before it, where retention purged the logs, and every later checkpoint must sign a log
+// found in the walk, so logs deleted from either end of the table are detected. Redacted api log must be listed
+// by an account erasure audit event, which is itself covered by the chain of audit events
+func Verify(table string, key []byte) (Report, error) {
+	report := Report{Table: table}
+	dbInstance := db.GetDb()
+	if dbInstance == nil {
+		return report, db.ErrNotInitialized
+	}
+	erased, err := erasedAPILogs()
+	if err != nil {
+		return report, err
+	}
+	var checkpoints []db.LogCheckpoint
+	if err := dbInstance.Where("log_table = ?", table).Order("id").Find(&checkpoints).Error; err != nil {
+		return report, err
+	}
+	checkpointHashes := map[int]string{}
+	visited := map[int]bool{}
+	for _, checkpoint := range checkpoints {
+		if len(key) > 0 && !VerifySignature(checkpoint, key) {
+			report.BrokenID = checkpoint.LastID
+			report.Problem = fmt.Sprintf("signature of checkpoint %d is invalid", checkpoint.ID)
+			return report, nil
+		}
+		checkpointHashes[checkpoint.LastID] = checkpoint.LastHash
+	}
+
+	prevHash := ""
+	err = walk(table, func(current link) bool {
+		report.Checked++
+		if report.Checked == 1 {
+			report.FirstID = current.ID
+			// logs before the first one may be purged by retention, which purge up to a checkpoint only
+			if current.PrevHash != purgedHash(checkpoints, current.ID) {
+				report.BrokenID = current.ID
+				report.Problem = "previous hash does not match the start of the chain nor the checkpoint before it"
+				return false
+			}
+		} else if current.PrevHash != prevHash {
+			report.BrokenID = current.ID
+			report.Problem = "previous hash does not match hash of the log before it"
+			return false
+		}
+		if current.Hash != db.ChainHash(current.PrevHash, current.ContentHash) {
+			report.BrokenID = current.ID
+			report.Problem = "hash does not match content of the log"
+			return false
+		}
+		if !current.PersonalDataIntact {
+			report.BrokenID = current.ID
+			report.Problem = "personal data does not match its hash"
+			return false
+		}
+		if current.Redacted && !erased[current.ID] {
+			report.BrokenID = current.ID
+			report.Problem = "personal data is redacted without an account erasure recording it"
+			return false
+		}
+		if expected, ok := checkpointHashes[current.ID]; ok {
+			report.CheckpointsChecked++
+			visited[current.ID] = true
+			if expected != current.Hash {
+				report.BrokenID = current.ID
+				report.Problem = "hash does not match the signed checkpoint"
+				return false
+			}
+		}
+		prevHash = current.Hash
+		report.LastID = current.ID
+		return true
+	})
+	if err != nil || !report.Intact() {
+		return report, err
+	}
+	for _, checkpoint := range checkpoints {
+		if (report.Checked == 0 || checkpoint.LastID >= report.FirstID) && !visited[checkpoint.LastID] {
+			report.BrokenID = checkpoint.LastID
+			report.Problem = fmt.Sprintf("log signed by checkpoint %d is deleted", checkpoint.ID)
+			return report, nil
+		}
+	}
+	return report, nil
+}
+
+// purgedHash give the hash the first log left follows, the hash of the last checkpoint before it
+// or the start of the chain when there is none
+func purgedHash(checkpoints []db.LogCheckpoint, firstID int) string {
+	hash := ""
+	for _, checkpoint := range checkpoints {
+		if checkpoint.LastID < firstID {
+			hash = checkpoint.LastHash
+		}
+	}
+	return hash
+}
+
+// erasedAPILogs give ids of the api logs redacted by account erasures, listed by their audit events
+func erasedAPILogs() (map[int]bool, error) {
+	var events []db.AuditEvent
+	if err := db.GetDb().Where("type = ?", audit.AccountErasure).Order("id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	erased := map[int]bool{}
+	for _, event := range events {
+		var metadata struct {
+			APILogIDs []int `json:"apiLogIds"`
+		}
+		// event without json metadata list no api log
+		if err := json.Unmarshal([]byte(event.Metadata), &metadata); err != nil {
+			continue
+		}
+		for _, id := range metadata.APILogIDs {
+			erased[id] = true
+		}
+	}
+	return erased, nil
+}
+
+// walk give every log of the table ordered by id to visit until it return false
+func walk(table string, visit func(link) bool) error {
+	dbInstance := db.GetDb()
+	var model interface{}
+	var toLink func() link
+	switch table {
+	case db.APILogTable:
+		apiLog := db.APILog{}
+		model = &apiLog
+		toLink = func() link {
+			return link{ID: apiLog.ID, PrevHash: apiLog.PrevHash, Hash: apiLog.Hash, ContentHash: apiLog.ContentHash(),
+				PersonalDataIntact: apiLog.PersonalDataIntact(), Redacted: apiLog.Redacted}
+		}
+	case db.AuditEventTable:
+		auditEvent := db.AuditEvent{}
+		model = &auditEvent
+		toLink = func() link {
+			return link{ID: auditEvent.ID, PrevHash: auditEvent.PrevHash, Hash: auditEvent.Hash, ContentHash: auditEvent.ContentHash(),
+				PersonalDataIntact: true}
+		}
+	default:
+		return fmt.Errorf("logchain: unknown table %s", table)
+	}
+	rows, err := dbInstance.Model(model).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := dbInstance.ScanRows(rows, model); err != nil {
+			return err
+		}
+		if !visit(toLink()) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,128 @@
+package logchain_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/logchain"
+	"github.com/stretchr/testify/assert"
+)
+
+func dbTestConfig() *db.Config {
+	return &db.Config{Driver: db.DriverSQLite, Path: db.SQLiteMemory, MigrateOnInit: true}
+}
+func setupTestCase(t *testing.T) func(t *testing.T) {
+	environments.Set("RELEASE_TYPE", "localhost")
+	_, filename, _, _ := runtime.Caller(0)
+	dir := path.Join(path.Dir(filename), "..")
+	err := os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+	environments.LoadEnvironmentVariableFile()
+	db.Init(dbTestConfig())
+	logs := db.NewGormLogRepository(nil)
+	for i := 0; i < 3; i++ {
+		logs.CreateAPILogs([]db.APILog{
+			{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/v1/sso/auth/login", Method: "POST",
+				UserID: "testid", ClientIP: "10.0.0.1", ClientTools: "test-agent"},
+			{Timestamp: time.Now(), ResponseStatus: 401, Path: "/api/v1/sso/auth/login", Method: "POST"},
+		})
+		logs.CreateAuditEvent(&db.AuditEvent{Timestamp: time.Now(), Type: "login_success", ActorID: "testid"})
+	}
+	return func(t *testing.T) {
+		os.Clearenv()
+		db.GetDb().Close()
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper string
+		// redact erase personal data of api logs of testid and record it as account erasure before verifying
+		redact   bool
+		table    string
+		brokenID int
+	}{
+		{name: "OKAPILogs", table: db.APILogTable},
+		{name: "OKAuditEvents", table: db.AuditEventTable},
+		{name: "FailedContentEdited", tamper: "UPDATE api_logs SET response_status = 200 WHERE id = 4", table: db.APILogTable, brokenID: 4},
+		{name: "FailedLogDeleted", tamper: "DELETE FROM audit_events WHERE id = 2", table: db.AuditEventTable, brokenID: 3},
+		{name: "OKRedactedAPILogs", redact: true, table: db.APILogTable},
+		{name: "FailedPersonalDataEdited", tamper: "UPDATE api_logs SET client_ip = '10.0.0.9' WHERE id = 3", table: db.APILogTable, brokenID: 3},
+		{name: "FailedRedactedKeepingPersonalData", tamper: "UPDATE api_logs SET redacted = true WHERE id = 3", table: db.APILogTable, brokenID: 3},
+		{name: "FailedForgedRedaction", tamper: "UPDATE api_logs SET user_id = '', client_ip = '', client_tools = '', personal_salt = '', redacted = true WHERE id = 3",
+			table: db.APILogTable, brokenID: 3},
+		{name: "FailedForgedRedactionBesideErasure", tamper: "UPDATE api_logs SET redacted = true WHERE id = 4", redact: true,
+			table: db.APILogTable, brokenID: 4},
+		{name: "FailedTailDeleted", tamper: "DELETE FROM api_logs WHERE id >= 5", table: db.APILogTable, brokenID: 6},
+		{name: "FailedHeadDeleted", tamper: "DELETE FROM api_logs WHERE id <= 2", table: db.APILogTable, brokenID: 3},
+		{name: "FailedEveryLogDeleted", tamper: "DELETE FROM api_logs", table: db.APILogTable, brokenID: 6},
+		{name: "FailedCheckpointForged", tamper: "UPDATE log_checkpoints SET last_hash = 'forged'", table: db.APILogTable, brokenID: 6},
+	}
+	key := []byte("testkey")
+	for _, tc := range tests {
+		set := setupTestCase(t)
+		_, err := logchain.CreateCheckpoint(db.APILogTable, key)
+		assert.Nil(t, err, "checkpoint should be created in test "+tc.name+" case")
+		if len(tc.tamper) > 0 {
+			db.GetDb().Exec(tc.tamper)
+		}
+		if tc.redact {
+			logs := db.NewGormLogRepository(nil)
+			redacted, err := logs.RedactAPILogs("testid")
+			assert.Nil(t, err)
+			assert.Equal(t, []int{1, 3, 5}, redacted, "every api log of the user should be redacted in test "+tc.name+" case")
+			metadata, _ := json.Marshal(map[string]interface{}{"apiLogIds": redacted})
+			logs.CreateAuditEvent(&db.AuditEvent{Timestamp: time.Now(), Type: audit.AccountErasure, SubjectID: "testid",
+				Metadata: string(metadata)})
+		}
+		report, err := logchain.Verify(tc.table, key)
+		assert.Nil(t, err, "test "+tc.name+" case")
+		assert.Equal(t, tc.brokenID, report.BrokenID, "test "+tc.name+" case")
+		assert.Equal(t, tc.brokenID == 0, report.Intact(), "test "+tc.name+" case")
+		set(t)
+	}
+}
+
+func TestVerifyPurged(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	key := []byte("testkey")
+	_, err := logchain.CreateCheckpoint(db.APILogTable, key)
+	assert.Nil(t, err)
+	logs := db.NewGormLogRepository(nil)
+	logs.CreateAPILogs([]db.APILog{
+		{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/v1/sso/auth/login"},
+		{Timestamp: time.Now(), ResponseStatus: 200, Path: "/api/v1/sso/auth/login"},
+	})
+
+	result, err := apilog.Purge(time.Now().Add(time.Minute), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, result.Deleted, "logs up to the checkpoint should be purged, newer logs kept")
+	report, err := logchain.Verify(db.APILogTable, key)
+	assert.Nil(t, err)
+	assert.True(t, report.Intact(), "chain purged up to a checkpoint should be intact: "+report.String())
+	assert.Equal(t, 7, report.FirstID)
+
+	logs.DeleteAPILogs(7, 1)
+	report, err = logchain.Verify(db.APILogTable, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, report.BrokenID, "log deleted after the checkpoint should be detected")
+}
+
+func TestVerifyUnknownTable(t *testing.T) {
+	set := setupTestCase(t)
+	defer set(t)
+	_, err := logchain.Verify("users", nil)
+	assert.Error(t, err, "Should return an error")
+}
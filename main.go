@@ -3,46 +3,149 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/drd-engineering/TwinCape/db"
-	"github.com/drd-engineering/TwinCape/domains"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
 	"github.com/drd-engineering/TwinCape/environments"
-	"github.com/drd-engineering/TwinCape/routes"
+	"github.com/drd-engineering/TwinCape/fieldcrypt"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/logchain"
 )
 
 func makeDbConfig() *db.Config {
 	return &db.Config{
+		Driver:   environments.Get("DB_DRIVER"),
 		Host:     environments.Get("HOST_DB"),
 		Username: environments.Get("USERNAME_DB"),
 		DBName:   environments.Get("DB_NAME"),
 		Password: environments.Get("PASSWORD_DB"),
+		SSLMode:  environments.Get("SSLMODE_DB"),
+		Path:     environments.Get("PATH_DB"),
+		// memory database is always empty, so it is useless without migrating on start
+		MigrateOnInit: environments.Get("MIGRATE_DB_ON_START") == "true" ||
+			environments.Get("PATH_DB") == db.SQLiteMemory,
 	}
 }
+
+// makeFieldCipher read the keys encrypting personal data of users, nil when FIELD_KEY_FILE is empty
+func makeFieldCipher() (*fieldcrypt.Cipher, error) {
+	path := environments.Get("FIELD_KEY_FILE")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return fieldcrypt.NewCipher(fieldcrypt.FileKeyProvider{Path: path})
+}
 func getRoutingPort() string {
 	return environments.Get("PORT")
 }
+func makeRetentionConfig() apilog.RetentionConfig {
+	// invalid or empty duration disable the retention
+	maxAge, _ := time.ParseDuration(environments.Get("API_LOG_RETENTION"))
+	interval, _ := time.ParseDuration(environments.Get("API_LOG_RETENTION_INTERVAL"))
+	return apilog.RetentionConfig{
+		MaxAge:     maxAge,
+		Interval:   interval,
+		ArchiveDir: environments.Get("API_LOG_ARCHIVE_DIR"),
+	}
+}
+func makeCheckpointConfig() logchain.CheckpointConfig {
+	interval, _ := time.ParseDuration(environments.Get("LOG_CHECKPOINT_INTERVAL"))
+	return logchain.CheckpointConfig{
+		Key:      []byte(environments.Get("LOG_CHECKPOINT_KEY")),
+		Interval: interval,
+	}
+}
+func makeRotationConfig() keyring.RotationConfig {
+	// invalid or empty duration disable the scheduled rotation
+	maxAge, _ := time.ParseDuration(environments.Get("SIGNING_KEY_ROTATION"))
+	interval, _ := time.ParseDuration(environments.Get("SIGNING_KEY_ROTATION_INTERVAL"))
+	return keyring.RotationConfig{
+		MaxAge:   maxAge,
+		Interval: interval,
+	}
+}
+
+// command is a subcommand of the binary
+type command struct {
+	run         func(args []string) error
+	description string
+	// needDb tell the database must be initiated before running the command
+	needDb bool
+}
+
+var commands = map[string]command{
+	"serve":            {run: serve, description: "start the http server, run when no command is given", needDb: true},
+	"migrate":          {run: migrate, description: "apply, revert or list schema migrations"},
+	"create-user":      {run: createUser(false), description: "create user and print its generated password", needDb: true},
+	"create-admin":     {run: createUser(true), description: "create administrator and print its generated password", needDb: true},
+	"reset-password":   {run: resetPassword, description: "replace password of a user with a generated one", needDb: true},
+	"disable-user":     {run: disableUser, description: "disable or enable a user", needDb: true},
+	"import-users":     {run: importUsers, description: "register users from CSV or JSONL with a report of every row", needDb: true},
+	"normalize-phones": {run: normalizePhones, description: "normalize phone numbers of existing users to E.164", needDb: true},
+	"encrypt-users":    {run: encryptUsers, description: "encrypt personal data of existing users by the current field key", needDb: true},
+	"rotate-keys":      {run: rotateKeys, description: "create new token signing keys, retiring the current ones", needDb: true},
+	"client":           {run: clientCommand, description: "manage applications allowed to call the API (client create)", needDb: true},
+	"saml":             {run: samlCommand, description: "manage SAML service providers (saml register)", needDb: true},
+	"export-logs":      {run: exportLogs, description: "write API logs of a time range to JSONL or CSV", needDb: true},
+	"verify-logs":      {run: verifyLogs, description: "verify hash chain of log tables", needDb: true},
+}
 
 func main() {
-	var port string
 	// Store the release type this engine will be run
 	releaseType := flag.String("release", "localhost", "to define release type you are running this command, default value : localhost")
+	flag.Usage = func() {
+		output := flag.CommandLine.Output()
+		fmt.Fprintln(output, "Usage: TwinCape [-release type] [command] [command options]")
+		flag.PrintDefaults()
+		fmt.Fprintln(output, "Commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(output, "  %-16s %s\n", name, commands[name].description)
+		}
+	}
+	flag.Parse()
 	if releaseType != nil {
 		environments.Set("RELEASE_TYPE", strings.ToLower(*releaseType))
 	} else {
 		environments.Set("RELEASE_TYPE", strings.ToLower("localhost"))
 	}
 	environments.LoadEnvironmentVariableFile()
-	err := db.InitPostgre(makeDbConfig())
-	if err != nil {
-		fmt.Println("POSTGRE is not started, there is something wrong with environment variable")
-		return
-	}
-	port = getRoutingPort()
-	// Add Specific router group to main router
-	domains.InitiateRoutes()
-
-	// Start Server
-	r := routes.GetInstance()
-	r.Run(":" + port)
+
+	name := "serve"
+	args := []string{}
+	if flag.NArg() > 0 {
+		name = flag.Arg(0)
+		args = flag.Args()[1:]
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Println("Unknown command " + name)
+		flag.Usage()
+		os.Exit(2)
+	}
+	// migrate open the database itself, since Init refuse to start on unmigrated schema
+	if command.needDb {
+		if err := db.Init(makeDbConfig()); err != nil {
+			fmt.Println("Database is not started, there is something wrong with environment variable: " + err.Error())
+			os.Exit(1)
+		}
+		cipher, err := makeFieldCipher()
+		if err != nil {
+			fmt.Println("Field key is not loaded, there is something wrong with FIELD_KEY_FILE: " + err.Error())
+			os.Exit(1)
+		}
+		db.SetFieldCipher(cipher)
+	}
+	if err := command.run(args); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// migrate is command to apply, revert or list schema migrations embedded in the binary
+func migrate(args []string) error {
+	command := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	steps := command.Int("steps", 1, "number of migrations reverted by down")
+	command.Usage = func() {
+		fmt.Fprintln(command.Output(), "Usage: TwinCape migrate up|down|status [-steps n]")
+		command.PrintDefaults()
+	}
+	if len(args) == 0 {
+		command.Usage()
+		return errors.New("migrate direction must be up, down or status")
+	}
+	if err := command.Parse(args[1:]); err != nil {
+		return err
+	}
+	conn, err := db.Open(makeDbConfig())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(conn)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		return err
+	case "down":
+		if *steps < 1 {
+			return errors.New("steps must be at least 1")
+		}
+		reverted, err := db.MigrateDown(conn, *steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d %s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := db.MigrationStatuses(conn)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %s: %s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	default:
+		command.Usage()
+		return errors.New("migrate direction must be up, down or status")
+	}
+}
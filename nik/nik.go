@@ -0,0 +1,178 @@
+// Package nik parse Nomor Induk Kependudukan, the 16 digit number of Indonesian KTP.
+// The digits are province, regency and district code of the first registration, birth date
+// as DDMMYY where women have 40 added to the day, and serial number of people registered
+// in the district on the same birth date
+package nik
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Length is number of digits of NIK
+const Length = 16
+
+// Errors of malformed NIK
+var (
+	ErrInvalidLength    = errors.New("nik: NIK must be 16 digits")
+	ErrInvalidRegion    = errors.New("nik: region code of NIK is unknown")
+	ErrInvalidBirthDate = errors.New("nik: birth date of NIK is invalid")
+	ErrInvalidSerial    = errors.New("nik: serial number of NIK must not be zero")
+)
+
+// Errors of profile contradicting NIK
+var (
+	ErrBirthDateMismatch = errors.New("nik: date of birth does not match NIK")
+	ErrGenderMismatch    = errors.New("nik: gender does not match NIK")
+)
+
+// Provinces is name of the provinces by their code, NIK keep the province code of the first registration
+var Provinces = map[string]string{
+	"11": "Aceh",
+	"12": "Sumatera Utara",
+	"13": "Sumatera Barat",
+	"14": "Riau",
+	"15": "Jambi",
+	"16": "Sumatera Selatan",
+	"17": "Bengkulu",
+	"18": "Lampung",
+	"19": "Kepulauan Bangka Belitung",
+	"21": "Kepulauan Riau",
+	"31": "DKI Jakarta",
+	"32": "Jawa Barat",
+	"33": "Jawa Tengah",
+	"34": "DI Yogyakarta",
+	"35": "Jawa Timur",
+	"36": "Banten",
+	"51": "Bali",
+	"52": "Nusa Tenggara Barat",
+	"53": "Nusa Tenggara Timur",
+	"61": "Kalimantan Barat",
+	"62": "Kalimantan Tengah",
+	"63": "Kalimantan Selatan",
+	"64": "Kalimantan Timur",
+	"65": "Kalimantan Utara",
+	"71": "Sulawesi Utara",
+	"72": "Sulawesi Tengah",
+	"73": "Sulawesi Selatan",
+	"74": "Sulawesi Tenggara",
+	"75": "Gorontalo",
+	"76": "Sulawesi Barat",
+	"81": "Maluku",
+	"82": "Maluku Utara",
+	"91": "Papua",
+	"92": "Papua Barat",
+	"93": "Papua Selatan",
+	"94": "Papua Tengah",
+	"95": "Papua Pegunungan",
+	"96": "Papua Barat Daya",
+}
+
+// Gender encoded in NIK
+const (
+	Male   = "male"
+	Female = "female"
+)
+
+// NIK is the data decoded from NIK
+type NIK struct {
+	Number string
+	// ProvinceCode is 2 digits, RegencyCode and DistrictCode contain the digits of the regions above them
+	ProvinceCode string
+	RegencyCode  string
+	DistrictCode string
+	BirthDate    time.Time
+	Gender       string
+	Serial       string
+}
+
+// Number is NIK written as text, unlike integer it keep leading zeros and can not be negative
+type Number string
+
+// Parse decode the number, see Parse
+func (n Number) Parse() (NIK, error) {
+	return Parse(string(n))
+}
+
+// Province give name of the province of the NIK
+func (n NIK) Province() string {
+	return Provinces[n.ProvinceCode]
+}
+
+// Parse decode the NIK, birth date is the latest date with its year ending with its two digits not after now
+func Parse(number string) (NIK, error) {
+	return ParseAt(number, time.Now())
+}
+
+// ParseAt decode the NIK as Parse does when the time is now
+func ParseAt(number string, now time.Time) (NIK, error) {
+	if len(number) != Length {
+		return NIK{}, ErrInvalidLength
+	}
+	for _, digit := range number {
+		if digit < '0' || digit > '9' {
+			return NIK{}, ErrInvalidLength
+		}
+	}
+	parsed := NIK{
+		Number:       number,
+		ProvinceCode: number[:2],
+		RegencyCode:  number[:4],
+		DistrictCode: number[:6],
+		Gender:       Male,
+		Serial:       number[12:],
+	}
+	if _, ok := Provinces[parsed.ProvinceCode]; !ok || number[2:4] == "00" || number[4:6] == "00" {
+		return NIK{}, ErrInvalidRegion
+	}
+	day, _ := strconv.Atoi(number[6:8])
+	month, _ := strconv.Atoi(number[8:10])
+	year, _ := strconv.Atoi(number[10:12])
+	if day > 40 {
+		day -= 40
+		parsed.Gender = Female
+	}
+	year += now.Year() / 100 * 100
+	// the birth date is in the last century when it is later this century than now, including the day
+	// and month so people born later in the year now are not taken as not born yet
+	if time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).After(now) {
+		year -= 100
+	}
+	parsed.BirthDate = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalize invalid date such as 31 February to another date
+	if day < 1 || month < 1 || month > 12 || parsed.BirthDate.Day() != day {
+		return NIK{}, ErrInvalidBirthDate
+	}
+	if parsed.Serial == "0000" {
+		return NIK{}, ErrInvalidSerial
+	}
+	return parsed, nil
+}
+
+// genders is gender written in profile by the gender it means
+var genders = map[string]string{
+	"male": Male, "m": Male, "laki-laki": Male, "laki laki": Male, "l": Male, "pria": Male,
+	"female": Female, "f": Female, "perempuan": Female, "p": Female, "wanita": Female,
+}
+
+// NormalizeGender give Male or Female for gender written in profile, empty when it is not known
+func NormalizeGender(gender string) string {
+	return genders[strings.ToLower(strings.TrimSpace(gender))]
+}
+
+// CheckProfile give error when birth date or gender in profile contradict the NIK, zero birth date
+// and unknown gender are not checked. Only two digits of the year are compared since NIK has no century
+func (n NIK) CheckProfile(birthDate time.Time, gender string) error {
+	if !birthDate.IsZero() {
+		year, month, day := birthDate.Date()
+		if year%100 != n.BirthDate.Year()%100 || month != n.BirthDate.Month() || day != n.BirthDate.Day() {
+			return ErrBirthDateMismatch
+		}
+	}
+	if normalized := NormalizeGender(gender); len(normalized) > 0 && normalized != n.Gender {
+		return ErrGenderMismatch
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package nik_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/nik"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name              string
+		number            string
+		expectedErr       error
+		expectedProvince  string
+		expectedDistrict  string
+		expectedBirthDate string
+		expectedGender    string
+	}{
+		{"man", "3201011505900001", nil, "Jawa Barat", "320101", "1990-05-15", nik.Male},
+		{"woman", "3174015505900002", nil, "DKI Jakarta", "317401", "1990-05-15", nik.Female},
+		{"born this century", "5171010101100003", nil, "Bali", "517101", "2010-01-01", nik.Male},
+		{"too short", "320101150590001", nik.ErrInvalidLength, "", "", "", ""},
+		{"not digits", "32010115059000A1", nik.ErrInvalidLength, "", "", "", ""},
+		{"negative", "-320101150590001", nik.ErrInvalidLength, "", "", "", ""},
+		{"unknown province", "9901011505900001", nik.ErrInvalidRegion, "", "", "", ""},
+		{"zero regency", "3200011505900001", nik.ErrInvalidRegion, "", "", "", ""},
+		{"zero district", "3201001505900001", nik.ErrInvalidRegion, "", "", "", ""},
+		{"invalid day", "3201013205900001", nik.ErrInvalidBirthDate, "", "", "", ""},
+		{"invalid woman day", "3201017205900001", nik.ErrInvalidBirthDate, "", "", "", ""},
+		{"31 February", "3201013102900001", nik.ErrInvalidBirthDate, "", "", "", ""},
+		{"invalid month", "3201011513900001", nik.ErrInvalidBirthDate, "", "", "", ""},
+		{"zero serial", "3201011505900000", nik.ErrInvalidSerial, "", "", "", ""},
+	}
+	for _, tc := range testCases {
+		parsed, err := nik.Number(tc.number).Parse()
+		assert.Equal(t, tc.expectedErr, err, "test "+tc.name+" case")
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.expectedProvince, parsed.Province(), "test "+tc.name+" case")
+		assert.Equal(t, tc.expectedDistrict, parsed.DistrictCode, "test "+tc.name+" case")
+		assert.Equal(t, tc.expectedBirthDate, parsed.BirthDate.Format("2006-01-02"), "test "+tc.name+" case")
+		assert.Equal(t, tc.expectedGender, parsed.Gender, "test "+tc.name+" case")
+	}
+}
+
+func TestParseAt(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name              string
+		number            string
+		now               time.Time
+		expectedErr       error
+		expectedBirthDate string
+	}{
+		{"born earlier this year", "3201010510260001", now, nil, "2026-10-05"},
+		{"born today", "3201011910260001", now, nil, "2026-10-19"},
+		{"born later in the year last century", "3201012010260001", now, nil, "1926-10-20"},
+		{"woman born later in the year last century", "3201016010260001", now, nil, "1926-10-20"},
+		{"born next year last century", "3201010101270001", now, nil, "1927-01-01"},
+		{"born last year", "3201013112250001", now, nil, "2025-12-31"},
+		{"29 February last century", "3201012902280001", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), nil, "1928-02-29"},
+		{"29 February of year not leap", "3201012902000001", time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC), nik.ErrInvalidBirthDate, ""},
+		{"29 February of leap century year", "3201012902000001", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), nil, "2000-02-29"},
+	}
+	for _, tc := range testCases {
+		parsed, err := nik.ParseAt(tc.number, tc.now)
+		assert.Equal(t, tc.expectedErr, err, "test "+tc.name+" case")
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.expectedBirthDate, parsed.BirthDate.Format("2006-01-02"), "test "+tc.name+" case")
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	parsed, _ := nik.Parse("3174015505900002")
+	testCases := []struct {
+		name        string
+		birthDate   time.Time
+		gender      string
+		expectedErr error
+	}{
+		{"matching profile", time.Date(1990, 5, 15, 0, 0, 0, 0, time.UTC), "Perempuan", nil},
+		{"empty profile", time.Time{}, "", nil},
+		{"unknown gender", time.Time{}, "other", nil},
+		{"other birth date", time.Date(1990, 5, 16, 0, 0, 0, 0, time.UTC), "female", nik.ErrBirthDateMismatch},
+		{"other century", time.Date(1890, 5, 15, 0, 0, 0, 0, time.UTC), "female", nil},
+		{"other gender", time.Time{}, "L", nik.ErrGenderMismatch},
+	}
+	for _, tc := range testCases {
+		err := parsed.CheckProfile(tc.birthDate, tc.gender)
+		assert.Equal(t, tc.expectedErr, err, "test "+tc.name+" case")
+	}
+}
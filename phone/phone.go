@@ -0,0 +1,63 @@
+// Package phone normalize phone numbers to E.164, the international format written as + followed by
+// country code and subscriber number. Numbers written without country code are Indonesian numbers
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultCountryCode is country code of numbers written without it
+const DefaultCountryCode = "62"
+
+// MaxDigits is maximum number of digits of E.164 number including the country code
+const MaxDigits = 15
+
+// Errors of malformed phone number
+var (
+	ErrInvalidNumber = errors.New("phone: number must be digits with optional country code")
+	ErrInvalidLength = errors.New("phone: number has too few or too many digits")
+)
+
+// separators are the characters written between digit groups, they are removed
+var separators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+// Normalize give the number in E.164. The number may be written as +62812..., 0062812..., 62812...,
+// 0812... or 812..., with spaces, dashes, dots or parentheses between the digits. Trunk prefix 0
+// written after the country code such as +62 (0)812... is removed
+func Normalize(number string) (string, error) {
+	digits := separators.Replace(strings.TrimSpace(number))
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		digits = DefaultCountryCode + digits[1:]
+	case !strings.HasPrefix(digits, DefaultCountryCode):
+		digits = DefaultCountryCode + digits
+	}
+	if len(digits) == 0 || digits[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return "", ErrInvalidNumber
+		}
+	}
+	if !strings.HasPrefix(digits, DefaultCountryCode) {
+		if len(digits) < 7 || len(digits) > MaxDigits {
+			return "", ErrInvalidLength
+		}
+		return "+" + digits, nil
+	}
+	subscriber := strings.TrimPrefix(digits[len(DefaultCountryCode):], "0")
+	if len(subscriber) == 0 || subscriber[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+	// Indonesian numbers are area code and subscriber number of 8 digits up to mobile numbers of 12 digits
+	if len(subscriber) < 8 || len(subscriber) > 12 {
+		return "", ErrInvalidLength
+	}
+	return "+" + DefaultCountryCode + subscriber, nil
+}
@@ -0,0 +1,39 @@
+package phone_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/phone"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name        string
+		number      string
+		expected    string
+		expectedErr error
+	}{
+		{"E.164", "+6281234567890", "+6281234567890", nil},
+		{"national", "081234567890", "+6281234567890", nil},
+		{"without trunk prefix", "81234567890", "+6281234567890", nil},
+		{"country code without plus", "62 812-3456-7890", "+6281234567890", nil},
+		{"international prefix", "0062 812 3456 7890", "+6281234567890", nil},
+		{"trunk prefix after country code", "+62 (0)812.3456.7890", "+6281234567890", nil},
+		{"Jakarta landline", "(021) 5551234", "+62215551234", nil},
+		{"other country", "+1 (202) 555-0100", "+12025550100", nil},
+		{"letters", "0812-ABCD-7890", "", phone.ErrInvalidNumber},
+		{"empty", " ", "", phone.ErrInvalidNumber},
+		{"zero country code", "+0812345678", "", phone.ErrInvalidNumber},
+		{"zeros after country code", "+6200000000000", "", phone.ErrInvalidNumber},
+		{"too short", "0812345", "", phone.ErrInvalidLength},
+		{"too long", "08123456789012", "", phone.ErrInvalidLength},
+		{"other country too long", "+1202555010012345", "", phone.ErrInvalidLength},
+	}
+	for _, tc := range testCases {
+		normalized, err := phone.Normalize(tc.number)
+		assert.Equal(t, tc.expectedErr, err, "test "+tc.name+" case")
+		assert.Equal(t, tc.expected, normalized, "test "+tc.name+" case")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/drd-engineering/TwinCape/keyring"
+)
+
+// rotateKeys is command to create new token signing keys in database, tokens signed by
+// the retired keys stay valid until they expire
+func rotateKeys(args []string) error {
+	command := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	for _, purpose := range keyring.Purposes {
+		key, err := keyring.Rotate(purpose)
+		if err != nil {
+			return err
+		}
+		fmt.Println("New " + purpose + " signing key " + key.ID)
+	}
+	return nil
+}
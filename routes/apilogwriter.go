@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/environments"
+)
+
+// Drop policy used by APILogWriter when the queue is full
+const (
+	// DropNewest discard the log that is being written
+	DropNewest = "drop-newest"
+	// DropOldest discard the oldest queued log to make room for the new one
+	DropOldest = "drop-oldest"
+	// Block wait for free room in the queue until BlockTimeout, then discard the log
+	Block = "block"
+)
+
+// APILogWriterConfig is configuration of APILogWriter queue and batch
+type APILogWriterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	DropPolicy    string
+	BlockTimeout  time.Duration
+}
+
+// APILogWriterStats is counter of APILogWriter activity since it started
+type APILogWriterStats struct {
+	Queued  int    `json:"queued"`
+	Written uint64 `json:"written"`
+	Dropped uint64 `json:"dropped"`
+	Failed  uint64 `json:"failed"`
+}
+
+// APILogWriter queue api logs in memory and write them to db in batch from background
+type APILogWriter struct {
+	config APILogWriterConfig
+	sink   func([]db.APILog) error
+	queue  chan db.APILog
+
+	written uint64
+	dropped uint64
+	failed  uint64
+
+	// lock guard queue from being closed while Write still sending
+	lock   sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+var logWriter *APILogWriter
+var logWriterOnce sync.Once
+
+// GetAPILogWriter will return api log writer that already been setup once
+func GetAPILogWriter() *APILogWriter {
+	logWriterOnce.Do(func() {
+		logWriter = NewAPILogWriter(makeAPILogWriterConfig(), func(apiLogs []db.APILog) error {
+			return logs.CreateAPILogs(apiLogs)
+		})
+	})
+	return logWriter
+}
+
+func makeAPILogWriterConfig() APILogWriterConfig {
+	return APILogWriterConfig{
+		QueueSize:     getEnvInt("API_LOG_QUEUE_SIZE", 1024),
+		BatchSize:     getEnvInt("API_LOG_BATCH_SIZE", 100),
+		FlushInterval: getEnvDuration("API_LOG_FLUSH_INTERVAL", 2*time.Second),
+		DropPolicy:    environments.Get("API_LOG_DROP_POLICY"),
+		BlockTimeout:  getEnvDuration("API_LOG_BLOCK_TIMEOUT", 50*time.Millisecond),
+	}
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(environments.Get(key))
+	if err != nil || value < 1 {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(environments.Get(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// NewAPILogWriter create writer and start the background goroutine writing to sink
+func NewAPILogWriter(config APILogWriterConfig, sink func([]db.APILog) error) *APILogWriter {
+	if config.QueueSize < 1 {
+		config.QueueSize = 1024
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 100
+	}
+	// a batch is written by single statement, which the database limits in size
+	if config.BatchSize > db.MaxAPILogBatchSize {
+		config.BatchSize = db.MaxAPILogBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 2 * time.Second
+	}
+	switch config.DropPolicy {
+	case DropNewest, DropOldest, Block:
+	default:
+		config.DropPolicy = DropNewest
+	}
+	w := &APILogWriter{
+		config: config,
+		sink:   sink,
+		queue:  make(chan db.APILog, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write put the log in the queue, return false when the log is dropped
+func (w *APILogWriter) Write(apiLog db.APILog) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.closed {
+		atomic.AddUint64(&w.dropped, 1)
+		return false
+	}
+	select {
+	case w.queue <- apiLog:
+		return true
+	default:
+	}
+
+	switch w.config.DropPolicy {
+	case DropOldest:
+		// make room by discarding the oldest one, another writer may take the room first
+		for i := 0; i < 3; i++ {
+			select {
+			case <-w.queue:
+				atomic.AddUint64(&w.dropped, 1)
+			default:
+			}
+			select {
+			case w.queue <- apiLog:
+				return true
+			default:
+			}
+		}
+	case Block:
+		timer := time.NewTimer(w.config.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case w.queue <- apiLog:
+			return true
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&w.dropped, 1)
+	return false
+}
+
+// Stats return current counter of the writer
+func (w *APILogWriter) Stats() APILogWriterStats {
+	return APILogWriterStats{
+		Queued:  len(w.queue),
+		Written: atomic.LoadUint64(&w.written),
+		Dropped: atomic.LoadUint64(&w.dropped),
+		Failed:  atomic.LoadUint64(&w.failed),
+	}
+}
+
+// Close stop accepting logs and wait until every queued log is flushed
+func (w *APILogWriter) Close() {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		<-w.done
+		return
+	}
+	w.closed = true
+	close(w.queue)
+	w.lock.Unlock()
+	<-w.done
+}
+
+func (w *APILogWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]db.APILog, 0, w.config.BatchSize)
+	var reportedDrop uint64
+	for {
+		select {
+		case apiLog, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, apiLog)
+			if len(batch) >= w.config.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+			// report dropped logs once per interval instead of once per request
+			if dropped := atomic.LoadUint64(&w.dropped); dropped != reportedDrop {
+				fmt.Printf("API log writer dropped %d logs so far\n", dropped)
+				reportedDrop = dropped
+			}
+		}
+	}
+}
+
+func (w *APILogWriter) flush(batch []db.APILog) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.sink(batch); err != nil {
+		atomic.AddUint64(&w.failed, uint64(len(batch)))
+		fmt.Println("Failed to write " + strconv.Itoa(len(batch)) + " API logs: " + err.Error())
+		return
+	}
+	atomic.AddUint64(&w.written, uint64(len(batch)))
+}
@@ -0,0 +1,137 @@
+package routes_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogSink struct {
+	lock    sync.Mutex
+	batches [][]db.APILog
+	err     error
+	block   chan struct{}
+}
+
+func (s *mockLogSink) write(apiLogs []db.APILog) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	batch := make([]db.APILog, len(apiLogs))
+	copy(batch, apiLogs)
+	s.batches = append(s.batches, batch)
+	return s.err
+}
+
+func (s *mockLogSink) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	total := 0
+	for _, batch := range s.batches {
+		total += len(batch)
+	}
+	return total
+}
+
+func TestAPILogWriterBatch(t *testing.T) {
+	sink := &mockLogSink{}
+	writer := routes.NewAPILogWriter(routes.APILogWriterConfig{
+		QueueSize: 10, BatchSize: 3, FlushInterval: time.Hour,
+	}, sink.write)
+	for i := 0; i < 7; i++ {
+		assert.True(t, writer.Write(db.APILog{ResponseStatus: 200}), "log should be queued")
+	}
+	writer.Close()
+
+	assert.Equal(t, 7, sink.count(), "every queued log should be flushed on close")
+	assert.Len(t, sink.batches, 3, "logs should be written in batch of 3")
+	assert.Equal(t, uint64(7), writer.Stats().Written)
+	assert.False(t, writer.Write(db.APILog{}), "closed writer should drop the log")
+	assert.Equal(t, uint64(1), writer.Stats().Dropped)
+}
+
+func TestAPILogWriterBatchLimit(t *testing.T) {
+	sink := &mockLogSink{}
+	writer := routes.NewAPILogWriter(routes.APILogWriterConfig{
+		QueueSize: db.MaxAPILogBatchSize + 1, BatchSize: 100000, FlushInterval: time.Hour,
+	}, sink.write)
+	for i := 0; i <= db.MaxAPILogBatchSize; i++ {
+		writer.Write(db.APILog{ResponseStatus: 200})
+	}
+	writer.Close()
+
+	assert.Len(t, sink.batches, 2, "batch size should be limited to what a statement can insert")
+	assert.Len(t, sink.batches[0], db.MaxAPILogBatchSize)
+}
+
+func TestAPILogWriterFlushInterval(t *testing.T) {
+	sink := &mockLogSink{}
+	writer := routes.NewAPILogWriter(routes.APILogWriterConfig{
+		QueueSize: 10, BatchSize: 100, FlushInterval: 10 * time.Millisecond,
+	}, sink.write)
+	defer writer.Close()
+	writer.Write(db.APILog{ResponseStatus: 200})
+
+	assert.Eventually(t, func() bool { return sink.count() == 1 }, time.Second, 5*time.Millisecond,
+		"log should be flushed after interval even if batch is not full")
+}
+
+func TestAPILogWriterDropPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		accepted int
+		dropped  uint64
+	}{
+		{name: "DropNewest", policy: routes.DropNewest, accepted: 2, dropped: 3},
+		{name: "DropOldest", policy: routes.DropOldest, accepted: 5, dropped: 3},
+		{name: "BlockTimeout", policy: routes.Block, accepted: 2, dropped: 3},
+		{name: "UnknownPolicyUseDropNewest", policy: "unknown", accepted: 2, dropped: 3},
+	}
+	for _, tc := range tests {
+		// the sink hold the first log so the queue of 2 fill up
+		sink := &mockLogSink{block: make(chan struct{})}
+		writer := routes.NewAPILogWriter(routes.APILogWriterConfig{
+			QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour,
+			DropPolicy: tc.policy, BlockTimeout: time.Millisecond,
+		}, sink.write)
+		writer.Write(db.APILog{Path: "first"})
+		assert.Eventually(t, func() bool { return writer.Stats().Queued == 0 }, time.Second, time.Millisecond,
+			"first log should be taken by the sink in test "+tc.name+" case")
+
+		accepted := 0
+		for i := 0; i < 5; i++ {
+			if writer.Write(db.APILog{ResponseStatus: i}) {
+				accepted++
+			}
+		}
+		assert.Equal(t, tc.accepted, accepted, "test "+tc.name+" case")
+		assert.Equal(t, tc.dropped, writer.Stats().Dropped, "test "+tc.name+" case")
+		close(sink.block)
+		writer.Close()
+	}
+}
+
+func TestAPILogWriterSinkFailed(t *testing.T) {
+	sink := &mockLogSink{err: errors.New("database is down")}
+	writer := routes.NewAPILogWriter(routes.APILogWriterConfig{
+		QueueSize: 10, BatchSize: 2, FlushInterval: time.Hour,
+	}, sink.write)
+	assert.NotPanics(t, func() {
+		writer.Write(db.APILog{})
+		writer.Write(db.APILog{})
+		writer.Write(db.APILog{})
+		writer.Close()
+	}, "failed sink should never break the writer")
+
+	stats := writer.Stats()
+	assert.Equal(t, uint64(3), stats.Failed)
+	assert.Equal(t, uint64(0), stats.Written)
+}
@@ -1,16 +1,17 @@
 package routes
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/drd-engineering/TwinCape/db"
 	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
 	"github.com/gin-gonic/gin"
 )
 
-// DRDApplicationIdentification is authorization for identify the request is from drd app
+// DRDApplicationIdentification is authorization for identify the request is from drd app,
+// client registered by "client create" send its id in Drd-Client-Id and its secret in Drd-Identification
 func DRDApplicationIdentification(auths ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKey := c.GetHeader("Drd-Identification")
@@ -18,6 +19,20 @@ func DRDApplicationIdentification(auths ...string) gin.HandlerFunc {
 			c.AbortWithStatus(401)
 			return
 		}
+		if clientID := c.GetHeader("Drd-Client-Id"); len(clientID) > 0 {
+			client, err := clients.FindClientByID(clientID)
+			if err != nil && err != db.ErrClientNotFound {
+				c.AbortWithStatus(500)
+				return
+			}
+			if err != nil || client.Disabled || !client.VerifySecret(apiKey) {
+				c.AbortWithStatus(401)
+				return
+			}
+			c.Set("clientID", client.ID)
+			c.Next()
+			return
+		}
 		if apiKey != environments.Get("DRD_IDENTIFICATION") {
 			c.AbortWithStatus(401)
 			return
@@ -37,15 +52,9 @@ func AuthorizationBearer(auths ...string) gin.HandlerFunc {
 				gin.H{"message": "Please provide authorization token"})
 			return
 		}
-		claims := jwt.StandardClaims{}
+		claims := keyring.Claims{}
 		tokenString := strArr[1]
-		_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-			//Make sure that the token method conform to "SigningMethodHMAC"
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(environments.Get("ACCESS_SECRET_KEY")), nil
-		})
+		err := keyring.Parse(keyring.Access, tokenString, &claims)
 		if err != nil {
 			c.Abort()
 			c.JSON(http.StatusUnauthorized,
@@ -59,7 +68,55 @@ func AuthorizationBearer(auths ...string) gin.HandlerFunc {
 			return
 		}
 		userID := claims.Audience
+		if len(claims.SessionID) == 0 {
+			c.Abort()
+			c.JSON(http.StatusUnauthorized,
+				gin.H{"message": "Access token has no session, please login again"})
+			return
+		}
+		// token stays valid until it expires, so revoking the session must be checked on every request
+		session, err := sessions.FindSessionByID(claims.SessionID)
+		if err != nil && err != db.ErrSessionNotFound {
+			c.Abort()
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"message": "Failed to get session"})
+			return
+		}
+		if err != nil || session.RevokedAt != nil || session.UserID != userID {
+			c.Abort()
+			c.JSON(http.StatusUnauthorized,
+				gin.H{"message": "Session is revoked, please login again"})
+			return
+		}
 		c.Set("userID", userID)
+		c.Set("sessionID", claims.SessionID)
+		c.Next()
+	}
+}
+
+// AdminOnly is authorization middleware for identify the user logged in is an administrator, use it after AuthorizationBearer
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		if len(userID) == 0 {
+			c.Abort()
+			c.JSON(http.StatusUnauthorized,
+				gin.H{"message": "Please provide authorization token"})
+			return
+		}
+		user, err := users.FindUserByID(userID)
+		if err != nil && err != db.ErrUserNotFound {
+			c.Abort()
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"message": "Failed to get user logged in"})
+			return
+		}
+		if !user.IsAdmin || user.Disabled {
+			c.Abort()
+			c.JSON(http.StatusForbidden,
+				gin.H{"message": "Only administrator can access this resource"})
+			return
+		}
 		c.Next()
 	}
 }
@@ -36,8 +36,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Origin, Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Drd-Identification, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Origin, Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Drd-Identification, Drd-Client-Id, Authorization")
 		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Next()
@@ -52,7 +52,7 @@ func environmentUpdater() gin.HandlerFunc {
 }
 
 func auditRailsLogger(param gin.LogFormatterParams) string {
-	// save the log to db, then also return the log to default logger
+	// queue the log to be saved to db, then also return the log to default logger
 	apiLog := db.APILog{
 		Timestamp:      param.TimeStamp,
 		TTL:            param.Latency.String(),
@@ -63,8 +63,11 @@ func auditRailsLogger(param gin.LogFormatterParams) string {
 		ClientTools:    param.Request.UserAgent(),
 		Protocol:       param.Request.Proto,
 	}
-	dbInstance := db.GetDb()
-	dbInstance.Create(&apiLog)
+	// user id is set by the authorization middleware of the route
+	if userID, ok := param.Keys["userID"].(string); ok {
+		apiLog.UserID = userID
+	}
+	GetAPILogWriter().Write(apiLog)
 
 	return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
 		param.ClientIP,
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"github.com/drd-engineering/TwinCape/db"
+)
+
+// UserRepository is user storage used by authorization middleware
+type UserRepository interface {
+	FindUserByID(id string) (db.User, error)
+}
+
+// LogRepository is api log storage used by api log writer
+type LogRepository interface {
+	CreateAPILogs(apiLogs []db.APILog) error
+}
+
+// ClientRepository is client storage used by application identification middleware
+type ClientRepository interface {
+	FindClientByID(id string) (db.Client, error)
+}
+
+// SessionRepository is session storage used by authorization middleware
+type SessionRepository interface {
+	FindSessionByID(id string) (db.Session, error)
+}
+
+var users UserRepository = db.NewGormUserRepository(nil)
+var logs LogRepository = db.NewGormLogRepository(nil)
+var clients ClientRepository = db.NewGormClientRepository(nil)
+var sessions SessionRepository = db.NewGormSessionRepository(nil)
+
+// SetUserRepository replace user storage used by authorization middleware
+func SetUserRepository(repository UserRepository) {
+	users = repository
+}
+
+// SetLogRepository replace api log storage used by api log writer
+func SetLogRepository(repository LogRepository) {
+	logs = repository
+}
+
+// SetClientRepository replace client storage used by application identification middleware
+func SetClientRepository(repository ClientRepository) {
+	clients = repository
+}
+
+// SetSessionRepository replace session storage used by authorization middleware
+func SetSessionRepository(repository SessionRepository) {
+	sessions = repository
+}
@@ -12,21 +12,15 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/drd-engineering/TwinCape/db"
+	"github.com/drd-engineering/TwinCape/db/memory"
 	"github.com/drd-engineering/TwinCape/domains/authenticator"
 	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/keyring"
 	"github.com/drd-engineering/TwinCape/routes"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func dbTestConfig() *db.Config {
-	return &db.Config{
-		Host:     environments.Get("HOST_DB"),
-		Username: environments.Get("USERNAME_DB"),
-		DBName:   environments.Get("DB_NAME"),
-		Password: environments.Get("PASSWORD_DB"),
-	}
-}
 func setupTestCase(t *testing.T) func(t *testing.T) {
 	environments.Set("RELEASE_TYPE", "localhost")
 	_, filename, _, _ := runtime.Caller(0)
@@ -36,11 +30,15 @@ func setupTestCase(t *testing.T) func(t *testing.T) {
 		panic(err)
 	}
 	environments.LoadEnvironmentVariableFile()
-	db.InitPostgre(dbTestConfig())
+	environments.Set("DRD_IDENTIFICATION", "testidentification")
+	environments.Set("USERNAME_DB", "testusername")
+	environments.Set("ACCESS_SECRET_KEY", "testaccesskey")
+	routes.SetUserRepository(memory.NewUserRepository())
+	routes.SetLogRepository(memory.NewLogRepository())
+	routes.SetClientRepository(memory.NewClientRepository())
+	keyring.SetKeyRepository(memory.NewKeyRepository())
 	return func(t *testing.T) {
 		os.Clearenv()
-		dbInstance := db.GetDb()
-		dbInstance.DropTable(db.User{}, db.APILog{})
 	}
 }
 func mockHandler(c *gin.Context) {
@@ -53,6 +51,7 @@ func TestDRDApplicationIdentification(t *testing.T) {
 		name      string
 		useHeader bool
 		input     string
+		clientID  string
 		code      int
 		body      []string
 	}{
@@ -74,9 +73,42 @@ func TestDRDApplicationIdentification(t *testing.T) {
 			input:     "USERNAME_DB",
 			code:      401,
 		},
+		{
+			name:      "OKClient",
+			useHeader: true,
+			input:     "CLIENT_SECRET",
+			clientID:  "testclient",
+			code:      200,
+		},
+		{
+			name:      "FailedClientSecretIsWrong",
+			useHeader: true,
+			input:     "DRD_IDENTIFICATION",
+			clientID:  "testclient",
+			code:      401,
+		},
+		{
+			name:      "FailedClientDisabled",
+			useHeader: true,
+			input:     "CLIENT_SECRET",
+			clientID:  "disabledclient",
+			code:      401,
+		},
+		{
+			name:      "FailedUnknownClient",
+			useHeader: true,
+			input:     "CLIENT_SECRET",
+			clientID:  "unknown",
+			code:      401,
+		},
 	}
 	set := setupTestCase(t)
 	defer set(t)
+	environments.Set("CLIENT_SECRET", "testclientsecret")
+	clients := memory.NewClientRepository()
+	clients.CreateClient(&db.Client{ID: "testclient", SecretHash: db.HashClientSecret("testclientsecret")})
+	clients.CreateClient(&db.Client{ID: "disabledclient", SecretHash: db.HashClientSecret("testclientsecret"), Disabled: true})
+	routes.SetClientRepository(clients)
 	r := gin.Default()
 	test := r.Group("/t")
 	{
@@ -89,6 +121,9 @@ func TestDRDApplicationIdentification(t *testing.T) {
 		if tc.useHeader {
 			req.Header.Set("Drd-Identification", environments.Get(tc.input))
 		}
+		if len(tc.clientID) > 0 {
+			req.Header.Set("Drd-Client-Id", tc.clientID)
+		}
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
@@ -101,6 +136,7 @@ type jwtTestDetails struct {
 	signString string
 	issuer     string
 	userID     string
+	sessionID  string
 	expiredAt  int64
 }
 
@@ -109,11 +145,14 @@ func mockJWTCreation(jwtDetails *jwtTestDetails) authenticator.TokenDetails {
 		return authenticator.TokenDetails{}
 	}
 	tokenDetails := authenticator.TokenDetails{}
-	accessTokenClaims := jwt.StandardClaims{
-		Audience:  jwtDetails.userID,
-		ExpiresAt: jwtDetails.expiredAt,
-		Issuer:    jwtDetails.issuer,
-		IssuedAt:  time.Now().Unix(),
+	accessTokenClaims := keyring.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  jwtDetails.userID,
+			ExpiresAt: jwtDetails.expiredAt,
+			Issuer:    jwtDetails.issuer,
+			IssuedAt:  time.Now().Unix(),
+		},
+		SessionID: jwtDetails.sessionID,
 	}
 	accessToken := jwt.NewWithClaims(jwtDetails.signMethod, accessTokenClaims)
 	signAccessToken, _ := accessToken.SignedString([]byte(environments.Get(jwtDetails.signString)))
@@ -130,31 +169,60 @@ func TestAuthorizationBearer(t *testing.T) {
 	}{
 		{
 			name: "Success",
-			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "testsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
 				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
 			code: 200,
 		},
 		{
 			name: "FailedNoAuthSendInHeader",
-			input: jwtTestDetails{create: false, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+			input: jwtTestDetails{create: false, userID: "testid", sessionID: "testsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
 				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
 			code: 401,
 		},
 		{
 			name: "FailedExpired",
-			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * -3).Unix(),
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "testsession", expiredAt: time.Now().Add(time.Minute * -3).Unix(),
 				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
 			code: 401,
 		},
 		{
-			name: "FailedNotIssuedbyDRD",
+			name: "FailedNoSession",
 			input: jwtTestDetails{create: true, userID: "testid", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+		},
+		{
+			name: "FailedSessionRevoked",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "revokedsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+		},
+		{
+			name: "FailedSessionOfOtherUser",
+			input: jwtTestDetails{create: true, userID: "otherid", sessionID: "testsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+		},
+		{
+			name: "FailedUnknownSession",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "unknown", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
+				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "SSO_TWINCAPE"},
+			code: 401,
+		},
+		{
+			name: "FailedNotIssuedbyDRD",
+			input: jwtTestDetails{create: true, userID: "testid", sessionID: "testsession", expiredAt: time.Now().Add(time.Minute * 3).Unix(),
 				signMethod: jwt.SigningMethodHS256, signString: "ACCESS_SECRET_KEY", issuer: "UNKNOWN"},
 			code: 401,
 		},
 	}
 	set := setupTestCase(t)
 	defer set(t)
+	sessions := memory.NewSessionRepository()
+	revokedAt := time.Now()
+	sessions.CreateSession(&db.Session{ID: "testsession", UserID: "testid", CreatedAt: time.Now(), LastUsedAt: time.Now()})
+	sessions.CreateSession(&db.Session{ID: "revokedsession", UserID: "testid", CreatedAt: time.Now(), LastUsedAt: time.Now(), RevokedAt: &revokedAt})
+	routes.SetSessionRepository(sessions)
 	r := gin.Default()
 	test := r.Group("/t")
 	{
@@ -176,6 +244,41 @@ func TestAuthorizationBearer(t *testing.T) {
 	}
 }
 
+func TestAdminOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID string
+		code   int
+	}{
+		{name: "OK", userID: "testadmin", code: 200},
+		{name: "FailedNotAdmin", userID: "testuser", code: 403},
+		{name: "FailedAdminDisabled", userID: "disabledadmin", code: 403},
+		{name: "FailedNoUserFound", userID: "unknown", code: 403},
+		{name: "FailedNoUserLoggedIn", userID: "", code: 401},
+	}
+	set := setupTestCase(t)
+	defer set(t)
+	users := memory.NewUserRepository()
+	users.CreateUser(&db.User{ID: "testadmin", KtpNumber: "1", IsAdmin: true})
+	users.CreateUser(&db.User{ID: "testuser", KtpNumber: "2"})
+	users.CreateUser(&db.User{ID: "disabledadmin", KtpNumber: "3", IsAdmin: true, Disabled: true})
+	routes.SetUserRepository(users)
+	for _, tc := range tests {
+		r := gin.Default()
+		r.Use(func(c *gin.Context) {
+			if len(tc.userID) > 0 {
+				c.Set("userID", tc.userID)
+			}
+		})
+		r.GET("/t/testanycall", routes.AdminOnly(), mockHandler)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/t/testanycall", nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, "test "+tc.name+" case")
+	}
+}
+
 // main routes testing
 func TestGetInstance(t *testing.T) {
 	routeInstance := routes.GetInstance()
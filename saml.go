@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/domains/saml"
+)
+
+// samlCommand is command to manage SAML service providers allowed to login users
+func samlCommand(args []string) error {
+	usage := errors.New("Usage: TwinCape saml register -name name -metadata file [-attributes attribute=field,...]")
+	if len(args) == 0 || args[0] != "register" {
+		return usage
+	}
+	command := flag.NewFlagSet("saml register", flag.ContinueOnError)
+	name := command.String("name", "", "name of the service provider, required")
+	metadataFile := command.String("metadata", "", "file of the service provider metadata XML, required")
+	attributes := command.String("attributes", "", "comma separated SAML attribute=user field, default uid=id,email=email,name=name")
+	if err := command.Parse(args[1:]); err != nil {
+		return err
+	}
+	if len(*metadataFile) == 0 {
+		return usage
+	}
+	metadata, err := ioutil.ReadFile(*metadataFile)
+	if err != nil {
+		return err
+	}
+	attributeMapping := map[string]string{}
+	for _, pair := range strings.Split(*attributes, ",") {
+		if len(pair) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid attribute mapping %s, expected attribute=field", pair)
+		}
+		attributeMapping[parts[0]] = parts[1]
+	}
+	serviceProvider, err := saml.RegisterServiceProvider(*name, metadata, attributeMapping)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Registered service provider " + serviceProvider.ID)
+	return nil
+}
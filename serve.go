@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/domains"
+	"github.com/drd-engineering/TwinCape/domains/apilog"
+	"github.com/drd-engineering/TwinCape/keyring"
+	"github.com/drd-engineering/TwinCape/logchain"
+	"github.com/drd-engineering/TwinCape/routes"
+)
+
+// serve is command to start the http server until interrupted
+func serve(args []string) error {
+	command := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	port := getRoutingPort()
+	// Add Specific router group to main router
+	domains.InitiateRoutes()
+
+	stopRetention := apilog.StartRetention(makeRetentionConfig())
+	stopCheckpoints := logchain.StartCheckpoints(makeCheckpointConfig())
+	stopRotation := keyring.StartRotation(makeRotationConfig())
+
+	// Start Server
+	r := routes.GetInstance()
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println("Server stopped: " + err.Error())
+		}
+	}()
+
+	// Wait for interrupt signal, then let the running request and queued api logs finish
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("Server forced to shutdown: " + err.Error())
+	}
+	stopRetention()
+	stopCheckpoints()
+	stopRotation()
+	routes.GetAPILogWriter().Close()
+	stats := routes.GetAPILogWriter().Stats()
+	fmt.Printf("API logs written: %d, dropped: %d, failed: %d\n", stats.Written, stats.Dropped, stats.Failed)
+	return nil
+}
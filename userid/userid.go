@@ -0,0 +1,117 @@
+// Package userid generate ids of new users by the scheme chosen with USER_ID_SCHEME. Every scheme
+// use crypto/rand and has a space large enough that a generated id is practically never used already
+package userid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/drd-engineering/TwinCape/environments"
+)
+
+// ErrNotConfigured returned when the drd scheme is chosen without ID_BASE_STRING
+var ErrNotConfigured = errors.New("userid: ID_BASE_STRING must have at least 2 characters")
+
+// Scheme generate ids of new users
+type Scheme interface {
+	NewID() (string, error)
+}
+
+// DRDLength is number of characters after the DRD- prefix, 16 characters of 36 give 2^82 ids
+const DRDLength = 16
+
+// DRD is id written as DRD- followed by random characters of the base string, as ids were always written
+type DRD struct {
+	BaseString string
+	Length     int
+}
+
+// NewID give DRD- followed by Length characters picked uniformly from BaseString
+func (s DRD) NewID() (string, error) {
+	result, err := RandomString(s.Length, s.BaseString)
+	if err != nil {
+		return "", err
+	}
+	return "DRD-" + result, nil
+}
+
+// ULID is 48 bits millisecond timestamp and 80 random bits written as 26 characters of Crockford base32,
+// ids sort by the time they are generated
+type ULID struct{}
+
+// crockford is the alphabet of Crockford base32, without I, L, O and U
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID give ULID of the current time
+func (ULID) NewID() (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	// 128 bits are written as 26 characters of 5 bits, the first character has only 3 bits
+	value := new(big.Int).SetBytes(id[:])
+	result := make([]byte, 26)
+	digit := new(big.Int)
+	base := big.NewInt(32)
+	for i := len(result) - 1; i >= 0; i-- {
+		value.DivMod(value, base, digit)
+		result[i] = crockford[digit.Int64()]
+	}
+	return string(result), nil
+}
+
+// UUIDv7 is UUID version 7 of RFC 9562, 48 bits millisecond timestamp and 74 random bits,
+// ids sort by the time they are generated
+type UUIDv7 struct{}
+
+// NewID give UUID version 7 of the current time
+func (UUIDv7) NewID() (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	encoded := hex.EncodeToString(id[:])
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:], nil
+}
+
+// Configured give the scheme named by USER_ID_SCHEME, drd, ulid or uuidv7, empty means drd
+func Configured() (Scheme, error) {
+	switch name := strings.ToLower(strings.TrimSpace(environments.Get("USER_ID_SCHEME"))); name {
+	case "", "drd":
+		baseString := environments.Get("ID_BASE_STRING")
+		if len(baseString) < 2 {
+			return nil, ErrNotConfigured
+		}
+		return DRD{BaseString: baseString, Length: DRDLength}, nil
+	case "ulid":
+		return ULID{}, nil
+	case "uuidv7":
+		return UUIDv7{}, nil
+	default:
+		return nil, fmt.Errorf("userid: unknown scheme %s", name)
+	}
+}
+
+// RandomString give length characters picked uniformly from the base string with crypto/rand
+func RandomString(length int, baseString string) (string, error) {
+	max := big.NewInt(int64(len(baseString)))
+	result := make([]byte, length)
+	for i := range result {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result[i] = baseString[index.Int64()]
+	}
+	return string(result), nil
+}
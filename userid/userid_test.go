@@ -0,0 +1,79 @@
+package userid_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/userid"
+)
+
+func TestSchemes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		scheme  userid.Scheme
+		pattern string
+	}{
+		{"drd", userid.DRD{BaseString: "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890", Length: userid.DRDLength}, `^DRD-[A-Z0-9]{16}$`},
+		{"ulid", userid.ULID{}, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"uuidv7", userid.UUIDv7{}, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+	for _, tc := range testCases {
+		generated := map[string]bool{}
+		previous := ""
+		for i := 0; i < 1000; i++ {
+			id, err := tc.scheme.NewID()
+			assert.Nil(t, err, "test "+tc.name+" case")
+			assert.Regexp(t, regexp.MustCompile(tc.pattern), id, "test "+tc.name+" case")
+			assert.False(t, generated[id], "id should not be generated twice in test "+tc.name+" case")
+			generated[id] = true
+			if tc.name != "drd" && i%100 == 0 {
+				// the timestamp is at the start of the id so ids of later milliseconds sort after
+				time.Sleep(2 * time.Millisecond)
+				assert.Less(t, previous, id, "id should sort by time in test "+tc.name+" case")
+				previous = id
+			}
+		}
+	}
+}
+
+func TestConfigured(t *testing.T) {
+	testCases := []struct {
+		name       string
+		scheme     string
+		baseString string
+		expected   userid.Scheme
+		isError    bool
+	}{
+		{name: "default", baseString: "AB", expected: userid.DRD{BaseString: "AB", Length: userid.DRDLength}},
+		{name: "drd", scheme: "drd", baseString: "AB", expected: userid.DRD{BaseString: "AB", Length: userid.DRDLength}},
+		{name: "drd without base string", scheme: "drd", isError: true},
+		{name: "ulid", scheme: "ULID", expected: userid.ULID{}},
+		{name: "uuidv7", scheme: "uuidv7", expected: userid.UUIDv7{}},
+		{name: "unknown", scheme: "serial", baseString: "AB", isError: true},
+	}
+	for _, tc := range testCases {
+		environments.Set("USER_ID_SCHEME", tc.scheme)
+		environments.Set("ID_BASE_STRING", tc.baseString)
+		scheme, err := userid.Configured()
+		assert.Equal(t, tc.isError, err != nil, "test "+tc.name+" case")
+		assert.Equal(t, tc.expected, scheme, "test "+tc.name+" case")
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	counts := map[rune]int{}
+	for i := 0; i < 1000; i++ {
+		result, err := userid.RandomString(8, "ab")
+		assert.Nil(t, err)
+		assert.Len(t, result, 8)
+		for _, character := range result {
+			counts[character]++
+		}
+	}
+	assert.Len(t, counts, 2, "only characters of the base string should be picked")
+	assert.InDelta(t, 4000, counts['a'], 400, "characters should be picked uniformly")
+}
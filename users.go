@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drd-engineering/TwinCape/audit"
+	"github.com/drd-engineering/TwinCape/domains/account"
+	"github.com/drd-engineering/TwinCape/domains/register"
+	"github.com/drd-engineering/TwinCape/nik"
+)
+
+// createUser make command to create user or administrator without registration API
+func createUser(isAdmin bool) func(args []string) error {
+	return func(args []string) error {
+		name := "create-user"
+		if isAdmin {
+			name = "create-admin"
+		}
+		command := flag.NewFlagSet(name, flag.ContinueOnError)
+		input := register.UserRegistrationData{}
+		command.StringVar(&input.Name, "name", "", "name of the user")
+		command.StringVar(&input.Email, "email", "", "email of the user, required")
+		ktpNumber := command.String("ktp", "", "KTP number of the user, required")
+		command.StringVar(&input.PhoneNumber, "phone", "", "phone number of the user, required")
+		command.StringVar(&input.Gender, "gender", "", "gender of the user")
+		command.StringVar(&input.Address, "address", "", "address of the user")
+		command.StringVar(&input.DateOfBirth, "birth-date", "", "date of birth of the user (YYYY-MM-DD)")
+		command.StringVar(&input.PlaceOfBirth, "birth-place", "", "place of birth of the user")
+		command.StringVar(&input.Cityzenship, "citizenship", "", "citizenship of the user")
+		if err := command.Parse(args); err != nil {
+			return err
+		}
+		input.KtpNumber = nik.Number(*ktpNumber)
+		user, password, err := register.CreateUser(input, isAdmin)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Created user " + user.ID)
+		fmt.Println("Password: " + password)
+		return nil
+	}
+}
+
+// resetPassword is command to replace password of a user with a generated one
+func resetPassword(args []string) error {
+	command := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	userID := command.String("id", "", "id of the user, required")
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	if len(*userID) == 0 {
+		return errors.New("id of the user must not be empty")
+	}
+	password, err := account.ResetPassword(*userID)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Password: " + password)
+	return nil
+}
+
+// disableUser is command to disable user so it can not login, or enable it back
+func disableUser(args []string) error {
+	command := flag.NewFlagSet("disable-user", flag.ContinueOnError)
+	userID := command.String("id", "", "id of the user, required")
+	enable := command.Bool("enable", false, "enable the user back instead")
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	if len(*userID) == 0 {
+		return errors.New("id of the user must not be empty")
+	}
+	if err := account.SetDisabled(*userID, !*enable); err != nil {
+		return err
+	}
+	if *enable {
+		fmt.Println("Enabled user " + *userID)
+	} else {
+		fmt.Println("Disabled user " + *userID)
+	}
+	return nil
+}
+
+// normalizePhones is command to backfill phone numbers of users saved before they were normalized to E.164
+func normalizePhones(args []string) error {
+	command := flag.NewFlagSet("normalize-phones", flag.ContinueOnError)
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	result, err := account.NormalizePhoneNumbers()
+	fmt.Printf("Normalized %d phone numbers\n", result.Normalized)
+	if len(result.Invalid) > 0 {
+		fmt.Println("Phone number kept as written, it is not valid: " + strings.Join(result.Invalid, ", "))
+	}
+	if len(result.Duplicate) > 0 {
+		fmt.Println("Phone number kept as written, it is used by another user: " + strings.Join(result.Duplicate, ", "))
+	}
+	return err
+}
+
+// encryptUsers is command to encrypt personal data of users saved before FIELD_KEY_FILE was set or encrypted
+// by a key retired since
+func encryptUsers(args []string) error {
+	command := flag.NewFlagSet("encrypt-users", flag.ContinueOnError)
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	result, err := account.EncryptUsers()
+	fmt.Printf("Encrypted %d users\n", result.Encrypted)
+	if len(result.Duplicate) > 0 {
+		fmt.Println("User kept as it is, its KTP number or phone number is used by another user: " +
+			strings.Join(result.Duplicate, ", "))
+	}
+	return err
+}
+
+// importUsers is command to register users from CSV or JSONL, the report of every row is written as JSONL
+func importUsers(args []string) error {
+	command := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	input := command.String("file", "", "CSV or JSONL of users, required")
+	format := command.String("format", "", "import format: jsonl or csv, default is the file extension")
+	dryRun := command.Bool("dry-run", false, "check every row without saving users")
+	output := command.String("out", "", "report file, default is standard output")
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	if len(*input) == 0 {
+		return errors.New("file of users must not be empty")
+	}
+	if len(*format) == 0 {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*input)), ".")
+	}
+	file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var writer io.Writer = os.Stdout
+	if len(*output) > 0 {
+		// the report has passwords of the users created
+		reportFile, err := os.OpenFile(*output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer reportFile.Close()
+		writer = reportFile
+	}
+	result, importErr := register.Import(file, *format, *dryRun)
+	encoder := json.NewEncoder(writer)
+	for _, row := range result.Rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "Checked %d rows, %d would be rejected\n", len(result.Rows), result.Failed)
+	} else {
+		fmt.Fprintf(os.Stderr, "Created %d users, %d rows rejected\n", result.Created, result.Failed)
+	}
+	// import failing to be read after some users are created still saved them
+	var validationErr *register.ValidationError
+	if !errors.As(importErr, &validationErr) || result.Created > 0 {
+		audit.Record(audit.Event{
+			Type: audit.AdminAction,
+			Metadata: map[string]interface{}{"action": "import_users", "dryRun": *dryRun,
+				"created": result.Created, "failed": result.Failed},
+		})
+	}
+	return importErr
+}
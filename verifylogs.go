@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/drd-engineering/TwinCape/environments"
+	"github.com/drd-engineering/TwinCape/logchain"
+)
+
+// verifyLogs is command to walk hash chain of log tables and report the first broken link
+func verifyLogs(args []string) error {
+	command := flag.NewFlagSet("verify-logs", flag.ContinueOnError)
+	table := command.String("table", "", "log table to verify, default is every log table")
+	if err := command.Parse(args); err != nil {
+		return err
+	}
+	tables := logchain.Tables
+	if len(*table) > 0 {
+		tables = []string{*table}
+	}
+	key := []byte(environments.Get("LOG_CHECKPOINT_KEY"))
+	if len(key) == 0 {
+		fmt.Println("LOG_CHECKPOINT_KEY is empty, checkpoint signatures are not verified")
+	}
+	intact := true
+	for _, table := range tables {
+		report, err := logchain.Verify(table, key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(report.String())
+		intact = intact && report.Intact()
+	}
+	if !intact {
+		return errors.New("log chain is broken")
+	}
+	return nil
+}